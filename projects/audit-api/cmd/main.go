@@ -1,8 +1,11 @@
 package main
 
 import (
+	"context"
 	"github.com/Waelson/audit/audit-api/internal/dao"
+	"github.com/Waelson/audit/audit-api/internal/encryption"
 	"github.com/Waelson/audit/audit-api/internal/handler"
+	"github.com/Waelson/audit/audit-api/pkg/auth"
 	"github.com/Waelson/audit/audit-api/pkg/config"
 	"github.com/Waelson/audit/audit-api/pkg/db"
 	"github.com/Waelson/audit/audit-api/pkg/middleware"
@@ -21,17 +24,35 @@ func main() {
 		log.Fatalf("Falha ao criar o cliente ImmuDB: %v", err)
 	}
 
+	decrypter, subjects, authorizer := initializeSecurity(config.GetSecurityConfig())
+
 	filterDao := dao.NewFilterDao(dbClient)
 	auditTrailDao := dao.NewAuditTrailDao(dbClient)
+	shredDao := dao.NewShredDao(dbClient)
+	transactionDao := dao.NewTransactionDao(dbClient)
+	schemaChangeDao := dao.NewSchemaChangeDao(dbClient)
+	if err := shredDao.CreateTable(context.Background()); err != nil {
+		log.Fatalf("Falha ao criar a tabela de eliminações: %v", err)
+	}
 	log.Println("DAOs iniciadas com sucesso.")
 
 	filterHandler := handler.NewFilterHandler(filterDao)
-	auditTrailHandler := handler.NewAuditTrailHandler(auditTrailDao)
+	auditTrailHandler := handler.NewAuditTrailHandler(auditTrailDao, decrypter, authorizer)
+	shredHandler := handler.NewShredHandler(shredDao, subjects, authorizer)
+	transactionHandler := handler.NewTransactionHandler(transactionDao, decrypter, authorizer)
+	schemaChangeHandler := handler.NewSchemaChangeHandler(schemaChangeDao)
+	healthHandler := handler.NewHealthHandler(dbClient)
 	log.Println("Handlers iniciados com sucesso.")
 
 	mux := http.NewServeMux()
 	mux.HandleFunc("/api/audit-trail", auditTrailHandler.QueryAuditTrail())
 	mux.HandleFunc("/api/filters", filterHandler.QueryFilters())
+	mux.HandleFunc("/api/transactions", transactionHandler.QueryTransaction())
+	mux.HandleFunc("/api/schema-changes", schemaChangeHandler.QuerySchemaChanges())
+	mux.HandleFunc("/api/schema-changes/tables", schemaChangeHandler.QuerySchemaTables())
+	mux.HandleFunc("/api/admin/shred", shredHandler.Shred())
+	mux.HandleFunc("/healthz", healthHandler.Liveness())
+	mux.HandleFunc("/readyz", healthHandler.Readiness())
 	log.Println("Rotas registradas com sucesso.")
 
 	// Adiciona o middleware de CORS
@@ -42,3 +63,31 @@ func main() {
 		log.Fatalf("Erro ao iniciar o servidor: %v", err)
 	}
 }
+
+// initializeSecurity carrega o arquivo de chaves, as chaves de titulares e os tokens de API usados
+// para exibir em claro as colunas cifradas e para eliminar os dados de titulares; sem eles os
+// valores cifrados são retornados como gravados
+func initializeSecurity(cfg config.SecurityConfig) (*encryption.Decrypter, *encryption.SubjectKeyStore, *auth.Authorizer) {
+	if cfg.KeyStoreFile == "" || cfg.TokensFile == "" {
+		log.Println("Criptografia desativada: ENCRYPTION_KEYSTORE_FILE e API_TOKENS_FILE não configurados.")
+		return nil, nil, nil
+	}
+
+	keyStore, err := encryption.NewFileKeyStore(cfg.KeyStoreFile)
+	if err != nil {
+		log.Fatalf("Falha ao carregar o arquivo de chaves: %v", err)
+	}
+	authorizer, err := auth.LoadTokens(cfg.TokensFile)
+	if err != nil {
+		log.Fatalf("Falha ao carregar os tokens de API: %v", err)
+	}
+	var subjects *encryption.SubjectKeyStore
+	if cfg.SubjectKeysDir != "" {
+		subjects, err = encryption.NewSubjectKeyStore(cfg.SubjectKeysDir, cfg.SubjectSecret, keyStore)
+		if err != nil {
+			log.Fatalf("Falha ao configurar as chaves de titulares: %v", err)
+		}
+	}
+	log.Println("Chaves de criptografia e tokens de API carregados com sucesso.")
+	return encryption.NewDecrypter(keyStore, subjects), subjects, authorizer
+}
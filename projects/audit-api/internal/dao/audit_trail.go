@@ -2,33 +2,79 @@ package dao
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"github.com/Waelson/audit/audit-api/internal/model"
-	"github.com/codenotary/immudb/pkg/client"
+	"github.com/Waelson/audit/audit-api/pkg/db"
+	"github.com/codenotary/immudb/pkg/api/schema"
 	"log"
+	"regexp"
+	"strings"
 	"time"
 )
 
+// DefaultTrailTable é a tabela de trilha consultada quando a requisição não informa outra
+const DefaultTrailTable = "audit_trail"
+
+// ErrInvalidTable indica um nome de tabela de trilha que não é um identificador SQL simples
+var ErrInvalidTable = errors.New("invalid trail table name")
+
+// ErrInvalidColumn indica um filtro por coluna alterada que não pode corresponder a uma coluna da
+// lista changed_columns
+var ErrInvalidColumn = errors.New("invalid changed column name")
+
+// identifierPattern restringe o nome da tabela de trilha, que é interpolado nas consultas
+var identifierPattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// trailTable retorna a tabela de trilha informada, ou a padrão quando ela é omitida. O
+// audit-consumer grava na tabela configurada na rota de cada tópico, sempre no banco da conexão.
+func trailTable(table string) (string, error) {
+	if table == "" {
+		return DefaultTrailTable, nil
+	}
+	if !identifierPattern.MatchString(table) {
+		return "", fmt.Errorf("%w: '%s'", ErrInvalidTable, table)
+	}
+	return table, nil
+}
+
 type AuditTrailDao interface {
 	QueryAuditTrail(ctx context.Context, params map[string]interface{}) ([]model.AuditTrail, error)
 }
 
 type auditTrailDao struct {
-	client client.ImmuClient
+	client *db.Connection
 }
 
-func NewAuditTrailDao(client client.ImmuClient) AuditTrailDao {
+func NewAuditTrailDao(client *db.Connection) AuditTrailDao {
 	return &auditTrailDao{client: client}
 }
 
 func (db *auditTrailDao) QueryAuditTrail(ctx context.Context, params map[string]interface{}) ([]model.AuditTrail, error) {
 	log.Printf("Executando consulta de audit trail com parâmetros: %+v", params)
+	table, _ := params["trail_table"].(string)
+	delete(params, "trail_table")
+	table, err := trailTable(table)
+	if err != nil {
+		return nil, err
+	}
 	query := `
-		SELECT application, db_name, db_schema, db_table, event_operation, event_date, event 
-		FROM audit_trail 
+		SELECT ` + auditTrailColumns + `
+		FROM ` + table + `
 		SINCE @start_date UNTIL @end_date
-		WHERE application = @application AND db_name = @db_name AND db_schema = @db_schema AND db_table = @db_table AND event_operation = @event_operation;
+		WHERE application = @application AND db_name = @db_name AND db_schema = @db_schema AND db_table = @db_table AND event_operation = @event_operation
 	`
+	if column, ok := params["changed_column"].(string); ok && column != "" {
+		pattern, err := changedColumnPattern(column)
+		if err != nil {
+			return nil, err
+		}
+		params["changed_column"] = pattern
+		query += " AND changed_columns LIKE @changed_column"
+	} else {
+		delete(params, "changed_column")
+	}
+	query += ";"
 
 	sqlResult, err := db.client.SQLQuery(ctx, query, params, false)
 	if err != nil {
@@ -39,17 +85,67 @@ func (db *auditTrailDao) QueryAuditTrail(ctx context.Context, params map[string]
 	log.Println("Consulta de audit trail executada com sucesso.")
 	response := make([]model.AuditTrail, 0)
 	for _, row := range sqlResult.Rows {
-		trail := model.AuditTrail{
-			Application:    row.Values[0].GetS(),
-			DbName:         row.Values[1].GetS(),
-			DbSchema:       row.Values[2].GetS(),
-			DbTable:        row.Values[3].GetS(),
-			EventOperation: row.Values[4].GetS(),
-			EventDate:      time.UnixMicro(row.Values[5].GetTs()),
-			Event:          row.Values[6].GetS(),
-		}
-		response = append(response, trail)
+		response = append(response, scanAuditTrail(row))
 	}
 
 	return response, nil
 }
+
+// changedColumnPattern retorna o padrão do filtro por coluna alterada: changed_columns é uma
+// lista separada por vírgulas e o LIKE do ImmuDB é avaliado como expressão regular. Uma coluna
+// com vírgula não pode estar na lista e é recusada.
+func changedColumnPattern(column string) (string, error) {
+	if strings.Contains(column, ",") {
+		return "", fmt.Errorf("%w: '%s'", ErrInvalidColumn, column)
+	}
+	return "(^|,)" + regexp.QuoteMeta(column) + "(,|$)", nil
+}
+
+// auditTrailColumns são as colunas lidas da tabela de trilha, na ordem esperada por scanAuditTrail
+const auditTrailColumns = `application, db_name, db_schema, db_table, event_operation, event_date, event,
+			connector, source_version, source_name, source_ts, source_snapshot, source_sequence, source_tx_id, source_lsn,
+			changed_columns, key_id, subject_ref, transaction_id, transaction_order`
+
+// scanAuditTrail converte uma linha da tabela de trilha
+func scanAuditTrail(row *schema.Row) model.AuditTrail {
+	return model.AuditTrail{
+		Application:      row.Values[0].GetS(),
+		DbName:           row.Values[1].GetS(),
+		DbSchema:         row.Values[2].GetS(),
+		DbTable:          row.Values[3].GetS(),
+		EventOperation:   row.Values[4].GetS(),
+		EventDate:        time.UnixMicro(row.Values[5].GetTs()),
+		Event:            row.Values[6].GetS(),
+		Connector:        row.Values[7].GetS(),
+		SourceVersion:    row.Values[8].GetS(),
+		SourceName:       row.Values[9].GetS(),
+		SourceTs:         nullableTimestamp(row.Values[10]),
+		SourceSnapshot:   row.Values[11].GetS(),
+		SourceSequence:   row.Values[12].GetS(),
+		SourceTxID:       row.Values[13].GetN(),
+		SourceLsn:        row.Values[14].GetN(),
+		ChangedColumns:   changedColumns(row.Values[15]),
+		KeyID:            row.Values[16].GetS(),
+		SubjectRef:       row.Values[17].GetS(),
+		TransactionID:    row.Values[18].GetS(),
+		TransactionOrder: row.Values[19].GetN(),
+	}
+}
+
+// nullableTimestamp converte uma coluna TIMESTAMP que pode ser nula (registros gravados antes
+// da inclusão da coluna) em um ponteiro para time.Time
+func nullableTimestamp(value *schema.SQLValue) *time.Time {
+	if _, isNull := value.GetValue().(*schema.SQLValue_Null); isNull || value.GetValue() == nil {
+		return nil
+	}
+	ts := time.UnixMicro(value.GetTs())
+	return &ts
+}
+
+// changedColumns converte a lista de colunas alteradas, nula para eventos que não são atualizações
+func changedColumns(value *schema.SQLValue) []string {
+	if _, isNull := value.GetValue().(*schema.SQLValue_Null); isNull || value.GetS() == "" {
+		return []string{}
+	}
+	return strings.Split(value.GetS(), ",")
+}
@@ -0,0 +1,43 @@
+package dao
+
+import (
+	"errors"
+	"regexp"
+	"testing"
+)
+
+func TestChangedColumnPattern(t *testing.T) {
+	tests := []struct {
+		name     string
+		column   string
+		columns  string
+		expected bool
+	}{
+		{"única coluna alterada", "amount", "amount", true},
+		{"primeira da lista", "amount", "amount,status", true},
+		{"no meio da lista", "amount", "id,amount,status", true},
+		{"última da lista", "amount", "status,amount", true},
+		{"prefixo de outra coluna", "amount", "amount_cents,status", false},
+		{"sufixo de outra coluna", "amount", "status,old_amount", false},
+		{"coluna ausente", "amount", "status", false},
+		{"metacaractere escapado", "price.usd", "priceXusd", false},
+		{"metacaractere literal", "price.usd", "id,price.usd", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pattern, err := changedColumnPattern(tt.column)
+			if err != nil {
+				t.Fatalf("erro inesperado: %v", err)
+			}
+			if matched := regexp.MustCompile(pattern).MatchString(tt.columns); matched != tt.expected {
+				t.Errorf("'%s' em '%s': esperado %v, obtido %v", tt.column, tt.columns, tt.expected, matched)
+			}
+		})
+	}
+}
+
+func TestChangedColumnPatternRejectsSeparator(t *testing.T) {
+	if _, err := changedColumnPattern("amount,status"); !errors.Is(err, ErrInvalidColumn) {
+		t.Errorf("esperado ErrInvalidColumn, obtido %v", err)
+	}
+}
@@ -3,11 +3,11 @@ package dao
 import (
 	"context"
 	"fmt"
-	"github.com/codenotary/immudb/pkg/client"
+	"github.com/Waelson/audit/audit-api/pkg/db"
 	"log"
 )
 
-func NewFilterDao(client client.ImmuClient) FilterDao {
+func NewFilterDao(client *db.Connection) FilterDao {
 	return &filterDao{client: client}
 }
 
@@ -16,7 +16,7 @@ type FilterDao interface {
 }
 
 type filterDao struct {
-	client client.ImmuClient
+	client *db.Connection
 }
 
 // GetAll executa a consulta para obter filtros hierárquicos e retorna no formato especificado
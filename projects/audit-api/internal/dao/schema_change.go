@@ -0,0 +1,96 @@
+package dao
+
+import (
+	"context"
+	"fmt"
+	"github.com/Waelson/audit/audit-api/internal/model"
+	"github.com/Waelson/audit/audit-api/pkg/db"
+	"log"
+	"time"
+)
+
+func NewSchemaChangeDao(client *db.Connection) SchemaChangeDao {
+	return &schemaChangeDao{client: client}
+}
+
+// SchemaChangeDao consulta o histórico de alterações de schema registrado pelo audit-consumer
+type SchemaChangeDao interface {
+	GetTables(ctx context.Context) ([]model.SchemaTable, error)
+	GetTimeline(ctx context.Context, params map[string]interface{}) ([]model.SchemaChange, error)
+}
+
+type schemaChangeDao struct {
+	client *db.Connection
+}
+
+// GetTables retorna as tabelas com alterações de schema registradas, com a quantidade de
+// alterações e o instante da última
+func (db *schemaChangeDao) GetTables(ctx context.Context) ([]model.SchemaTable, error) {
+	log.Println("Consultando as tabelas com alterações de schema...")
+	query := `
+		SELECT db_name, db_schema, db_table, COUNT(*), MAX(change_date)
+		FROM schema_change
+		GROUP BY db_name, db_schema, db_table
+		ORDER BY db_name, db_schema, db_table;
+	`
+	sqlResult, err := db.client.SQLQuery(ctx, query, nil, false)
+	if err != nil {
+		log.Printf("Erro ao consultar as tabelas com alterações de schema: %v", err)
+		return nil, fmt.Errorf("error querying schema change tables: %w", err)
+	}
+
+	tables := make([]model.SchemaTable, 0, len(sqlResult.Rows))
+	for _, row := range sqlResult.Rows {
+		tables = append(tables, model.SchemaTable{
+			DbName:     row.Values[0].GetS(),
+			DbSchema:   row.Values[1].GetS(),
+			DbTable:    row.Values[2].GetS(),
+			Changes:    row.Values[3].GetN(),
+			LastChange: time.UnixMicro(row.Values[4].GetTs()),
+		})
+	}
+	return tables, nil
+}
+
+// GetTimeline retorna as alterações de schema da tabela em ordem cronológica. O banco e o schema
+// são opcionais e restringem a consulta quando a mesma tabela existe em mais de um deles.
+func (db *schemaChangeDao) GetTimeline(ctx context.Context, params map[string]interface{}) ([]model.SchemaChange, error) {
+	log.Printf("Consultando o histórico de schema com parâmetros: %+v", params)
+	query := `
+		SELECT source_name, db_name, db_schema, db_table, change_type, ddl, table_definition,
+			source_position, change_date, recorded_at
+		FROM schema_change
+		WHERE db_table = @db_table`
+	for _, column := range []string{"db_name", "db_schema"} {
+		if value, ok := params[column].(string); ok && value != "" {
+			query += fmt.Sprintf(" AND %[1]s = @%[1]s", column)
+		} else {
+			delete(params, column)
+		}
+	}
+	query += " ORDER BY change_date;"
+
+	sqlResult, err := db.client.SQLQuery(ctx, query, params, false)
+	if err != nil {
+		log.Printf("Erro ao consultar o histórico de schema: %v", err)
+		return nil, fmt.Errorf("error querying schema changes: %w", err)
+	}
+
+	changes := make([]model.SchemaChange, 0, len(sqlResult.Rows))
+	for _, row := range sqlResult.Rows {
+		changes = append(changes, model.SchemaChange{
+			SourceName:      row.Values[0].GetS(),
+			DbName:          row.Values[1].GetS(),
+			DbSchema:        row.Values[2].GetS(),
+			DbTable:         row.Values[3].GetS(),
+			ChangeType:      row.Values[4].GetS(),
+			DDL:             row.Values[5].GetS(),
+			TableDefinition: row.Values[6].GetS(),
+			SourcePosition:  row.Values[7].GetS(),
+			ChangeDate:      time.UnixMicro(row.Values[8].GetTs()),
+			RecordedAt:      time.UnixMicro(row.Values[9].GetTs()),
+		})
+	}
+	log.Printf("Histórico de schema consultado: %d alteração(ões).", len(changes))
+	return changes, nil
+}
@@ -0,0 +1,75 @@
+package dao
+
+import (
+	"context"
+	"fmt"
+	"github.com/Waelson/audit/audit-api/internal/model"
+	"github.com/Waelson/audit/audit-api/pkg/db"
+	"log"
+)
+
+func NewShredDao(client *db.Connection) ShredDao {
+	return &shredDao{client: client}
+}
+
+// ShredDao registra na trilha imutável as destruições de chaves de titulares
+type ShredDao interface {
+	CreateTable(ctx context.Context) error
+	RecordShred(ctx context.Context, shred model.Shred) error
+}
+
+type shredDao struct {
+	client *db.Connection
+}
+
+// CreateTable cria a tabela shred_log, se ainda não existir
+func (db *shredDao) CreateTable(ctx context.Context) error {
+	query := `
+		CREATE TABLE IF NOT EXISTS shred_log (
+			id INTEGER AUTO_INCREMENT,
+			key_id VARCHAR,
+			tenant VARCHAR,
+			subject_ref VARCHAR,
+			requested_by VARCHAR,
+			reason VARCHAR,
+			shredded_at TIMESTAMP,
+			PRIMARY KEY (id)
+		);
+	`
+	if _, err := db.client.SQLExec(ctx, query, nil); err != nil {
+		return fmt.Errorf("error creating shred_log table: %w", err)
+	}
+	return nil
+}
+
+// RecordShred grava o registro da destruição da chave. O registro é único por chave: se a
+// destruição já foi registrada, nada é gravado.
+func (db *shredDao) RecordShred(ctx context.Context, shred model.Shred) error {
+	log.Printf("Registrando eliminação da chave '%s' do tenant '%s'...", shred.KeyID, shred.Tenant)
+	query := `SELECT COUNT(*) FROM shred_log WHERE key_id = @key_id;`
+	sqlResult, err := db.client.SQLQuery(ctx, query, map[string]interface{}{"key_id": shred.KeyID}, false)
+	if err != nil {
+		return fmt.Errorf("error querying shred_log: %w", err)
+	}
+	if len(sqlResult.Rows) > 0 && sqlResult.Rows[0].Values[0].GetN() > 0 {
+		log.Printf("Eliminação da chave '%s' já registrada.", shred.KeyID)
+		return nil
+	}
+
+	query = `
+		INSERT INTO shred_log (key_id, tenant, subject_ref, requested_by, reason, shredded_at)
+		VALUES (@key_id, @tenant, @subject_ref, @requested_by, @reason, @shredded_at);
+	`
+	params := map[string]interface{}{
+		"key_id":       shred.KeyID,
+		"tenant":       shred.Tenant,
+		"subject_ref":  shred.SubjectRef,
+		"requested_by": shred.RequestedBy,
+		"reason":       shred.Reason,
+		"shredded_at":  shred.ShreddedAt,
+	}
+	if _, err := db.client.SQLExec(ctx, query, params); err != nil {
+		return fmt.Errorf("error recording shred: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,97 @@
+package dao
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/Waelson/audit/audit-api/internal/model"
+	"github.com/Waelson/audit/audit-api/pkg/db"
+	"log"
+	"time"
+)
+
+func NewTransactionDao(client *db.Connection) TransactionDao {
+	return &transactionDao{client: client}
+}
+
+// TransactionDao consulta as transações do banco de origem registradas pelo audit-consumer
+type TransactionDao interface {
+	GetTransaction(ctx context.Context, transactionID, table string) (*model.Transaction, error)
+}
+
+type transactionDao struct {
+	client *db.Connection
+}
+
+// dataCollectionRecord é o formato das tabelas da transação gravado pelo audit-consumer
+type dataCollectionRecord struct {
+	DataCollection string `json:"data_collection"`
+	EventCount     int64  `json:"event_count"`
+	ReceivedCount  int64  `json:"received_count"`
+}
+
+// GetTransaction retorna a transação e os seus eventos da tabela de trilha informada (a padrão,
+// se vazia), na ordem da transação. Retorna nil se a transação não foi registrada e não há
+// eventos dela na trilha.
+func (db *transactionDao) GetTransaction(ctx context.Context, transactionID, table string) (*model.Transaction, error) {
+	log.Printf("Consultando a transação %s...", transactionID)
+	table, err := trailTable(table)
+	if err != nil {
+		return nil, err
+	}
+	params := map[string]interface{}{"transaction_id": transactionID}
+
+	query := `
+		SELECT status, event_count, received_count, data_collections, commit_date, recorded_at, validated_at
+		FROM audit_transaction
+		WHERE transaction_id = @transaction_id;
+	`
+	sqlResult, err := db.client.SQLQuery(ctx, query, params, false)
+	if err != nil {
+		log.Printf("Erro ao consultar a transação: %v", err)
+		return nil, fmt.Errorf("error querying transaction: %w", err)
+	}
+
+	transaction := &model.Transaction{TransactionID: transactionID, DataCollections: []model.DataCollectionCount{}}
+	found := len(sqlResult.Rows) > 0
+	if found {
+		row := sqlResult.Rows[0]
+		transaction.Status = row.Values[0].GetS()
+		transaction.EventCount = row.Values[1].GetN()
+		transaction.ReceivedCount = row.Values[2].GetN()
+		transaction.CommitDate = time.UnixMicro(row.Values[4].GetTs())
+		transaction.RecordedAt = time.UnixMicro(row.Values[5].GetTs())
+		transaction.ValidatedAt = nullableTimestamp(row.Values[6])
+
+		var collections []dataCollectionRecord
+		if err := json.Unmarshal([]byte(row.Values[3].GetS()), &collections); err != nil {
+			return nil, fmt.Errorf("error decoding transaction data collections: %w", err)
+		}
+		for _, collection := range collections {
+			transaction.DataCollections = append(transaction.DataCollections, model.DataCollectionCount(collection))
+		}
+	}
+
+	query = `
+		SELECT ` + auditTrailColumns + `
+		FROM ` + table + `
+		WHERE transaction_id = @transaction_id
+		ORDER BY transaction_order;
+	`
+	sqlResult, err = db.client.SQLQuery(ctx, query, params, false)
+	if err != nil {
+		log.Printf("Erro ao consultar os eventos da transação: %v", err)
+		return nil, fmt.Errorf("error querying transaction events: %w", err)
+	}
+
+	transaction.Events = make([]model.AuditTrail, 0, len(sqlResult.Rows))
+	for _, row := range sqlResult.Rows {
+		transaction.Events = append(transaction.Events, scanAuditTrail(row))
+	}
+	if !found && len(transaction.Events) == 0 {
+		return nil, nil
+	}
+
+	log.Printf("Transação %s consultada: %d evento(s).", transactionID, len(transaction.Events))
+	return transaction, nil
+}
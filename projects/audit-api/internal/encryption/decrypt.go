@@ -0,0 +1,135 @@
+package encryption
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// Algorithm identifica o algoritmo dos valores cifrados pelo audit-consumer
+const Algorithm = "aes-256-gcm"
+
+// ShreddedMarker substitui o algoritmo nos valores de titulares cuja chave foi destruída
+const ShreddedMarker = "shredded"
+
+// Decrypter decifra os valores cifrados do evento gravado na trilha de auditoria
+type Decrypter struct {
+	provider KeyProvider
+	subjects *SubjectKeyStore
+}
+
+// NewDecrypter cria um Decrypter com o provedor de chaves informado. O repositório de chaves de
+// titulares é opcional: sem ele os valores cifrados com chaves de titulares não são decifrados.
+func NewDecrypter(provider KeyProvider, subjects *SubjectKeyStore) *Decrypter {
+	return &Decrypter{provider: provider, subjects: subjects}
+}
+
+// DecryptEvent decifra, no JSON do evento, os valores {"enc", "kid", "ct"} cujas chaves pertencem
+// a um tenant autorizado. Os demais valores cifrados são mantidos como estão.
+func (d *Decrypter) DecryptEvent(event string, authorized func(tenant string) bool) (string, error) {
+	var document interface{}
+	dec := json.NewDecoder(bytes.NewReader([]byte(event)))
+	dec.UseNumber()
+	if err := dec.Decode(&document); err != nil {
+		return event, fmt.Errorf("erro ao decodificar o evento: %w", err)
+	}
+
+	document, err := d.decryptValue(document, authorized)
+	if err != nil {
+		return event, err
+	}
+
+	data, err := json.Marshal(document)
+	if err != nil {
+		return event, fmt.Errorf("erro ao serializar o evento decifrado: %w", err)
+	}
+	return string(data), nil
+}
+
+// decryptValue percorre o documento substituindo os envelopes cifrados pelos valores em claro
+func (d *Decrypter) decryptValue(value interface{}, authorized func(tenant string) bool) (interface{}, error) {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		if isEnvelope(v) {
+			return d.decryptEnvelope(v, authorized)
+		}
+		for key, item := range v {
+			decrypted, err := d.decryptValue(item, authorized)
+			if err != nil {
+				return nil, err
+			}
+			v[key] = decrypted
+		}
+		return v, nil
+	case []interface{}:
+		for i, item := range v {
+			decrypted, err := d.decryptValue(item, authorized)
+			if err != nil {
+				return nil, err
+			}
+			v[i] = decrypted
+		}
+		return v, nil
+	}
+	return value, nil
+}
+
+// decryptEnvelope decifra um envelope se a chave pertencer a um tenant autorizado
+func (d *Decrypter) decryptEnvelope(envelope map[string]interface{}, authorized func(tenant string) bool) (interface{}, error) {
+	kid := envelope["kid"].(string)
+	key, err := d.key(kid)
+	if errors.Is(err, ErrSubjectShredded) {
+		// Os dados do titular foram eliminados: o valor não pode mais ser decifrado
+		return map[string]interface{}{"enc": ShreddedMarker, "kid": kid}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if key.Key == nil {
+		return envelope, nil
+	}
+	if !authorized(key.Tenant) {
+		return envelope, nil
+	}
+
+	ciphertext, err := base64.StdEncoding.DecodeString(envelope["ct"].(string))
+	if err != nil {
+		return nil, fmt.Errorf("valor cifrado em base64 inválido: %w", err)
+	}
+	plaintext, err := open(key.Key, ciphertext, []byte(kid))
+	if err != nil {
+		return nil, fmt.Errorf("erro ao decifrar valor com a chave '%s': %w", kid, err)
+	}
+
+	var value interface{}
+	dec := json.NewDecoder(bytes.NewReader(plaintext))
+	dec.UseNumber()
+	if err := dec.Decode(&value); err != nil {
+		return nil, fmt.Errorf("erro ao decodificar valor decifrado: %w", err)
+	}
+	return value, nil
+}
+
+// key retorna a chave do envelope. Sem repositório de chaves de titulares, as chaves de
+// titulares são retornadas vazias e os valores permanecem cifrados.
+func (d *Decrypter) key(kid string) (DataKey, error) {
+	if !isSubjectKey(kid) {
+		return d.provider.Key(kid)
+	}
+	if d.subjects == nil {
+		return DataKey{ID: kid}, nil
+	}
+	return d.subjects.Key(kid)
+}
+
+// isEnvelope indica se o objeto é um valor cifrado pelo audit-consumer
+func isEnvelope(value map[string]interface{}) bool {
+	if len(value) != 3 || value["enc"] != Algorithm {
+		return false
+	}
+	_, hasKid := value["kid"].(string)
+	_, hasCiphertext := value["ct"].(string)
+	return hasKid && hasCiphertext
+}
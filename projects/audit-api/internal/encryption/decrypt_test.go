@@ -0,0 +1,97 @@
+package encryption
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"strings"
+	"testing"
+)
+
+// seal cifra o valor como o audit-consumer: AES-256-GCM com o nonce no início e o id da chave como
+// dado adicional. As chaves do envelope seguem a ordem em que o evento decifrado é serializado.
+func seal(t *testing.T, key []byte, kid, value string) string {
+	t.Helper()
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		t.Fatal(err)
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		t.Fatal(err)
+	}
+	ciphertext := aead.Seal(nonce, nonce, []byte(value), []byte(kid))
+	return `{"ct":"` + base64.StdEncoding.EncodeToString(ciphertext) + `","enc":"` + Algorithm + `","kid":"` + kid + `"}`
+}
+
+func TestDecryptEvent(t *testing.T) {
+	key := make([]byte, keySize)
+	provider := &fileKeyStore{keys: map[string]DataKey{"acme-1": {ID: "acme-1", Tenant: "acme", Key: key}}}
+	subjects := newTestSubjectKeyStore(t)
+	if _, err := subjects.Shred("acme", "42", "admin", "LGPD"); err != nil {
+		t.Fatal(err)
+	}
+	shreddedKid := SubjectKeyID(subjects.Ref("acme", "42"))
+	decrypter := NewDecrypter(provider, subjects)
+
+	tenantEnvelope := seal(t, key, "acme-1", `"123.456.789-00"`)
+	shreddedEnvelope := seal(t, key, shreddedKid, `"Maria"`)
+	tests := []struct {
+		name       string
+		event      string
+		authorized []string
+		expected   string
+		err        bool
+	}{
+		{"tenant autorizado", `{"cpf":` + tenantEnvelope + `}`, []string{"acme"}, `{"cpf":"123.456.789-00"}`, false},
+		{"sem autorização", `{"cpf":` + tenantEnvelope + `}`, nil, `{"cpf":` + tenantEnvelope + `}`, false},
+		{"tenant diferente", `{"cpf":` + tenantEnvelope + `}`, []string{"globex"}, `{"cpf":` + tenantEnvelope + `}`, false},
+		{"titular eliminado", `{"nome":` + shreddedEnvelope + `}`, []string{"acme"}, `{"nome":{"enc":"shredded","kid":"` + shreddedKid + `"}}`, false},
+		{"valores aninhados", `{"after":{"id":1,"cpf":[` + tenantEnvelope + `]}}`, []string{"acme"}, `{"after":{"cpf":["123.456.789-00"],"id":1}}`, false},
+		{"chave desconhecida", `{"cpf":` + strings.Replace(tenantEnvelope, "acme-1", "acme-2", 1) + `}`, []string{"acme"}, "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			authorized := func(tenant string) bool {
+				for _, allowed := range tt.authorized {
+					if allowed == tenant {
+						return true
+					}
+				}
+				return false
+			}
+			event, err := decrypter.DecryptEvent(tt.event, authorized)
+			if tt.err {
+				if err == nil {
+					t.Errorf("DecryptEvent não retornou erro, obtido %s", event)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("erro inesperado: %v", err)
+			}
+			if event != tt.expected {
+				t.Errorf("esperado %s, obtido %s", tt.expected, event)
+			}
+		})
+	}
+}
+
+func TestDecryptEventWithoutSubjectKeys(t *testing.T) {
+	key := make([]byte, keySize)
+	decrypter := NewDecrypter(&fileKeyStore{keys: map[string]DataKey{}}, nil)
+	envelope := seal(t, key, "subject-0123456789abcdef0123456789abcdef", `"Maria"`)
+
+	event, err := decrypter.DecryptEvent(`{"nome":`+envelope+`}`, func(string) bool { return true })
+	if err != nil {
+		t.Fatalf("erro inesperado: %v", err)
+	}
+	if event != `{"nome":`+envelope+`}` {
+		t.Errorf("esperado o valor cifrado mantido, obtido %s", event)
+	}
+}
@@ -0,0 +1,100 @@
+package encryption
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+// keySize é o tamanho das chaves mestras e das chaves de dados (AES-256)
+const keySize = 32
+
+// DataKey é uma chave de dados já desembrulhada
+type DataKey struct {
+	ID     string
+	Tenant string
+	Key    []byte
+}
+
+// KeyProvider fornece as chaves de dados usadas para decifrar as colunas sensíveis
+type KeyProvider interface {
+	Key(id string) (DataKey, error)
+}
+
+// keyStoreFile é o conteúdo do arquivo de chaves compartilhado com o audit-consumer
+type keyStoreFile struct {
+	MasterKeys map[string]string `json:"masterKeys"`
+	DataKeys   []wrappedKey      `json:"dataKeys"`
+}
+
+// wrappedKey é uma chave de dados cifrada por uma chave mestra
+type wrappedKey struct {
+	ID          string `json:"id"`
+	Tenant      string `json:"tenant"`
+	MasterKeyID string `json:"masterKeyId"`
+	WrappedKey  string `json:"wrappedKey"`
+}
+
+// fileKeyStore é um KeyProvider baseado no arquivo de chaves local
+type fileKeyStore struct {
+	keys map[string]DataKey
+}
+
+// NewFileKeyStore carrega o arquivo de chaves e desembrulha todas as chaves de dados
+func NewFileKeyStore(path string) (KeyProvider, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("erro ao ler o arquivo de chaves '%s': %w", path, err)
+	}
+	var file keyStoreFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("erro ao decodificar o arquivo de chaves '%s': %w", path, err)
+	}
+
+	store := &fileKeyStore{keys: make(map[string]DataKey)}
+	for _, wrapped := range file.DataKeys {
+		master, err := base64.StdEncoding.DecodeString(file.MasterKeys[wrapped.MasterKeyID])
+		if err != nil || len(master) != keySize {
+			return nil, fmt.Errorf("chave mestra '%s' ausente ou inválida", wrapped.MasterKeyID)
+		}
+		ciphertext, err := base64.StdEncoding.DecodeString(wrapped.WrappedKey)
+		if err != nil {
+			return nil, fmt.Errorf("chave de dados '%s' em base64 inválido: %w", wrapped.ID, err)
+		}
+		key, err := open(master, ciphertext, []byte(wrapped.ID))
+		if err != nil {
+			return nil, fmt.Errorf("erro ao desembrulhar a chave de dados '%s': %w", wrapped.ID, err)
+		}
+		store.keys[wrapped.ID] = DataKey{ID: wrapped.ID, Tenant: wrapped.Tenant, Key: key}
+	}
+	return store, nil
+}
+
+// Key retorna a chave de dados com o identificador informado
+func (s *fileKeyStore) Key(id string) (DataKey, error) {
+	key, ok := s.keys[id]
+	if !ok {
+		return DataKey{}, fmt.Errorf("chave de dados '%s' não encontrada", id)
+	}
+	return key, nil
+}
+
+// open decifra um texto cifrado com AES-256-GCM cujo nonce está gravado no início
+func open(key, ciphertext, additionalData []byte) ([]byte, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	if len(ciphertext) < aead.NonceSize() {
+		return nil, fmt.Errorf("texto cifrado menor que o nonce")
+	}
+	nonce, data := ciphertext[:aead.NonceSize()], ciphertext[aead.NonceSize():]
+	return aead.Open(nil, nonce, data, additionalData)
+}
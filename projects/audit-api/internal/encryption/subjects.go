@@ -0,0 +1,198 @@
+package encryption
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/Waelson/audit/audit-api/internal/model"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// ErrSubjectShredded indica que a chave do titular já foi destruída
+var ErrSubjectShredded = errors.New("chave do titular destruída")
+
+// subjectKeyPrefix identifica as chaves de titulares
+const subjectKeyPrefix = "subject-"
+
+// shreddedSuffix é a extensão do marcador gravado quando a chave de um titular é destruída
+const shreddedSuffix = ".shredded"
+
+// subjectKeyFile é o arquivo de uma chave de titular, gravado pelo audit-consumer
+type subjectKeyFile struct {
+	ID         string `json:"id"`
+	Tenant     string `json:"tenant"`
+	SubjectRef string `json:"subjectRef"`
+	KekID      string `json:"kekId"`
+	WrappedKey string `json:"wrappedKey"`
+}
+
+// SubjectKeyStore lê as chaves de titulares criadas pelo audit-consumer e executa a sua destruição
+type SubjectKeyStore struct {
+	dir        string
+	secret     []byte
+	tenantKeys KeyProvider
+}
+
+// NewSubjectKeyStore cria o repositório de chaves de titulares. O segredo deve ser o mesmo usado
+// pelo audit-consumer para calcular a referência dos titulares.
+func NewSubjectKeyStore(dir, secret string, tenantKeys KeyProvider) (*SubjectKeyStore, error) {
+	if secret == "" {
+		return nil, fmt.Errorf("segredo das chaves de titulares não configurado")
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, fmt.Errorf("erro ao criar o diretório de chaves de titulares '%s': %w", dir, err)
+	}
+	return &SubjectKeyStore{dir: dir, secret: []byte(secret), tenantKeys: tenantKeys}, nil
+}
+
+// Ref retorna a referência do titular: o HMAC-SHA256 do tenant e do identificador do titular
+func (s *SubjectKeyStore) Ref(tenant, subject string) string {
+	mac := hmac.New(sha256.New, s.secret)
+	mac.Write([]byte(tenant + ":" + subject))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// SubjectKeyID retorna o identificador da chave do titular a partir da sua referência
+func SubjectKeyID(ref string) string {
+	return subjectKeyPrefix + ref[:32]
+}
+
+// isSubjectKey indica se o identificador é de uma chave de titular
+func isSubjectKey(id string) bool {
+	return strings.HasPrefix(id, subjectKeyPrefix)
+}
+
+// Key retorna a chave do titular. Retorna ErrSubjectShredded se a chave foi destruída.
+func (s *SubjectKeyStore) Key(id string) (DataKey, error) {
+	if s.shredded(id) {
+		return DataKey{}, ErrSubjectShredded
+	}
+	data, err := os.ReadFile(s.path(id))
+	if err != nil {
+		return DataKey{}, fmt.Errorf("chave de titular '%s' não encontrada: %w", id, err)
+	}
+	var file subjectKeyFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return DataKey{}, fmt.Errorf("arquivo da chave de titular '%s' inválido: %w", id, err)
+	}
+
+	kek, err := s.tenantKeys.Key(file.KekID)
+	if err != nil {
+		return DataKey{}, err
+	}
+	ciphertext, err := base64.StdEncoding.DecodeString(file.WrappedKey)
+	if err != nil {
+		return DataKey{}, fmt.Errorf("chave de titular '%s' em base64 inválido: %w", id, err)
+	}
+	key, err := open(kek.Key, ciphertext, []byte(id))
+	if err != nil {
+		return DataKey{}, fmt.Errorf("erro ao desembrulhar a chave de titular '%s': %w", id, err)
+	}
+	return DataKey{ID: id, Tenant: file.Tenant, Key: key}, nil
+}
+
+// Shred destrói a chave do titular. O marcador é gravado antes da remoção da chave para que o
+// audit-consumer não crie uma nova chave para o titular: os eventos seguintes dele passam a ser
+// gravados apenas com o marcador de eliminação. Se o marcador já existe, a remoção da chave é
+// refeita, concluindo uma eliminação interrompida, e o registro original é retornado junto com
+// ErrSubjectShredded.
+func (s *SubjectKeyStore) Shred(tenant, subject, requestedBy, reason string) (model.Shred, error) {
+	ref := s.Ref(tenant, subject)
+	shred := model.Shred{
+		KeyID:       SubjectKeyID(ref),
+		Tenant:      tenant,
+		SubjectRef:  ref,
+		RequestedBy: requestedBy,
+		Reason:      reason,
+		ShreddedAt:  time.Now().UTC(),
+	}
+
+	created, err := s.mark(&shred)
+	if err != nil {
+		return model.Shred{}, err
+	}
+	if err := s.destroy(shred.KeyID); err != nil {
+		return model.Shred{}, err
+	}
+	if !created {
+		return shred, ErrSubjectShredded
+	}
+	return shred, nil
+}
+
+// mark grava o marcador de eliminação da chave e indica se ele foi criado agora. Se o marcador já
+// existe, o registro é substituído pelo gravado nele; um marcador ilegível, deixado por uma gravação
+// interrompida, é regravado com o registro atual.
+func (s *SubjectKeyStore) mark(shred *model.Shred) (bool, error) {
+	path := s.path(shred.KeyID) + shreddedSuffix
+	data, err := json.Marshal(shred)
+	if err != nil {
+		return false, err
+	}
+
+	marker, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if errors.Is(err, os.ErrExist) {
+		existing, err := os.ReadFile(path)
+		if err != nil {
+			return false, fmt.Errorf("erro ao ler o marcador de eliminação: %w", err)
+		}
+		var recorded model.Shred
+		if json.Unmarshal(existing, &recorded) == nil && recorded.KeyID == shred.KeyID {
+			*shred = recorded
+			return false, nil
+		}
+		if err := os.WriteFile(path, data, 0600); err != nil {
+			return false, fmt.Errorf("erro ao gravar o marcador de eliminação: %w", err)
+		}
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("erro ao gravar o marcador de eliminação: %w", err)
+	}
+	_, err = marker.Write(data)
+	if closeErr := marker.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return false, fmt.Errorf("erro ao gravar o marcador de eliminação: %w", err)
+	}
+	return true, nil
+}
+
+// destroy sobrescreve e remove o arquivo da chave. A chave pode não existir se o titular ainda
+// não teve dados cifrados.
+func (s *SubjectKeyStore) destroy(id string) error {
+	path := s.path(id)
+	info, err := os.Stat(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("erro ao destruir a chave de titular '%s': %w", id, err)
+	}
+	if err := os.WriteFile(path, make([]byte, info.Size()), 0600); err != nil {
+		return fmt.Errorf("erro ao destruir a chave de titular '%s': %w", id, err)
+	}
+	if err := os.Remove(path); err != nil {
+		return fmt.Errorf("erro ao destruir a chave de titular '%s': %w", id, err)
+	}
+	return nil
+}
+
+// shredded indica se existe o marcador de destruição da chave
+func (s *SubjectKeyStore) shredded(id string) bool {
+	_, err := os.Stat(s.path(id) + shreddedSuffix)
+	return err == nil
+}
+
+// path retorna o caminho do arquivo da chave
+func (s *SubjectKeyStore) path(id string) string {
+	return filepath.Join(s.dir, id+".json")
+}
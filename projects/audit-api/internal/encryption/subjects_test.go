@@ -0,0 +1,71 @@
+package encryption
+
+import (
+	"errors"
+	"os"
+	"testing"
+)
+
+func newTestSubjectKeyStore(t *testing.T) *SubjectKeyStore {
+	t.Helper()
+	store, err := NewSubjectKeyStore(t.TempDir(), "segredo", nil)
+	if err != nil {
+		t.Fatalf("erro ao criar o repositório de chaves de titulares: %v", err)
+	}
+	return store
+}
+
+func TestShredFinishesInterruptedShred(t *testing.T) {
+	store := newTestSubjectKeyStore(t)
+	keyID := SubjectKeyID(store.Ref("acme", "42"))
+
+	// Um diretório no lugar do arquivo da chave faz a remoção falhar depois do marcador gravado
+	if err := os.MkdirAll(store.path(keyID)+"/x", 0700); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.Shred("acme", "42", "admin", "LGPD"); err == nil {
+		t.Fatal("Shred não retornou erro com a chave não removível")
+	}
+	_, err := store.Shred("acme", "42", "outro", "LGPD")
+	if err == nil || errors.Is(err, ErrSubjectShredded) {
+		t.Fatalf("esperado erro da remoção com a chave ainda presente, obtido %v", err)
+	}
+
+	if err := os.RemoveAll(store.path(keyID)); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(store.path(keyID), []byte(`{"id":"`+keyID+`"}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	shred, err := store.Shred("acme", "42", "outro", "LGPD")
+	if !errors.Is(err, ErrSubjectShredded) {
+		t.Fatalf("esperado ErrSubjectShredded, obtido %v", err)
+	}
+	if shred.KeyID != keyID || shred.RequestedBy != "admin" {
+		t.Errorf("esperado o registro original do marcador, obtido %+v", shred)
+	}
+	if _, err := os.Stat(store.path(keyID)); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("esperado arquivo da chave removido, obtido %v", err)
+	}
+}
+
+func TestShredRewritesUnreadableMarker(t *testing.T) {
+	store := newTestSubjectKeyStore(t)
+	keyID := SubjectKeyID(store.Ref("acme", "42"))
+	if err := os.WriteFile(store.path(keyID)+shreddedSuffix, nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	shred, err := store.Shred("acme", "42", "admin", "LGPD")
+	if !errors.Is(err, ErrSubjectShredded) {
+		t.Fatalf("esperado ErrSubjectShredded, obtido %v", err)
+	}
+	if shred.KeyID != keyID || shred.RequestedBy != "admin" {
+		t.Errorf("esperado o registro da solicitação atual, obtido %+v", shred)
+	}
+
+	again, err := store.Shred("acme", "42", "outro", "LGPD")
+	if !errors.Is(err, ErrSubjectShredded) || again.RequestedBy != "admin" {
+		t.Errorf("esperado o registro regravado no marcador, obtido %+v (%v)", again, err)
+	}
+}
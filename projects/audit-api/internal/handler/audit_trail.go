@@ -3,15 +3,21 @@ package handler
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"github.com/Waelson/audit/audit-api/internal/dao"
+	"github.com/Waelson/audit/audit-api/internal/encryption"
+	"github.com/Waelson/audit/audit-api/internal/model"
+	"github.com/Waelson/audit/audit-api/pkg/auth"
 	"log"
 	"net/http"
 	"strings"
 )
 
-func NewAuditTrailHandler(d dao.AuditTrailDao) AuditTrailHandler {
-	return &auditTrailHandler{dao: d}
+// NewAuditTrailHandler cria o handler de consulta. O decrypter e o authorizer são opcionais: sem
+// eles os valores cifrados são sempre retornados como gravados.
+func NewAuditTrailHandler(d dao.AuditTrailDao, decrypter *encryption.Decrypter, authorizer *auth.Authorizer) AuditTrailHandler {
+	return &auditTrailHandler{dao: d, decrypter: decrypter, authorizer: authorizer}
 }
 
 type AuditTrailHandler interface {
@@ -19,7 +25,9 @@ type AuditTrailHandler interface {
 }
 
 type auditTrailHandler struct {
-	dao dao.AuditTrailDao
+	dao        dao.AuditTrailDao
+	decrypter  *encryption.Decrypter
+	authorizer *auth.Authorizer
 }
 
 // QueryAuditTrail manipula as solicitações para consultar eventos de trilha de auditoria
@@ -34,6 +42,7 @@ func (a *auditTrailHandler) QueryAuditTrail() http.HandlerFunc {
 		startDate := r.URL.Query().Get("start_date")
 		endDate := r.URL.Query().Get("end_date")
 		eventOperation := strings.ToLower(r.URL.Query().Get("event_operation"))
+		changedColumn := r.URL.Query().Get("changed_column")
 
 		startDate = strings.ReplaceAll(startDate, "T", " ") + ":00"
 		endDate = strings.ReplaceAll(endDate, "T", " ") + ":00"
@@ -52,15 +61,27 @@ func (a *auditTrailHandler) QueryAuditTrail() http.HandlerFunc {
 			"start_date":      startDate,
 			"end_date":        endDate,
 			"event_operation": eventOperation,
+			"changed_column":  changedColumn,
+			"trail_table":     r.URL.Query().Get("trail_table"),
 		}
 
 		rows, err := a.dao.QueryAuditTrail(ctx, params)
+		if errors.Is(err, dao.ErrInvalidTable) || errors.Is(err, dao.ErrInvalidColumn) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
 		if err != nil {
 			log.Printf("Erro ao consultar audit trail: %v", err)
 			http.Error(w, fmt.Sprintf("Error querying audit trail: %v", err), http.StatusInternalServerError)
 			return
 		}
 
+		if err := decryptRows(a.decrypter, a.authorizer, r, rows); err != nil {
+			log.Printf("Erro ao decifrar audit trail: %v", err)
+			http.Error(w, fmt.Sprintf("Error decrypting audit trail: %v", err), http.StatusInternalServerError)
+			return
+		}
+
 		log.Println("Consulta de audit trail bem-sucedida, enviando resposta.")
 		jsonResult, err := json.Marshal(rows)
 		if err != nil {
@@ -73,3 +94,27 @@ func (a *auditTrailHandler) QueryAuditTrail() http.HandlerFunc {
 		w.Write(jsonResult)
 	}
 }
+
+// decryptRows decifra os eventos cifrados com chaves de tenants que o chamador pode ver em claro.
+// Cada acesso aos dados em claro é registrado em log.
+func decryptRows(decrypter *encryption.Decrypter, authorizer *auth.Authorizer, r *http.Request, rows []model.AuditTrail) error {
+	caller := authorizer.Identify(r)
+	if decrypter == nil || caller == nil {
+		return nil
+	}
+
+	for i := range rows {
+		if rows[i].KeyID == "" {
+			continue
+		}
+		event, err := decrypter.DecryptEvent(rows[i].Event, caller.CanDecrypt)
+		if err != nil {
+			return err
+		}
+		if event != rows[i].Event {
+			log.Printf("Dados cifrados exibidos em claro para '%s': Table=%s, Chave=%s", caller.Name, rows[i].DbTable, rows[i].KeyID)
+		}
+		rows[i].Event = event
+	}
+	return nil
+}
@@ -0,0 +1,165 @@
+package handler
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"github.com/Waelson/audit/audit-api/internal/dao"
+	"github.com/Waelson/audit/audit-api/internal/encryption"
+	"github.com/Waelson/audit/audit-api/internal/model"
+	"github.com/Waelson/audit/audit-api/pkg/auth"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// testKeys é um provedor de chaves de dados em memória
+type testKeys map[string]encryption.DataKey
+
+func (k testKeys) Key(id string) (encryption.DataKey, error) {
+	key, ok := k[id]
+	if !ok {
+		return encryption.DataKey{}, fmt.Errorf("chave de dados '%s' não encontrada", id)
+	}
+	return key, nil
+}
+
+// sealValue cifra o valor como o audit-consumer, com as chaves do envelope na ordem em que o evento
+// decifrado é serializado
+func sealValue(t *testing.T, key []byte, kid, value string) string {
+	t.Helper()
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		t.Fatal(err)
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		t.Fatal(err)
+	}
+	ciphertext := aead.Seal(nonce, nonce, []byte(value), []byte(kid))
+	return `{"ct":"` + base64.StdEncoding.EncodeToString(ciphertext) + `","enc":"` + encryption.Algorithm + `","kid":"` + kid + `"}`
+}
+
+func TestDecryptRows(t *testing.T) {
+	key := make([]byte, 32)
+	subjects, err := encryption.NewSubjectKeyStore(t.TempDir(), "segredo", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := subjects.Shred("acme", "42", "admin", "LGPD"); err != nil {
+		t.Fatal(err)
+	}
+	shreddedKid := encryption.SubjectKeyID(subjects.Ref("acme", "42"))
+	decrypter := encryption.NewDecrypter(testKeys{"acme-1": {ID: "acme-1", Tenant: "acme", Key: key}}, subjects)
+	authorizer := newTestAuthorizer(t, map[string]auth.Token{
+		"sem-tenants": {Name: "sem-tenants"},
+		"globex":      {Name: "globex", Tenants: []string{"globex"}},
+		"acme":        {Name: "acme", Tenants: []string{"acme"}},
+	})
+
+	tenantEvent := `{"cpf":` + sealValue(t, key, "acme-1", `"123.456.789-00"`) + `}`
+	shreddedEvent := `{"nome":` + sealValue(t, key, shreddedKid, `"Maria"`) + `}`
+	tests := []struct {
+		name      string
+		decrypter *encryption.Decrypter
+		token     string
+		event     string
+		keyID     string
+		expected  string
+	}{
+		{"sem identificação", decrypter, "", tenantEvent, "acme-1", tenantEvent},
+		{"token desconhecido", decrypter, "outro", tenantEvent, "acme-1", tenantEvent},
+		{"sem permissão para decifrar", decrypter, "sem-tenants", tenantEvent, "acme-1", tenantEvent},
+		{"tenant diferente", decrypter, "globex", tenantEvent, "acme-1", tenantEvent},
+		{"sem chaves configuradas", nil, "acme", tenantEvent, "acme-1", tenantEvent},
+		{"titular eliminado", decrypter, "acme", shreddedEvent, shreddedKid, `{"nome":{"enc":"shredded","kid":"` + shreddedKid + `"}}`},
+		{"evento sem dados cifrados", decrypter, "acme", `{"id":1}`, "", `{"id":1}`},
+		{"decifra para o tenant autorizado", decrypter, "acme", tenantEvent, "acme-1", `{"cpf":"123.456.789-00"}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/api/audit-trail", nil)
+			if tt.token != "" {
+				r.Header.Set("Authorization", "Bearer "+tt.token)
+			}
+			rows := []model.AuditTrail{{DbTable: "customers", KeyID: tt.keyID, Event: tt.event}}
+			if err := decryptRows(tt.decrypter, authorizer, r, rows); err != nil {
+				t.Fatalf("erro inesperado: %v", err)
+			}
+			if rows[0].Event != tt.expected {
+				t.Errorf("esperado %s, obtido %s", tt.expected, rows[0].Event)
+			}
+		})
+	}
+}
+
+func TestDecryptRowsUnknownKey(t *testing.T) {
+	key := make([]byte, 32)
+	decrypter := encryption.NewDecrypter(testKeys{}, nil)
+	authorizer := newTestAuthorizer(t, map[string]auth.Token{"acme": {Name: "acme", Tenants: []string{"acme"}}})
+
+	r := httptest.NewRequest(http.MethodGet, "/api/audit-trail", nil)
+	r.Header.Set("Authorization", "Bearer acme")
+	rows := []model.AuditTrail{{DbTable: "customers", KeyID: "acme-1", Event: `{"cpf":` + sealValue(t, key, "acme-1", `"1"`) + `}`}}
+	if err := decryptRows(decrypter, authorizer, r, rows); err == nil {
+		t.Error("decryptRows não retornou erro com a chave de dados ausente")
+	}
+}
+
+// testAuditTrailDao guarda os parâmetros da última consulta e retorna o erro configurado
+type testAuditTrailDao struct {
+	err    error
+	params map[string]interface{}
+}
+
+func (d *testAuditTrailDao) QueryAuditTrail(ctx context.Context, params map[string]interface{}) ([]model.AuditTrail, error) {
+	d.params = params
+	if d.err != nil {
+		return nil, d.err
+	}
+	return []model.AuditTrail{{DbTable: "payments", ChangedColumns: []string{"amount"}}}, nil
+}
+
+func TestQueryAuditTrailChangedColumn(t *testing.T) {
+	const required = "application=payment-api&db_name=payment_db&db_schema=public&db_table=payments" +
+		"&start_date=2024-01-15T10:00&end_date=2024-01-15T11:00&event_operation=U"
+
+	tests := []struct {
+		name     string
+		query    string
+		err      error
+		status   int
+		expected interface{}
+	}{
+		{"sem parâmetros obrigatórios", "changed_column=amount", nil, http.StatusBadRequest, nil},
+		{"sem filtro de coluna", required, nil, http.StatusOK, ""},
+		{"com filtro de coluna", required + "&changed_column=amount", nil, http.StatusOK, "amount"},
+		{"coluna inválida", required + "&changed_column=amount,status", fmt.Errorf("%w: 'amount,status'", dao.ErrInvalidColumn), http.StatusBadRequest, nil},
+		{"tabela de trilha inválida", required + "&trail_table=x;y", fmt.Errorf("%w: 'x;y'", dao.ErrInvalidTable), http.StatusBadRequest, nil},
+		{"erro na consulta", required + "&changed_column=amount", errors.New("immudb indisponível"), http.StatusInternalServerError, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			trailDao := &testAuditTrailDao{err: tt.err}
+			w := httptest.NewRecorder()
+			NewAuditTrailHandler(trailDao, nil, nil).QueryAuditTrail()(w, httptest.NewRequest(http.MethodGet, "/api/audit-trail?"+tt.query, nil))
+			if w.Code != tt.status {
+				t.Fatalf("esperado status %d, obtido %d (%s)", tt.status, w.Code, w.Body.String())
+			}
+			if tt.status != http.StatusOK {
+				return
+			}
+			if trailDao.params["changed_column"] != tt.expected || trailDao.params["event_operation"] != "u" {
+				t.Errorf("parâmetros da consulta = %+v, esperado changed_column %q", trailDao.params, tt.expected)
+			}
+		})
+	}
+}
@@ -0,0 +1,88 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/codenotary/immudb/pkg/api/schema"
+	"net/http"
+	"time"
+)
+
+// healthTimeout limita a verificação do ImmuDB feita por cada requisição de saúde
+const healthTimeout = 2 * time.Second
+
+// DatabaseHealth verifica a sessão com o ImmuDB; é implementado por db.Connection
+type DatabaseHealth interface {
+	Health(ctx context.Context) (*schema.DatabaseHealthResponse, error)
+}
+
+// NewHealthHandler cria os endpoints de saúde da API, que dependem apenas do ImmuDB
+func NewHealthHandler(database DatabaseHealth) HealthHandler {
+	return &healthHandler{database: database}
+}
+
+type HealthHandler interface {
+	Liveness() http.HandlerFunc
+	Readiness() http.HandlerFunc
+}
+
+type healthHandler struct {
+	database DatabaseHealth
+}
+
+// immudbStatus é a situação do ImmuDB informada nos endpoints de saúde
+type immudbStatus struct {
+	Status  string `json:"status"`
+	Error   string `json:"error,omitempty"`
+	Latency string `json:"latency"`
+}
+
+// Liveness responde 200 enquanto o processo está no ar; uma falha do ImmuDB aparece apenas como
+// degraded, para não provocar o reinício da API por uma indisponibilidade do banco
+func (h *healthHandler) Liveness() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		immudb := h.check(r.Context())
+		status := "ok"
+		if immudb.Status != "ok" {
+			status = "degraded"
+		}
+		writeHealth(w, http.StatusOK, status, immudb)
+	}
+}
+
+// Readiness responde 503 enquanto o ImmuDB não responde. A verificação também renova a sessão,
+// se ela tiver expirado.
+func (h *healthHandler) Readiness() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		immudb := h.check(r.Context())
+		if immudb.Status != "ok" {
+			writeHealth(w, http.StatusServiceUnavailable, "down", immudb)
+			return
+		}
+		writeHealth(w, http.StatusOK, "ok", immudb)
+	}
+}
+
+// check consulta o ImmuDB e mede o tempo de resposta
+func (h *healthHandler) check(ctx context.Context) immudbStatus {
+	ctx, cancel := context.WithTimeout(ctx, healthTimeout)
+	defer cancel()
+	start := time.Now()
+	_, err := h.database.Health(ctx)
+	result := immudbStatus{Status: "ok", Latency: time.Since(start).Round(time.Microsecond).String()}
+	if err != nil {
+		result.Status, result.Error = "down", err.Error()
+	}
+	return result
+}
+
+// writeHealth grava a resposta no formato comum aos serviços, com o ImmuDB como única dependência
+func writeHealth(w http.ResponseWriter, code int, status string, immudb immudbStatus) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status": status,
+		"checks": map[string]immudbStatus{"immudb": immudb},
+	})
+}
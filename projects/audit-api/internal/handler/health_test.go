@@ -0,0 +1,71 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/codenotary/immudb/pkg/api/schema"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// testDatabaseHealth responde à verificação do ImmuDB com o erro configurado
+type testDatabaseHealth struct {
+	err error
+}
+
+func (d testDatabaseHealth) Health(ctx context.Context) (*schema.DatabaseHealthResponse, error) {
+	if _, ok := ctx.Deadline(); !ok {
+		return nil, errors.New("verificação sem prazo")
+	}
+	return &schema.DatabaseHealthResponse{}, d.err
+}
+
+func TestHealth(t *testing.T) {
+	unavailable := errors.New("immudb indisponível")
+	tests := []struct {
+		name      string
+		err       error
+		readiness bool
+		code      int
+		status    string
+	}{
+		{"liveness com o ImmuDB disponível", nil, false, http.StatusOK, "ok"},
+		{"readiness com o ImmuDB disponível", nil, true, http.StatusOK, "ok"},
+		{"liveness com o ImmuDB indisponível", unavailable, false, http.StatusOK, "degraded"},
+		{"readiness com o ImmuDB indisponível", unavailable, true, http.StatusServiceUnavailable, "down"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			health := NewHealthHandler(testDatabaseHealth{err: tt.err})
+			handle, path := health.Liveness(), "/healthz"
+			if tt.readiness {
+				handle, path = health.Readiness(), "/readyz"
+			}
+			w := httptest.NewRecorder()
+			handle(w, httptest.NewRequest(http.MethodGet, path, nil))
+			if w.Code != tt.code {
+				t.Errorf("esperado status %d, obtido %d", tt.code, w.Code)
+			}
+
+			var report struct {
+				Status string                  `json:"status"`
+				Checks map[string]immudbStatus `json:"checks"`
+			}
+			if err := json.Unmarshal(w.Body.Bytes(), &report); err != nil {
+				t.Fatalf("resposta inválida: %v", err)
+			}
+			immudb, ok := report.Checks["immudb"]
+			if report.Status != tt.status || !ok {
+				t.Fatalf("esperado a situação %s com a verificação do immudb, obtido %+v", tt.status, report)
+			}
+			if tt.err == nil && (immudb.Status != "ok" || immudb.Error != "") {
+				t.Errorf("esperado immudb ok, obtido %+v", immudb)
+			}
+			if tt.err != nil && (immudb.Status != "down" || immudb.Error != tt.err.Error()) {
+				t.Errorf("esperado immudb down com o erro, obtido %+v", immudb)
+			}
+		})
+	}
+}
@@ -0,0 +1,85 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/Waelson/audit/audit-api/internal/dao"
+	"log"
+	"net/http"
+)
+
+func NewSchemaChangeHandler(d dao.SchemaChangeDao) SchemaChangeHandler {
+	return &schemaChangeHandler{dao: d}
+}
+
+type SchemaChangeHandler interface {
+	QuerySchemaChanges() http.HandlerFunc
+	QuerySchemaTables() http.HandlerFunc
+}
+
+type schemaChangeHandler struct {
+	dao dao.SchemaChangeDao
+}
+
+// QuerySchemaChanges manipula as solicitações para consultar o histórico de schema de uma tabela
+func (h *schemaChangeHandler) QuerySchemaChanges() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		log.Println("Recebendo solicitação para consultar histórico de schema...")
+		ctx := context.Background()
+		query := r.URL.Query()
+		table := query.Get("db_table")
+		if table == "" {
+			log.Println("Tabela ausente na solicitação.")
+			http.Error(w, "Missing required query parameter: db_table", http.StatusBadRequest)
+			return
+		}
+		params := map[string]interface{}{
+			"db_table":  table,
+			"db_name":   query.Get("db_name"),
+			"db_schema": query.Get("db_schema"),
+		}
+
+		changes, err := h.dao.GetTimeline(ctx, params)
+		if err != nil {
+			log.Printf("Erro ao consultar histórico de schema: %v", err)
+			http.Error(w, fmt.Sprintf("Error querying schema changes: %v", err), http.StatusInternalServerError)
+			return
+		}
+
+		log.Println("Consulta de histórico de schema bem-sucedida, enviando resposta.")
+		jsonResult, err := json.Marshal(changes)
+		if err != nil {
+			log.Printf("Erro ao serializar a resposta JSON: %v", err)
+			http.Error(w, fmt.Sprintf("Error encoding result to JSON: %v", err), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(jsonResult)
+	}
+}
+
+// QuerySchemaTables manipula as solicitações para listar as tabelas com alterações de schema
+func (h *schemaChangeHandler) QuerySchemaTables() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		log.Println("Recebendo solicitação para listar tabelas com alterações de schema...")
+		tables, err := h.dao.GetTables(context.Background())
+		if err != nil {
+			log.Printf("Erro ao listar tabelas com alterações de schema: %v", err)
+			http.Error(w, fmt.Sprintf("Error querying schema change tables: %v", err), http.StatusInternalServerError)
+			return
+		}
+
+		log.Println("Consulta de tabelas com alterações de schema bem-sucedida, enviando resposta.")
+		jsonResult, err := json.Marshal(tables)
+		if err != nil {
+			log.Printf("Erro ao serializar a resposta JSON: %v", err)
+			http.Error(w, fmt.Sprintf("Error encoding result to JSON: %v", err), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(jsonResult)
+	}
+}
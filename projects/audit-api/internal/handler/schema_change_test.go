@@ -0,0 +1,111 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/Waelson/audit/audit-api/internal/model"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// testSchemaChangeDao retorna as alterações registradas e guarda os parâmetros da última consulta
+type testSchemaChangeDao struct {
+	tables  []model.SchemaTable
+	changes []model.SchemaChange
+	err     error
+	params  map[string]interface{}
+}
+
+func (d *testSchemaChangeDao) GetTables(ctx context.Context) ([]model.SchemaTable, error) {
+	return d.tables, d.err
+}
+
+func (d *testSchemaChangeDao) GetTimeline(ctx context.Context, params map[string]interface{}) ([]model.SchemaChange, error) {
+	d.params = params
+	return d.changes, d.err
+}
+
+func TestQuerySchemaChanges(t *testing.T) {
+	changeDate := time.Date(2024, 1, 15, 10, 0, 0, 0, time.UTC)
+	changes := []model.SchemaChange{
+		{DbName: "payment_db", DbSchema: "public", DbTable: "payments", ChangeType: "CREATE", DDL: "CREATE TABLE payments (id int)", ChangeDate: changeDate},
+		{DbName: "payment_db", DbSchema: "public", DbTable: "payments", ChangeType: "ALTER", DDL: "ALTER TABLE payments ADD amount numeric", ChangeDate: changeDate.Add(time.Hour)},
+	}
+
+	tests := []struct {
+		name     string
+		query    string
+		err      error
+		status   int
+		expected map[string]interface{}
+	}{
+		{"sem tabela", "db_name=payment_db", nil, http.StatusBadRequest, nil},
+		{"erro na consulta", "db_table=payments", errors.New("immudb indisponível"), http.StatusInternalServerError, nil},
+		{"apenas a tabela", "db_table=payments", nil, http.StatusOK,
+			map[string]interface{}{"db_table": "payments", "db_name": "", "db_schema": ""}},
+		{"tabela em um banco e schema", "db_table=payments&db_name=payment_db&db_schema=public", nil, http.StatusOK,
+			map[string]interface{}{"db_table": "payments", "db_name": "payment_db", "db_schema": "public"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			schemaDao := &testSchemaChangeDao{changes: changes, err: tt.err}
+			w := httptest.NewRecorder()
+			NewSchemaChangeHandler(schemaDao).QuerySchemaChanges()(w, httptest.NewRequest(http.MethodGet, "/api/schema-changes?"+tt.query, nil))
+			if w.Code != tt.status {
+				t.Fatalf("esperado status %d, obtido %d (%s)", tt.status, w.Code, w.Body.String())
+			}
+			if tt.status != http.StatusOK {
+				return
+			}
+
+			for key, value := range tt.expected {
+				if schemaDao.params[key] != value {
+					t.Errorf("parâmetro %s: esperado %q, obtido %v", key, value, schemaDao.params[key])
+				}
+			}
+			var timeline []model.SchemaChange
+			if err := json.Unmarshal(w.Body.Bytes(), &timeline); err != nil {
+				t.Fatalf("resposta inválida: %v", err)
+			}
+			if len(timeline) != 2 || timeline[0].ChangeType != "CREATE" || timeline[1].DDL != changes[1].DDL || !timeline[1].ChangeDate.Equal(changes[1].ChangeDate) {
+				t.Errorf("esperado o histórico na ordem da consulta, obtido %+v", timeline)
+			}
+		})
+	}
+}
+
+func TestQuerySchemaTables(t *testing.T) {
+	lastChange := time.Date(2024, 1, 15, 10, 0, 0, 0, time.UTC)
+	tables := []model.SchemaTable{{DbName: "payment_db", DbSchema: "public", DbTable: "payments", Changes: 2, LastChange: lastChange}}
+
+	tests := []struct {
+		name   string
+		err    error
+		status int
+	}{
+		{"tabelas com alterações", nil, http.StatusOK},
+		{"erro na consulta", errors.New("immudb indisponível"), http.StatusInternalServerError},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			NewSchemaChangeHandler(&testSchemaChangeDao{tables: tables, err: tt.err}).QuerySchemaTables()(w, httptest.NewRequest(http.MethodGet, "/api/schema-changes/tables", nil))
+			if w.Code != tt.status {
+				t.Fatalf("esperado status %d, obtido %d (%s)", tt.status, w.Code, w.Body.String())
+			}
+			if tt.status != http.StatusOK {
+				return
+			}
+			var result []model.SchemaTable
+			if err := json.Unmarshal(w.Body.Bytes(), &result); err != nil {
+				t.Fatalf("resposta inválida: %v", err)
+			}
+			if len(result) != 1 || result[0].DbTable != "payments" || result[0].Changes != 2 || !result[0].LastChange.Equal(lastChange) {
+				t.Errorf("esperado %+v, obtido %+v", tables, result)
+			}
+		})
+	}
+}
@@ -0,0 +1,98 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/Waelson/audit/audit-api/internal/dao"
+	"github.com/Waelson/audit/audit-api/internal/encryption"
+	"github.com/Waelson/audit/audit-api/pkg/auth"
+	"log"
+	"net/http"
+)
+
+// shredRequest é o corpo da solicitação de eliminação dos dados de um titular
+type shredRequest struct {
+	Tenant  string `json:"tenant"`
+	Subject string `json:"subject"`
+	Reason  string `json:"reason"`
+}
+
+func NewShredHandler(d dao.ShredDao, subjects *encryption.SubjectKeyStore, authorizer *auth.Authorizer) ShredHandler {
+	return &shredHandler{dao: d, subjects: subjects, authorizer: authorizer}
+}
+
+type ShredHandler interface {
+	Shred() http.HandlerFunc
+}
+
+type shredHandler struct {
+	dao        dao.ShredDao
+	subjects   *encryption.SubjectKeyStore
+	authorizer *auth.Authorizer
+}
+
+// Shred manipula as solicitações de eliminação dos dados de um titular: a chave do titular é
+// destruída, tornando ilegíveis os seus dados na trilha sem alterar os registros gravados, e a
+// eliminação é registrada na tabela shred_log. Apenas tokens de administrador podem executá-la.
+func (h *shredHandler) Shred() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		log.Println("Recebendo solicitação de eliminação de dados de titular...")
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		caller := h.authorizer.Identify(r)
+		if caller == nil || !caller.Admin {
+			log.Println("Solicitação de eliminação recusada: chamador não é administrador.")
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+		if h.subjects == nil {
+			http.Error(w, "Subject keys not configured", http.StatusServiceUnavailable)
+			return
+		}
+
+		var request shredRequest
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil || request.Tenant == "" || request.Subject == "" || request.Reason == "" {
+			log.Println("Corpo da solicitação de eliminação inválido.")
+			http.Error(w, "Body must contain tenant, subject and reason", http.StatusBadRequest)
+			return
+		}
+
+		shred, err := h.subjects.Shred(request.Tenant, request.Subject, caller.Name, request.Reason)
+		alreadyShredded := errors.Is(err, encryption.ErrSubjectShredded)
+		if err != nil && !alreadyShredded {
+			log.Printf("Erro ao destruir a chave do titular: %v", err)
+			http.Error(w, fmt.Sprintf("Error shredding subject: %v", err), http.StatusInternalServerError)
+			return
+		}
+		if !alreadyShredded {
+			log.Printf("Chave '%s' do tenant '%s' destruída por '%s'.", shred.KeyID, shred.Tenant, shred.RequestedBy)
+		}
+
+		// A chave já foi destruída: uma falha no registro é informada, mas não desfaz a eliminação.
+		// Como o registro é idempotente, repetir a solicitação grava o registro que faltou.
+		if err := h.dao.RecordShred(context.Background(), shred); err != nil {
+			log.Printf("Erro ao registrar a eliminação da chave '%s': %v", shred.KeyID, err)
+			http.Error(w, fmt.Sprintf("Subject shredded but not recorded: %v", err), http.StatusInternalServerError)
+			return
+		}
+		if alreadyShredded {
+			http.Error(w, "Subject already shredded", http.StatusConflict)
+			return
+		}
+
+		jsonResult, err := json.Marshal(shred)
+		if err != nil {
+			log.Printf("Erro ao serializar a resposta JSON: %v", err)
+			http.Error(w, fmt.Sprintf("Error encoding result to JSON: %v", err), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		w.Write(jsonResult)
+	}
+}
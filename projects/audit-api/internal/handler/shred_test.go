@@ -0,0 +1,121 @@
+package handler
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"github.com/Waelson/audit/audit-api/internal/encryption"
+	"github.com/Waelson/audit/audit-api/internal/model"
+	"github.com/Waelson/audit/audit-api/pkg/auth"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// testShredDao guarda os registros por chave, como o shred_log, e falha as primeiras gravações
+type testShredDao struct {
+	failures int
+	records  map[string]model.Shred
+}
+
+func (d *testShredDao) CreateTable(ctx context.Context) error {
+	return nil
+}
+
+func (d *testShredDao) RecordShred(ctx context.Context, shred model.Shred) error {
+	if d.failures > 0 {
+		d.failures--
+		return errors.New("immudb indisponível")
+	}
+	if _, ok := d.records[shred.KeyID]; !ok {
+		d.records[shred.KeyID] = shred
+	}
+	return nil
+}
+
+// newTestAuthorizer cria um autorizador a partir de um arquivo de tokens, indexados pelo token em claro
+func newTestAuthorizer(t *testing.T, tokens map[string]auth.Token) *auth.Authorizer {
+	t.Helper()
+	var list []auth.Token
+	for secret, token := range tokens {
+		sum := sha256.Sum256([]byte(secret))
+		token.TokenSha256 = hex.EncodeToString(sum[:])
+		list = append(list, token)
+	}
+	data, err := json.Marshal(list)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "tokens.json")
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+	authorizer, err := auth.LoadTokens(path)
+	if err != nil {
+		t.Fatalf("erro ao carregar os tokens: %v", err)
+	}
+	return authorizer
+}
+
+func shredRequestFor(token string) *http.Request {
+	r := httptest.NewRequest(http.MethodPost, "/api/shred", strings.NewReader(`{"tenant":"acme","subject":"42","reason":"LGPD"}`))
+	r.Header.Set("Authorization", "Bearer "+token)
+	return r
+}
+
+func TestShredRecordsOnRetry(t *testing.T) {
+	subjects, err := encryption.NewSubjectKeyStore(t.TempDir(), "segredo", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	authorizer := newTestAuthorizer(t, map[string]auth.Token{"adm": {Name: "admin", Tenants: []string{"*"}, Admin: true}})
+	shredDao := &testShredDao{failures: 1, records: map[string]model.Shred{}}
+	handle := NewShredHandler(shredDao, subjects, authorizer).Shred()
+
+	tests := []struct {
+		name   string
+		status int
+	}{
+		{"falha no registro", http.StatusInternalServerError},
+		{"repetição registra a eliminação", http.StatusConflict},
+		{"eliminação já registrada", http.StatusConflict},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		handle(w, shredRequestFor("adm"))
+		if w.Code != tt.status {
+			t.Errorf("%s: esperado status %d, obtido %d (%s)", tt.name, tt.status, w.Code, w.Body.String())
+		}
+	}
+
+	keyID := encryption.SubjectKeyID(subjects.Ref("acme", "42"))
+	if len(shredDao.records) != 1 || shredDao.records[keyID].RequestedBy != "admin" {
+		t.Errorf("esperado um registro da eliminação, obtido %+v", shredDao.records)
+	}
+}
+
+func TestShredRequiresAdmin(t *testing.T) {
+	subjects, err := encryption.NewSubjectKeyStore(t.TempDir(), "segredo", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	authorizer := newTestAuthorizer(t, map[string]auth.Token{"leitor": {Name: "leitor", Tenants: []string{"acme"}}})
+	shredDao := &testShredDao{records: map[string]model.Shred{}}
+	handle := NewShredHandler(shredDao, subjects, authorizer).Shred()
+
+	for _, token := range []string{"leitor", "desconhecido"} {
+		w := httptest.NewRecorder()
+		handle(w, shredRequestFor(token))
+		if w.Code != http.StatusForbidden {
+			t.Errorf("token %q: esperado status %d, obtido %d", token, http.StatusForbidden, w.Code)
+		}
+	}
+	if len(shredDao.records) != 0 {
+		t.Errorf("esperado nenhum registro, obtido %+v", shredDao.records)
+	}
+}
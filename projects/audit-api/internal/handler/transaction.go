@@ -0,0 +1,74 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/Waelson/audit/audit-api/internal/dao"
+	"github.com/Waelson/audit/audit-api/internal/encryption"
+	"github.com/Waelson/audit/audit-api/pkg/auth"
+	"log"
+	"net/http"
+)
+
+func NewTransactionHandler(d dao.TransactionDao, decrypter *encryption.Decrypter, authorizer *auth.Authorizer) TransactionHandler {
+	return &transactionHandler{dao: d, decrypter: decrypter, authorizer: authorizer}
+}
+
+type TransactionHandler interface {
+	QueryTransaction() http.HandlerFunc
+}
+
+type transactionHandler struct {
+	dao        dao.TransactionDao
+	decrypter  *encryption.Decrypter
+	authorizer *auth.Authorizer
+}
+
+// QueryTransaction manipula as solicitações para consultar uma transação do banco de origem e
+// todos os seus eventos
+func (h *transactionHandler) QueryTransaction() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		log.Println("Recebendo solicitação para consultar transação...")
+		ctx := context.Background()
+		transactionID := r.URL.Query().Get("id")
+		if transactionID == "" {
+			log.Println("Identificador da transação ausente na solicitação.")
+			http.Error(w, "Missing required query parameter: id", http.StatusBadRequest)
+			return
+		}
+
+		transaction, err := h.dao.GetTransaction(ctx, transactionID, r.URL.Query().Get("trail_table"))
+		if errors.Is(err, dao.ErrInvalidTable) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err != nil {
+			log.Printf("Erro ao consultar transação: %v", err)
+			http.Error(w, fmt.Sprintf("Error querying transaction: %v", err), http.StatusInternalServerError)
+			return
+		}
+		if transaction == nil {
+			http.Error(w, "Transaction not found", http.StatusNotFound)
+			return
+		}
+
+		if err := decryptRows(h.decrypter, h.authorizer, r, transaction.Events); err != nil {
+			log.Printf("Erro ao decifrar eventos da transação: %v", err)
+			http.Error(w, fmt.Sprintf("Error decrypting transaction: %v", err), http.StatusInternalServerError)
+			return
+		}
+
+		log.Println("Consulta de transação bem-sucedida, enviando resposta.")
+		jsonResult, err := json.Marshal(transaction)
+		if err != nil {
+			log.Printf("Erro ao serializar a resposta JSON: %v", err)
+			http.Error(w, fmt.Sprintf("Error encoding result to JSON: %v", err), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(jsonResult)
+	}
+}
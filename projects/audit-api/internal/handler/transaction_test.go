@@ -0,0 +1,98 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/Waelson/audit/audit-api/internal/dao"
+	"github.com/Waelson/audit/audit-api/internal/encryption"
+	"github.com/Waelson/audit/audit-api/internal/model"
+	"github.com/Waelson/audit/audit-api/pkg/auth"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// testTransactionDao retorna cópias das transações registradas e guarda a tabela de trilha consultada
+type testTransactionDao struct {
+	transactions map[string]*model.Transaction
+	err          error
+	table        string
+}
+
+func (d *testTransactionDao) GetTransaction(ctx context.Context, transactionID, table string) (*model.Transaction, error) {
+	d.table = table
+	if d.err != nil {
+		return nil, d.err
+	}
+	transaction, ok := d.transactions[transactionID]
+	if !ok {
+		return nil, nil
+	}
+	// O handler decifra os eventos no lugar: cada consulta recebe a sua cópia
+	found := *transaction
+	found.Events = append([]model.AuditTrail(nil), transaction.Events...)
+	return &found, nil
+}
+
+func TestQueryTransaction(t *testing.T) {
+	key := make([]byte, 32)
+	event := `{"cpf":` + sealValue(t, key, "acme-1", `"123.456.789-00"`) + `}`
+	transactionDao := &testTransactionDao{transactions: map[string]*model.Transaction{
+		"tx-1": {
+			TransactionID: "tx-1",
+			Status:        "complete",
+			EventCount:    1,
+			ReceivedCount: 1,
+			Events:        []model.AuditTrail{{DbTable: "customers", KeyID: "acme-1", Event: event}},
+		},
+	}}
+	decrypter := encryption.NewDecrypter(testKeys{"acme-1": {ID: "acme-1", Tenant: "acme", Key: key}}, nil)
+	authorizer := newTestAuthorizer(t, map[string]auth.Token{"acme": {Name: "acme", Tenants: []string{"acme"}}})
+	handle := NewTransactionHandler(transactionDao, decrypter, authorizer).QueryTransaction()
+
+	tests := []struct {
+		name   string
+		query  string
+		token  string
+		err    error
+		status int
+		event  string
+	}{
+		{"sem identificador", "", "", nil, http.StatusBadRequest, ""},
+		{"transação não encontrada", "id=tx-2", "", nil, http.StatusNotFound, ""},
+		{"tabela de trilha inválida", "id=tx-1&trail_table=x;y", "", fmt.Errorf("%w: 'x;y'", dao.ErrInvalidTable), http.StatusBadRequest, ""},
+		{"erro na consulta", "id=tx-1", "", errors.New("immudb indisponível"), http.StatusInternalServerError, ""},
+		{"eventos cifrados sem identificação", "id=tx-1", "", nil, http.StatusOK, event},
+		{"eventos decifrados para o tenant", "id=tx-1&trail_table=orders_trail", "acme", nil, http.StatusOK, `{"cpf":"123.456.789-00"}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			transactionDao.err = tt.err
+			r := httptest.NewRequest(http.MethodGet, "/api/transactions?"+tt.query, nil)
+			if tt.token != "" {
+				r.Header.Set("Authorization", "Bearer "+tt.token)
+			}
+			w := httptest.NewRecorder()
+			handle(w, r)
+			if w.Code != tt.status {
+				t.Fatalf("esperado status %d, obtido %d (%s)", tt.status, w.Code, w.Body.String())
+			}
+			if tt.status != http.StatusOK {
+				return
+			}
+
+			var transaction model.Transaction
+			if err := json.Unmarshal(w.Body.Bytes(), &transaction); err != nil {
+				t.Fatalf("resposta inválida: %v", err)
+			}
+			if transaction.TransactionID != "tx-1" || len(transaction.Events) != 1 || transaction.Events[0].Event != tt.event {
+				t.Errorf("esperado tx-1 com o evento %s, obtido %+v", tt.event, transaction)
+			}
+			if r.URL.Query().Get("trail_table") != transactionDao.table {
+				t.Errorf("esperado a tabela de trilha '%s', consultada '%s'", r.URL.Query().Get("trail_table"), transactionDao.table)
+			}
+		})
+	}
+}
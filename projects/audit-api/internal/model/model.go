@@ -10,4 +10,79 @@ type AuditTrail struct {
 	EventOperation string    `json:"eventOperation"`
 	EventDate      time.Time `json:"eventDate"`
 	Event          string    `json:"event"`
+	Connector      string    `json:"connector"`
+	// Metadados da origem informados pelo Debezium
+	SourceVersion  string     `json:"sourceVersion"`
+	SourceName     string     `json:"sourceName"`
+	SourceTs       *time.Time `json:"sourceTs"`
+	SourceSnapshot string     `json:"sourceSnapshot"`
+	SourceSequence string     `json:"sourceSequence"`
+	SourceTxID     int64      `json:"sourceTxId"`
+	SourceLsn      int64      `json:"sourceLsn"`
+	// Colunas alteradas pelos eventos de atualização
+	ChangedColumns []string `json:"changedColumns"`
+	// Chave de dados usada na criptografia das colunas sensíveis do evento
+	KeyID string `json:"keyId"`
+	// Referência dos titulares cujos dados foram cifrados com chaves de titular
+	SubjectRef string `json:"subjectRef"`
+	// Transação do banco de origem e posição do evento dentro dela
+	TransactionID    string `json:"transactionId"`
+	TransactionOrder int64  `json:"transactionOrder"`
+}
+
+// Transaction é uma transação do banco de origem registrada pelo audit-consumer, com os seus
+// eventos na ordem em que foram executados
+type Transaction struct {
+	TransactionID   string                `json:"transactionId"`
+	Status          string                `json:"status"`
+	EventCount      int64                 `json:"eventCount"`
+	ReceivedCount   int64                 `json:"receivedCount"`
+	DataCollections []DataCollectionCount `json:"dataCollections"`
+	CommitDate      time.Time             `json:"commitDate"`
+	RecordedAt      time.Time             `json:"recordedAt"`
+	ValidatedAt     *time.Time            `json:"validatedAt"`
+	Events          []AuditTrail          `json:"events"`
+}
+
+// DataCollectionCount é a quantidade de eventos anunciada e recebida de uma tabela na transação
+type DataCollectionCount struct {
+	DataCollection string `json:"dataCollection"`
+	EventCount     int64  `json:"eventCount"`
+	ReceivedCount  int64  `json:"receivedCount"`
+}
+
+// Shred é o registro da destruição da chave de um titular (crypto-shredding)
+type Shred struct {
+	KeyID       string    `json:"keyId"`
+	Tenant      string    `json:"tenant"`
+	SubjectRef  string    `json:"subjectRef"`
+	RequestedBy string    `json:"requestedBy"`
+	Reason      string    `json:"reason"`
+	ShreddedAt  time.Time `json:"shreddedAt"`
+}
+
+// SchemaChange é uma alteração de schema (DDL) de uma tabela do banco de origem registrada pelo
+// audit-consumer
+type SchemaChange struct {
+	SourceName string `json:"sourceName"`
+	DbName     string `json:"dbName"`
+	DbSchema   string `json:"dbSchema"`
+	DbTable    string `json:"dbTable"`
+	ChangeType string `json:"changeType"`
+	DDL        string `json:"ddl"`
+	// Definição da tabela após a alteração, em JSON, como informada pelo Debezium
+	TableDefinition string `json:"tableDefinition"`
+	// Posição do DDL no log do banco de origem, em JSON
+	SourcePosition string    `json:"sourcePosition"`
+	ChangeDate     time.Time `json:"changeDate"`
+	RecordedAt     time.Time `json:"recordedAt"`
+}
+
+// SchemaTable é uma tabela do banco de origem com alterações de schema registradas
+type SchemaTable struct {
+	DbName     string    `json:"dbName"`
+	DbSchema   string    `json:"dbSchema"`
+	DbTable    string    `json:"dbTable"`
+	Changes    int64     `json:"changes"`
+	LastChange time.Time `json:"lastChange"`
 }
@@ -0,0 +1,86 @@
+package auth
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// wildcard autoriza todos os tenants
+const wildcard = "*"
+
+// Token associa um token de API, identificado pelo seu SHA-256, aos tenants cujos dados cifrados
+// o chamador pode ver em claro. Admin autoriza as operações administrativas, como a eliminação
+// dos dados de um titular.
+type Token struct {
+	Name        string   `json:"name"`
+	TokenSha256 string   `json:"tokenSha256"`
+	Tenants     []string `json:"tenants"`
+	Admin       bool     `json:"admin"`
+}
+
+// Caller é o chamador identificado pelo token da requisição
+type Caller struct {
+	Name    string
+	Tenants []string
+	Admin   bool
+}
+
+// CanDecrypt indica se o chamador pode ver em claro os dados do tenant
+func (c *Caller) CanDecrypt(tenant string) bool {
+	if c == nil {
+		return false
+	}
+	for _, allowed := range c.Tenants {
+		if allowed == wildcard || allowed == tenant {
+			return true
+		}
+	}
+	return false
+}
+
+// Authorizer identifica os chamadores pelo cabeçalho Authorization: Bearer <token>
+type Authorizer struct {
+	tokens map[string]Token
+}
+
+// LoadTokens lê os tokens de um arquivo JSON contendo uma lista de tokens
+func LoadTokens(path string) (*Authorizer, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("erro ao ler o arquivo de tokens '%s': %w", path, err)
+	}
+
+	var tokens []Token
+	if err := json.Unmarshal(data, &tokens); err != nil {
+		return nil, fmt.Errorf("erro ao decodificar o arquivo de tokens '%s': %w", path, err)
+	}
+
+	authorizer := &Authorizer{tokens: make(map[string]Token, len(tokens))}
+	for _, token := range tokens {
+		authorizer.tokens[strings.ToLower(token.TokenSha256)] = token
+	}
+	return authorizer, nil
+}
+
+// Identify retorna o chamador da requisição ou nil se o token estiver ausente ou não for reconhecido
+func (a *Authorizer) Identify(r *http.Request) *Caller {
+	if a == nil {
+		return nil
+	}
+	header := r.Header.Get("Authorization")
+	if !strings.HasPrefix(header, "Bearer ") {
+		return nil
+	}
+
+	sum := sha256.Sum256([]byte(strings.TrimPrefix(header, "Bearer ")))
+	token, ok := a.tokens[hex.EncodeToString(sum[:])]
+	if !ok {
+		return nil
+	}
+	return &Caller{Name: token.Name, Tenants: token.Tenants, Admin: token.Admin}
+}
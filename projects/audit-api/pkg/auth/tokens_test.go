@@ -0,0 +1,73 @@
+package auth
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func tokenHash(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func TestIdentify(t *testing.T) {
+	authorizer := &Authorizer{tokens: map[string]Token{
+		tokenHash("leitor"): {Name: "leitor", Tenants: []string{"acme"}},
+		tokenHash("adm"):    {Name: "admin", Tenants: []string{wildcard}, Admin: true},
+	}}
+
+	tests := []struct {
+		name       string
+		authorizer *Authorizer
+		header     string
+		expected   *Caller
+	}{
+		{"sem cabeçalho", authorizer, "", nil},
+		{"esquema diferente de Bearer", authorizer, "Basic leitor", nil},
+		{"token desconhecido", authorizer, "Bearer outro", nil},
+		{"sem autorizador", nil, "Bearer leitor", nil},
+		{"token de leitura", authorizer, "Bearer leitor", &Caller{Name: "leitor", Tenants: []string{"acme"}}},
+		{"token de administrador", authorizer, "Bearer adm", &Caller{Name: "admin", Tenants: []string{wildcard}, Admin: true}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/api/audit-trail", nil)
+			if tt.header != "" {
+				r.Header.Set("Authorization", tt.header)
+			}
+			caller := tt.authorizer.Identify(r)
+			if tt.expected == nil {
+				if caller != nil {
+					t.Errorf("esperado nenhum chamador, obtido %+v", caller)
+				}
+				return
+			}
+			if caller == nil || caller.Name != tt.expected.Name || caller.Admin != tt.expected.Admin || len(caller.Tenants) != len(tt.expected.Tenants) {
+				t.Errorf("esperado %+v, obtido %+v", tt.expected, caller)
+			}
+		})
+	}
+}
+
+func TestCanDecrypt(t *testing.T) {
+	tests := []struct {
+		name     string
+		caller   *Caller
+		tenant   string
+		expected bool
+	}{
+		{"sem chamador", nil, "acme", false},
+		{"chamador sem tenants", &Caller{Name: "leitor"}, "acme", false},
+		{"tenant diferente", &Caller{Name: "leitor", Tenants: []string{"globex"}}, "acme", false},
+		{"tenant autorizado", &Caller{Name: "leitor", Tenants: []string{"globex", "acme"}}, "acme", true},
+		{"todos os tenants", &Caller{Name: "admin", Tenants: []string{wildcard}}, "acme", true},
+	}
+	for _, tt := range tests {
+		if got := tt.caller.CanDecrypt(tt.tenant); got != tt.expected {
+			t.Errorf("%s: esperado %v, obtido %v", tt.name, tt.expected, got)
+		}
+	}
+}
@@ -23,6 +23,27 @@ type ImmuDBConfig struct {
 	Db       string
 }
 
+// SecurityConfig indica os arquivos de chaves de criptografia e de tokens de API. Com ambos
+// configurados, chamadores autorizados recebem as colunas cifradas em claro. O diretório e o
+// segredo das chaves de titulares, compartilhados com o audit-consumer, habilitam a eliminação
+// dos dados de titulares.
+type SecurityConfig struct {
+	KeyStoreFile   string
+	TokensFile     string
+	SubjectKeysDir string
+	SubjectSecret  string
+}
+
+func GetSecurityConfig() SecurityConfig {
+	log.Println("Obtendo configuração de segurança a partir das variáveis de ambiente...")
+	return SecurityConfig{
+		KeyStoreFile:   utils.GetEnv("ENCRYPTION_KEYSTORE_FILE", ""),
+		TokensFile:     utils.GetEnv("API_TOKENS_FILE", ""),
+		SubjectKeysDir: utils.GetEnv("ENCRYPTION_SUBJECT_KEYS_DIR", ""),
+		SubjectSecret:  utils.GetEnv("ENCRYPTION_SUBJECT_SECRET", ""),
+	}
+}
+
 func GetImmuDBConfig() ImmuDBConfig {
 	log.Println("Obtendo configuração do ImmuDB a partir das variáveis de ambiente...")
 	return ImmuDBConfig{
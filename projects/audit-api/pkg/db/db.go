@@ -6,34 +6,180 @@ import (
 	"github.com/Waelson/audit/audit-api/pkg/config"
 	"github.com/codenotary/immudb/pkg/api/schema"
 	"github.com/codenotary/immudb/pkg/client"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 	"log"
+	"strings"
+	"sync"
 )
 
-// NewImmuDBClient inicializa um novo cliente ImmuDB
-func NewImmuDBClient(cfg config.ImmuDBConfig) (client.ImmuClient, error) {
-	ctx := context.Background()
-	log.Printf("Conectando ao ImmuDB em %s:%d...", cfg.Host, cfg.Port)
+// sessionErrors são as mensagens com que o ImmuDB rejeita uma operação por falta de uma sessão
+// válida: o token expirou, o servidor foi reiniciado ou a sessão foi encerrada
+var sessionErrors = []string{
+	"not logged in",
+	"token has expired",
+	"invalid token",
+	"session not found",
+	"no session found",
+	"please select a database first",
+	client.ErrNotConnected.Error(),
+}
 
-	immuClient, err := client.NewImmuClient(client.DefaultOptions().WithAddress(cfg.Host).WithPort(cfg.Port))
-	if err != nil {
-		fmt.Errorf("Falha ao conectar ao ImmuDB: %v", err)
+// Connection é uma conexão com o ImmuDB que renova a sessão automaticamente. Quando uma operação
+// falha por sessão expirada ou por erro de transporte, a conexão é refeita: um novo cliente é
+// autenticado e o banco configurado é selecionado novamente com UseDatabase. A operação é repetida
+// uma vez após a renovação quando é seguro fazê-lo: sempre que o servidor rejeitou a sessão, pois
+// a operação não chegou a ser executada, e nas consultas em caso de erro de transporte.
+type Connection struct {
+	cfg config.ImmuDBConfig
+
+	mu         sync.Mutex
+	client     client.ImmuClient
+	generation uint64
+}
+
+// NewImmuDBClient abre uma conexão autenticada com o ImmuDB, usando o banco configurado
+func NewImmuDBClient(cfg config.ImmuDBConfig) (*Connection, error) {
+	connection := &Connection{cfg: cfg}
+	if err := connection.dial(context.Background()); err != nil {
 		return nil, err
 	}
+	log.Println("Conexão e autenticação com o ImmuDB bem-sucedidas.")
+	return connection, nil
+}
 
-	log.Println("Autenticando no ImmuDB...")
-	_, err = immuClient.Login(ctx, []byte(cfg.User), []byte(cfg.Password))
+// dial cria um novo cliente, autentica e seleciona o banco configurado. Deve ser chamado com o
+// mutex adquirido, exceto na criação da conexão.
+func (c *Connection) dial(ctx context.Context) error {
+	log.Printf("Conectando ao ImmuDB em %s:%d...", c.cfg.Host, c.cfg.Port)
+	immuClient, err := client.NewImmuClient(client.DefaultOptions().WithAddress(c.cfg.Host).WithPort(c.cfg.Port))
 	if err != nil {
-		fmt.Errorf("Falha ao autenticar no ImmuDB: %v", err)
-		return nil, err
+		return fmt.Errorf("falha ao conectar ao ImmuDB: %w", err)
 	}
 
-	// Usa o banco de dados criado
-	_, err = immuClient.UseDatabase(context.Background(), &schema.Database{DatabaseName: cfg.Db})
-	if err != nil {
-		fmt.Errorf("erro ao usar banco de dados '%s': %w", cfg.Db, err)
-		return nil, err
+	log.Println("Autenticando no ImmuDB...")
+	if _, err := immuClient.Login(ctx, []byte(c.cfg.User), []byte(c.cfg.Password)); err != nil {
+		immuClient.Disconnect()
+		return fmt.Errorf("falha ao autenticar no ImmuDB: %w", err)
 	}
 
-	log.Println("Conexão e autenticação com o ImmuDB bem-sucedidas.")
-	return immuClient, nil
+	// Usa o banco de dados configurado
+	if _, err := immuClient.UseDatabase(ctx, &schema.Database{DatabaseName: c.cfg.Db}); err != nil {
+		immuClient.Disconnect()
+		return fmt.Errorf("erro ao usar banco de dados '%s': %w", c.cfg.Db, err)
+	}
+
+	c.client = immuClient
+	c.generation++
+	return nil
+}
+
+// renew refaz a conexão após a falha de uma operação executada com a geração informada. Se outra
+// requisição já renovou a conexão, a nova sessão é reaproveitada.
+func (c *Connection) renew(ctx context.Context, generation uint64) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.generation != generation {
+		return nil
+	}
+
+	log.Println("Conexão com o ImmuDB perdida, reconectando...")
+	// A sessão anterior já foi invalidada pelo servidor: os erros do encerramento são esperados
+	c.client.Disconnect()
+	if err := c.dial(ctx); err != nil {
+		log.Printf("Falha ao reconectar ao ImmuDB: %v", err)
+		return err
+	}
+	log.Println("Sessão com o ImmuDB renovada com sucesso.")
+	return nil
+}
+
+// current retorna o cliente em uso e a sua geração
+func (c *Connection) current() (client.ImmuClient, uint64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.client, c.generation
+}
+
+// do executa a operação, renovando a conexão e repetindo a operação uma vez quando ela falha por
+// sessão inválida ou, se a operação for idempotente, por erro de transporte
+func (c *Connection) do(ctx context.Context, idempotent bool, operation func(immuClient client.ImmuClient) error) error {
+	immuClient, generation := c.current()
+	err := operation(immuClient)
+	if err == nil {
+		return nil
+	}
+
+	expired := isSessionError(err)
+	if !expired && !isTransportError(err) {
+		return err
+	}
+	if renewErr := c.renew(ctx, generation); renewErr != nil {
+		return renewErr
+	}
+	if !expired && !idempotent {
+		// A gravação pode ter sido aplicada antes da falha: cabe ao chamador decidir se a repete
+		return err
+	}
+
+	immuClient, _ = c.current()
+	return operation(immuClient)
+}
+
+// SQLExec executa um comando SQL no banco configurado
+func (c *Connection) SQLExec(ctx context.Context, query string, params map[string]interface{}) (*schema.SQLExecResult, error) {
+	var result *schema.SQLExecResult
+	err := c.do(ctx, false, func(immuClient client.ImmuClient) error {
+		var err error
+		result, err = immuClient.SQLExec(ctx, query, params)
+		return err
+	})
+	return result, err
+}
+
+// SQLQuery executa uma consulta SQL no banco configurado
+func (c *Connection) SQLQuery(ctx context.Context, query string, params map[string]interface{}, renewSnapshot bool) (*schema.SQLQueryResult, error) {
+	var result *schema.SQLQueryResult
+	err := c.do(ctx, true, func(immuClient client.ImmuClient) error {
+		var err error
+		result, err = immuClient.SQLQuery(ctx, query, params, renewSnapshot)
+		return err
+	})
+	return result, err
+}
+
+// Health verifica se a sessão é válida e o banco configurado está disponível, renovando a sessão
+// se necessário
+func (c *Connection) Health(ctx context.Context) (*schema.DatabaseHealthResponse, error) {
+	var response *schema.DatabaseHealthResponse
+	err := c.do(ctx, true, func(immuClient client.ImmuClient) error {
+		var err error
+		response, err = immuClient.Health(ctx)
+		return err
+	})
+	return response, err
+}
+
+// isSessionError indica se o ImmuDB rejeitou a operação por falta de uma sessão válida
+func isSessionError(err error) bool {
+	if st, ok := status.FromError(err); ok && st.Code() == codes.Unauthenticated {
+		return true
+	}
+	message := err.Error()
+	for _, sessionError := range sessionErrors {
+		if strings.Contains(message, sessionError) {
+			return true
+		}
+	}
+	return false
+}
+
+// isTransportError indica se a operação falhou na comunicação com o servidor. O cliente do ImmuDB
+// nem sempre preserva o código gRPC, por isso a mensagem também é verificada.
+func isTransportError(err error) bool {
+	if st, ok := status.FromError(err); ok && st.Code() == codes.Unavailable {
+		return true
+	}
+	message := err.Error()
+	return strings.Contains(message, "connection error") || strings.Contains(message, "transport is closing")
 }
@@ -0,0 +1,245 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/Waelson/audit/audit-consumer/internal/config"
+	consumer2 "github.com/Waelson/audit/audit-consumer/internal/consumer"
+	"github.com/Waelson/audit/audit-consumer/internal/deadletter"
+	"github.com/Waelson/audit/audit-consumer/internal/routing"
+	"github.com/Waelson/audit/audit-consumer/internal/sink"
+	"github.com/Waelson/audit/audit-consumer/internal/utils"
+	"io"
+	"log"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+	"time"
+)
+
+// importCheckpoint é o conteúdo do arquivo de checkpoint de uma importação
+type importCheckpoint struct {
+	File   string `json:"file"`
+	Source string `json:"source"`
+	consumer2.ImportPosition
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// importFiles importa arquivos JSON Lines com envelopes do Debezium exportados por sistemas que
+// não publicam no Kafka. Cada linha passa pelo mesmo pipeline do consumo contínuo, como uma
+// mensagem do tópico informado, que define a rota. As linhas rejeitadas são gravadas em um arquivo
+// de rejeições e a posição de cada arquivo é salva periodicamente em um checkpoint, a partir do
+// qual uma importação interrompida é retomada. As linhas são identificadas pela origem do
+// arquivo: o hash SHA-256 do conteúdo ou o identificador informado em -source-id.
+//
+//	audit-consumer import -topic legacy.public.payment dump-2023.ndjson dump-2024.ndjson
+func importFiles(args []string) {
+	flags := flag.NewFlagSet("import", flag.ExitOnError)
+	topic := flags.String("topic", "", "tópico cuja rota é usada na gravação das linhas")
+	stateDir := flags.String("state-dir", "", "diretório dos checkpoints e das rejeições (padrão: o diretório de cada arquivo)")
+	progress := flags.Duration("progress", 10*time.Second, "intervalo entre os relatórios de progresso e os checkpoints")
+	sourceID := flags.String("source-id", "", "identificador da origem do arquivo (padrão: o hash SHA-256 do conteúdo)")
+	flags.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Uso: audit-consumer import -topic <tópico> [opções] <arquivo>...")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	if *topic == "" || flags.NArg() == 0 || *progress <= 0 {
+		flags.Usage()
+		os.Exit(2)
+	}
+	if *sourceID != "" && flags.NArg() > 1 {
+		fmt.Fprintln(os.Stderr, "-source-id identifica um único arquivo; importe um arquivo por vez.")
+		os.Exit(2)
+	}
+
+	cfg, err := config.Load(utils.GetEnv("CONFIG_FILE", ""))
+	if err != nil {
+		log.Fatalf("Erro na configuração: %v", err)
+	}
+	immuCfg := cfg.ImmuDB
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	router := initializeRouter(cfg.Kafka.RoutesFile, immuCfg.Database, cfg.Kafka.AvroTopics, cfg.Kafka.TransactionTopics, cfg.Kafka.SchemaTopics)
+	route := router.Route(*topic)
+	log.Printf("Importando %d arquivo(s) com a rota do tópico %s - Banco: %s, Tabela: %s",
+		flags.NArg(), *topic, route.Database, route.Table)
+	masker := initializeMasker(cfg.Masking)
+	encryptor := initializeEncryptor(cfg.Encryption)
+
+	auditSink := initializeSink(cfg.Sink, immuCfg)
+	if _, ok := auditSink.(sink.TransactionStore); route.Kind == routing.KindTransaction && !ok {
+		log.Fatalf("O sink %s não registra transações; o tópico %s é um tópico de transações.", auditSink.Name(), *topic)
+	}
+	if _, ok := auditSink.(sink.SchemaChangeStore); route.Kind == routing.KindSchema && !ok {
+		log.Fatalf("O sink %s não registra alterações de schema; o tópico %s é um tópico de alterações de schema.", auditSink.Name(), *topic)
+	}
+	if cfg.Sink.Type == sink.TypeJSONL {
+		log.Println("ATENÇÃO: o sink JSON Lines não é idempotente; as linhas reprocessadas ao retomar uma importação serão gravadas novamente.")
+	}
+	if err := auditSink.Setup(ctx, router.Databases()); err != nil {
+		log.Fatalf("Erro ao configurar o sink %s: %v", auditSink.Name(), err)
+	}
+
+	// As rejeições de cada arquivo são gravadas no seu próprio arquivo de rejeições
+	consumer := newConsumer(cfg, router, auditSink, masker, encryptor, nil, newRetryPolicy(immuCfg))
+	var total consumer2.ImportPosition
+	failed := false
+	for _, path := range flags.Args() {
+		position, err := importFile(ctx, consumer, path, *topic, *sourceID, *stateDir, *progress)
+		total.Line += position.Line
+		total.Accepted += position.Accepted
+		total.Rejected += position.Rejected
+		if err != nil {
+			log.Printf("Importação de %s interrompida na linha %d: %v. Execute o mesmo comando para retomá-la.",
+				path, position.Line+1, err)
+			failed = true
+			break
+		}
+	}
+
+	closeSink(auditSink)
+	log.Printf("Resumo da importação - Linhas: %d, Aceitas: %d, Rejeitadas: %d", total.Line, total.Accepted, total.Rejected)
+	if failed {
+		os.Exit(1)
+	}
+}
+
+// importFile importa um arquivo a partir do seu checkpoint, salvando a posição a cada relatório
+// de progresso e ao final, mesmo quando a importação é interrompida. Sem sourceID a origem é o
+// hash do conteúdo do arquivo.
+func importFile(ctx context.Context, consumer *consumer2.KafkaConsumer, path, topic, sourceID, stateDir string, progress time.Duration) (consumer2.ImportPosition, error) {
+	absolute, err := filepath.Abs(path)
+	if err != nil {
+		return consumer2.ImportPosition{}, err
+	}
+	dir := stateDir
+	if dir == "" {
+		dir = filepath.Dir(absolute)
+	}
+	checkpointPath := filepath.Join(dir, filepath.Base(absolute)+".checkpoint")
+	rejectsPath := filepath.Join(dir, filepath.Base(absolute)+".rejects.ndjson")
+
+	file, err := os.Open(absolute)
+	if err != nil {
+		return consumer2.ImportPosition{}, fmt.Errorf("erro ao abrir o arquivo: %w", err)
+	}
+	defer file.Close()
+	source := sourceID
+	if source == "" {
+		if source, err = contentSource(file); err != nil {
+			return consumer2.ImportPosition{}, err
+		}
+	}
+	position, err := loadImportCheckpoint(checkpointPath, absolute, source)
+	if err != nil {
+		return consumer2.ImportPosition{}, err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		return position, fmt.Errorf("erro ao ler o tamanho do arquivo: %w", err)
+	}
+	if position.Offset > info.Size() {
+		return position, fmt.Errorf("o checkpoint %s aponta para o byte %d, mas o arquivo tem %d bytes", checkpointPath, position.Offset, info.Size())
+	}
+	if _, err := file.Seek(position.Offset, io.SeekStart); err != nil {
+		return position, fmt.Errorf("erro ao posicionar o arquivo no checkpoint: %w", err)
+	}
+	if position.Line > 0 {
+		log.Printf("Retomando a importação de %s na linha %d (%d aceitas, %d rejeitadas até o checkpoint)",
+			absolute, position.Line+1, position.Accepted, position.Rejected)
+	} else {
+		log.Printf("Iniciando a importação de %s (%d bytes) - Origem: %s", absolute, info.Size(), source)
+	}
+
+	rejects, err := deadletter.NewFilePublisher(rejectsPath)
+	if err != nil {
+		return position, err
+	}
+	defer rejects.Close()
+	consumer.DeadLetter = rejects
+
+	report := func(position consumer2.ImportPosition) error {
+		percent := 100.0
+		if info.Size() > 0 {
+			percent = float64(position.Offset) * 100 / float64(info.Size())
+		}
+		log.Printf("Importação de %s: %.1f%% - Linhas: %d, Aceitas: %d, Rejeitadas: %d",
+			filepath.Base(absolute), percent, position.Line, position.Accepted, position.Rejected)
+		return saveImportCheckpoint(checkpointPath, absolute, source, position)
+	}
+	position, importErr := consumer.Import(ctx, file, topic, source, position, progress, report)
+	if err := saveImportCheckpoint(checkpointPath, absolute, source, position); err != nil {
+		return position, errors.Join(importErr, err)
+	}
+	if importErr != nil {
+		return position, importErr
+	}
+
+	log.Printf("Importação de %s concluída - Linhas: %d, Aceitas: %d, Rejeitadas: %d (em %s)",
+		absolute, position.Line, position.Accepted, position.Rejected, rejectsPath)
+	return position, nil
+}
+
+// contentSource retorna a origem de um arquivo derivada do hash SHA-256 do seu conteúdo e volta
+// ao início do arquivo
+func contentSource(file *os.File) (string, error) {
+	hash := sha256.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return "", fmt.Errorf("erro ao calcular o hash do arquivo: %w", err)
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return "", fmt.Errorf("erro ao posicionar o arquivo: %w", err)
+	}
+	return "sha256:" + hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// loadImportCheckpoint lê a posição salva para o arquivo; sem checkpoint a importação começa do
+// início. Um checkpoint de outro arquivo com o mesmo nome, ou de outra origem (o arquivo foi
+// alterado depois do checkpoint), é recusado.
+func loadImportCheckpoint(path, file, source string) (consumer2.ImportPosition, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return consumer2.ImportPosition{}, nil
+	}
+	if err != nil {
+		return consumer2.ImportPosition{}, fmt.Errorf("erro ao ler o checkpoint '%s': %w", path, err)
+	}
+	var checkpoint importCheckpoint
+	if err := json.Unmarshal(data, &checkpoint); err != nil {
+		return consumer2.ImportPosition{}, fmt.Errorf("checkpoint '%s' inválido: %w", path, err)
+	}
+	if checkpoint.File != file {
+		return consumer2.ImportPosition{}, fmt.Errorf("o checkpoint '%s' pertence ao arquivo '%s'", path, checkpoint.File)
+	}
+	if checkpoint.Source != source {
+		return consumer2.ImportPosition{}, fmt.Errorf("o checkpoint '%s' pertence à origem '%s', e não a '%s'", path, checkpoint.Source, source)
+	}
+	return checkpoint.ImportPosition, nil
+}
+
+// saveImportCheckpoint grava a posição em um arquivo temporário e o renomeia, para que uma
+// interrupção durante a gravação não corrompa o checkpoint anterior
+func saveImportCheckpoint(path, file, source string, position consumer2.ImportPosition) error {
+	checkpoint := importCheckpoint{File: file, Source: source, ImportPosition: position, UpdatedAt: time.Now().UTC()}
+	data, err := json.MarshalIndent(checkpoint, "", "  ")
+	if err != nil {
+		return fmt.Errorf("erro ao serializar o checkpoint: %w", err)
+	}
+	temporary := path + ".tmp"
+	if err := os.WriteFile(temporary, data, 0o640); err != nil {
+		return fmt.Errorf("erro ao gravar o checkpoint '%s': %w", path, err)
+	}
+	if err := os.Rename(temporary, path); err != nil {
+		return fmt.Errorf("erro ao gravar o checkpoint '%s': %w", path, err)
+	}
+	return nil
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"fmt"
+	consumer2 "github.com/Waelson/audit/audit-consumer/internal/consumer"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestImportCheckpoint(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "dump.ndjson.checkpoint")
+	file := filepath.Join(dir, "dump.ndjson")
+	source := "legacy-2023"
+
+	// Sem checkpoint a importação começa do início
+	position, err := loadImportCheckpoint(path, file, source)
+	if err != nil || position != (consumer2.ImportPosition{}) {
+		t.Fatalf("loadImportCheckpoint() = %+v, %v; esperada a posição inicial", position, err)
+	}
+
+	want := consumer2.ImportPosition{Offset: 1024, Line: 10, Accepted: 8, Rejected: 2}
+	if err := saveImportCheckpoint(path, file, source, want); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(path + ".tmp"); !os.IsNotExist(err) {
+		t.Errorf("arquivo temporário mantido após a gravação: %v", err)
+	}
+	position, err = loadImportCheckpoint(path, file, source)
+	if err != nil || position != want {
+		t.Fatalf("loadImportCheckpoint() = %+v, %v; esperado %+v", position, err, want)
+	}
+
+	// Um checkpoint de outro arquivo com o mesmo nome é recusado
+	if _, err := loadImportCheckpoint(path, filepath.Join(dir, "outro", "dump.ndjson"), source); err == nil || !strings.Contains(err.Error(), file) {
+		t.Errorf("loadImportCheckpoint() de outro arquivo = %v, esperado erro", err)
+	}
+
+	// O arquivo foi alterado depois do checkpoint: as posições salvas não valem para o novo conteúdo
+	if _, err := loadImportCheckpoint(path, file, "legacy-2024"); err == nil || !strings.Contains(err.Error(), source) {
+		t.Errorf("loadImportCheckpoint() de outra origem = %v, esperado erro", err)
+	}
+
+	if err := os.WriteFile(path, []byte("{"), 0o640); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := loadImportCheckpoint(path, file, source); err == nil {
+		t.Error("loadImportCheckpoint() de um checkpoint inválido não retornou erro")
+	}
+}
+
+func TestContentSource(t *testing.T) {
+	dir := t.TempDir()
+	sources := make([]string, 0, 3)
+	for i, content := range []string{"linha 1\nlinha 2\n", "linha 1\nlinha 2\n", "linha 1\n"} {
+		// O mesmo conteúdo em outro caminho tem a mesma origem
+		path := filepath.Join(dir, fmt.Sprintf("copia-%d", i), "dump.ndjson")
+		if err := os.MkdirAll(filepath.Dir(path), 0o750); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o640); err != nil {
+			t.Fatal(err)
+		}
+		file, err := os.Open(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer file.Close()
+		source, err := contentSource(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if offset, _ := file.Seek(0, io.SeekCurrent); offset != 0 {
+			t.Errorf("arquivo no byte %d após o hash, esperado 0", offset)
+		}
+		sources = append(sources, source)
+	}
+	if sources[0] != sources[1] || sources[0] == sources[2] || !strings.HasPrefix(sources[0], "sha256:") {
+		t.Errorf("origens = %v, esperada a mesma origem apenas para o mesmo conteúdo", sources)
+	}
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"encoding/base64"
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/Waelson/audit/audit-consumer/internal/encryption"
+	"log"
+	"os"
+)
+
+// keytool administra o arquivo de chaves usado na criptografia das colunas sensíveis.
+//
+//	keytool -keystore keys.json new-master -id mk-2024
+//	keytool -keystore keys.json new-data-key -tenant payments -id payments-2024-01 -master mk-2024
+//	keytool -keystore keys.json rewrap -master mk-2025
+func main() {
+	keyStorePath := flag.String("keystore", "keystore.json", "arquivo de chaves")
+	flag.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Uso: keytool -keystore <arquivo> <new-master|new-data-key|rewrap> [opções]")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	file, err := loadOrCreate(*keyStorePath)
+	if err != nil {
+		log.Fatalf("Erro ao abrir o arquivo de chaves: %v", err)
+	}
+
+	args := flag.Args()[1:]
+	switch flag.Arg(0) {
+	case "new-master":
+		err = newMaster(file, args)
+	case "new-data-key":
+		err = newDataKey(file, args)
+	case "rewrap":
+		err = rewrap(file, args)
+	default:
+		flag.Usage()
+		os.Exit(2)
+	}
+	if err != nil {
+		log.Fatalf("Erro: %v", err)
+	}
+
+	if err := file.Save(*keyStorePath); err != nil {
+		log.Fatalf("Erro ao gravar o arquivo de chaves: %v", err)
+	}
+}
+
+// newMaster gera uma nova chave mestra
+func newMaster(file *encryption.KeyStoreFile, args []string) error {
+	flags := flag.NewFlagSet("new-master", flag.ExitOnError)
+	id := flags.String("id", "", "identificador da chave mestra")
+	flags.Parse(args)
+	if *id == "" {
+		return fmt.Errorf("informe o identificador da chave mestra (-id)")
+	}
+	if _, exists := file.MasterKeys[*id]; exists {
+		return fmt.Errorf("a chave mestra '%s' já existe", *id)
+	}
+
+	key, err := encryption.NewKey()
+	if err != nil {
+		return err
+	}
+	file.MasterKeys[*id] = base64.StdEncoding.EncodeToString(key)
+	log.Printf("Chave mestra '%s' criada.", *id)
+	return nil
+}
+
+// newDataKey gera uma nova chave de dados para o tenant e a torna a chave ativa. As chaves
+// anteriores do tenant são mantidas para decifrar os registros já gravados.
+func newDataKey(file *encryption.KeyStoreFile, args []string) error {
+	flags := flag.NewFlagSet("new-data-key", flag.ExitOnError)
+	id := flags.String("id", "", "identificador da chave de dados")
+	tenant := flags.String("tenant", "", "tenant dono da chave")
+	master := flags.String("master", "", "chave mestra que embrulha a chave de dados")
+	flags.Parse(args)
+	if *id == "" || *tenant == "" || *master == "" {
+		return fmt.Errorf("informe -id, -tenant e -master")
+	}
+	for _, dataKey := range file.DataKeys {
+		if dataKey.ID == *id {
+			return fmt.Errorf("a chave de dados '%s' já existe", *id)
+		}
+	}
+
+	key, err := encryption.NewKey()
+	if err != nil {
+		return err
+	}
+	wrapped, err := file.Wrap(*id, *tenant, *master, key)
+	if err != nil {
+		return err
+	}
+	wrapped.Active = true
+
+	for i := range file.DataKeys {
+		if file.DataKeys[i].Tenant == *tenant && file.DataKeys[i].Active {
+			file.DataKeys[i].Active = false
+			log.Printf("Chave de dados '%s' desativada.", file.DataKeys[i].ID)
+		}
+	}
+	file.DataKeys = append(file.DataKeys, wrapped)
+	log.Printf("Chave de dados '%s' criada e ativada para o tenant '%s'.", *id, *tenant)
+	return nil
+}
+
+// rewrap embrulha todas as chaves de dados com outra chave mestra, sem alterar as chaves de dados
+// e, portanto, sem reescrever os registros cifrados com elas
+func rewrap(file *encryption.KeyStoreFile, args []string) error {
+	flags := flag.NewFlagSet("rewrap", flag.ExitOnError)
+	master := flags.String("master", "", "nova chave mestra")
+	flags.Parse(args)
+	if *master == "" {
+		return fmt.Errorf("informe a nova chave mestra (-master)")
+	}
+
+	for i, dataKey := range file.DataKeys {
+		key, err := file.Unwrap(dataKey)
+		if err != nil {
+			return err
+		}
+		wrapped, err := file.Wrap(dataKey.ID, dataKey.Tenant, *master, key)
+		if err != nil {
+			return err
+		}
+		wrapped.Active = dataKey.Active
+		file.DataKeys[i] = wrapped
+	}
+	log.Printf("%d chave(s) de dados embrulhada(s) com a chave mestra '%s'.", len(file.DataKeys), *master)
+	return nil
+}
+
+// loadOrCreate lê o arquivo de chaves ou cria um arquivo vazio se ele ainda não existir
+func loadOrCreate(path string) (*encryption.KeyStoreFile, error) {
+	if _, err := os.Stat(path); errors.Is(err, os.ErrNotExist) {
+		return &encryption.KeyStoreFile{MasterKeys: make(map[string]string)}, nil
+	}
+	return encryption.ReadKeyStoreFile(path)
+}
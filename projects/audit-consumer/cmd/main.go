@@ -2,146 +2,508 @@ package main
 
 import (
 	"context"
-	"fmt"
+	"errors"
+	"github.com/Waelson/audit/audit-consumer/internal/config"
 	consumer2 "github.com/Waelson/audit/audit-consumer/internal/consumer"
+	"github.com/Waelson/audit/audit-consumer/internal/deadletter"
+	"github.com/Waelson/audit/audit-consumer/internal/decoder"
+	"github.com/Waelson/audit/audit-consumer/internal/encryption"
+	"github.com/Waelson/audit/audit-consumer/internal/health"
+	"github.com/Waelson/audit/audit-consumer/internal/masking"
+	"github.com/Waelson/audit/audit-consumer/internal/resilience"
+	"github.com/Waelson/audit/audit-consumer/internal/routing"
+	"github.com/Waelson/audit/audit-consumer/internal/sink"
 	"github.com/Waelson/audit/audit-consumer/internal/utils"
-	"github.com/codenotary/immudb/pkg/api/schema"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"log"
+	"net/http"
 	"os"
 	"os/signal"
+	"strings"
+	"sync"
 	"syscall"
 	"time"
 
 	"github.com/IBM/sarama"
-	"github.com/codenotary/immudb/pkg/client"
 )
 
 func main() {
+	// Subcomandos de reprocessamento e de importação offline
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "replay":
+			replay(os.Args[2:])
+			return
+		case "import":
+			importFiles(os.Args[2:])
+			return
+		}
+	}
 	log.Println("Iniciando a aplicação Kafka -> ImmuDB")
 
-	// Obter parâmetros do Kafka e do ImmuDB de variáveis de ambiente ou usar valores padrão
-	kafkaBrokers := utils.GetEnv("KAFKA_BROKERS", "localhost:9092")
-	kafkaTopic := utils.GetEnv("KAFKA_TOPIC", "audit-trail")
-	kafkaGroup := utils.GetEnv("KAFKA_CONSUMER_GROUP", "audit-trail-consumer-group")
+	// Carrega a configuração do arquivo (opcional), sobreposta pelas variáveis de ambiente
+	cfg, err := config.Load(utils.GetEnv("CONFIG_FILE", ""))
+	if err != nil {
+		log.Fatalf("Erro na configuração: %v", err)
+	}
+	kafkaCfg, immuCfg := cfg.Kafka, cfg.ImmuDB
+	retryPolicy := newRetryPolicy(immuCfg)
 
-	immuHost := utils.GetEnv("IMMUD_HOST", "localhost")
-	immuPort := utils.GetEnvAsInt("IMMUD_PORT", 3322)
-	immuUser := utils.GetEnv("IMMUD_USER", "immudb")
-	immuPassword := utils.GetEnv("IMMUD_PASSWORD", "immudb")
+	log.Printf("Configuração do Kafka - Brokers: %v, Tópicos: %v, Expressão: %s, Grupo: %s, Dead-letter: %s",
+		kafkaCfg.Brokers, kafkaCfg.Topics, kafkaCfg.TopicPattern, kafkaCfg.ConsumerGroup, kafkaCfg.DLQTopic)
+	log.Printf("Configuração do consumer group - Offset inicial: %s, Sessão: %s, Heartbeat: %s, Estratégia: %s, SASL: %s, TLS: %t",
+		kafkaCfg.InitialOffset, kafkaCfg.SessionTimeout, kafkaCfg.HeartbeatInterval, kafkaCfg.RebalanceStrategy,
+		kafkaCfg.SASL.Mechanism, kafkaCfg.TLS.Enabled)
+	log.Printf("Configuração do sink - Tipo: %s, Banco padrão: %s", cfg.Sink.Type, immuCfg.Database)
+	if cfg.Sink.Type == sink.TypeImmuDB {
+		log.Printf("Configuração do ImmuDB - Host: %s, Porta: %d, TLS: %t, Gravações verificadas: %t, Estado confiável: %s",
+			immuCfg.Host, immuCfg.Port, immuCfg.TLS.Enabled, immuCfg.VerifyWrites, immuCfg.StateDir)
+	}
+	log.Printf("Configuração de retentativa - Tentativas: %d, Backoff: %s a %s, Classes: %v, Circuit breaker: %d falhas / %s",
+		retryPolicy.MaxAttempts, retryPolicy.InitialBackoff, retryPolicy.MaxBackoff, immuCfg.Retry.ErrorClasses,
+		immuCfg.Breaker.FailureThreshold, immuCfg.Breaker.OpenTimeout)
+	log.Printf("Configuração de lote - Tamanho: %d, Timeout: %s", cfg.Batch.Size, cfg.Batch.Timeout)
+	log.Printf("Configuração de decoders - Tópicos Avro: %v, Schema registry: %s", kafkaCfg.AvroTopics, cfg.SchemaRegistry.URL)
+	log.Printf("Configuração de encerramento - Prazo: %s", cfg.Shutdown.Timeout)
+
+	// Captura as interrupções do sistema para encerrar o consumidor com segurança
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
 
-	log.Printf("Configuração do Kafka - Brokers: %s, Tópico: %s, Grupo: %s", kafkaBrokers, kafkaTopic, kafkaGroup)
-	log.Printf("Configuração do ImmuDB - Host: %s, Porta: %d", immuHost, immuPort)
+	subscription, err := routing.NewSubscription(kafkaCfg.Topics, kafkaCfg.TopicPattern, kafkaCfg.DLQTopic)
+	if err != nil {
+		log.Fatalf("Erro na configuração dos tópicos: %v", err)
+	}
+	router := initializeRouter(kafkaCfg.RoutesFile, immuCfg.Database, kafkaCfg.AvroTopics, kafkaCfg.TransactionTopics, kafkaCfg.SchemaTopics)
+	masker := initializeMasker(cfg.Masking)
+	encryptor := initializeEncryptor(cfg.Encryption)
 
-	// Inicializa o cliente ImmuDB
-	immuClient := initializeImmuDB(immuHost, immuPort, immuUser, immuPassword)
+	auditSink := initializeSink(cfg.Sink, immuCfg)
+	if _, ok := auditSink.(sink.TransactionStore); router.HasKind(routing.KindTransaction) && !ok {
+		log.Fatalf("O sink %s não registra transações; remova os tópicos de transações da configuração.", auditSink.Name())
+	}
+	if _, ok := auditSink.(sink.SchemaChangeStore); router.HasKind(routing.KindSchema) && !ok {
+		log.Fatalf("O sink %s não registra alterações de schema; remova os tópicos de alterações de schema da configuração.", auditSink.Name())
+	}
 
-	// Cria o banco de dados e tabela automaticamente
-	if err := createDatabaseAndTable(immuClient, "audit_db"); err != nil {
-		log.Fatalf("Erro ao configurar o banco de dados e tabela: %v", err)
+	// Expõe as métricas e os endpoints de saúde do consumidor. Até a inicialização de cada
+	// dependência, sua verificação indica que ela ainda não está pronta.
+	checker := health.NewChecker(cfg.HTTP.HealthCheckTimeout)
+	checker.Register("kafka", startingCheck)
+	for dbName := range router.Databases() {
+		checker.Register(auditSink.Name()+":"+dbName, startingCheck)
 	}
+	server := startHTTPServer(cfg.HTTP.Addr, checker)
 
-	log.Println("Inicializando o consumidor Kafka...")
-	consumer := &consumer2.KafkaConsumer{
-		ImmuClient: immuClient,
+	// Prepara cada banco de destino do sink, criando as tabelas automaticamente
+	if err := auditSink.Setup(ctx, router.Databases()); err != nil {
+		log.Fatalf("Erro ao configurar o sink %s: %v", auditSink.Name(), err)
+	}
+	for dbName := range router.Databases() {
+		checker.Register(auditSink.Name()+":"+dbName, sinkCheck(auditSink, dbName))
 	}
 
 	// Configuração do Kafka
-	config := sarama.NewConfig()
-	config.Consumer.Group.Rebalance.Strategy = sarama.BalanceStrategyRoundRobin
-	config.Version = sarama.V2_6_0_0
+	saramaConfig, err := kafkaCfg.Sarama()
+	if err != nil {
+		log.Fatalf("Erro na configuração do Kafka: %v", err)
+	}
 
-	for {
+	// Inicializa o producer do tópico de dead-letter
+	deadLetter := initializeDeadLetter(ctx, kafkaCfg.Brokers, kafkaCfg.DLQTopic, saramaConfig)
+	if deadLetter == nil {
+		closeSink(auditSink)
+		shutdownHTTPServer(server)
+		log.Println("Consumidor encerrado antes de iniciar o consumo.")
+		return
+	}
+
+	log.Println("Inicializando o consumidor Kafka...")
+	consumer := newConsumer(cfg, router, auditSink, masker, encryptor, deadLetter, retryPolicy)
+	checker.Register("kafka", consumer.CheckMembership)
+
+	// Valida as transações anunciadas nos tópicos de transações
+	var validators sync.WaitGroup
+	if router.HasKind(routing.KindTransaction) {
+		log.Printf("Validação de transações - Intervalo: %s, Timeout: %s", cfg.Transactions.CheckInterval, cfg.Transactions.Timeout)
+		validators.Add(1)
+		go func() {
+			defer validators.Done()
+			consumer.ValidateTransactions(ctx, cfg.Transactions.CheckInterval, cfg.Transactions.Timeout)
+		}()
+	}
+
+	// Ao receber o sinal, o consumo de novas mensagens é interrompido e as mensagens em andamento
+	// são concluídas até o prazo de encerramento
+	consumeCtx, stopConsuming := context.WithCancel(context.Background())
+	defer stopConsuming()
+	drainCtx, abortDrain := context.WithCancel(context.Background())
+	defer abortDrain()
+	go func() {
+		<-ctx.Done()
+		log.Printf("Sinal de encerramento recebido. Concluindo as mensagens em andamento em até %s...", cfg.Shutdown.Timeout)
+		consumer.Drain(drainCtx)
+		stopConsuming()
+		watchShutdown(cfg.Shutdown.Timeout, abortDrain)
+	}()
+
+	for consumeCtx.Err() == nil {
 		log.Println("Conectando ao Kafka...")
-		kafkaClient, err := sarama.NewConsumerGroup([]string{kafkaBrokers}, kafkaGroup, config)
+		kafkaClient, err := sarama.NewClient(kafkaCfg.Brokers, saramaConfig)
+		if err != nil {
+			log.Printf("Erro ao criar cliente Kafka: %v. Tentando novamente em 5 segundos...", err)
+			sleep(consumeCtx, 5*time.Second)
+			continue
+		}
+		consumerGroup, err := sarama.NewConsumerGroupFromClient(kafkaCfg.ConsumerGroup, kafkaClient)
 		if err != nil {
 			log.Printf("Erro ao criar consumer group: %v. Tentando novamente em 5 segundos...", err)
-			time.Sleep(5 * time.Second)
+			kafkaClient.Close()
+			sleep(consumeCtx, 5*time.Second)
 			continue
 		}
 
-		// Captura interrupções do sistema para fechar o consumidor com segurança
-		ctx, cancel := context.WithCancel(context.Background())
-		go func() {
-			sigchan := make(chan os.Signal, 1)
-			signal.Notify(sigchan, os.Interrupt, syscall.SIGTERM)
-			<-sigchan
-			log.Println("Interrompendo o consumidor...")
-			cancel()
-		}()
-
-		log.Printf("Consumindo mensagens do tópico: %s", kafkaTopic)
 		for {
-			if err := kafkaClient.Consume(ctx, []string{kafkaTopic}, consumer); err != nil {
-				log.Printf("Erro ao consumir mensagens: %v. Tentando reconectar em 5 segundos...", err)
-				time.Sleep(5 * time.Second)
+			topics, err := resolveTopics(kafkaClient, subscription)
+			if err != nil {
+				log.Printf("Erro ao listar os tópicos: %v. Tentando reconectar em 5 segundos...", err)
+				sleep(consumeCtx, 5*time.Second)
 				break
 			}
-			if ctx.Err() != nil {
+			if len(topics) == 0 {
+				log.Printf("Nenhum tópico corresponde à expressão %s. Verificando novamente em %s...", kafkaCfg.TopicPattern, kafkaCfg.TopicRefreshInterval)
+				sleep(consumeCtx, kafkaCfg.TopicRefreshInterval)
+			} else {
+				// Com expressão regular, a sessão é encerrada quando o conjunto de tópicos muda,
+				// para que o consumidor volte ao grupo inscrito nos novos tópicos
+				sessionCtx, stopSession := context.WithCancel(consumeCtx)
+				if subscription.Dynamic() {
+					go watchTopics(sessionCtx, stopSession, kafkaClient, subscription, topics, kafkaCfg.TopicRefreshInterval)
+				}
+
+				log.Printf("Consumindo mensagens dos tópicos: %v", topics)
+				err = consumerGroup.Consume(sessionCtx, topics, consumer)
+				stopSession()
+				if err != nil {
+					log.Printf("Erro ao consumir mensagens: %v. Tentando reconectar em 5 segundos...", err)
+					sleep(consumeCtx, 5*time.Second)
+					break
+				}
+			}
+			if consumeCtx.Err() != nil {
 				log.Println("Contexto encerrado, saindo do loop de consumo.")
 				break
 			}
 		}
+
+		// Fechar o consumer group encerra a participação no grupo; os offsets marcados já foram
+		// confirmados ao final da sessão
 		log.Println("Fechando o cliente Kafka...")
+		if err := consumerGroup.Close(); err != nil {
+			log.Printf("Erro ao fechar o consumer group: %v", err)
+		}
 		kafkaClient.Close()
 	}
+
+	validators.Wait()
+	log.Println("Fechando o producer de dead-letter...")
+	if err := deadLetter.Close(); err != nil {
+		log.Printf("Erro ao fechar o producer de dead-letter: %v", err)
+	}
+	closeSink(auditSink)
+	shutdownHTTPServer(server)
+	log.Println("Consumidor encerrado.")
 }
 
-// createDatabaseAndTable cria o banco de dados e tabela se ainda não existirem
-func createDatabaseAndTable(immuClient client.ImmuClient, dbName string) error {
-	log.Printf("Criando banco de dados '%s' e tabela 'payments', se não existirem...", dbName)
+// newRetryPolicy cria a política de retentativa das gravações no sink
+func newRetryPolicy(immuCfg config.ImmuDBConfig) resilience.RetryPolicy {
+	return resilience.NewRetryPolicy(
+		immuCfg.Retry.MaxAttempts,
+		immuCfg.Retry.InitialBackoff,
+		immuCfg.Retry.MaxBackoff,
+		immuCfg.Retry.Jitter,
+		immuCfg.Retry.ErrorClasses,
+	)
+}
 
-	// Cria o banco de dados, se não existir
-	_, err := immuClient.CreateDatabaseV2(context.Background(), dbName, nil)
+// newConsumer cria o consumidor com o pipeline de decodificação, transformação e gravação, usado
+// tanto no consumo contínuo quanto no replay
+func newConsumer(cfg config.Config, router *routing.Router, auditSink sink.AuditSink, masker *masking.Masker,
+	encryptor *encryption.Encryptor, deadLetter deadletter.Publisher, retryPolicy resilience.RetryPolicy) *consumer2.KafkaConsumer {
+	immuCfg := cfg.ImmuDB
+	return &consumer2.KafkaConsumer{
+		Sink:         auditSink,
+		Router:       router,
+		Decoders:     initializeDecoders(router, cfg.SchemaRegistry),
+		Masker:       masker,
+		Encryptor:    encryptor,
+		DeadLetter:   deadLetter,
+		RetryPolicy:  retryPolicy,
+		Breaker:      resilience.NewCircuitBreaker(auditSink.Name(), immuCfg.Breaker.FailureThreshold, immuCfg.Breaker.OpenTimeout),
+		WriteTimeout: immuCfg.WriteTimeout,
+		BatchSize:    cfg.Batch.Size,
+		BatchTimeout: cfg.Batch.Timeout,
+	}
+}
+
+// forcedExitGrace é o tempo dado ao fechamento das conexões depois de esgotado o prazo de
+// encerramento, antes de o processo ser finalizado
+const forcedExitGrace = 5 * time.Second
+
+// watchShutdown interrompe as gravações em andamento quando o prazo de encerramento se esgota e
+// finaliza o processo se, ainda assim, o fechamento das conexões não terminar
+func watchShutdown(timeout time.Duration, abortDrain context.CancelFunc) {
+	time.AfterFunc(timeout, func() {
+		log.Println("Prazo de encerramento esgotado. Interrompendo as mensagens em andamento; elas serão entregues novamente.")
+		abortDrain()
+	})
+	time.AfterFunc(timeout+forcedExitGrace, func() {
+		log.Println("O consumidor não foi encerrado a tempo. Finalizando o processo.")
+		os.Exit(1)
+	})
+}
+
+// sleep aguarda o tempo informado ou o cancelamento do contexto
+func sleep(ctx context.Context, d time.Duration) {
+	select {
+	case <-ctx.Done():
+	case <-time.After(d):
+	}
+}
+
+// resolveTopics atualiza os metadados do cluster e retorna os tópicos da inscrição
+func resolveTopics(kafkaClient sarama.Client, subscription routing.Subscription) ([]string, error) {
+	if !subscription.Dynamic() {
+		return subscription.Resolve(nil), nil
+	}
+	if err := kafkaClient.RefreshMetadata(); err != nil {
+		return nil, err
+	}
+	available, err := kafkaClient.Topics()
 	if err != nil {
-		if err.Error() != "database already exists" {
-			return fmt.Errorf("erro ao criar banco de dados: %w", err)
+		return nil, err
+	}
+	return subscription.Resolve(available), nil
+}
+
+// watchTopics verifica periodicamente os tópicos que casam com a expressão regular e encerra a
+// sessão de consumo quando eles mudam
+func watchTopics(ctx context.Context, stop context.CancelFunc, kafkaClient sarama.Client, subscription routing.Subscription, current []string, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			topics, err := resolveTopics(kafkaClient, subscription)
+			if err != nil {
+				log.Printf("Erro ao atualizar a lista de tópicos: %v", err)
+				continue
+			}
+			if strings.Join(topics, ",") != strings.Join(current, ",") {
+				log.Printf("Tópicos alterados de %v para %v. Reiniciando a sessão de consumo...", current, topics)
+				stop()
+				return
+			}
 		}
 	}
+}
 
-	// Usa o banco de dados criado
-	_, err = immuClient.UseDatabase(context.Background(), &schema.Database{DatabaseName: dbName})
-	if err != nil {
-		return fmt.Errorf("erro ao usar banco de dados '%s': %w", dbName, err)
-	}
-
-	// Cria a tabela 'payments', se não existir
-	query := `
-		CREATE TABLE IF NOT EXISTS audit_trail (
-			id INTEGER AUTO_INCREMENT, 
-			connector VARCHAR,
-			application VARCHAR,         
-			db_name VARCHAR,           
-			db_schema VARCHAR,         
-			db_table VARCHAR,          
-			event_operation VARCHAR,   
-			event_date TIMESTAMP,      
-			event JSON,                
-			PRIMARY KEY (id)           
-		);
-	`
-	_, err = immuClient.SQLExec(context.Background(), query, nil)
+// initializeRouter cria as rotas dos tópicos a partir do arquivo de rotas. Os tópicos de
+// KAFKA_TRANSACTION_TOPICS e de KAFKA_SCHEMA_TOPICS são tratados como tópicos de transações e de
+// alterações de schema, e os de KAFKA_AVRO_TOPICS sem rota própria são decodificados com o
+// decoder Avro. As rotas sem banco próprio gravam no banco padrão.
+func initializeRouter(routesFile, database string, avroTopics, transactionTopics, schemaTopics []string) *routing.Router {
+	var routes []routing.Route
+	if routesFile != "" {
+		loaded, err := routing.LoadRoutes(routesFile)
+		if err != nil {
+			log.Fatalf("Erro ao carregar as rotas dos tópicos: %v", err)
+		}
+		routes = loaded
+	}
+	avro := make(map[string]bool, len(avroTopics))
+	for _, topic := range avroTopics {
+		avro[topic] = true
+	}
+	kinds := map[string][]string{routing.KindTransaction: transactionTopics, routing.KindSchema: schemaTopics}
+	for _, kind := range []string{routing.KindTransaction, routing.KindSchema} {
+		for _, topic := range kinds[kind] {
+			route := routing.Route{Topic: topic, Kind: kind}
+			if avro[topic] {
+				route.Decoder = routing.DecoderAvro
+				delete(avro, topic)
+			}
+			routes = append(routes, route)
+		}
+	}
+	for _, topic := range avroTopics {
+		if avro[topic] {
+			routes = append(routes, routing.Route{Topic: topic, Decoder: routing.DecoderAvro})
+		}
+	}
+
+	defaults := routing.Route{Kind: routing.KindChange, Decoder: routing.DecoderJSON, Database: database, Table: "audit_trail"}
+	router, err := routing.NewRouter(defaults, routes)
 	if err != nil {
-		return fmt.Errorf("erro ao criar tabela no ImmuDB: %w", err)
+		log.Fatalf("Erro na configuração das rotas dos tópicos: %v", err)
 	}
+	log.Printf("Rotas dos tópicos configuradas: %d", len(routes))
+	return router
+}
 
-	log.Println("Banco de dados e tabela configurados com sucesso.")
+// initializeSink cria o sink configurado para a trilha de auditoria
+func initializeSink(cfg config.SinkConfig, immuCfg config.ImmuDBConfig) sink.AuditSink {
+	switch cfg.Type {
+	case sink.TypePostgres:
+		postgresSink, err := sink.NewPostgresSink(cfg.Postgres.DSN)
+		if err != nil {
+			log.Fatalf("Erro na configuração do PostgreSQL: %v", err)
+		}
+		return postgresSink
+	case sink.TypeJSONL:
+		log.Printf("Configuração do sink JSON Lines - Diretório: %s, Tamanho máximo: %d bytes, Idade máxima: %s",
+			cfg.JSONL.Dir, cfg.JSONL.MaxBytes, cfg.JSONL.MaxAge)
+		return sink.NewJSONLSink(cfg.JSONL.Dir, int64(cfg.JSONL.MaxBytes), cfg.JSONL.MaxAge)
+	default:
+		options, err := immuCfg.ClientOptions()
+		if err != nil {
+			log.Fatalf("Erro na configuração do ImmuDB: %v", err)
+		}
+		return sink.NewImmuDBSink(options, immuCfg.User, immuCfg.Password, immuCfg.VerifyWrites)
+	}
+}
+
+// closeSink encerra as sessões e as conexões do sink
+func closeSink(auditSink sink.AuditSink) {
+	log.Printf("Fechando o sink %s...", auditSink.Name())
+	if err := auditSink.Close(); err != nil {
+		log.Printf("Erro ao fechar o sink %s: %v", auditSink.Name(), err)
+	}
+}
+
+// initializeDeadLetter inicializa o producer do tópico de dead-letter, aguardando o Kafka ficar
+// disponível. Retorna nil se o contexto for cancelado antes disso.
+func initializeDeadLetter(ctx context.Context, brokers []string, topic string, saramaConfig *sarama.Config) deadletter.Publisher {
+	for ctx.Err() == nil {
+		log.Printf("Inicializando o producer de dead-letter - Tópico: %s", topic)
+		publisher, err := deadletter.NewKafkaPublisher(brokers, topic, saramaConfig)
+		if err == nil {
+			log.Println("Producer de dead-letter inicializado com sucesso.")
+			return publisher
+		}
+		log.Printf("Erro ao criar producer de dead-letter: %v. Tentando novamente em 5 segundos...", err)
+		sleep(ctx, 5*time.Second)
+	}
 	return nil
 }
 
-// initializeImmuDB inicializa o cliente ImmuDB
-func initializeImmuDB(host string, port int, user, password string) client.ImmuClient {
-	log.Printf("Inicializando conexão com o ImmuDB - Host: %s, Porta: %d", host, port)
-	immuClient, err := client.NewImmuClient(client.DefaultOptions().WithAddress(host).WithPort(port))
+// startHTTPServer expõe as métricas do Prometheus e os endpoints de saúde no endereço informado
+func startHTTPServer(addr string, checker *health.Checker) *http.Server {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.Handler())
+	mux.HandleFunc("/healthz", checker.Liveness())
+	mux.HandleFunc("/readyz", checker.Readiness())
+	server := &http.Server{Addr: addr, Handler: mux}
+	go func() {
+		log.Printf("Servidor de métricas e saúde iniciado em %s", addr)
+		if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Printf("Erro no servidor de métricas e saúde: %v", err)
+		}
+	}()
+	return server
+}
+
+// shutdownHTTPServer encerra o servidor de métricas e saúde, aguardando as requisições em andamento
+func shutdownHTTPServer(server *http.Server) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := server.Shutdown(ctx); err != nil {
+		log.Printf("Erro ao encerrar o servidor de métricas e saúde: %v", err)
+	}
+}
+
+// startingCheck é a verificação de uma dependência que ainda está sendo inicializada
+func startingCheck(context.Context) error {
+	return errors.New("inicialização em andamento")
+}
+
+// sinkCheck verifica se o banco de destino do sink está disponível para gravação
+func sinkCheck(auditSink sink.AuditSink, database string) health.Check {
+	return func(ctx context.Context) error {
+		return auditSink.Check(ctx, database)
+	}
+}
+
+// initializeDecoders cria os decoders usados pelas rotas. O decoder Avro só é criado, e o schema
+// registry exigido, quando alguma rota o utiliza.
+func initializeDecoders(router *routing.Router, registryCfg config.SchemaRegistryConfig) map[string]decoder.Decoder {
+	decoders := map[string]decoder.Decoder{routing.DecoderJSON: decoder.NewJSONDecoder()}
+	if !router.Uses(routing.DecoderAvro) {
+		return decoders
+	}
+
+	registry, err := decoder.NewSchemaRegistry(decoder.RegistryOptions{
+		URL:      registryCfg.URL,
+		Username: registryCfg.Username,
+		Password: registryCfg.Password,
+	})
 	if err != nil {
-		log.Fatalf("Erro ao conectar ao ImmuDB: %v", err)
+		log.Fatalf("Erro ao configurar o schema registry para os tópicos Avro: %v", err)
 	}
+	decoders[routing.DecoderAvro] = decoder.NewAvroDecoder(registry)
+	return decoders
+}
 
-	log.Println("Autenticando no ImmuDB...")
-	_, err = immuClient.Login(context.Background(), []byte(user), []byte(password))
+// initializeMasker carrega as regras de mascaramento; sem arquivo de regras os eventos são gravados
+// sem mascaramento
+func initializeMasker(cfg config.MaskingConfig) *masking.Masker {
+	if cfg.RulesFile == "" {
+		log.Println("Nenhum arquivo de mascaramento configurado (MASKING_RULES_FILE).")
+		return nil
+	}
+
+	rules, err := masking.LoadRules(cfg.RulesFile)
 	if err != nil {
-		log.Fatalf("Erro ao autenticar no ImmuDB: %v", err)
+		log.Fatalf("Erro ao carregar as regras de mascaramento: %v", err)
+	}
+	masker, err := masking.NewMasker(rules, cfg.Salt)
+	if err != nil {
+		log.Fatalf("Erro na configuração das regras de mascaramento: %v", err)
+	}
+	log.Printf("Regras de mascaramento configuradas: %d", len(rules))
+	return masker
+}
+
+// initializeEncryptor carrega as regras de criptografia, o arquivo de chaves e, se configurado, o
+// repositório de chaves de titulares; sem arquivo de regras as colunas são gravadas sem criptografia
+func initializeEncryptor(cfg config.EncryptionConfig) *encryption.Encryptor {
+	if cfg.RulesFile == "" {
+		log.Println("Nenhum arquivo de criptografia configurado (ENCRYPTION_RULES_FILE).")
+		return nil
 	}
 
-	log.Println("Conexão com o ImmuDB estabelecida com sucesso.")
-	return immuClient
+	rules, err := encryption.LoadRules(cfg.RulesFile)
+	if err != nil {
+		log.Fatalf("Erro ao carregar as regras de criptografia: %v", err)
+	}
+	keyStore, err := encryption.NewFileKeyStore(cfg.KeyStoreFile)
+	if err != nil {
+		log.Fatalf("Erro ao carregar o arquivo de chaves: %v", err)
+	}
+	var subjects *encryption.SubjectKeyStore
+	if cfg.SubjectKeysDir != "" {
+		subjects, err = encryption.NewSubjectKeyStore(cfg.SubjectKeysDir, cfg.SubjectSecret, keyStore)
+		if err != nil {
+			log.Fatalf("Erro ao configurar as chaves de titulares: %v", err)
+		}
+		log.Printf("Chaves de titulares em '%s'.", cfg.SubjectKeysDir)
+	}
+	encryptor, err := encryption.NewEncryptor(rules, keyStore, subjects)
+	if err != nil {
+		log.Fatalf("Erro na configuração das regras de criptografia: %v", err)
+	}
+	log.Printf("Regras de criptografia configuradas: %d", len(rules))
+	return encryptor
 }
@@ -0,0 +1,285 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"github.com/Waelson/audit/audit-consumer/internal/config"
+	consumer2 "github.com/Waelson/audit/audit-consumer/internal/consumer"
+	"github.com/Waelson/audit/audit-consumer/internal/routing"
+	"github.com/Waelson/audit/audit-consumer/internal/sink"
+	"github.com/Waelson/audit/audit-consumer/internal/utils"
+	"log"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/IBM/sarama"
+)
+
+// replayOptions são os parâmetros do subcomando replay
+type replayOptions struct {
+	topic       string
+	partitions  []int32
+	fromOffset  int64
+	fromTime    time.Time
+	toOffset    int64
+	toTime      time.Time
+	idleTimeout time.Duration
+}
+
+// replay relê um intervalo de offsets ou de tempo de um tópico com o mesmo pipeline do consumo
+// contínuo, sem usar o consumer group nem alterar os seus offsets. Os eventos já gravados são
+// descartados pela idempotência do sink.
+//
+//	audit-consumer replay -topic payments.public.payment -from-offset 1200 -to-offset 1500
+//	audit-consumer replay -topic payments.public.payment -partitions 0,2 -from-time 2024-05-01T00:00:00Z
+func replay(args []string) {
+	options := parseReplayOptions(args)
+	log.Printf("Iniciando o replay do tópico %s", options.topic)
+
+	cfg, err := config.Load(utils.GetEnv("CONFIG_FILE", ""))
+	if err != nil {
+		log.Fatalf("Erro na configuração: %v", err)
+	}
+	kafkaCfg, immuCfg := cfg.Kafka, cfg.ImmuDB
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	router := initializeRouter(kafkaCfg.RoutesFile, immuCfg.Database, kafkaCfg.AvroTopics, kafkaCfg.TransactionTopics, kafkaCfg.SchemaTopics)
+	masker := initializeMasker(cfg.Masking)
+	encryptor := initializeEncryptor(cfg.Encryption)
+
+	auditSink := initializeSink(cfg.Sink, immuCfg)
+	if _, ok := auditSink.(sink.TransactionStore); router.HasKind(routing.KindTransaction) && !ok {
+		log.Fatalf("O sink %s não registra transações; remova os tópicos de transações da configuração.", auditSink.Name())
+	}
+	if _, ok := auditSink.(sink.SchemaChangeStore); router.HasKind(routing.KindSchema) && !ok {
+		log.Fatalf("O sink %s não registra alterações de schema; remova os tópicos de alterações de schema da configuração.", auditSink.Name())
+	}
+	if cfg.Sink.Type == sink.TypeJSONL {
+		log.Println("ATENÇÃO: o sink JSON Lines não é idempotente; os eventos relidos serão gravados novamente.")
+	}
+	if err := auditSink.Setup(ctx, router.Databases()); err != nil {
+		log.Fatalf("Erro ao configurar o sink %s: %v", auditSink.Name(), err)
+	}
+
+	saramaConfig, err := kafkaCfg.Sarama()
+	if err != nil {
+		log.Fatalf("Erro na configuração do Kafka: %v", err)
+	}
+	// Os erros da leitura das partições são entregues ao replay, que os registra no log
+	saramaConfig.Consumer.Return.Errors = true
+	kafkaClient, err := sarama.NewClient(kafkaCfg.Brokers, saramaConfig)
+	if err != nil {
+		log.Fatalf("Erro ao criar cliente Kafka: %v", err)
+	}
+	ranges, err := resolveReplayRanges(kafkaClient, options)
+	if err != nil {
+		log.Fatalf("Erro ao calcular os offsets do replay: %v", err)
+	}
+
+	deadLetter := initializeDeadLetter(ctx, kafkaCfg.Brokers, kafkaCfg.DLQTopic, saramaConfig)
+	if deadLetter == nil {
+		kafkaClient.Close()
+		closeSink(auditSink)
+		log.Println("Replay encerrado antes de iniciar a leitura.")
+		os.Exit(1)
+	}
+	kafkaConsumer, err := sarama.NewConsumerFromClient(kafkaClient)
+	if err != nil {
+		log.Fatalf("Erro ao criar o consumidor Kafka: %v", err)
+	}
+
+	consumer := newConsumer(cfg, router, auditSink, masker, encryptor, deadLetter, newRetryPolicy(immuCfg))
+	results := make([]consumer2.ReplayResult, len(ranges))
+	errs := make([]error, len(ranges))
+	var partitions sync.WaitGroup
+	for i, r := range ranges {
+		partitions.Add(1)
+		go func() {
+			defer partitions.Done()
+			results[i], errs[i] = consumer.Replay(ctx, kafkaConsumer, r, options.idleTimeout)
+		}()
+	}
+	partitions.Wait()
+
+	failed := false
+	var processed int64
+	for i, r := range ranges {
+		processed += results[i].Processed
+		if errs[i] != nil {
+			failed = true
+			log.Printf("Replay da partição %d interrompido: %v. Retome com -partitions %d -from-offset %d",
+				r.Partition, errs[i], r.Partition, results[i].Next)
+			continue
+		}
+		log.Printf("Replay da partição %d concluído - Mensagens: %d", r.Partition, results[i].Processed)
+	}
+
+	if err := kafkaConsumer.Close(); err != nil {
+		log.Printf("Erro ao fechar o consumidor Kafka: %v", err)
+	}
+	kafkaClient.Close()
+	if err := deadLetter.Close(); err != nil {
+		log.Printf("Erro ao fechar o producer de dead-letter: %v", err)
+	}
+	closeSink(auditSink)
+
+	log.Printf("Replay do tópico %s encerrado - Mensagens processadas: %d", options.topic, processed)
+	if failed {
+		os.Exit(1)
+	}
+}
+
+// parseReplayOptions lê e valida os parâmetros do subcomando replay
+func parseReplayOptions(args []string) replayOptions {
+	flags := flag.NewFlagSet("replay", flag.ExitOnError)
+	topic := flags.String("topic", "", "tópico relido")
+	partitions := flags.String("partitions", "", "partições relidas, separadas por vírgula (padrão: todas)")
+	fromOffset := flags.Int64("from-offset", -1, "primeiro offset relido em cada partição")
+	fromTime := flags.String("from-time", "", "relê as mensagens a partir deste instante (RFC 3339)")
+	toOffset := flags.Int64("to-offset", -1, "último offset relido em cada partição (padrão: o último no início do replay)")
+	toTime := flags.String("to-time", "", "relê as mensagens anteriores a este instante (RFC 3339)")
+	idleTimeout := flags.Duration("idle-timeout", 10*time.Second, "encerra a partição quando nenhuma mensagem chega neste intervalo")
+	flags.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Uso: audit-consumer replay -topic <tópico> (-from-offset <offset> | -from-time <instante>) [-to-offset <offset> | -to-time <instante>] [opções]")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	options := replayOptions{
+		topic:       *topic,
+		fromOffset:  *fromOffset,
+		toOffset:    *toOffset,
+		idleTimeout: *idleTimeout,
+	}
+	if options.topic == "" {
+		replayUsage(flags, "informe o tópico com -topic")
+	}
+	if (*fromOffset >= 0) == (*fromTime != "") {
+		replayUsage(flags, "informe o início com -from-offset ou -from-time")
+	}
+	if *toOffset >= 0 && *toTime != "" {
+		replayUsage(flags, "informe o fim com -to-offset ou -to-time, não ambos")
+	}
+	if *idleTimeout <= 0 {
+		replayUsage(flags, "-idle-timeout deve ser positivo")
+	}
+	var err error
+	if *fromTime != "" {
+		if options.fromTime, err = time.Parse(time.RFC3339, *fromTime); err != nil {
+			replayUsage(flags, fmt.Sprintf("-from-time inválido: %v", err))
+		}
+	}
+	if *toTime != "" {
+		if options.toTime, err = time.Parse(time.RFC3339, *toTime); err != nil {
+			replayUsage(flags, fmt.Sprintf("-to-time inválido: %v", err))
+		}
+	}
+	if *fromOffset >= 0 && *toOffset >= 0 && *toOffset < *fromOffset {
+		replayUsage(flags, "-to-offset deve ser maior ou igual a -from-offset")
+	}
+	if !options.fromTime.IsZero() && !options.toTime.IsZero() && !options.toTime.After(options.fromTime) {
+		replayUsage(flags, "-to-time deve ser posterior a -from-time")
+	}
+	for _, value := range strings.Split(*partitions, ",") {
+		if value = strings.TrimSpace(value); value == "" {
+			continue
+		}
+		partition, err := strconv.ParseInt(value, 10, 32)
+		if err != nil || partition < 0 {
+			replayUsage(flags, fmt.Sprintf("partição inválida: %q", value))
+		}
+		options.partitions = append(options.partitions, int32(partition))
+	}
+	return options
+}
+
+// replayUsage informa o erro nos parâmetros e encerra o processo
+func replayUsage(flags *flag.FlagSet, message string) {
+	fmt.Fprintf(os.Stderr, "Erro: %s\n", message)
+	flags.Usage()
+	os.Exit(2)
+}
+
+// resolveReplayRanges converte o início e o fim do replay em intervalos de offsets de cada
+// partição, limitados aos offsets ainda retidos pelo Kafka. Sem fim informado, o replay vai até o
+// último offset existente no início da execução.
+func resolveReplayRanges(kafkaClient sarama.Client, options replayOptions) ([]consumer2.ReplayRange, error) {
+	available, err := kafkaClient.Partitions(options.topic)
+	if err != nil {
+		return nil, fmt.Errorf("erro ao listar as partições do tópico %s: %w", options.topic, err)
+	}
+	partitions := options.partitions
+	if len(partitions) == 0 {
+		partitions = available
+	}
+
+	ranges := make([]consumer2.ReplayRange, 0, len(partitions))
+	for _, partition := range partitions {
+		if !containsPartition(available, partition) {
+			return nil, fmt.Errorf("a partição %d não existe no tópico %s", partition, options.topic)
+		}
+		oldest, err := kafkaClient.GetOffset(options.topic, partition, sarama.OffsetOldest)
+		if err != nil {
+			return nil, fmt.Errorf("erro ao obter o primeiro offset da partição %d: %w", partition, err)
+		}
+		newest, err := kafkaClient.GetOffset(options.topic, partition, sarama.OffsetNewest)
+		if err != nil {
+			return nil, fmt.Errorf("erro ao obter o último offset da partição %d: %w", partition, err)
+		}
+
+		start := options.fromOffset
+		if !options.fromTime.IsZero() {
+			if start, err = offsetForTime(kafkaClient, options.topic, partition, options.fromTime, newest); err != nil {
+				return nil, err
+			}
+		}
+		if start < oldest {
+			log.Printf("O offset %d da partição %d não está mais retido pelo Kafka; o replay começa em %d.", start, partition, oldest)
+			start = oldest
+		}
+
+		end := newest
+		switch {
+		case options.toOffset >= 0:
+			end = min(options.toOffset+1, newest)
+		case !options.toTime.IsZero():
+			if end, err = offsetForTime(kafkaClient, options.topic, partition, options.toTime, newest); err != nil {
+				return nil, err
+			}
+		}
+
+		ranges = append(ranges, consumer2.ReplayRange{Topic: options.topic, Partition: partition, Start: start, End: end})
+	}
+	return ranges, nil
+}
+
+// offsetForTime retorna o offset da primeira mensagem da partição com timestamp igual ou posterior
+// ao instante informado, ou newest se não houver mensagem posterior
+func offsetForTime(kafkaClient sarama.Client, topic string, partition int32, instant time.Time, newest int64) (int64, error) {
+	offset, err := kafkaClient.GetOffset(topic, partition, instant.UnixMilli())
+	if err != nil {
+		return 0, fmt.Errorf("erro ao obter o offset da partição %d em %s: %w", partition, instant.Format(time.RFC3339), err)
+	}
+	if offset < 0 {
+		return newest, nil
+	}
+	return offset, nil
+}
+
+// containsPartition indica se a partição está na lista
+func containsPartition(partitions []int32, partition int32) bool {
+	for _, p := range partitions {
+		if p == partition {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,406 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"github.com/IBM/sarama"
+	"github.com/Waelson/audit/audit-consumer/internal/resilience"
+	"github.com/Waelson/audit/audit-consumer/internal/sink"
+	"gopkg.in/yaml.v3"
+	"io"
+	"net"
+	"os"
+	"time"
+)
+
+// Config é a configuração do audit-consumer. Ela é lida de um arquivo YAML ou JSON opcional
+// (CONFIG_FILE), sobreposta pelas variáveis de ambiente e validada na inicialização.
+type Config struct {
+	Kafka          KafkaConfig          `yaml:"kafka"`
+	ImmuDB         ImmuDBConfig         `yaml:"immudb"`
+	Sink           SinkConfig           `yaml:"sink"`
+	SchemaRegistry SchemaRegistryConfig `yaml:"schema_registry"`
+	Batch          BatchConfig          `yaml:"batch"`
+	Transactions   TransactionConfig    `yaml:"transactions"`
+	Masking        MaskingConfig        `yaml:"masking"`
+	Encryption     EncryptionConfig     `yaml:"encryption"`
+	HTTP           HTTPConfig           `yaml:"http"`
+	Shutdown       ShutdownConfig       `yaml:"shutdown"`
+}
+
+// KafkaConfig é a configuração da conexão com o Kafka e do consumer group
+type KafkaConfig struct {
+	Brokers  []string `yaml:"brokers"`
+	ClientID string   `yaml:"client_id"`
+	// Version é a versão do protocolo do Kafka usada pelo cliente, ex.: 2.6.0
+	Version              string        `yaml:"version"`
+	Topics               []string      `yaml:"topics"`
+	TopicPattern         string        `yaml:"topic_pattern"`
+	TopicRefreshInterval time.Duration `yaml:"topic_refresh_interval"`
+	RoutesFile           string        `yaml:"routes_file"`
+	AvroTopics           []string      `yaml:"avro_topics"`
+	TransactionTopics    []string      `yaml:"transaction_topics"`
+	SchemaTopics         []string      `yaml:"schema_topics"`
+	ConsumerGroup        string        `yaml:"consumer_group"`
+	DLQTopic             string        `yaml:"dlq_topic"`
+	// InitialOffset é o offset usado pelas partições sem offset confirmado: oldest ou newest
+	InitialOffset     string        `yaml:"initial_offset"`
+	SessionTimeout    time.Duration `yaml:"session_timeout"`
+	HeartbeatInterval time.Duration `yaml:"heartbeat_interval"`
+	// RebalanceStrategy é a estratégia de distribuição das partições: range, roundrobin ou sticky
+	RebalanceStrategy string     `yaml:"rebalance_strategy"`
+	SASL              SASLConfig `yaml:"sasl"`
+	TLS               TLSConfig  `yaml:"tls"`
+}
+
+// SASLConfig é a autenticação SASL no Kafka; sem mecanismo a autenticação fica desativada
+type SASLConfig struct {
+	// Mechanism é o mecanismo SASL: PLAIN, SCRAM-SHA-256 ou SCRAM-SHA-512
+	Mechanism string `yaml:"mechanism"`
+	Username  string `yaml:"username"`
+	Password  string `yaml:"password"`
+}
+
+// TLSConfig é a configuração de TLS de uma conexão. O certificado e a chave do cliente são
+// opcionais e, quando informados, habilitam a autenticação mútua.
+type TLSConfig struct {
+	Enabled            bool   `yaml:"enabled"`
+	CAFile             string `yaml:"ca_file"`
+	CertFile           string `yaml:"cert_file"`
+	KeyFile            string `yaml:"key_file"`
+	ServerName         string `yaml:"server_name"`
+	InsecureSkipVerify bool   `yaml:"insecure_skip_verify"`
+}
+
+// ImmuDBConfig é a configuração da conexão com o ImmuDB e da política de gravação
+type ImmuDBConfig struct {
+	Host     string `yaml:"host"`
+	Port     int    `yaml:"port"`
+	User     string `yaml:"user"`
+	Password string `yaml:"password"`
+	// Database é o banco de destino das rotas que não informam um banco próprio
+	Database     string        `yaml:"database"`
+	WriteTimeout time.Duration `yaml:"write_timeout"`
+	// VerifyWrites confirma cada gravação com uma prova criptográfica contra o estado confiável
+	VerifyWrites bool `yaml:"verify_writes"`
+	// StateDir é o diretório em que o cliente persiste o último estado confiável de cada banco
+	StateDir string        `yaml:"state_dir"`
+	TLS      TLSConfig     `yaml:"tls"`
+	Retry    RetryConfig   `yaml:"retry"`
+	Breaker  BreakerConfig `yaml:"breaker"`
+}
+
+// SinkConfig é o armazenamento da trilha de auditoria. O banco padrão, o timeout de escrita, a
+// retentativa e o circuit breaker de ImmuDBConfig valem para todos os sinks.
+type SinkConfig struct {
+	// Type é o sink usado: immudb, postgres ou jsonl
+	Type     string             `yaml:"type"`
+	Postgres PostgresSinkConfig `yaml:"postgres"`
+	JSONL    JSONLSinkConfig    `yaml:"jsonl"`
+}
+
+// PostgresSinkConfig é a conexão do sink PostgreSQL
+type PostgresSinkConfig struct {
+	DSN string `yaml:"dsn"`
+}
+
+// JSONLSinkConfig é o diretório e a troca dos arquivos do sink JSON Lines
+type JSONLSinkConfig struct {
+	Dir      string        `yaml:"dir"`
+	MaxBytes int           `yaml:"max_bytes"`
+	MaxAge   time.Duration `yaml:"max_age"`
+}
+
+// RetryConfig é a política de retentativa das gravações no sink
+type RetryConfig struct {
+	MaxAttempts    int           `yaml:"max_attempts"`
+	InitialBackoff time.Duration `yaml:"initial_backoff"`
+	MaxBackoff     time.Duration `yaml:"max_backoff"`
+	Jitter         float64       `yaml:"jitter"`
+	ErrorClasses   []string      `yaml:"error_classes"`
+}
+
+// BreakerConfig é a configuração do circuit breaker das gravações no ImmuDB
+type BreakerConfig struct {
+	FailureThreshold int           `yaml:"failure_threshold"`
+	OpenTimeout      time.Duration `yaml:"open_timeout"`
+}
+
+// SchemaRegistryConfig é o schema registry usado pelos tópicos Avro
+type SchemaRegistryConfig struct {
+	URL      string `yaml:"url"`
+	Username string `yaml:"username"`
+	Password string `yaml:"password"`
+}
+
+// BatchConfig é o modo em lote: tamanhos menores ou iguais a 1 gravam cada mensagem em sua
+// própria transação
+type BatchConfig struct {
+	Size    int           `yaml:"size"`
+	Timeout time.Duration `yaml:"timeout"`
+}
+
+// TransactionConfig é a validação das transações anunciadas nos tópicos de transações
+type TransactionConfig struct {
+	CheckInterval time.Duration `yaml:"check_interval"`
+	Timeout       time.Duration `yaml:"timeout"`
+}
+
+// MaskingConfig é o mascaramento de dados sensíveis
+type MaskingConfig struct {
+	RulesFile string `yaml:"rules_file"`
+	Salt      string `yaml:"salt"`
+}
+
+// EncryptionConfig é a criptografia de colunas com chaves por tenant e por titular
+type EncryptionConfig struct {
+	RulesFile      string `yaml:"rules_file"`
+	KeyStoreFile   string `yaml:"keystore_file"`
+	SubjectKeysDir string `yaml:"subject_keys_dir"`
+	SubjectSecret  string `yaml:"subject_secret"`
+}
+
+// HTTPConfig é o servidor das métricas e dos endpoints de saúde
+type HTTPConfig struct {
+	Addr               string        `yaml:"addr"`
+	HealthCheckTimeout time.Duration `yaml:"health_check_timeout"`
+}
+
+// ShutdownConfig é o encerramento do consumidor ao receber SIGTERM ou SIGINT
+type ShutdownConfig struct {
+	// Timeout é o prazo para concluir as mensagens em andamento, confirmar os offsets e fechar as
+	// conexões; ao final dele as gravações pendentes são interrompidas
+	Timeout time.Duration `yaml:"timeout"`
+}
+
+// Valores aceitos nas opções enumeradas
+const (
+	OffsetOldest = "oldest"
+	OffsetNewest = "newest"
+
+	StrategyRange      = "range"
+	StrategyRoundRobin = "roundrobin"
+	StrategySticky     = "sticky"
+
+	MechanismPlain       = "PLAIN"
+	MechanismSCRAMSHA256 = "SCRAM-SHA-256"
+	MechanismSCRAMSHA512 = "SCRAM-SHA-512"
+)
+
+// defaultTopic é o tópico consumido quando nenhum tópico ou expressão regular é informado
+const defaultTopic = "audit-trail"
+
+// Default retorna a configuração padrão, usada para os campos omitidos no arquivo e no ambiente
+func Default() Config {
+	return Config{
+		Kafka: KafkaConfig{
+			Brokers:              []string{"localhost:9092"},
+			ClientID:             "audit-consumer",
+			Version:              "2.6.0",
+			TopicRefreshInterval: time.Minute,
+			ConsumerGroup:        "audit-trail-consumer-group",
+			DLQTopic:             "audit-trail-dlq",
+			InitialOffset:        OffsetNewest,
+			SessionTimeout:       10 * time.Second,
+			HeartbeatInterval:    3 * time.Second,
+			RebalanceStrategy:    StrategyRoundRobin,
+		},
+		ImmuDB: ImmuDBConfig{
+			Host:         "localhost",
+			Port:         3322,
+			User:         "immudb",
+			Password:     "immudb",
+			Database:     "audit_db",
+			WriteTimeout: 10 * time.Second,
+			VerifyWrites: true,
+			StateDir:     ".",
+			Retry: RetryConfig{
+				MaxAttempts:    5,
+				InitialBackoff: 200 * time.Millisecond,
+				MaxBackoff:     10 * time.Second,
+				Jitter:         0.2,
+				ErrorClasses:   resilience.DefaultRetryableClasses,
+			},
+			Breaker: BreakerConfig{
+				FailureThreshold: 5,
+				OpenTimeout:      30 * time.Second,
+			},
+		},
+		Sink: SinkConfig{
+			Type: sink.TypeImmuDB,
+			JSONL: JSONLSinkConfig{
+				MaxBytes: 100 << 20,
+				MaxAge:   24 * time.Hour,
+			},
+		},
+		Batch: BatchConfig{
+			Size:    1,
+			Timeout: 500 * time.Millisecond,
+		},
+		Transactions: TransactionConfig{
+			CheckInterval: 10 * time.Second,
+			Timeout:       5 * time.Minute,
+		},
+		HTTP: HTTPConfig{
+			Addr:               ":9102",
+			HealthCheckTimeout: 2 * time.Second,
+		},
+		Shutdown: ShutdownConfig{
+			Timeout: 30 * time.Second,
+		},
+	}
+}
+
+// Load lê a configuração do arquivo informado (opcional), aplica as variáveis de ambiente e
+// valida o resultado. Todos os problemas encontrados são retornados de uma só vez.
+func Load(path string) (Config, error) {
+	cfg := Default()
+	if path != "" {
+		if err := cfg.readFile(path); err != nil {
+			return cfg, err
+		}
+	}
+	if err := cfg.applyEnv(); err != nil {
+		return cfg, fmt.Errorf("variáveis de ambiente inválidas:\n%w", err)
+	}
+	if len(cfg.Kafka.Topics) == 0 && cfg.Kafka.TopicPattern == "" {
+		cfg.Kafka.Topics = []string{defaultTopic}
+	}
+	if err := cfg.Validate(); err != nil {
+		return cfg, fmt.Errorf("configuração inválida:\n%w", err)
+	}
+	return cfg, nil
+}
+
+// readFile sobrepõe a configuração com o conteúdo do arquivo. Como JSON é um subconjunto de
+// YAML, os dois formatos são lidos pelo mesmo decoder; campos desconhecidos são rejeitados para
+// que erros de digitação não passem despercebidos.
+func (c *Config) readFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("erro ao ler o arquivo de configuração '%s': %w", path, err)
+	}
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(c); err != nil && !errors.Is(err, io.EOF) {
+		return fmt.Errorf("erro ao decodificar o arquivo de configuração '%s': %w", path, err)
+	}
+	return nil
+}
+
+// Validate verifica a configuração e retorna um erro por campo inválido
+func (c Config) Validate() error {
+	var errs []error
+	check := func(ok bool, field, format string, args ...interface{}) {
+		if !ok {
+			errs = append(errs, fmt.Errorf("%s: %s", field, fmt.Sprintf(format, args...)))
+		}
+	}
+
+	kafka := c.Kafka
+	check(len(kafka.Brokers) > 0, "kafka.brokers", "ao menos um broker deve ser informado")
+	for _, broker := range kafka.Brokers {
+		_, _, err := net.SplitHostPort(broker)
+		check(err == nil, "kafka.brokers", "broker '%s' deve estar no formato host:porta", broker)
+	}
+	_, err := sarama.ParseKafkaVersion(kafka.Version)
+	check(err == nil, "kafka.version", "versão '%s' inválida", kafka.Version)
+	check(kafka.TopicRefreshInterval > 0, "kafka.topic_refresh_interval", "deve ser maior que zero")
+	check(kafka.ConsumerGroup != "", "kafka.consumer_group", "deve ser informado")
+	check(kafka.DLQTopic != "", "kafka.dlq_topic", "deve ser informado")
+	check(kafka.InitialOffset == OffsetOldest || kafka.InitialOffset == OffsetNewest,
+		"kafka.initial_offset", "'%s' inválido, use %s ou %s", kafka.InitialOffset, OffsetOldest, OffsetNewest)
+	check(kafka.SessionTimeout > 0, "kafka.session_timeout", "deve ser maior que zero")
+	check(kafka.HeartbeatInterval > 0 && kafka.HeartbeatInterval < kafka.SessionTimeout,
+		"kafka.heartbeat_interval", "deve ser maior que zero e menor que kafka.session_timeout")
+	check(kafka.RebalanceStrategy == StrategyRange || kafka.RebalanceStrategy == StrategyRoundRobin || kafka.RebalanceStrategy == StrategySticky,
+		"kafka.rebalance_strategy", "'%s' inválida, use %s, %s ou %s", kafka.RebalanceStrategy, StrategyRange, StrategyRoundRobin, StrategySticky)
+	switch kafka.SASL.Mechanism {
+	case "":
+	case MechanismPlain, MechanismSCRAMSHA256, MechanismSCRAMSHA512:
+		check(kafka.SASL.Username != "", "kafka.sasl.username", "deve ser informado com o mecanismo %s", kafka.SASL.Mechanism)
+		check(kafka.SASL.Password != "", "kafka.sasl.password", "deve ser informada com o mecanismo %s", kafka.SASL.Mechanism)
+	default:
+		check(false, "kafka.sasl.mechanism", "'%s' inválido, use %s, %s ou %s",
+			kafka.SASL.Mechanism, MechanismPlain, MechanismSCRAMSHA256, MechanismSCRAMSHA512)
+	}
+	errs = append(errs, kafka.TLS.validate("kafka.tls")...)
+
+	immu := c.ImmuDB
+	check(immu.Host != "", "immudb.host", "deve ser informado")
+	check(immu.Port > 0 && immu.Port <= 65535, "immudb.port", "%d fora do intervalo 1 a 65535", immu.Port)
+	check(immu.User != "", "immudb.user", "deve ser informado")
+	check(immu.Database != "", "immudb.database", "deve ser informado")
+	check(immu.WriteTimeout >= 0, "immudb.write_timeout", "não pode ser negativo")
+	check(immu.StateDir != "", "immudb.state_dir", "deve ser informado")
+	errs = append(errs, immu.TLS.validate("immudb.tls")...)
+	check(immu.Retry.MaxAttempts >= 1, "immudb.retry.max_attempts", "deve ser ao menos 1")
+	check(immu.Retry.InitialBackoff > 0, "immudb.retry.initial_backoff", "deve ser maior que zero")
+	check(immu.Retry.MaxBackoff >= immu.Retry.InitialBackoff, "immudb.retry.max_backoff", "não pode ser menor que immudb.retry.initial_backoff")
+	check(immu.Retry.Jitter >= 0 && immu.Retry.Jitter <= 1, "immudb.retry.jitter", "deve estar entre 0 e 1")
+	for _, class := range immu.Retry.ErrorClasses {
+		check(knownErrorClasses[class], "immudb.retry.error_classes", "classe de erro '%s' desconhecida", class)
+	}
+	check(immu.Breaker.FailureThreshold >= 1, "immudb.breaker.failure_threshold", "deve ser ao menos 1")
+	check(immu.Breaker.OpenTimeout > 0, "immudb.breaker.open_timeout", "deve ser maior que zero")
+
+	switch c.Sink.Type {
+	case sink.TypeImmuDB:
+	case sink.TypePostgres:
+		check(c.Sink.Postgres.DSN != "", "sink.postgres.dsn", "deve ser informado para o sink %s", sink.TypePostgres)
+	case sink.TypeJSONL:
+		check(c.Sink.JSONL.Dir != "", "sink.jsonl.dir", "deve ser informado para o sink %s", sink.TypeJSONL)
+		check(c.Sink.JSONL.MaxBytes > 0, "sink.jsonl.max_bytes", "deve ser maior que zero")
+		check(c.Sink.JSONL.MaxAge >= 0, "sink.jsonl.max_age", "não pode ser negativo")
+	default:
+		check(false, "sink.type", "'%s' inválido, use %s, %s ou %s", c.Sink.Type,
+			sink.TypeImmuDB, sink.TypePostgres, sink.TypeJSONL)
+	}
+
+	check(c.Batch.Size <= 1 || c.Batch.Timeout > 0, "batch.timeout", "deve ser maior que zero no modo em lote")
+	check(c.Transactions.CheckInterval > 0, "transactions.check_interval", "deve ser maior que zero")
+	check(c.Transactions.Timeout > 0, "transactions.timeout", "deve ser maior que zero")
+	check(c.Encryption.RulesFile == "" || c.Encryption.KeyStoreFile != "",
+		"encryption.keystore_file", "deve ser informado para usar criptografia")
+	check(c.Encryption.SubjectKeysDir == "" || c.Encryption.SubjectSecret != "",
+		"encryption.subject_secret", "deve ser informado com encryption.subject_keys_dir")
+	check(c.HTTP.Addr != "", "http.addr", "deve ser informado")
+	check(c.HTTP.HealthCheckTimeout > 0, "http.health_check_timeout", "deve ser maior que zero")
+	check(c.Shutdown.Timeout > 0, "shutdown.timeout", "deve ser maior que zero")
+
+	return errors.Join(errs...)
+}
+
+// validate verifica a configuração de TLS
+func (t TLSConfig) validate(field string) []error {
+	if !t.Enabled {
+		return nil
+	}
+	var errs []error
+	if (t.CertFile == "") != (t.KeyFile == "") {
+		errs = append(errs, fmt.Errorf("%s: cert_file e key_file devem ser informados juntos", field))
+	}
+	files := [][2]string{{"ca_file", t.CAFile}, {"cert_file", t.CertFile}, {"key_file", t.KeyFile}}
+	for _, file := range files {
+		if file[1] == "" {
+			continue
+		}
+		if _, err := os.Stat(file[1]); err != nil {
+			errs = append(errs, fmt.Errorf("%s.%s: %w", field, file[0], err))
+		}
+	}
+	return errs
+}
+
+// knownErrorClasses são as classes de erro aceitas na política de retentativa
+var knownErrorClasses = map[string]bool{
+	resilience.ErrorClassUnavailable:       true,
+	resilience.ErrorClassTimeout:           true,
+	resilience.ErrorClassResourceExhausted: true,
+	resilience.ErrorClassAborted:           true,
+	resilience.ErrorClassUnauthenticated:   true,
+	resilience.ErrorClassInvalid:           true,
+	resilience.ErrorClassCanceled:          true,
+	resilience.ErrorClassUnknown:           true,
+}
@@ -0,0 +1,73 @@
+package config
+
+import (
+	"github.com/Waelson/audit/audit-consumer/internal/sink"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDefaultIsValid(t *testing.T) {
+	if err := Default().Validate(); err != nil {
+		t.Errorf("Validate() = %v, esperado a configuração padrão válida", err)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	missing := filepath.Join(t.TempDir(), "ausente.pem")
+	tests := []struct {
+		name   string
+		modify func(*Config)
+		fields []string
+	}{
+		{name: "broker sem porta", modify: func(c *Config) { c.Kafka.Brokers = []string{"kafka"} }, fields: []string{"kafka.brokers"}},
+		{name: "sem brokers", modify: func(c *Config) { c.Kafka.Brokers = nil }, fields: []string{"kafka.brokers"}},
+		{name: "versão inválida", modify: func(c *Config) { c.Kafka.Version = "x" }, fields: []string{"kafka.version"}},
+		{name: "offset inicial inválido", modify: func(c *Config) { c.Kafka.InitialOffset = "latest" }, fields: []string{"kafka.initial_offset"}},
+		{name: "heartbeat maior que a sessão", modify: func(c *Config) { c.Kafka.HeartbeatInterval = time.Minute }, fields: []string{"kafka.heartbeat_interval"}},
+		{name: "estratégia inválida", modify: func(c *Config) { c.Kafka.RebalanceStrategy = "cooperative" }, fields: []string{"kafka.rebalance_strategy"}},
+		{name: "SASL sem credenciais", modify: func(c *Config) { c.Kafka.SASL.Mechanism = MechanismSCRAMSHA512 },
+			fields: []string{"kafka.sasl.username", "kafka.sasl.password"}},
+		{name: "mecanismo SASL inválido", modify: func(c *Config) { c.Kafka.SASL.Mechanism = "GSSAPI" }, fields: []string{"kafka.sasl.mechanism"}},
+		{name: "TLS com certificado sem chave", modify: func(c *Config) { c.Kafka.TLS = TLSConfig{Enabled: true, CertFile: missing} },
+			fields: []string{"kafka.tls: cert_file e key_file", "kafka.tls.cert_file"}},
+		{name: "TLS desativado ignora os arquivos", modify: func(c *Config) { c.ImmuDB.TLS = TLSConfig{CAFile: missing} }},
+		{name: "porta fora do intervalo", modify: func(c *Config) { c.ImmuDB.Port = 70000 }, fields: []string{"immudb.port"}},
+		{name: "backoff máximo menor que o inicial", modify: func(c *Config) { c.ImmuDB.Retry.MaxBackoff = time.Millisecond }, fields: []string{"immudb.retry.max_backoff"}},
+		{name: "jitter fora do intervalo", modify: func(c *Config) { c.ImmuDB.Retry.Jitter = 1.5 }, fields: []string{"immudb.retry.jitter"}},
+		{name: "classe de erro desconhecida", modify: func(c *Config) { c.ImmuDB.Retry.ErrorClasses = []string{"flaky"} }, fields: []string{"immudb.retry.error_classes"}},
+		{name: "sink desconhecido", modify: func(c *Config) { c.Sink.Type = "memory" }, fields: []string{"sink.type"}},
+		{name: "sink PostgreSQL sem DSN", modify: func(c *Config) { c.Sink.Type = sink.TypePostgres }, fields: []string{"sink.postgres.dsn"}},
+		{name: "sink JSON Lines sem diretório", modify: func(c *Config) { c.Sink.Type = sink.TypeJSONL }, fields: []string{"sink.jsonl.dir"}},
+		{name: "lote sem timeout", modify: func(c *Config) { c.Batch = BatchConfig{Size: 100} }, fields: []string{"batch.timeout"}},
+		{name: "criptografia sem chaves", modify: func(c *Config) { c.Encryption.RulesFile = "encryption.json" }, fields: []string{"encryption.keystore_file"}},
+		{name: "chaves de titulares sem segredo", modify: func(c *Config) { c.Encryption.SubjectKeysDir = "subjects" }, fields: []string{"encryption.subject_secret"}},
+		{name: "vários campos", modify: func(c *Config) { c.Kafka.ConsumerGroup = ""; c.Shutdown.Timeout = 0 },
+			fields: []string{"kafka.consumer_group", "shutdown.timeout"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := Default()
+			tt.modify(&cfg)
+			err := cfg.Validate()
+			if len(tt.fields) == 0 {
+				if err != nil {
+					t.Errorf("Validate() = %v, esperado nenhum erro", err)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatalf("Validate() não retornou erro, esperado %v", tt.fields)
+			}
+			if got := len(strings.Split(err.Error(), "\n")); got != len(tt.fields) {
+				t.Errorf("Validate() = %v, esperado %d erro(s)", err, len(tt.fields))
+			}
+			for _, field := range tt.fields {
+				if !strings.Contains(err.Error(), field) {
+					t.Errorf("Validate() = %v, esperado erro em %s", err, field)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,173 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// applyEnv sobrepõe a configuração com as variáveis de ambiente definidas. Valores que não podem
+// ser convertidos são reportados em vez de substituídos silenciosamente pelo padrão.
+func (c *Config) applyEnv() error {
+	env := &envReader{}
+
+	kafka := &c.Kafka
+	env.list("KAFKA_BROKERS", &kafka.Brokers)
+	env.str("KAFKA_CLIENT_ID", &kafka.ClientID)
+	env.str("KAFKA_VERSION", &kafka.Version)
+	// KAFKA_TOPIC é mantida por compatibilidade e tem precedência menor que KAFKA_TOPICS
+	env.list("KAFKA_TOPIC", &kafka.Topics)
+	env.list("KAFKA_TOPICS", &kafka.Topics)
+	env.str("KAFKA_TOPIC_PATTERN", &kafka.TopicPattern)
+	env.duration("KAFKA_TOPIC_REFRESH_INTERVAL", &kafka.TopicRefreshInterval)
+	env.str("KAFKA_TOPIC_ROUTES_FILE", &kafka.RoutesFile)
+	env.list("KAFKA_AVRO_TOPICS", &kafka.AvroTopics)
+	env.list("KAFKA_TRANSACTION_TOPICS", &kafka.TransactionTopics)
+	env.list("KAFKA_SCHEMA_TOPICS", &kafka.SchemaTopics)
+	env.str("KAFKA_CONSUMER_GROUP", &kafka.ConsumerGroup)
+	env.str("KAFKA_DLQ_TOPIC", &kafka.DLQTopic)
+	env.str("KAFKA_INITIAL_OFFSET", &kafka.InitialOffset)
+	env.duration("KAFKA_SESSION_TIMEOUT", &kafka.SessionTimeout)
+	env.duration("KAFKA_HEARTBEAT_INTERVAL", &kafka.HeartbeatInterval)
+	env.str("KAFKA_REBALANCE_STRATEGY", &kafka.RebalanceStrategy)
+	env.str("KAFKA_SASL_MECHANISM", &kafka.SASL.Mechanism)
+	env.str("KAFKA_SASL_USERNAME", &kafka.SASL.Username)
+	env.str("KAFKA_SASL_PASSWORD", &kafka.SASL.Password)
+	env.tls("KAFKA_TLS", &kafka.TLS)
+
+	immu := &c.ImmuDB
+	env.str("IMMUD_HOST", &immu.Host)
+	env.int("IMMUD_PORT", &immu.Port)
+	env.str("IMMUD_USER", &immu.User)
+	env.str("IMMUD_PASSWORD", &immu.Password)
+	env.str("IMMUD_DB", &immu.Database)
+	env.duration("IMMUD_WRITE_TIMEOUT", &immu.WriteTimeout)
+	env.bool("IMMUD_VERIFY_WRITES", &immu.VerifyWrites)
+	env.str("IMMUD_STATE_DIR", &immu.StateDir)
+	env.tls("IMMUD_TLS", &immu.TLS)
+	env.int("IMMUD_RETRY_MAX_ATTEMPTS", &immu.Retry.MaxAttempts)
+	env.duration("IMMUD_RETRY_INITIAL_BACKOFF", &immu.Retry.InitialBackoff)
+	env.duration("IMMUD_RETRY_MAX_BACKOFF", &immu.Retry.MaxBackoff)
+	env.float("IMMUD_RETRY_JITTER", &immu.Retry.Jitter)
+	env.list("IMMUD_RETRY_ERROR_CLASSES", &immu.Retry.ErrorClasses)
+	env.int("IMMUD_BREAKER_FAILURE_THRESHOLD", &immu.Breaker.FailureThreshold)
+	env.duration("IMMUD_BREAKER_OPEN_TIMEOUT", &immu.Breaker.OpenTimeout)
+
+	env.str("SINK_TYPE", &c.Sink.Type)
+	env.str("SINK_POSTGRES_DSN", &c.Sink.Postgres.DSN)
+	env.str("SINK_JSONL_DIR", &c.Sink.JSONL.Dir)
+	env.int("SINK_JSONL_MAX_BYTES", &c.Sink.JSONL.MaxBytes)
+	env.duration("SINK_JSONL_MAX_AGE", &c.Sink.JSONL.MaxAge)
+
+	env.str("SCHEMA_REGISTRY_URL", &c.SchemaRegistry.URL)
+	env.str("SCHEMA_REGISTRY_USERNAME", &c.SchemaRegistry.Username)
+	env.str("SCHEMA_REGISTRY_PASSWORD", &c.SchemaRegistry.Password)
+
+	env.int("BATCH_SIZE", &c.Batch.Size)
+	env.duration("BATCH_TIMEOUT", &c.Batch.Timeout)
+
+	env.duration("TRANSACTION_CHECK_INTERVAL", &c.Transactions.CheckInterval)
+	env.duration("TRANSACTION_TIMEOUT", &c.Transactions.Timeout)
+
+	env.str("MASKING_RULES_FILE", &c.Masking.RulesFile)
+	env.str("MASKING_SALT", &c.Masking.Salt)
+
+	env.str("ENCRYPTION_RULES_FILE", &c.Encryption.RulesFile)
+	env.str("ENCRYPTION_KEYSTORE_FILE", &c.Encryption.KeyStoreFile)
+	env.str("ENCRYPTION_SUBJECT_KEYS_DIR", &c.Encryption.SubjectKeysDir)
+	env.str("ENCRYPTION_SUBJECT_SECRET", &c.Encryption.SubjectSecret)
+
+	env.str("METRICS_ADDR", &c.HTTP.Addr)
+	env.duration("HEALTH_CHECK_TIMEOUT", &c.HTTP.HealthCheckTimeout)
+
+	env.duration("SHUTDOWN_TIMEOUT", &c.Shutdown.Timeout)
+
+	return errors.Join(env.errs...)
+}
+
+// envReader lê as variáveis de ambiente definidas, acumulando os erros de conversão
+type envReader struct {
+	errs []error
+}
+
+// fail registra um valor que não pôde ser convertido
+func (e *envReader) fail(key, value string, err error) {
+	e.errs = append(e.errs, fmt.Errorf("%s: valor '%s' inválido: %w", key, value, err))
+}
+
+func (e *envReader) str(key string, target *string) {
+	if value, ok := os.LookupEnv(key); ok {
+		*target = value
+	}
+}
+
+func (e *envReader) int(key string, target *int) {
+	if value, ok := os.LookupEnv(key); ok {
+		parsed, err := strconv.Atoi(strings.TrimSpace(value))
+		if err != nil {
+			e.fail(key, value, err)
+			return
+		}
+		*target = parsed
+	}
+}
+
+func (e *envReader) float(key string, target *float64) {
+	if value, ok := os.LookupEnv(key); ok {
+		parsed, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+		if err != nil {
+			e.fail(key, value, err)
+			return
+		}
+		*target = parsed
+	}
+}
+
+func (e *envReader) bool(key string, target *bool) {
+	if value, ok := os.LookupEnv(key); ok {
+		parsed, err := strconv.ParseBool(strings.TrimSpace(value))
+		if err != nil {
+			e.fail(key, value, err)
+			return
+		}
+		*target = parsed
+	}
+}
+
+// duration lê uma duração no formato do Go, ex.: "500ms", "30s"
+func (e *envReader) duration(key string, target *time.Duration) {
+	if value, ok := os.LookupEnv(key); ok {
+		parsed, err := time.ParseDuration(strings.TrimSpace(value))
+		if err != nil {
+			e.fail(key, value, err)
+			return
+		}
+		*target = parsed
+	}
+}
+
+// list lê uma lista separada por vírgulas, ignorando itens vazios
+func (e *envReader) list(key string, target *[]string) {
+	if value, ok := os.LookupEnv(key); ok {
+		items := make([]string, 0)
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+		*target = items
+	}
+}
+
+// tls lê a configuração de TLS das variáveis com o prefixo informado
+func (e *envReader) tls(prefix string, target *TLSConfig) {
+	e.bool(prefix+"_ENABLED", &target.Enabled)
+	e.str(prefix+"_CA_FILE", &target.CAFile)
+	e.str(prefix+"_CERT_FILE", &target.CertFile)
+	e.str(prefix+"_KEY_FILE", &target.KeyFile)
+	e.str(prefix+"_SERVER_NAME", &target.ServerName)
+	e.bool(prefix+"_INSECURE_SKIP_VERIFY", &target.InsecureSkipVerify)
+}
@@ -0,0 +1,22 @@
+package config
+
+import (
+	"fmt"
+	"github.com/codenotary/immudb/pkg/client"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+)
+
+// ClientOptions cria as opções de conexão com o ImmuDB. Com TLS habilitado a conexão gRPC usa a
+// configuração de TLS informada no lugar da conexão sem criptografia padrão do cliente.
+func (i ImmuDBConfig) ClientOptions() (*client.Options, error) {
+	options := client.DefaultOptions().WithAddress(i.Host).WithPort(i.Port).WithDir(i.StateDir)
+	if i.TLS.Enabled {
+		tlsConfig, err := i.TLS.Build()
+		if err != nil {
+			return nil, fmt.Errorf("erro na configuração de TLS do ImmuDB: %w", err)
+		}
+		options = options.WithDialOptions([]grpc.DialOption{grpc.WithTransportCredentials(credentials.NewTLS(tlsConfig))})
+	}
+	return options, nil
+}
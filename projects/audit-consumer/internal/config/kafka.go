@@ -0,0 +1,69 @@
+package config
+
+import (
+	"crypto/sha256"
+	"crypto/sha512"
+	"fmt"
+	"github.com/IBM/sarama"
+)
+
+// Sarama cria a configuração do cliente do Kafka, usada pelo consumer group e pelo producer
+// de dead-letter
+func (k KafkaConfig) Sarama() (*sarama.Config, error) {
+	config := sarama.NewConfig()
+	config.ClientID = k.ClientID
+
+	version, err := sarama.ParseKafkaVersion(k.Version)
+	if err != nil {
+		return nil, fmt.Errorf("versão do Kafka '%s' inválida: %w", k.Version, err)
+	}
+	config.Version = version
+
+	switch k.InitialOffset {
+	case OffsetOldest:
+		config.Consumer.Offsets.Initial = sarama.OffsetOldest
+	default:
+		config.Consumer.Offsets.Initial = sarama.OffsetNewest
+	}
+	config.Consumer.Group.Session.Timeout = k.SessionTimeout
+	config.Consumer.Group.Heartbeat.Interval = k.HeartbeatInterval
+
+	switch k.RebalanceStrategy {
+	case StrategyRange:
+		config.Consumer.Group.Rebalance.GroupStrategies = []sarama.BalanceStrategy{sarama.NewBalanceStrategyRange()}
+	case StrategySticky:
+		config.Consumer.Group.Rebalance.GroupStrategies = []sarama.BalanceStrategy{sarama.NewBalanceStrategySticky()}
+	default:
+		config.Consumer.Group.Rebalance.GroupStrategies = []sarama.BalanceStrategy{sarama.NewBalanceStrategyRoundRobin()}
+	}
+
+	if k.SASL.Mechanism != "" {
+		config.Net.SASL.Enable = true
+		config.Net.SASL.User = k.SASL.Username
+		config.Net.SASL.Password = k.SASL.Password
+		switch k.SASL.Mechanism {
+		case MechanismSCRAMSHA256:
+			config.Net.SASL.Mechanism = sarama.SASLTypeSCRAMSHA256
+			config.Net.SASL.SCRAMClientGeneratorFunc = func() sarama.SCRAMClient { return newSCRAMClient(sha256.New) }
+		case MechanismSCRAMSHA512:
+			config.Net.SASL.Mechanism = sarama.SASLTypeSCRAMSHA512
+			config.Net.SASL.SCRAMClientGeneratorFunc = func() sarama.SCRAMClient { return newSCRAMClient(sha512.New) }
+		default:
+			config.Net.SASL.Mechanism = sarama.SASLTypePlaintext
+		}
+	}
+
+	if k.TLS.Enabled {
+		tlsConfig, err := k.TLS.Build()
+		if err != nil {
+			return nil, fmt.Errorf("erro na configuração de TLS do Kafka: %w", err)
+		}
+		config.Net.TLS.Enable = true
+		config.Net.TLS.Config = tlsConfig
+	}
+
+	if err := config.Validate(); err != nil {
+		return nil, fmt.Errorf("configuração do cliente do Kafka inválida: %w", err)
+	}
+	return config, nil
+}
@@ -0,0 +1,149 @@
+package config
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"golang.org/x/crypto/pbkdf2"
+	"hash"
+	"strconv"
+	"strings"
+)
+
+// scramClient implementa a autenticação SCRAM (RFC 5802) exigida pelo sarama para os mecanismos
+// SCRAM-SHA-256 e SCRAM-SHA-512
+type scramClient struct {
+	hash  func() hash.Hash
+	nonce func() (string, error)
+
+	user     string
+	password string
+	authzID  string
+
+	step        int
+	clientNonce string
+	firstBare   string
+	serverSig   []byte
+	done        bool
+}
+
+// newSCRAMClient cria um cliente SCRAM com a função de hash do mecanismo
+func newSCRAMClient(hashFunc func() hash.Hash) *scramClient {
+	return &scramClient{hash: hashFunc, nonce: randomNonce}
+}
+
+// Begin prepara a troca de mensagens com o usuário e a senha
+func (c *scramClient) Begin(user, password, authzID string) error {
+	c.user, c.password, c.authzID = user, password, authzID
+	c.step, c.done, c.serverSig = 0, false, nil
+	return nil
+}
+
+// Step responde a cada mensagem do servidor: a primeira mensagem do cliente, a prova de posse
+// da senha e a verificação da assinatura do servidor
+func (c *scramClient) Step(challenge string) (string, error) {
+	c.step++
+	switch c.step {
+	case 1:
+		nonce, err := c.nonce()
+		if err != nil {
+			return "", err
+		}
+		c.clientNonce = nonce
+		c.firstBare = "n=" + escapeSCRAMName(c.user) + ",r=" + nonce
+		return c.gs2Header() + c.firstBare, nil
+	case 2:
+		return c.finalMessage(challenge)
+	case 3:
+		c.done = true
+		attrs := parseSCRAMAttributes(challenge)
+		if message, ok := attrs["e"]; ok {
+			return "", fmt.Errorf("autenticação SCRAM recusada pelo servidor: %s", message)
+		}
+		signature, err := base64.StdEncoding.DecodeString(attrs["v"])
+		if err != nil || !hmac.Equal(signature, c.serverSig) {
+			return "", errors.New("assinatura SCRAM do servidor inválida")
+		}
+		return "", nil
+	default:
+		return "", errors.New("mensagem SCRAM inesperada")
+	}
+}
+
+// Done indica o fim da troca de mensagens
+func (c *scramClient) Done() bool {
+	return c.done
+}
+
+// finalMessage calcula a prova do cliente a partir do salt e das iterações enviados pelo servidor
+func (c *scramClient) finalMessage(serverFirst string) (string, error) {
+	attrs := parseSCRAMAttributes(serverFirst)
+	nonce := attrs["r"]
+	if !strings.HasPrefix(nonce, c.clientNonce) {
+		return "", errors.New("nonce SCRAM do servidor inválido")
+	}
+	salt, err := base64.StdEncoding.DecodeString(attrs["s"])
+	if err != nil {
+		return "", fmt.Errorf("salt SCRAM do servidor inválido: %w", err)
+	}
+	iterations, err := strconv.Atoi(attrs["i"])
+	if err != nil || iterations <= 0 {
+		return "", errors.New("iterações SCRAM do servidor inválidas")
+	}
+
+	salted := pbkdf2.Key([]byte(c.password), salt, iterations, c.hash().Size(), c.hash)
+	clientKey := c.hmac(salted, "Client Key")
+	storedKey := c.hash()
+	storedKey.Write(clientKey)
+
+	withoutProof := "c=" + base64.StdEncoding.EncodeToString([]byte(c.gs2Header())) + ",r=" + nonce
+	authMessage := c.firstBare + "," + serverFirst + "," + withoutProof
+
+	proof := c.hmac(storedKey.Sum(nil), authMessage)
+	for i := range proof {
+		proof[i] ^= clientKey[i]
+	}
+	c.serverSig = c.hmac(c.hmac(salted, "Server Key"), authMessage)
+	return withoutProof + ",p=" + base64.StdEncoding.EncodeToString(proof), nil
+}
+
+// gs2Header é o cabeçalho da primeira mensagem, sem channel binding
+func (c *scramClient) gs2Header() string {
+	if c.authzID == "" {
+		return "n,,"
+	}
+	return "n,a=" + escapeSCRAMName(c.authzID) + ","
+}
+
+func (c *scramClient) hmac(key []byte, message string) []byte {
+	mac := hmac.New(c.hash, key)
+	mac.Write([]byte(message))
+	return mac.Sum(nil)
+}
+
+// randomNonce gera o nonce do cliente
+func randomNonce() (string, error) {
+	buf := make([]byte, 24)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("erro ao gerar o nonce SCRAM: %w", err)
+	}
+	return base64.RawStdEncoding.EncodeToString(buf), nil
+}
+
+// escapeSCRAMName codifica os caracteres reservados nos nomes de usuário
+func escapeSCRAMName(name string) string {
+	return strings.NewReplacer("=", "=3D", ",", "=2C").Replace(name)
+}
+
+// parseSCRAMAttributes separa os atributos chave=valor de uma mensagem SCRAM
+func parseSCRAMAttributes(message string) map[string]string {
+	attrs := make(map[string]string)
+	for _, part := range strings.Split(message, ",") {
+		if key, value, ok := strings.Cut(part, "="); ok {
+			attrs[key] = value
+		}
+	}
+	return attrs
+}
@@ -0,0 +1,203 @@
+package consumer
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"github.com/Waelson/audit/audit-consumer/internal/model"
+	"github.com/Waelson/audit/audit-consumer/internal/resilience"
+	"github.com/Waelson/audit/audit-consumer/internal/sink"
+	"log"
+	"sync"
+	"time"
+)
+
+// derivedSchemaConnectors são os conectores do Debezium que não publicam o histórico de DDL:
+// as alterações de schema das suas tabelas são derivadas do schema que acompanha os eventos
+var derivedSchemaConnectors = map[string]bool{"postgresql": true}
+
+// schemaTracker guarda a última definição conhecida de cada tabela de origem cujas alterações
+// de schema são derivadas dos eventos
+type schemaTracker struct {
+	mu    sync.Mutex
+	known map[string]string
+	// recording serializa a consulta e o registro das alterações, para que partições da mesma
+	// tabela não registrem a mesma alteração duas vezes
+	recording sync.Mutex
+}
+
+// current retorna a definição conhecida da tabela
+func (t *schemaTracker) current(key string) (string, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	definition, ok := t.known[key]
+	return definition, ok
+}
+
+// remember registra a definição da tabela
+func (t *schemaTracker) remember(key, definition string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.known == nil {
+		t.known = make(map[string]string)
+	}
+	t.known[key] = definition
+}
+
+// connectColumn é uma coluna da definição de tabela derivada do schema do Kafka Connect
+type connectColumn struct {
+	Name        string            `json:"name"`
+	Type        string            `json:"type"`
+	Optional    bool              `json:"optional"`
+	LogicalType string            `json:"logicalType,omitempty"`
+	Parameters  map[string]string `json:"parameters,omitempty"`
+}
+
+// connectTable é a definição de tabela derivada do schema do Kafka Connect
+type connectTable struct {
+	Columns []connectColumn `json:"columns"`
+}
+
+// tableDefinition monta a definição da tabela a partir do schema da imagem after ou, nas
+// exclusões, da imagem before. Retorna falso se o envelope não informa o schema das colunas.
+func tableDefinition(schema *model.ConnectSchema) (string, bool) {
+	row := schema.FieldSchema("after")
+	if row == nil || len(row.Fields) == 0 {
+		row = schema.FieldSchema("before")
+	}
+	if row == nil || len(row.Fields) == 0 {
+		return "", false
+	}
+
+	table := connectTable{Columns: make([]connectColumn, 0, len(row.Fields))}
+	for _, field := range row.Fields {
+		table.Columns = append(table.Columns, connectColumn{
+			Name:        field.Field,
+			Type:        field.Type,
+			Optional:    field.Optional,
+			LogicalType: field.Name,
+			Parameters:  field.Parameters,
+		})
+	}
+	data, err := json.Marshal(table)
+	if err != nil {
+		return "", false
+	}
+	return canonicalJSON(string(data)), true
+}
+
+// canonicalJSON serializa novamente o JSON com as chaves em ordem alfabética, para que a
+// definição lida do sink, que pode reordenar as chaves, seja comparável à derivada do evento
+func canonicalJSON(data string) string {
+	var value interface{}
+	if err := json.Unmarshal([]byte(data), &value); err != nil {
+		return data
+	}
+	canonical, err := json.Marshal(value)
+	if err != nil {
+		return data
+	}
+	return string(canonical)
+}
+
+// trackSchemas compara o schema dos eventos gravados com a última definição conhecida de cada
+// tabela e registra as alterações no histórico de schema do banco da rota. Vale apenas para os
+// conectores que não publicam o histórico de DDL. Na primeira vez em que a tabela é vista, a
+// definição conhecida é lida do histórico. Uma falha no registro não afeta os eventos já
+// gravados: ela é registrada em log e a comparação é refeita no próximo evento da tabela.
+func (kc *KafkaConsumer) trackSchemas(ctx context.Context, events ...model.KafkaEvent) {
+	store, ok := kc.Sink.(sink.SchemaChangeStore)
+	if !ok {
+		return
+	}
+	for _, event := range events {
+		if event.Schema == nil || !derivedSchemaConnectors[event.Source.Connector] {
+			continue
+		}
+		definition, ok := tableDefinition(event.Schema)
+		if !ok {
+			continue
+		}
+		database := kc.Router.Route(event.Kafka.Topic).Database
+		key := database + "/" + sink.SourceTable(event.Source)
+		if known, ok := kc.schemas.current(key); ok && known == definition {
+			continue
+		}
+		if err := kc.recordDerivedSchema(ctx, store, database, key, definition, event); err != nil {
+			log.Printf("Erro ao registrar a alteração de schema da tabela %s: %v", sink.SourceTable(event.Source), err)
+		}
+	}
+}
+
+// recordDerivedSchema lê a definição registrada da tabela, se ainda não for conhecida, e
+// registra a nova definição quando ela é diferente
+func (kc *KafkaConsumer) recordDerivedSchema(ctx context.Context, store sink.SchemaChangeStore, database, key, definition string, event model.KafkaEvent) error {
+	kc.schemas.recording.Lock()
+	defer kc.schemas.recording.Unlock()
+
+	known, ok := kc.schemas.current(key)
+	if !ok {
+		_, err := resilience.Run(ctx, kc.RetryPolicy, kc.Breaker, func(ctx context.Context) error {
+			var err error
+			known, err = store.SchemaDefinition(ctx, database, event.Source.Db, event.Source.Schema, event.Source.Table)
+			return err
+		})
+		if err != nil {
+			return fmt.Errorf("erro ao consultar o histórico de schema: %w", err)
+		}
+		known = canonicalJSON(known)
+	}
+	if known == definition {
+		kc.schemas.remember(key, definition)
+		return nil
+	}
+
+	record := derivedSchemaRecord(event, definition, known == "", time.Now())
+	_, err := resilience.Run(ctx, kc.RetryPolicy, kc.Breaker, func(ctx context.Context) error {
+		return kc.recordSchemaChanges(ctx, store, database, []sink.SchemaChangeRecord{record})
+	})
+	if err != nil {
+		return err
+	}
+	log.Printf("Alteração de schema derivada dos eventos - Tabela: %s, Tipo: %s", sink.SourceTable(event.Source), record.ChangeType)
+	kc.schemas.remember(key, definition)
+	return nil
+}
+
+// derivedSchemaRecord cria o registro da alteração de schema derivada do evento: CREATE na
+// primeira definição registrada da tabela e ALTER nas seguintes. Não há DDL; a chave combina a
+// posição do evento no log do banco de origem (ou, sem ela, as coordenadas da mensagem), a
+// tabela e o resumo da definição.
+func derivedSchemaRecord(event model.KafkaEvent, definition string, created bool, recordedAt time.Time) sink.SchemaChangeRecord {
+	sum := sha256.Sum256([]byte(definition))
+	digest := hex.EncodeToString(sum[:8])
+	table := sink.SourceTable(event.Source)
+
+	record := sink.SchemaChangeRecord{
+		Key:        fmt.Sprintf("kafka:%s:%d:%d:%s:%s", event.Kafka.Topic, event.Kafka.Partition, event.Kafka.Offset, table, digest),
+		SourceName: event.Source.Name,
+		DbName:     event.Source.Db,
+		DbSchema:   event.Source.Schema,
+		DbTable:    event.Source.Table,
+		ChangeType: "ALTER",
+		Definition: definition,
+		ChangeDate: recordedAt,
+		RecordedAt: recordedAt,
+	}
+	if created {
+		record.ChangeType = "CREATE"
+	}
+	if event.Source.Lsn > 0 {
+		record.Position = fmt.Sprintf(`{"lsn":%d}`, event.Source.Lsn)
+		record.Key = fmt.Sprintf("lsn:%d:%s:%s", event.Source.Lsn, table, digest)
+	}
+	switch {
+	case event.Source.TsMs > 0:
+		record.ChangeDate = time.UnixMilli(event.Source.TsMs)
+	case event.TsMs > 0:
+		record.ChangeDate = time.UnixMilli(event.TsMs)
+	}
+	return record
+}
@@ -0,0 +1,94 @@
+package consumer
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// schemaEvent retorna um evento da tabela payments no envelope {schema, payload}, com as colunas
+// informadas, todas do tipo string
+func schemaEvent(t *testing.T, connector string, lsn int, columns ...string) []byte {
+	t.Helper()
+	fields := make([]map[string]interface{}, 0, len(columns))
+	after := make(map[string]interface{}, len(columns))
+	for _, column := range columns {
+		fields = append(fields, map[string]interface{}{"field": column, "type": "string", "optional": column != "id"})
+		after[column] = column
+	}
+	row := map[string]interface{}{"type": "struct", "optional": true, "name": "payment_db.public.payments.Value", "fields": fields}
+	value, err := json.Marshal(map[string]interface{}{
+		"schema": map[string]interface{}{
+			"type": "struct",
+			"fields": []map[string]interface{}{
+				withField(row, "before"), withField(row, "after"),
+				{"field": "source", "type": "struct", "fields": []map[string]interface{}{}},
+				{"field": "op", "type": "string"},
+			},
+		},
+		"payload": map[string]interface{}{
+			"op":     "c",
+			"after":  after,
+			"source": map[string]interface{}{"connector": connector, "db": "payment_db", "schema": "public", "table": "payments", "ts_ms": 1700000000000 + lsn, "lsn": lsn},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return value
+}
+
+func withField(schema map[string]interface{}, name string) map[string]interface{} {
+	field := map[string]interface{}{"field": name}
+	for key, value := range schema {
+		field[key] = value
+	}
+	return field
+}
+
+func TestSchemaChangesDerivedFromConnectSchema(t *testing.T) {
+	for _, batchSize := range []int{1, 3} {
+		t.Run(fmt.Sprintf("batch=%d", batchSize), func(t *testing.T) {
+			kc, memory, _ := newTestConsumer(t)
+			kc.BatchSize = batchSize
+
+			consume(kc, "audit-trail",
+				schemaEvent(t, "postgresql", 1, "id", "name"),
+				schemaEvent(t, "postgresql", 2, "id", "name"),
+				schemaEvent(t, "postgresql", 3, "id", "name", "email"),
+				schemaEvent(t, "mysql", 4, "id"),
+			)
+			records := memory.SchemaChanges(testDatabase)
+			if len(records) != 2 {
+				t.Fatalf("alterações registradas = %d, esperado 2: %+v", len(records), records)
+			}
+			if records[0].ChangeType != "CREATE" || records[1].ChangeType != "ALTER" {
+				t.Errorf("tipos = %s, %s, esperado CREATE, ALTER", records[0].ChangeType, records[1].ChangeType)
+			}
+			if !strings.Contains(records[1].Definition, `"name":"email"`) || strings.Contains(records[0].Definition, "email") {
+				t.Errorf("definições inesperadas: %s / %s", records[0].Definition, records[1].Definition)
+			}
+			if records[1].DbName != "payment_db" || records[1].DbSchema != "public" || records[1].DbTable != "payments" || records[1].Position != `{"lsn":3}` {
+				t.Errorf("registro inesperado: %+v", records[1])
+			}
+
+			// Um novo consumidor lê a definição conhecida do histórico e não registra a mesma
+			// definição novamente
+			restarted, _, _ := newTestConsumer(t)
+			restarted.Sink = memory
+			consume(restarted, "audit-trail", schemaEvent(t, "postgresql", 5, "id", "name", "email"))
+			if got := len(memory.SchemaChanges(testDatabase)); got != 2 {
+				t.Errorf("alterações registradas após o reinício = %d, esperado 2", got)
+			}
+		})
+	}
+}
+
+func TestTableDefinitionIgnoresMissingSchema(t *testing.T) {
+	kc, memory, _ := newTestConsumer(t)
+	consume(kc, "audit-trail", changeEvent(1))
+	if records := memory.SchemaChanges(testDatabase); len(records) != 0 {
+		t.Errorf("alterações registradas = %d, esperado nenhuma", len(records))
+	}
+}
@@ -0,0 +1,234 @@
+package consumer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/IBM/sarama"
+	"github.com/Waelson/audit/audit-consumer/internal/decoder"
+	"github.com/Waelson/audit/audit-consumer/internal/encryption"
+	"github.com/Waelson/audit/audit-consumer/internal/model"
+	"github.com/Waelson/audit/audit-consumer/internal/resilience"
+	"github.com/Waelson/audit/audit-consumer/internal/routing"
+	"github.com/Waelson/audit/audit-consumer/internal/sink"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+// testSession é uma sessão do consumer group que registra os offsets marcados
+type testSession struct {
+	ctx    context.Context
+	mu     sync.Mutex
+	marked []int64
+}
+
+func (s *testSession) Claims() map[string][]int32               { return nil }
+func (s *testSession) MemberID() string                         { return "test" }
+func (s *testSession) GenerationID() int32                      { return 1 }
+func (s *testSession) MarkOffset(string, int32, int64, string)  {}
+func (s *testSession) Commit()                                  {}
+func (s *testSession) ResetOffset(string, int32, int64, string) {}
+func (s *testSession) Context() context.Context                 { return s.ctx }
+
+func (s *testSession) MarkMessage(msg *sarama.ConsumerMessage, _ string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.marked = append(s.marked, msg.Offset)
+}
+
+// testClaim entrega as mensagens de um canal já preenchido e fechado
+type testClaim struct {
+	topic    string
+	messages chan *sarama.ConsumerMessage
+}
+
+func (c *testClaim) Topic() string                            { return c.topic }
+func (c *testClaim) Partition() int32                         { return 0 }
+func (c *testClaim) InitialOffset() int64                     { return 0 }
+func (c *testClaim) HighWaterMarkOffset() int64               { return int64(cap(c.messages)) }
+func (c *testClaim) Messages() <-chan *sarama.ConsumerMessage { return c.messages }
+
+// testPublisher registra as mensagens enviadas ao dead-letter
+type testPublisher struct {
+	mu        sync.Mutex
+	published []string
+}
+
+func (p *testPublisher) Publish(_ context.Context, msg *sarama.ConsumerMessage, errorClass string, _ int, _ error) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.published = append(p.published, fmt.Sprintf("%d:%s", msg.Offset, errorClass))
+	return nil
+}
+
+func (p *testPublisher) Close() error { return nil }
+
+// Published conta as mensagens enviadas ao dead-letter, como exigido pela importação
+func (p *testPublisher) Published() int64 {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return int64(len(p.published))
+}
+
+const testDatabase = "audit_db"
+
+// newTestConsumer cria um consumidor que grava no sink em memória, com as rotas informadas além
+// da rota padrão para audit_db.audit_trail
+func newTestConsumer(t *testing.T, routes ...routing.Route) (*KafkaConsumer, *sink.MemorySink, *testPublisher) {
+	t.Helper()
+	defaults := routing.Route{Kind: routing.KindChange, Decoder: routing.DecoderJSON, Database: testDatabase, Table: "audit_trail"}
+	router, err := routing.NewRouter(defaults, routes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	memory := sink.NewMemorySink()
+	if err := memory.Setup(context.Background(), router.Databases()); err != nil {
+		t.Fatal(err)
+	}
+	publisher := &testPublisher{}
+	kc := &KafkaConsumer{
+		Sink:         memory,
+		Router:       router,
+		Decoders:     map[string]decoder.Decoder{routing.DecoderJSON: decoder.NewJSONDecoder()},
+		DeadLetter:   publisher,
+		RetryPolicy:  resilience.NewRetryPolicy(2, time.Millisecond, time.Millisecond, 0, resilience.DefaultRetryableClasses),
+		Breaker:      resilience.NewCircuitBreaker(t.Name(), 5, time.Second),
+		WriteTimeout: time.Second,
+	}
+	return kc, memory, publisher
+}
+
+// consume entrega as mensagens ao consumidor em uma sessão e retorna os offsets marcados
+func consume(kc *KafkaConsumer, topic string, values ...[]byte) []int64 {
+	messages := make(chan *sarama.ConsumerMessage, len(values))
+	for i, value := range values {
+		messages <- &sarama.ConsumerMessage{Topic: topic, Offset: int64(i), Value: value, Timestamp: time.Unix(1700000000, 0)}
+	}
+	close(messages)
+	sess := &testSession{ctx: context.Background()}
+	kc.ConsumeClaim(sess, &testClaim{topic: topic, messages: messages})
+	return sess.marked
+}
+
+// changeEvent retorna um evento de criação da tabela payments com o identificador informado
+func changeEvent(id int) []byte {
+	return []byte(fmt.Sprintf(`{"op":"c","application":"payment-api","after":{"id":%d,"name_on_card":"Maria","customer_id":"42"},`+
+		`"source":{"connector":"postgresql","db":"payment_db","schema":"public","table":"payments","ts_ms":1700000000000,"lsn":%d}}`, id, 1000+id))
+}
+
+// unavailableKeys é um provedor de chaves sem nenhuma chave disponível
+type unavailableKeys struct{}
+
+func (unavailableKeys) ActiveKey(tenant string) (encryption.DataKey, error) {
+	return encryption.DataKey{}, errors.New("chave ativa indisponível para o tenant " + tenant)
+}
+
+func (unavailableKeys) Key(id string) (encryption.DataKey, error) {
+	return encryption.DataKey{}, errors.New("chave indisponível: " + id)
+}
+
+func TestEncryptionFailureStopsPartition(t *testing.T) {
+	for _, batchSize := range []int{1, 3} {
+		t.Run(fmt.Sprintf("batch=%d", batchSize), func(t *testing.T) {
+			kc, memory, publisher := newTestConsumer(t)
+			encryptor, err := encryption.NewEncryptor([]encryption.Rule{{Column: "name_on_card"}}, unavailableKeys{}, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			kc.Encryptor = encryptor
+			kc.BatchSize = batchSize
+			kc.BatchTimeout = time.Second
+
+			marked := consume(kc, "audit-trail", changeEvent(1), changeEvent(2))
+			if len(marked) != 0 {
+				t.Errorf("offsets marcados = %v, esperado nenhum", marked)
+			}
+			if len(publisher.published) != 0 {
+				t.Errorf("mensagens no dead-letter = %v, esperado nenhuma", publisher.published)
+			}
+			if events := memory.Events(sink.Target{Database: testDatabase, Table: "audit_trail"}); len(events) != 0 {
+				t.Errorf("eventos gravados = %d, esperado nenhum", len(events))
+			}
+		})
+	}
+}
+
+// slowKeys atrasa a obtenção da chave na mensagem informada, simulando uma mensagem cujo
+// preparo dura mais que o BatchTimeout
+type slowKeys struct {
+	key   encryption.DataKey
+	slow  int
+	delay time.Duration
+
+	mu    sync.Mutex
+	calls int
+}
+
+func (k *slowKeys) ActiveKey(string) (encryption.DataKey, error) {
+	k.mu.Lock()
+	k.calls++
+	slow := k.calls == k.slow
+	k.mu.Unlock()
+	if slow {
+		time.Sleep(k.delay)
+	}
+	return k.key, nil
+}
+
+func (k *slowKeys) Key(string) (encryption.DataKey, error) { return k.key, nil }
+
+// sizedSink registra o tamanho de cada gravação
+type sizedSink struct {
+	*sink.MemorySink
+
+	mu     sync.Mutex
+	writes []int
+}
+
+func (s *sizedSink) Write(ctx context.Context, target sink.Target, events []model.KafkaEvent) error {
+	s.mu.Lock()
+	s.writes = append(s.writes, len(events))
+	s.mu.Unlock()
+	return s.MemorySink.Write(ctx, target, events)
+}
+
+func TestBatchTimeoutFiredBeforeSizeFlush(t *testing.T) {
+	kc, memory, _ := newTestConsumer(t)
+	sized := &sizedSink{MemorySink: memory}
+	kc.Sink = sized
+	kc.BatchSize = 2
+	kc.BatchTimeout = 100 * time.Millisecond
+	key, err := encryption.NewKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys := &slowKeys{key: encryption.DataKey{ID: "kek", Tenant: "payment-api", Key: key}, slow: 2, delay: 300 * time.Millisecond}
+	kc.Encryptor, err = encryption.NewEncryptor([]encryption.Rule{{Column: "name_on_card"}}, keys, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// O timer do primeiro lote dispara durante o preparo da sua segunda mensagem, que completa o
+	// lote; a segunda mensagem do lote seguinte chega bem antes do BatchTimeout
+	messages := make(chan *sarama.ConsumerMessage)
+	go func() {
+		defer close(messages)
+		for i := 0; i < 4; i++ {
+			if i == 3 {
+				time.Sleep(20 * time.Millisecond)
+			}
+			messages <- &sarama.ConsumerMessage{Topic: "audit-trail", Offset: int64(i), Value: changeEvent(i + 1), Timestamp: time.Unix(1700000000, 0)}
+		}
+	}()
+	sess := &testSession{ctx: context.Background()}
+	kc.ConsumeClaim(sess, &testClaim{topic: "audit-trail", messages: messages})
+
+	if want := []int{2, 2}; !reflect.DeepEqual(sized.writes, want) {
+		t.Errorf("gravações = %v, esperado %v", sized.writes, want)
+	}
+	if len(sess.marked) != 4 {
+		t.Errorf("offsets marcados = %v, esperado 4", sess.marked)
+	}
+}
@@ -0,0 +1,134 @@
+package consumer
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"github.com/IBM/sarama"
+	"io"
+	"time"
+)
+
+// ImportPartition retorna a partição atribuída às linhas de um arquivo importado: um número
+// negativo derivado do identificador da origem do arquivo, como o hash do seu conteúdo, e não do
+// caminho, para que o mesmo arquivo importado de outro diretório não seja gravado novamente. Como
+// nenhuma partição do Kafka é negativa, as chaves de idempotência baseadas nas coordenadas
+// (kafka:<tópico>:<partição>:<linha>) não colidem com as das mensagens consumidas do tópico, e a
+// linha N de uma origem não colide com a linha N de outra importada com o mesmo tópico.
+func ImportPartition(source string) int32 {
+	sum := sha256.Sum256([]byte(source))
+	return -1 - int32(binary.BigEndian.Uint32(sum[:4])&0x7fffffff)
+}
+
+// ImportPosition é a posição de uma importação: o byte e o número da linha seguintes à última
+// linha processada, com os totais de linhas aceitas e rejeitadas até ela
+type ImportPosition struct {
+	Offset   int64 `json:"offset"`
+	Line     int64 `json:"line"`
+	Accepted int64 `json:"accepted"`
+	Rejected int64 `json:"rejected"`
+}
+
+// rejectCounter é implementado pelos publishers de dead-letter que contam as mensagens recebidas
+type rejectCounter interface {
+	Published() int64
+}
+
+// Import lê envelopes do Debezium em JSON Lines, um por linha, a partir da posição informada, e
+// processa cada linha com o mesmo pipeline do consumo contínuo, como uma mensagem do tópico
+// informado na partição da origem (ImportPartition) cujo offset é o número da linha. Linhas em
+// branco são ignoradas. A cada intervalo progress, report recebe a posição das linhas já gravadas
+// ou rejeitadas; retomar a importação a partir dela reprocessa apenas as linhas posteriores, e as
+// que já tiverem sido gravadas são descartadas pela idempotência do sink. O DeadLetter do
+// consumidor deve contabilizar as mensagens rejeitadas, como o deadletter.FilePublisher.
+func (kc *KafkaConsumer) Import(ctx context.Context, reader io.Reader, topic, source string, position ImportPosition,
+	progress time.Duration, report func(ImportPosition) error) (ImportPosition, error) {
+	counter, ok := kc.DeadLetter.(rejectCounter)
+	if !ok {
+		return position, errors.New("o dead-letter da importação não contabiliza as mensagens rejeitadas")
+	}
+
+	partition := ImportPartition(source)
+	committed, read := position, position
+	published := counter.Published()
+	var pendingLines int64
+	// commit considera processadas todas as linhas lidas, atualizando os totais com as rejeições
+	// registradas no dead-letter desde o último commit
+	commit := func() {
+		rejected := counter.Published() - published
+		published += rejected
+		committed.Offset, committed.Line = read.Offset, read.Line
+		committed.Rejected += rejected
+		committed.Accepted += pendingLines - rejected
+		pendingLines = 0
+	}
+
+	batch := make([]pendingMessage, 0, kc.BatchSize)
+	flush := func() error {
+		if len(batch) > 0 {
+			if err := kc.flushBatch(ctx, batch); err != nil {
+				return fmt.Errorf("gravação do lote interrompida na linha %d: %w", batch[0].msg.Offset, err)
+			}
+			batch = batch[:0]
+		}
+		commit()
+		return nil
+	}
+
+	buffered := bufio.NewReaderSize(reader, 1<<20)
+	lastReport := time.Now()
+	for {
+		if ctx.Err() != nil {
+			return committed, ctx.Err()
+		}
+		line, readErr := buffered.ReadBytes('\n')
+		if readErr != nil && !errors.Is(readErr, io.EOF) {
+			return committed, fmt.Errorf("erro ao ler a linha %d: %w", read.Line+1, readErr)
+		}
+		if len(line) > 0 {
+			read.Offset += int64(len(line))
+			read.Line++
+			if value := bytes.TrimSpace(line); len(value) > 0 {
+				pendingLines++
+				msg := &sarama.ConsumerMessage{
+					Topic:     topic,
+					Partition: partition,
+					Offset:    read.Line,
+					Value:     value,
+					Timestamp: time.Now(),
+				}
+				if kc.BatchSize > 1 {
+					pending, err := kc.prepareMessage(ctx, msg)
+					if err != nil {
+						return committed, fmt.Errorf("importação interrompida na linha %d: %w", read.Line, err)
+					}
+					batch = append(batch, pending)
+				} else if err := kc.processMessage(ctx, msg); err != nil {
+					return committed, fmt.Errorf("importação interrompida na linha %d: %w", read.Line, err)
+				}
+			}
+			if len(batch) == 0 || len(batch) >= kc.BatchSize {
+				if err := flush(); err != nil {
+					return committed, err
+				}
+			}
+		}
+
+		if errors.Is(readErr, io.EOF) {
+			if err := flush(); err != nil {
+				return committed, err
+			}
+			return committed, nil
+		}
+		if time.Since(lastReport) >= progress {
+			lastReport = time.Now()
+			if err := report(committed); err != nil {
+				return committed, err
+			}
+		}
+	}
+}
@@ -0,0 +1,98 @@
+package consumer
+
+import (
+	"context"
+	"fmt"
+	"github.com/Waelson/audit/audit-consumer/internal/sink"
+	"strings"
+	"testing"
+	"time"
+)
+
+// snapshotLine retorna uma leitura de snapshot, que não tem LSN próprio e por isso é identificada
+// pelas coordenadas da mensagem
+func snapshotLine(id int) string {
+	return fmt.Sprintf(`{"op":"r","after":{"id":%d},"source":{"connector":"postgresql","db":"legacy","schema":"public","table":"payment","snapshot":"true","lsn":500}}`, id)
+}
+
+func importLines(t *testing.T, kc *KafkaConsumer, source string, position ImportPosition, lines ...string) ImportPosition {
+	t.Helper()
+	reader := strings.NewReader(strings.Join(lines, "\n") + "\n")
+	position, err := kc.Import(context.Background(), reader, "legacy.public.payment", source, position, time.Hour, func(ImportPosition) error { return nil })
+	if err != nil {
+		t.Fatal(err)
+	}
+	return position
+}
+
+func TestImportDistinguishesSources(t *testing.T) {
+	for _, batchSize := range []int{1, 2} {
+		t.Run(fmt.Sprintf("batch=%d", batchSize), func(t *testing.T) {
+			kc, memory, _ := newTestConsumer(t)
+			kc.BatchSize = batchSize
+
+			// As duas origens têm as mesmas linhas: a linha N de uma não é duplicata da linha N da outra
+			lines := []string{snapshotLine(1), "", snapshotLine(2), snapshotLine(3)}
+			first := importLines(t, kc, "legacy-2023", ImportPosition{}, lines...)
+			second := importLines(t, kc, "legacy-2024", ImportPosition{}, lines...)
+
+			want := ImportPosition{Offset: first.Offset, Line: 4, Accepted: 3}
+			for _, position := range []ImportPosition{first, second} {
+				if position != want {
+					t.Errorf("posição = %+v, esperado %+v", position, want)
+				}
+			}
+			if events := memory.Events(sink.Target{Database: testDatabase, Table: "audit_trail"}); len(events) != 6 {
+				t.Errorf("eventos gravados = %d, esperado 6", len(events))
+			}
+
+			// Importar novamente a mesma origem não grava as linhas outra vez
+			importLines(t, kc, "legacy-2023", ImportPosition{}, lines...)
+			if events := memory.Events(sink.Target{Database: testDatabase, Table: "audit_trail"}); len(events) != 6 {
+				t.Errorf("eventos gravados após a reimportação = %d, esperado 6", len(events))
+			}
+		})
+	}
+}
+
+func TestImportResumesFromPosition(t *testing.T) {
+	kc, memory, publisher := newTestConsumer(t)
+	lines := []string{snapshotLine(1), "{inválido", snapshotLine(3)}
+
+	// A posição após a primeira linha retoma a importação na segunda
+	position := ImportPosition{Offset: int64(len(lines[0]) + 1), Line: 1, Accepted: 1}
+	reader := strings.NewReader(strings.Join(lines[1:], "\n"))
+	position, err := kc.Import(context.Background(), reader, "legacy.public.payment", "legacy", position, time.Hour, func(ImportPosition) error { return nil })
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := ImportPosition{Offset: int64(len(strings.Join(lines, "\n"))), Line: 3, Accepted: 2, Rejected: 1}
+	if position != want {
+		t.Errorf("posição = %+v, esperado %+v", position, want)
+	}
+	if len(publisher.published) != 1 || !strings.HasPrefix(publisher.published[0], "2:") {
+		t.Errorf("rejeições = %v, esperada a linha 2", publisher.published)
+	}
+	if events := memory.Events(sink.Target{Database: testDatabase, Table: "audit_trail"}); len(events) != 1 {
+		t.Errorf("eventos gravados = %d, esperado 1", len(events))
+	}
+}
+
+func TestImportPartition(t *testing.T) {
+	sources := []string{"legacy-2023", "legacy-2024", "sha256:9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08", ""}
+	seen := make(map[int32]string)
+	for _, source := range sources {
+		partition := ImportPartition(source)
+		if partition >= 0 {
+			t.Errorf("ImportPartition(%q) = %d, esperado um número negativo", source, partition)
+		}
+		if other, ok := seen[partition]; ok {
+			t.Errorf("ImportPartition(%q) = ImportPartition(%q) = %d", source, other, partition)
+		}
+		seen[partition] = source
+		if again := ImportPartition(source); again != partition {
+			t.Errorf("ImportPartition(%q) não é estável: %d e %d", source, partition, again)
+		}
+	}
+}
@@ -2,108 +2,479 @@ package consumer
 
 import (
 	"context"
-	"encoding/json"
+	"errors"
 	"fmt"
 	"github.com/IBM/sarama"
+	"github.com/Waelson/audit/audit-consumer/internal/deadletter"
+	"github.com/Waelson/audit/audit-consumer/internal/decoder"
+	"github.com/Waelson/audit/audit-consumer/internal/diff"
+	"github.com/Waelson/audit/audit-consumer/internal/encryption"
+	"github.com/Waelson/audit/audit-consumer/internal/masking"
+	"github.com/Waelson/audit/audit-consumer/internal/metrics"
 	"github.com/Waelson/audit/audit-consumer/internal/model"
-	"github.com/codenotary/immudb/pkg/client"
+	"github.com/Waelson/audit/audit-consumer/internal/resilience"
+	"github.com/Waelson/audit/audit-consumer/internal/routing"
+	"github.com/Waelson/audit/audit-consumer/internal/sink"
 	"log"
+	"strconv"
+	"sync/atomic"
 	"time"
 )
 
 // KafkaConsumer representa o consumidor do Kafka
 type KafkaConsumer struct {
-	ImmuClient client.ImmuClient
+	// Sink grava os eventos na trilha de auditoria
+	Sink sink.AuditSink
+	// Router define o decoder, o destino e a aplicação das mensagens de cada tópico
+	Router *routing.Router
+	// Decoders contém os decoders disponíveis para as rotas, por nome (json, avro)
+	Decoders map[string]decoder.Decoder
+	// Masker mascara os dados sensíveis das imagens; nil desativa o mascaramento
+	Masker *masking.Masker
+	// Encryptor cifra as colunas sensíveis das imagens; nil desativa a criptografia
+	Encryptor    *encryption.Encryptor
+	DeadLetter   deadletter.Publisher
+	RetryPolicy  resilience.RetryPolicy
+	Breaker      *resilience.CircuitBreaker
+	WriteTimeout time.Duration
+	// BatchSize é a quantidade máxima de mensagens gravadas em uma única operação do sink.
+	// Valores menores ou iguais a 1 desativam o modo em lote.
+	BatchSize int
+	// BatchTimeout é o tempo máximo que uma mensagem aguarda no lote antes da gravação
+	BatchTimeout time.Duration
+
+	// member indica se o consumidor participa de uma sessão ativa do consumer group
+	member atomic.Bool
+	// drain é o contexto do encerramento, definido por Drain
+	drain atomic.Pointer[context.Context]
+	// schemas guarda as definições das tabelas cujas alterações de schema são derivadas dos eventos
+	schemas schemaTracker
 }
 
-// Setup é executado antes de uma nova sessão de consumo
+// errTombstone indica uma mensagem sem valor, publicada pelo Debezium após uma exclusão para
+// permitir a compactação do tópico. Ela não representa uma alteração e é apenas confirmada.
+var errTombstone = errors.New("mensagem tombstone")
+
+// errEncryption indica que o evento não pôde ser cifrado, por exemplo por falta da chave ativa
+// do tenant ou por um repositório de chaves ilegível. A falha é de configuração ou de
+// disponibilidade, não da mensagem: ela não vai para o dead-letter, em que chegaria com os
+// valores em claro, e o processamento da partição é interrompido para que a mensagem seja
+// entregue novamente.
+var errEncryption = errors.New("falha na criptografia do evento")
+
+// pendingMessage é uma mensagem aguardando a gravação do lote para ser marcada como processada
+type pendingMessage struct {
+	msg   *sarama.ConsumerMessage
+	event model.KafkaEvent
+	// handled indica que a mensagem já foi tratada (enviada ao dead-letter) e não deve ser gravada
+	handled bool
+}
+
+// Setup é executado antes de uma nova sessão de consumo, a cada rebalanceamento do grupo
 func (kc *KafkaConsumer) Setup(sarama.ConsumerGroupSession) error {
 	log.Println("Setup da sessão do consumer iniciado.")
+	metrics.Rebalances.Inc()
+	kc.member.Store(true)
 	return nil
 }
 
-// Cleanup é executado ao final da sessão de consumo
-func (kc *KafkaConsumer) Cleanup(sarama.ConsumerGroupSession) error {
+// Cleanup é executado ao final da sessão de consumo. O lag das partições da sessão deixa de ser
+// exposto, pois elas podem ser atribuídas a outro consumidor no rebalanceamento.
+// Os offsets marcados são confirmados antes de a sessão terminar.
+func (kc *KafkaConsumer) Cleanup(sess sarama.ConsumerGroupSession) error {
+	kc.member.Store(false)
+	sess.Commit()
+	for topic, partitions := range sess.Claims() {
+		for _, partition := range partitions {
+			metrics.ConsumerLag.DeleteLabelValues(topic, strconv.Itoa(int(partition)))
+		}
+	}
 	log.Println("Cleanup da sessão do consumer finalizado.")
 	return nil
 }
 
+// CheckMembership verifica se o consumidor participa de uma sessão ativa do consumer group. Entre
+// o fim de uma sessão e o início da próxima, durante um rebalanceamento, o consumidor não está pronto.
+func (kc *KafkaConsumer) CheckMembership(context.Context) error {
+	if !kc.member.Load() {
+		return errors.New("consumidor fora de uma sessão do consumer group")
+	}
+	return nil
+}
+
+// Drain prepara o encerramento do consumidor e deve ser chamado antes de cancelar o contexto do
+// consumo. As mensagens em andamento quando a sessão terminar são concluídas (e o lote gravado)
+// até o fim de ctx, em vez de interrompidas como em um rebalanceamento.
+func (kc *KafkaConsumer) Drain(ctx context.Context) {
+	kc.drain.Store(&ctx)
+}
+
 // ConsumeClaim processa as mensagens do tópico
 func (kc *KafkaConsumer) ConsumeClaim(sess sarama.ConsumerGroupSession, claim sarama.ConsumerGroupClaim) error {
 	log.Printf("Iniciando o processamento de mensagens do tópico: %s", claim.Topic())
-	for msg := range claim.Messages() {
-		log.Printf("Mensagem recebida - Partição: %d, Offset: %d, Valor: %s", msg.Partition, msg.Offset, string(msg.Value))
+	ctx, cancel := kc.processingContext(sess)
+	defer cancel()
+	if kc.BatchSize > 1 {
+		kc.consumeBatches(ctx, sess, claim)
+	} else {
+		kc.consumeMessages(ctx, sess, claim)
+	}
+	log.Printf("Finalizado o processamento de mensagens do tópico: %s", claim.Topic())
+	return nil
+}
 
-		// Decodifica o evento Kafka para a estrutura KafkaEvent
-		var event model.KafkaEvent
-		if err := json.Unmarshal(msg.Value, &event); err != nil {
-			log.Printf("Erro ao decodificar mensagem: %v", err)
-			continue
+// processingContext cria o contexto do processamento das mensagens da sessão. Ele é cancelado
+// junto com a sessão, exceto durante o encerramento, quando dura até o fim do contexto de Drain.
+func (kc *KafkaConsumer) processingContext(sess sarama.ConsumerGroupSession) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(context.Background())
+	stop := context.AfterFunc(sess.Context(), func() {
+		if drain := kc.drain.Load(); drain != nil {
+			context.AfterFunc(*drain, cancel)
+			return
 		}
+		cancel()
+	})
+	return ctx, func() {
+		stop()
+		cancel()
+	}
+}
 
-		log.Printf("Mensagem decodificada com sucesso: %+v", event.After)
-
-		// Insere o registro extraído no ImmuDB
-		if err := kc.insertIntoImmuDB(event); err != nil {
-			log.Printf("Erro ao inserir no ImmuDB: %v", err)
-			continue
+// consumeMessages processa e marca as mensagens uma a uma. Com a sessão encerrada, as mensagens
+// já recebidas do Kafka e ainda não processadas são deixadas para a próxima sessão.
+func (kc *KafkaConsumer) consumeMessages(ctx context.Context, sess sarama.ConsumerGroupSession, claim sarama.ConsumerGroupClaim) {
+	for msg := range claim.Messages() {
+		if sess.Context().Err() != nil {
+			return
 		}
+		log.Printf("Mensagem recebida - Tópico: %s, Partição: %d, Offset: %d", msg.Topic, msg.Partition, msg.Offset)
+		metrics.MessagesConsumed.WithLabelValues(msg.Topic).Inc()
 
-		log.Printf("Registro inserido no ImmuDB com sucesso")
+		if err := kc.processMessage(ctx, msg); err != nil {
+			// A mensagem não foi armazenada nem enviada ao dead-letter: não marca o offset
+			// para que ela seja entregue novamente na próxima sessão
+			log.Printf("Processamento interrompido - Partição: %d, Offset: %d: %v", msg.Partition, msg.Offset, err)
+			return
+		}
 
 		// Marca a mensagem como processada
 		sess.MarkMessage(msg, "")
+		recordLag(claim, msg.Offset)
 		log.Printf("Mensagem marcada como processada - Offset: %d", msg.Offset)
 	}
-	log.Printf("Finalizado o processamento de mensagens do tópico: %s", claim.Topic())
-	return nil
 }
 
-// insertIntoImmuDB insere um evento Kafka na tabela audit_trail do ImmuDB
-func (kc *KafkaConsumer) insertIntoImmuDB(event model.KafkaEvent) error {
-	log.Printf("Preparando para inserir no ImmuDB: Operation=%s, Table=%s", event.Op, event.Source.Table)
+// consumeBatches acumula as mensagens até atingir BatchSize ou BatchTimeout e grava o lote
+// em uma única transação. As mensagens só são marcadas depois da gravação, preservando a
+// entrega at-least-once. Com a sessão encerrada, o lote em andamento é gravado e as mensagens
+// ainda não processadas são deixadas para a próxima sessão.
+func (kc *KafkaConsumer) consumeBatches(ctx context.Context, sess sarama.ConsumerGroupSession, claim sarama.ConsumerGroupClaim) {
+	batch := make([]pendingMessage, 0, kc.BatchSize)
+	timer := time.NewTimer(kc.BatchTimeout)
+	defer timer.Stop()
+	// stopTimer para o timer e descarta um disparo ainda não lido, que de outro modo encerraria o
+	// próximo lote logo após a sua primeira mensagem
+	stopTimer := func() {
+		if !timer.Stop() {
+			select {
+			case <-timer.C:
+			default:
+			}
+		}
+	}
+	stopTimer()
+
+	flush := func() bool {
+		stopTimer()
+		if len(batch) == 0 {
+			return true
+		}
+		if err := kc.flushBatch(ctx, batch); err != nil {
+			log.Printf("Gravação do lote interrompida - Partição: %d, Offsets: %d a %d: %v",
+				claim.Partition(), batch[0].msg.Offset, batch[len(batch)-1].msg.Offset, err)
+			return false
+		}
+		for _, pending := range batch {
+			sess.MarkMessage(pending.msg, "")
+		}
+		recordLag(claim, batch[len(batch)-1].msg.Offset)
+		log.Printf("Lote marcado como processado - Partição: %d, Offsets: %d a %d",
+			claim.Partition(), batch[0].msg.Offset, batch[len(batch)-1].msg.Offset)
+		batch = batch[:0]
+		return true
+	}
+
+	for {
+		select {
+		case msg, ok := <-claim.Messages():
+			if !ok || sess.Context().Err() != nil {
+				flush()
+				return
+			}
+			log.Printf("Mensagem recebida - Tópico: %s, Partição: %d, Offset: %d", msg.Topic, msg.Partition, msg.Offset)
+			metrics.MessagesConsumed.WithLabelValues(msg.Topic).Inc()
+
+			pending, err := kc.prepareMessage(ctx, msg)
+			if err != nil {
+				log.Printf("Processamento interrompido - Partição: %d, Offset: %d: %v", msg.Partition, msg.Offset, err)
+				return
+			}
+			if len(batch) == 0 {
+				timer.Reset(kc.BatchTimeout)
+			}
+			batch = append(batch, pending)
+			if len(batch) >= kc.BatchSize && !flush() {
+				return
+			}
+		case <-timer.C:
+			if !flush() {
+				return
+			}
+		case <-sess.Context().Done():
+			flush()
+			return
+		}
+	}
+}
+
+// prepareMessage decodifica a mensagem para inclusão no lote. Mensagens que não podem ser
+// decodificadas são enviadas ao dead-letter e entram no lote apenas para manter a ordem dos offsets;
+// uma falha na criptografia é retornada, sem o envio ao dead-letter.
+func (kc *KafkaConsumer) prepareMessage(ctx context.Context, msg *sarama.ConsumerMessage) (pendingMessage, error) {
+	// Os marcadores de transação e as alterações de schema são registrados imediatamente e entram
+	// no lote apenas para manter a ordem dos offsets
+	switch route := kc.Router.Route(msg.Topic); route.Kind {
+	case routing.KindTransaction:
+		if err := kc.processTransactionMarker(ctx, msg, route); err != nil {
+			return pendingMessage{}, err
+		}
+		return pendingMessage{msg: msg, handled: true}, nil
+	case routing.KindSchema:
+		if err := kc.processSchemaChange(ctx, msg, route); err != nil {
+			return pendingMessage{}, err
+		}
+		return pendingMessage{msg: msg, handled: true}, nil
+	}
+
+	event, err := kc.decodeMessage(ctx, msg)
+	if errors.Is(err, errTombstone) {
+		return pendingMessage{msg: msg, handled: true}, nil
+	}
+	if ctx.Err() != nil {
+		return pendingMessage{}, ctx.Err()
+	}
+	if errors.Is(err, errEncryption) {
+		return pendingMessage{}, err
+	}
+	if err != nil {
+		if err := kc.publishDeadLetter(ctx, msg, deadletter.ErrorClassDecode, 1, err); err != nil {
+			return pendingMessage{}, err
+		}
+		return pendingMessage{msg: msg, handled: true}, nil
+	}
+	return pendingMessage{msg: msg, event: event}, nil
+}
+
+// flushBatch grava o lote em uma única transação. Se o lote for rejeitado por um erro que não
+// é transitório, as mensagens são gravadas individualmente para que apenas as mensagens com
+// problema sigam para o dead-letter.
+func (kc *KafkaConsumer) flushBatch(ctx context.Context, batch []pendingMessage) error {
+	events := make([]model.KafkaEvent, 0, len(batch))
+	for _, pending := range batch {
+		if !pending.handled {
+			events = append(events, pending.event)
+		}
+	}
+	if len(events) == 0 {
+		return nil
+	}
 
-	// Converter o timestamp do evento (TsMs) para time.Time
-	eventDate := time.UnixMilli(event.TsMs)
+	log.Printf("Gravando lote de %d evento(s) no sink %s", len(events), kc.Sink.Name())
+	metrics.BatchSize.Observe(float64(len(events)))
+	_, err := resilience.Run(ctx, kc.RetryPolicy, kc.Breaker, func(ctx context.Context) error {
+		return kc.insertWithTimeout(ctx, events)
+	})
+	if err == nil {
+		log.Printf("Lote de %d evento(s) gravado com sucesso", len(events))
+		recordStored(events...)
+		kc.trackSchemas(ctx, events...)
+		return nil
+	}
+	if ctx.Err() != nil || integrityFailure(err) {
+		return err
+	}
 
-	// Query para inserir dados na tabela audit_trail
-	query := `
-		INSERT INTO audit_trail (
-			connector, application, db_name, db_schema, db_table, event_operation, event_date, event
-		)
-		VALUES (
-			@connector, @application, @db_name, @db_schema, @db_table, @event_operation, @event_date, @event
-		);
-	`
+	log.Printf("Erro ao gravar o lote: %v. Gravando as mensagens individualmente...", err)
+	for _, pending := range batch {
+		if pending.handled {
+			continue
+		}
+		if err := kc.storeEvent(ctx, pending.msg, pending.event); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// processMessage decodifica e armazena a mensagem. Mensagens que não podem ser decodificadas
+// ou armazenadas são enviadas ao tópico de dead-letter; um erro só é retornado quando nem
+// isso foi possível ou quando o evento não pôde ser cifrado, e nesse caso a mensagem não deve
+// ser marcada como processada.
+func (kc *KafkaConsumer) processMessage(ctx context.Context, msg *sarama.ConsumerMessage) error {
+	switch route := kc.Router.Route(msg.Topic); route.Kind {
+	case routing.KindTransaction:
+		return kc.processTransactionMarker(ctx, msg, route)
+	case routing.KindSchema:
+		return kc.processSchemaChange(ctx, msg, route)
+	}
 
-	// Serializa o evento como string JSON
-	e := model.Event{
-		After:  event.After,
-		Before: event.Before,
+	event, err := kc.decodeMessage(ctx, msg)
+	if errors.Is(err, errTombstone) {
+		return nil
+	}
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	if errors.Is(err, errEncryption) {
+		return err
 	}
-	eventData, err := json.Marshal(e)
 	if err != nil {
-		return fmt.Errorf("erro ao converter evento para JSON: %w", err)
+		return kc.publishDeadLetter(ctx, msg, deadletter.ErrorClassDecode, 1, err)
 	}
+	return kc.storeEvent(ctx, msg, event)
+}
 
-	// Cria o mapa de parâmetros para a query
-	params := map[string]interface{}{
-		"connector":       event.Source.Connector,
-		"application":     event.Application,
-		"db_name":         event.Source.Db,
-		"db_schema":       event.Source.Schema,
-		"db_table":        event.Source.Table,
-		"event_operation": event.Op,
-		"event_date":      eventDate,
-		"event":           string(eventData),
+// decodeMessage decodifica o evento Kafka para a estrutura KafkaEvent e valida a operação.
+// Retorna errTombstone para mensagens sem valor.
+func (kc *KafkaConsumer) decodeMessage(ctx context.Context, msg *sarama.ConsumerMessage) (model.KafkaEvent, error) {
+	if len(msg.Value) == 0 {
+		log.Printf("Tombstone recebido - Partição: %d, Offset: %d, Chave: %s. Ignorando.", msg.Partition, msg.Offset, string(msg.Key))
+		return model.KafkaEvent{}, errTombstone
+	}
+	route := kc.Router.Route(msg.Topic)
+	event, err := kc.decodeWithRetry(ctx, msg, route)
+	if err != nil {
+		log.Printf("Erro ao decodificar mensagem: %v", err)
+		return event, err
+	}
+	if err := event.Validate(); err != nil {
+		log.Printf("Evento inválido: %v", err)
+		return event, err
+	}
+	decoder.NormalizeLogicalTypes(&event)
+	event.Kafka = model.KafkaCoordinates{Topic: msg.Topic, Partition: msg.Partition, Offset: msg.Offset}
+	metrics.MessagesDecoded.WithLabelValues(msg.Topic, sink.SourceTable(event.Source)).Inc()
+	if route.Application != "" {
+		event.Application = route.Application
+	}
+	// O mascaramento precede o log do evento, o cálculo do diff e a gravação no sink
+	kc.Masker.Apply(&event)
+	if event.Op == model.OperationUpdate {
+		event.Diff = diff.Compute(event.Before, event.After)
+	}
+	// A criptografia é aplicada após o diff, que compara os valores em claro
+	if err := kc.Encryptor.Apply(&event); err != nil {
+		log.Printf("Erro ao cifrar o evento: %v", err)
+		return model.KafkaEvent{}, fmt.Errorf("%w: %w", errEncryption, err)
 	}
 
-	// Executa a query SQL
-	_, err = kc.ImmuClient.SQLExec(context.Background(), query, params)
+	switch event.Op {
+	case model.OperationRead:
+		log.Printf("Leitura de snapshot recebida: Table=%s, Snapshot=%s", event.Source.Table, event.Source.Snapshot)
+	case model.OperationDelete:
+		log.Printf("Exclusão recebida: Table=%s", event.Source.Table)
+	case model.OperationTruncate:
+		log.Printf("Truncate recebido: Table=%s", event.Source.Table)
+	}
+
+	log.Printf("Mensagem decodificada com sucesso: %+v", event.After)
+	return event, nil
+}
+
+// decodeWithRetry decodifica a mensagem, aguardando enquanto o schema registry estiver
+// indisponível em vez de enviar ao dead-letter uma mensagem que não tem problema
+func (kc *KafkaConsumer) decodeWithRetry(ctx context.Context, msg *sarama.ConsumerMessage, route routing.Route) (model.KafkaEvent, error) {
+	var event model.KafkaEvent
+	err := kc.retryDecode(ctx, msg, route, func(dec decoder.Decoder) error {
+		var err error
+		event, err = dec.Decode(msg.Value)
+		return err
+	})
+	return event, err
+}
+
+// retryDecode executa a decodificação com o decoder da rota, repetindo-a enquanto o schema
+// registry estiver indisponível
+func (kc *KafkaConsumer) retryDecode(ctx context.Context, msg *sarama.ConsumerMessage, route routing.Route, decode func(dec decoder.Decoder) error) error {
+	dec, ok := kc.Decoders[route.Decoder]
+	if !ok {
+		return fmt.Errorf("decoder '%s' não configurado para o tópico %s", route.Decoder, msg.Topic)
+	}
+
+	for attempt := 1; ; attempt++ {
+		err := decode(dec)
+		if !errors.Is(err, decoder.ErrRegistryUnavailable) {
+			return err
+		}
+
+		backoff := kc.RetryPolicy.Backoff(attempt)
+		log.Printf("Erro ao resolver o schema da mensagem (tentativa %d): %v. Tentando novamente em %s...", attempt, err, backoff)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(backoff):
+		}
+	}
+}
+
+// storeEvent grava o evento no sink, repetindo em caso de falhas transitórias, e envia a
+// mensagem ao dead-letter quando a gravação não é possível. Uma falha na verificação de
+// integridade do sink é retornada sem o envio ao dead-letter.
+func (kc *KafkaConsumer) storeEvent(ctx context.Context, msg *sarama.ConsumerMessage, event model.KafkaEvent) error {
+	attempts, err := resilience.Run(ctx, kc.RetryPolicy, kc.Breaker, func(ctx context.Context) error {
+		return kc.insertWithTimeout(ctx, []model.KafkaEvent{event})
+	})
 	if err != nil {
-		return fmt.Errorf("erro ao inserir evento no ImmuDB: %w", err)
+		if ctx.Err() != nil || integrityFailure(err) {
+			return err
+		}
+		log.Printf("Erro ao gravar no sink %s após %d tentativa(s): %v", kc.Sink.Name(), attempts, err)
+		return kc.publishDeadLetter(ctx, msg, deadletter.ErrorClassStorage, attempts, err)
 	}
 
-	log.Printf("Inserção no ImmuDB concluída: Table=%s, Operation=%s", event.Source.Table, event.Op)
+	log.Printf("Registro gravado com sucesso")
+	recordStored(event)
+	kc.trackSchemas(ctx, event)
 	return nil
 }
+
+// publishDeadLetter envia a mensagem ao dead-letter e a contabiliza como falha na etapa
+// correspondente à classe do erro
+func (kc *KafkaConsumer) publishDeadLetter(ctx context.Context, msg *sarama.ConsumerMessage, class string, attempts int, cause error) error {
+	metrics.MessagesFailed.WithLabelValues(msg.Topic, class).Inc()
+	return kc.DeadLetter.Publish(ctx, msg, class, attempts, cause)
+}
+
+// recordStored contabiliza os eventos gravados e a latência entre a alteração no banco de
+// origem e a gravação
+func recordStored(events ...model.KafkaEvent) {
+	now := time.Now()
+	for _, event := range events {
+		table := sink.SourceTable(event.Source)
+		metrics.MessagesStored.WithLabelValues(event.Kafka.Topic, table).Inc()
+		if event.Source.TsMs != 0 {
+			latency := now.Sub(time.UnixMilli(event.Source.TsMs))
+			metrics.EndToEndLatency.WithLabelValues(event.Kafka.Topic, table).Observe(latency.Seconds())
+		}
+	}
+}
+
+// recordLag atualiza o lag da partição a partir do high-water mark informado pelo Kafka, que é
+// o offset da próxima mensagem a ser produzida
+func recordLag(claim sarama.ConsumerGroupClaim, offset int64) {
+	lag := claim.HighWaterMarkOffset() - offset - 1
+	if lag < 0 {
+		lag = 0
+	}
+	metrics.ConsumerLag.WithLabelValues(claim.Topic(), strconv.Itoa(int(claim.Partition()))).Set(float64(lag))
+}
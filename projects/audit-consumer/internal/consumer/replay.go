@@ -0,0 +1,135 @@
+package consumer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/IBM/sarama"
+	"log"
+	"time"
+)
+
+// ReplayRange é o intervalo de offsets relido de uma partição, de Start até End (exclusivo)
+type ReplayRange struct {
+	Topic     string
+	Partition int32
+	Start     int64
+	End       int64
+}
+
+// ReplayResult é o resultado do replay de uma partição. Next é o offset a partir do qual o replay
+// deve ser retomado se tiver sido interrompido.
+type ReplayResult struct {
+	Processed int64
+	Next      int64
+}
+
+// Replay relê as mensagens do intervalo com o mesmo pipeline do consumo contínuo: decodificação,
+// transformação, gravação no sink e envio ao dead-letter. O replay não usa o consumer group nem
+// altera os seus offsets, e depende da idempotência do sink para não registrar duas vezes os
+// eventos já gravados. A leitura termina no fim do intervalo ou quando nenhuma mensagem chega em
+// idleTimeout, o que ocorre quando os últimos offsets do intervalo não correspondem a mensagens
+// (registros de controle de transações do Kafka ou tópicos compactados). Se o Kafka encerrar a
+// leitura da partição antes do fim do intervalo, por exemplo quando a retenção remove o segmento
+// em leitura (ErrOffsetOutOfRange), o replay retorna um erro com o offset de retomada.
+func (kc *KafkaConsumer) Replay(ctx context.Context, kafkaConsumer sarama.Consumer, r ReplayRange, idleTimeout time.Duration) (ReplayResult, error) {
+	result := ReplayResult{Next: r.Start}
+	if r.Start >= r.End {
+		return result, nil
+	}
+	log.Printf("Relendo o tópico %s - Partição: %d, Offsets: %d a %d", r.Topic, r.Partition, r.Start, r.End-1)
+
+	partitionConsumer, err := kafkaConsumer.ConsumePartition(r.Topic, r.Partition, r.Start)
+	if err != nil {
+		return result, fmt.Errorf("erro ao ler a partição %d do tópico %s: %w", r.Partition, r.Topic, err)
+	}
+	defer partitionConsumer.Close()
+
+	batch := make([]pendingMessage, 0, kc.BatchSize)
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		if err := kc.flushBatch(ctx, batch); err != nil {
+			return fmt.Errorf("gravação do lote interrompida no offset %d: %w", batch[0].msg.Offset, err)
+		}
+		result.Processed += int64(len(batch))
+		result.Next = batch[len(batch)-1].msg.Offset + 1
+		batch = batch[:0]
+		return nil
+	}
+
+	readErrors := partitionConsumer.Errors()
+	var lastErr error
+	for {
+		select {
+		case <-ctx.Done():
+			return result, ctx.Err()
+		case <-time.After(idleTimeout):
+			log.Printf("Nenhuma mensagem recebida em %s - Partição: %d, Offset: %d. Encerrando o replay da partição.",
+				idleTimeout, r.Partition, result.Next)
+			return result, flush()
+		case err, ok := <-readErrors:
+			if !ok {
+				readErrors = nil
+				continue
+			}
+			log.Printf("Erro na leitura do tópico %s - Partição: %d: %v", r.Topic, r.Partition, err)
+			lastErr = err
+		case msg, ok := <-partitionConsumer.Messages():
+			if !ok {
+				if err := flush(); err != nil {
+					return result, err
+				}
+				return result, fmt.Errorf("a leitura da partição %d do tópico %s foi encerrada no offset %d: %w",
+					r.Partition, r.Topic, result.Next, closedReason(partitionConsumer, lastErr))
+			}
+			if msg.Offset >= r.End {
+				return result, flush()
+			}
+
+			if kc.BatchSize > 1 {
+				pending, err := kc.prepareMessage(ctx, msg)
+				if err != nil {
+					return result, fmt.Errorf("processamento interrompido no offset %d: %w", msg.Offset, err)
+				}
+				batch = append(batch, pending)
+				if len(batch) >= kc.BatchSize {
+					if err := flush(); err != nil {
+						return result, err
+					}
+				}
+			} else {
+				if err := kc.processMessage(ctx, msg); err != nil {
+					return result, fmt.Errorf("processamento interrompido no offset %d: %w", msg.Offset, err)
+				}
+				result.Processed++
+				result.Next = msg.Offset + 1
+			}
+
+			if msg.Offset+1 >= r.End {
+				return result, flush()
+			}
+		}
+	}
+}
+
+// closedReason retorna o erro que encerrou a leitura da partição: o último erro entregue pelo
+// Kafka antes do fechamento do canal de mensagens, ainda pendente ou já recebido (lastErr)
+func closedReason(partitionConsumer sarama.PartitionConsumer, lastErr error) error {
+	reason := lastErr
+	if reason == nil {
+		reason = errors.New("canal de mensagens fechado")
+	}
+	for {
+		select {
+		case err, ok := <-partitionConsumer.Errors():
+			if !ok {
+				return reason
+			}
+			reason = err
+		default:
+			return reason
+		}
+	}
+}
@@ -0,0 +1,97 @@
+package consumer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/IBM/sarama"
+	"github.com/Waelson/audit/audit-consumer/internal/sink"
+	"testing"
+	"time"
+)
+
+// replaySource é um consumidor do Kafka que entrega as mensagens preparadas de uma partição
+type replaySource struct {
+	sarama.Consumer
+	partition *replayPartition
+}
+
+func (s *replaySource) ConsumePartition(string, int32, int64) (sarama.PartitionConsumer, error) {
+	return s.partition, nil
+}
+
+// replayPartition entrega as mensagens e os erros informados e, se closed, fecha os canais como o
+// sarama faz ao encerrar a leitura da partição
+type replayPartition struct {
+	sarama.PartitionConsumer
+	messages chan *sarama.ConsumerMessage
+	errors   chan *sarama.ConsumerError
+}
+
+func newReplayPartition(topic string, offsets []int64, readErr error, closed bool) *replayPartition {
+	p := &replayPartition{
+		messages: make(chan *sarama.ConsumerMessage, len(offsets)),
+		errors:   make(chan *sarama.ConsumerError, 1),
+	}
+	for _, offset := range offsets {
+		p.messages <- &sarama.ConsumerMessage{Topic: topic, Offset: offset, Value: changeEvent(int(offset))}
+	}
+	if readErr != nil {
+		p.errors <- &sarama.ConsumerError{Topic: topic, Err: readErr}
+	}
+	if closed {
+		close(p.messages)
+		close(p.errors)
+	}
+	return p
+}
+
+func (p *replayPartition) Messages() <-chan *sarama.ConsumerMessage { return p.messages }
+func (p *replayPartition) Errors() <-chan *sarama.ConsumerError     { return p.errors }
+func (p *replayPartition) Close() error                             { return nil }
+
+func TestReplay(t *testing.T) {
+	tests := []struct {
+		name    string
+		offsets []int64
+		readErr error
+		closed  bool
+		want    ReplayResult
+		wantErr error
+	}{
+		{name: "fim do intervalo", offsets: []int64{10, 11, 12, 13, 14}, want: ReplayResult{Processed: 4, Next: 14}},
+		{name: "sem mensagens até o fim do intervalo", offsets: []int64{10, 11}, want: ReplayResult{Processed: 2, Next: 12}},
+		{
+			name: "leitura encerrada pela retenção", offsets: []int64{10, 11, 12}, readErr: sarama.ErrOffsetOutOfRange, closed: true,
+			want: ReplayResult{Processed: 3, Next: 13}, wantErr: sarama.ErrOffsetOutOfRange,
+		},
+		{name: "canais fechados sem erro", offsets: []int64{10}, closed: true, want: ReplayResult{Processed: 1, Next: 11}, wantErr: errors.New("")},
+	}
+	for _, tt := range tests {
+		for _, batchSize := range []int{1, 2} {
+			t.Run(fmt.Sprintf("%s/batch=%d", tt.name, batchSize), func(t *testing.T) {
+				kc, memory, _ := newTestConsumer(t)
+				kc.BatchSize = batchSize
+				source := &replaySource{partition: newReplayPartition("audit-trail", tt.offsets, tt.readErr, tt.closed)}
+
+				r := ReplayRange{Topic: "audit-trail", Start: 10, End: 14}
+				result, err := kc.Replay(context.Background(), source, r, 50*time.Millisecond)
+				switch {
+				case tt.wantErr == nil && err != nil:
+					t.Fatalf("Replay() = %v", err)
+				case tt.wantErr != nil && err == nil:
+					t.Fatal("Replay() não retornou erro")
+				case tt.readErr != nil && !errors.Is(err, tt.readErr):
+					t.Fatalf("Replay() = %v, esperado %v", err, tt.readErr)
+				}
+				if result != tt.want {
+					t.Errorf("resultado = %+v, esperado %+v", result, tt.want)
+				}
+				events := memory.Events(sink.Target{Database: testDatabase, Table: "audit_trail"})
+				if int64(len(events)) != tt.want.Processed {
+					t.Errorf("eventos gravados = %d, esperado %d", len(events), tt.want.Processed)
+				}
+			})
+		}
+	}
+}
@@ -0,0 +1,204 @@
+package consumer
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"github.com/IBM/sarama"
+	"github.com/Waelson/audit/audit-consumer/internal/deadletter"
+	"github.com/Waelson/audit/audit-consumer/internal/decoder"
+	"github.com/Waelson/audit/audit-consumer/internal/model"
+	"github.com/Waelson/audit/audit-consumer/internal/resilience"
+	"github.com/Waelson/audit/audit-consumer/internal/routing"
+	"github.com/Waelson/audit/audit-consumer/internal/sink"
+	"log"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// quotedIdentifierPattern extrai as partes de um identificador de tabela entre aspas, como
+// "payment_db"."public"."payments", em que aspas duplicadas representam uma aspa no nome
+var quotedIdentifierPattern = regexp.MustCompile(`"((?:[^"]|"")*)"`)
+
+// processSchemaChange decodifica um evento do tópico de alterações de schema e registra o DDL de
+// cada tabela afetada no histórico do banco da rota. Eventos que não podem ser decodificados ou
+// registrados são enviados ao dead-letter; um erro só é retornado quando nem isso foi possível.
+func (kc *KafkaConsumer) processSchemaChange(ctx context.Context, msg *sarama.ConsumerMessage, route routing.Route) error {
+	if len(msg.Value) == 0 {
+		log.Printf("Tombstone recebido no tópico de alterações de schema - Partição: %d, Offset: %d. Ignorando.", msg.Partition, msg.Offset)
+		return nil
+	}
+
+	var change model.SchemaChange
+	err := kc.retryDecode(ctx, msg, route, func(dec decoder.Decoder) error {
+		var err error
+		change, err = dec.DecodeSchemaChange(msg.Value)
+		return err
+	})
+	if err == nil {
+		err = change.Validate()
+	}
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	if err != nil {
+		log.Printf("Erro ao decodificar alteração de schema: %v", err)
+		return kc.publishDeadLetter(ctx, msg, deadletter.ErrorClassDecode, 1, err)
+	}
+
+	records := schemaChangeRecords(msg, change, time.Now())
+	log.Printf("Alteração de schema recebida - Banco: %s, Tabelas: %d, DDL: %s", change.DatabaseName, len(change.TableChanges), change.DDL)
+	store, ok := kc.Sink.(sink.SchemaChangeStore)
+	if !ok {
+		err := fmt.Errorf("o sink %s não registra alterações de schema", kc.Sink.Name())
+		log.Printf("Erro ao registrar a alteração de schema: %v", err)
+		return kc.publishDeadLetter(ctx, msg, deadletter.ErrorClassStorage, 1, err)
+	}
+	attempts, err := resilience.Run(ctx, kc.RetryPolicy, kc.Breaker, func(ctx context.Context) error {
+		return kc.recordSchemaChanges(ctx, store, route.Database, records)
+	})
+	if err != nil {
+		if ctx.Err() != nil || integrityFailure(err) {
+			return err
+		}
+		log.Printf("Erro ao registrar a alteração de schema após %d tentativa(s): %v", attempts, err)
+		return kc.publishDeadLetter(ctx, msg, deadletter.ErrorClassStorage, attempts, err)
+	}
+	return nil
+}
+
+// recordSchemaChanges registra as alterações de schema no histórico do banco. Um evento entregue
+// novamente tem as mesmas chaves e é ignorado pelo sink.
+func (kc *KafkaConsumer) recordSchemaChanges(ctx context.Context, store sink.SchemaChangeStore, database string, records []sink.SchemaChangeRecord) error {
+	if kc.WriteTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, kc.WriteTimeout)
+		defer cancel()
+	}
+	if err := store.InsertSchemaChanges(ctx, database, records); err != nil {
+		return err
+	}
+	log.Printf("%d alteração(ões) de schema registrada(s) no banco '%s'.", len(records), database)
+	return nil
+}
+
+// schemaChangeRecords converte o evento em um registro por tabela alterada. A chave de cada
+// registro combina a posição do DDL no log do banco de origem, o identificador da tabela e o
+// resumo do DDL; sem posição, as coordenadas da mensagem no Kafka são usadas no lugar dela.
+func schemaChangeRecords(msg *sarama.ConsumerMessage, change model.SchemaChange, recordedAt time.Time) []sink.SchemaChangeRecord {
+	position := change.Position
+	if len(position) == 0 {
+		position = change.Source
+	}
+	var positionJSON string
+	if len(position) > 0 {
+		// As chaves dos mapas são serializadas em ordem, o que mantém a posição estável
+		if data, err := json.Marshal(position); err == nil {
+			positionJSON = string(data)
+		}
+	}
+	origin := "ddl:" + positionJSON
+	if positionJSON == "" {
+		origin = fmt.Sprintf("kafka:%s:%d:%d", msg.Topic, msg.Partition, msg.Offset)
+	}
+	ddlSum := sha256.Sum256([]byte(change.DDL))
+	ddlDigest := hex.EncodeToString(ddlSum[:8])
+
+	base := sink.SchemaChangeRecord{
+		SourceName: stringField(change.Source, "name"),
+		DbName:     change.DatabaseName,
+		DbSchema:   change.SchemaName,
+		DDL:        change.DDL,
+		Position:   positionJSON,
+		ChangeDate: schemaChangeDate(msg, change),
+		RecordedAt: recordedAt,
+	}
+	if base.SourceName == "" {
+		base.SourceName = stringField(change.Source, "server")
+	}
+	if base.ChangeDate.IsZero() {
+		base.ChangeDate = recordedAt
+	}
+
+	if len(change.TableChanges) == 0 {
+		record := base
+		record.Key = fmt.Sprintf("%s::%s", origin, ddlDigest)
+		if fields := strings.Fields(change.DDL); len(fields) > 0 {
+			record.ChangeType = strings.ToUpper(fields[0])
+		}
+		return []sink.SchemaChangeRecord{record}
+	}
+
+	records := make([]sink.SchemaChangeRecord, 0, len(change.TableChanges))
+	for _, tableChange := range change.TableChanges {
+		record := base
+		record.Key = fmt.Sprintf("%s:%s:%s", origin, tableChange.ID, ddlDigest)
+		record.ChangeType = tableChange.Type
+		record.DbName, record.DbSchema, record.DbTable = splitTableID(tableChange.ID, change.DatabaseName, change.SchemaName)
+		if table := strings.TrimSpace(string(tableChange.Table)); table != "" && table != "null" {
+			record.Definition = table
+		}
+		records = append(records, record)
+	}
+	return records
+}
+
+// splitTableID separa o identificador da tabela informado pelo Debezium em banco, schema e
+// tabela. Identificadores com três partes informam os três; com duas, o banco e a tabela (nos
+// bancos sem schema, como o MySQL). As partes ausentes assumem o banco e o schema do evento.
+func splitTableID(id, database, schema string) (string, string, string) {
+	var parts []string
+	if matches := quotedIdentifierPattern.FindAllStringSubmatch(id, -1); len(matches) > 0 {
+		for _, match := range matches {
+			parts = append(parts, strings.ReplaceAll(match[1], `""`, `"`))
+		}
+	} else {
+		parts = strings.Split(id, ".")
+	}
+
+	switch len(parts) {
+	case 1:
+		return database, schema, parts[0]
+	case 2:
+		return parts[0], schema, parts[1]
+	default:
+		return parts[len(parts)-3], parts[len(parts)-2], parts[len(parts)-1]
+	}
+}
+
+// schemaChangeDate retorna o instante do DDL no banco de origem (source.ts_ms), o instante do
+// processamento pelo Debezium (ts_ms), o instante do registro do histórico (position.ts_sec) ou,
+// na falta deles, o timestamp da mensagem, que é zero quando o produtor não o informa
+func schemaChangeDate(msg *sarama.ConsumerMessage, change model.SchemaChange) time.Time {
+	if tsMs := numberField(change.Source, "ts_ms"); tsMs > 0 {
+		return time.UnixMilli(tsMs)
+	}
+	if change.TsMs > 0 {
+		return time.UnixMilli(change.TsMs)
+	}
+	if tsSec := numberField(change.Position, "ts_sec"); tsSec > 0 {
+		return time.Unix(tsSec, 0)
+	}
+	return msg.Timestamp
+}
+
+// stringField retorna o campo textual do mapa, ou vazio se ele não existir
+func stringField(fields map[string]interface{}, name string) string {
+	value, _ := fields[name].(string)
+	return value
+}
+
+// numberField retorna o campo numérico do mapa, ou zero se ele não existir
+func numberField(fields map[string]interface{}, name string) int64 {
+	switch value := fields[name].(type) {
+	case json.Number:
+		number, _ := value.Int64()
+		return number
+	case float64:
+		return int64(value)
+	}
+	return 0
+}
@@ -0,0 +1,132 @@
+package consumer
+
+import (
+	"github.com/IBM/sarama"
+	"github.com/Waelson/audit/audit-consumer/internal/decoder"
+	"github.com/Waelson/audit/audit-consumer/internal/model"
+	"testing"
+	"time"
+)
+
+func TestSplitTableID(t *testing.T) {
+	tests := []struct {
+		id                      string
+		database, schema, table string
+	}{
+		{id: `"payment_db"."public"."payments"`, database: "payment_db", schema: "public", table: "payments"},
+		{id: `"payment_db"."public"."pay.ments"`, database: "payment_db", schema: "public", table: "pay.ments"},
+		{id: `"payment_db"."public"."say ""hi"""`, database: "payment_db", schema: "public", table: `say "hi"`},
+		{id: "payment_db.public.payments", database: "payment_db", schema: "public", table: "payments"},
+		{id: "inventory.orders", database: "inventory", schema: "evento", table: "orders"},
+		{id: `"orders"`, database: "banco", schema: "evento", table: "orders"},
+		{id: "orders", database: "banco", schema: "evento", table: "orders"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.id, func(t *testing.T) {
+			database, schema, table := splitTableID(tt.id, "banco", "evento")
+			if database != tt.database || schema != tt.schema || table != tt.table {
+				t.Errorf("splitTableID() = %s, %s, %s, esperado %s, %s, %s", database, schema, table, tt.database, tt.schema, tt.table)
+			}
+		})
+	}
+}
+
+// decodeSchemaChange decodifica o evento de alteração de schema como o consumidor
+func decodeSchemaChange(t *testing.T, value string) model.SchemaChange {
+	t.Helper()
+	change, err := decoder.NewJSONDecoder().DecodeSchemaChange([]byte(value))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return change
+}
+
+func TestSchemaChangeRecords(t *testing.T) {
+	recordedAt := time.Unix(1700000100, 0)
+	msg := &sarama.ConsumerMessage{Topic: "payment", Partition: 2, Offset: 7, Timestamp: time.Unix(1700000050, 0)}
+	change := decodeSchemaChange(t, `{
+		"source": {"name": "payment", "db": "payment_db", "ts_ms": 1700000000000, "lsn": 9007199254740993},
+		"databaseName": "payment_db", "schemaName": "public",
+		"ddl": "ALTER TABLE payments ADD note text; CREATE TABLE refunds (id int)",
+		"tableChanges": [
+			{"type": "ALTER", "id": "\"payment_db\".\"public\".\"payments\"", "table": {"columns": [{"name": "note"}]}},
+			{"type": "CREATE", "id": "\"payment_db\".\"public\".\"refunds\"", "table": null}
+		]
+	}`)
+
+	records := schemaChangeRecords(msg, change, recordedAt)
+	if len(records) != 2 {
+		t.Fatalf("registros = %d, esperado 2", len(records))
+	}
+	payments, refunds := records[0], records[1]
+	if payments.ChangeType != "ALTER" || payments.DbName != "payment_db" || payments.DbSchema != "public" || payments.DbTable != "payments" {
+		t.Errorf("registro de payments = %+v", payments)
+	}
+	if payments.Definition != `{"columns": [{"name": "note"}]}` || refunds.Definition != "" {
+		t.Errorf("definições = %q e %q, esperado a tabela informada e vazio para null", payments.Definition, refunds.Definition)
+	}
+	if refunds.ChangeType != "CREATE" || refunds.DbTable != "refunds" {
+		t.Errorf("registro de refunds = %+v", refunds)
+	}
+	if payments.Key == refunds.Key {
+		t.Error("tabelas do mesmo DDL com a mesma chave")
+	}
+	if want := `{"db":"payment_db","lsn":9007199254740993,"name":"payment","ts_ms":1700000000000}`; payments.Position != want {
+		t.Errorf("posição = %s, esperado %s", payments.Position, want)
+	}
+	if payments.SourceName != "payment" || !payments.ChangeDate.Equal(time.UnixMilli(1700000000000)) || !payments.RecordedAt.Equal(recordedAt) {
+		t.Errorf("origem = %s, data = %s, registro = %s", payments.SourceName, payments.ChangeDate, payments.RecordedAt)
+	}
+
+	// O mesmo evento entregue novamente, em outro offset, produz as mesmas chaves
+	redelivered := *msg
+	redelivered.Offset = 90
+	again := schemaChangeRecords(&redelivered, change, recordedAt.Add(time.Hour))
+	if again[0].Key != payments.Key || again[1].Key != refunds.Key {
+		t.Errorf("chaves da reentrega = %s e %s, esperado %s e %s", again[0].Key, again[1].Key, payments.Key, refunds.Key)
+	}
+}
+
+func TestSchemaChangeRecordsWithoutTables(t *testing.T) {
+	msg := &sarama.ConsumerMessage{Topic: "payment", Partition: 2, Offset: 7, Timestamp: time.Unix(1700000050, 0)}
+	tests := []struct {
+		name       string
+		value      string
+		changeType string
+		keyPrefix  string
+		changeDate time.Time
+	}{
+		{
+			name:       "histórico com posição",
+			value:      `{"position": {"file": "binlog.000003", "pos": 154, "ts_sec": 1700000010}, "source": {"server": "inventory"}, "databaseName": "inventory", "ddl": "drop table orders"}`,
+			changeType: "DROP",
+			keyPrefix:  `ddl:{"file":"binlog.000003","pos":154,"ts_sec":1700000010}::`,
+			changeDate: time.Unix(1700000010, 0),
+		},
+		{
+			name:       "sem posição",
+			value:      `{"databaseName": "inventory", "ddl": "CREATE INDEX idx ON orders (id)"}`,
+			changeType: "CREATE",
+			keyPrefix:  "kafka:payment:2:7::",
+			changeDate: time.Unix(1700000050, 0),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			records := schemaChangeRecords(msg, decodeSchemaChange(t, tt.value), time.Unix(1700000100, 0))
+			if len(records) != 1 {
+				t.Fatalf("registros = %d, esperado 1", len(records))
+			}
+			record := records[0]
+			if record.ChangeType != tt.changeType || record.DbName != "inventory" {
+				t.Errorf("tipo = %s, banco = %s, esperado %s e inventory", record.ChangeType, record.DbName, tt.changeType)
+			}
+			if len(record.Key) != len(tt.keyPrefix)+16 || record.Key[:len(tt.keyPrefix)] != tt.keyPrefix {
+				t.Errorf("chave = %s, esperado o prefixo %s e o resumo do DDL", record.Key, tt.keyPrefix)
+			}
+			if !record.ChangeDate.Equal(tt.changeDate) {
+				t.Errorf("data = %s, esperado %s", record.ChangeDate, tt.changeDate)
+			}
+		})
+	}
+}
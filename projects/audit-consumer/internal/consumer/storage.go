@@ -0,0 +1,47 @@
+package consumer
+
+import (
+	"context"
+	"errors"
+	"github.com/Waelson/audit/audit-consumer/internal/metrics"
+	"github.com/Waelson/audit/audit-consumer/internal/model"
+	"github.com/Waelson/audit/audit-consumer/internal/resilience"
+	"github.com/Waelson/audit/audit-consumer/internal/sink"
+	"log"
+	"time"
+)
+
+// insertWithTimeout executa uma tentativa de gravação no sink limitada pelo timeout de escrita.
+// Os eventos de uma chamada vêm sempre da mesma partição e, portanto, compartilham a mesma rota.
+func (kc *KafkaConsumer) insertWithTimeout(ctx context.Context, events []model.KafkaEvent) error {
+	if kc.WriteTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, kc.WriteTimeout)
+		defer cancel()
+	}
+
+	target := kc.targetFor(events[0].Kafka.Topic)
+	start := time.Now()
+	err := kc.Sink.Write(ctx, target, events)
+	metrics.WriteDuration.WithLabelValues(kc.Sink.Name(), target.Database, target.Table).Observe(time.Since(start).Seconds())
+	if err != nil {
+		log.Printf("Tentativa de gravação no sink %s falhou (classe: %s): %v", kc.Sink.Name(), resilience.ClassifyError(err), err)
+		metrics.StorageAttempts.WithLabelValues(resilience.ClassifyError(err)).Inc()
+		return err
+	}
+	metrics.StorageAttempts.WithLabelValues("success").Inc()
+	return nil
+}
+
+// integrityFailure indica se o sink recusou a gravação por falha na verificação de integridade.
+// Nesse caso a mensagem não segue para o dead-letter: ela permanece sem marcação, e o
+// processamento da partição é interrompido até a intervenção de um operador.
+func integrityFailure(err error) bool {
+	return errors.Is(err, sink.ErrVerificationFailed)
+}
+
+// targetFor retorna a tabela de destino dos eventos do tópico informado
+func (kc *KafkaConsumer) targetFor(topic string) sink.Target {
+	route := kc.Router.Route(topic)
+	return sink.Target{Database: route.Database, Table: route.Table}
+}
@@ -0,0 +1,207 @@
+package consumer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/IBM/sarama"
+	"github.com/Waelson/audit/audit-consumer/internal/deadletter"
+	"github.com/Waelson/audit/audit-consumer/internal/decoder"
+	"github.com/Waelson/audit/audit-consumer/internal/metrics"
+	"github.com/Waelson/audit/audit-consumer/internal/model"
+	"github.com/Waelson/audit/audit-consumer/internal/resilience"
+	"github.com/Waelson/audit/audit-consumer/internal/routing"
+	"github.com/Waelson/audit/audit-consumer/internal/sink"
+	"log"
+	"time"
+)
+
+// processTransactionMarker decodifica um marcador do tópico de transações e registra as
+// transações encerradas (END) como pendentes de validação. Marcadores que não podem ser
+// decodificados ou registrados são enviados ao dead-letter; um erro só é retornado quando nem
+// isso foi possível.
+func (kc *KafkaConsumer) processTransactionMarker(ctx context.Context, msg *sarama.ConsumerMessage, route routing.Route) error {
+	if len(msg.Value) == 0 {
+		log.Printf("Tombstone recebido no tópico de transações - Partição: %d, Offset: %d. Ignorando.", msg.Partition, msg.Offset)
+		return nil
+	}
+
+	var marker model.TransactionMarker
+	err := kc.retryDecode(ctx, msg, route, func(dec decoder.Decoder) error {
+		var err error
+		marker, err = dec.DecodeTransaction(msg.Value)
+		return err
+	})
+	if err == nil {
+		err = marker.Validate()
+	}
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	if err != nil {
+		log.Printf("Erro ao decodificar marcador de transação: %v", err)
+		return kc.publishDeadLetter(ctx, msg, deadletter.ErrorClassDecode, 1, err)
+	}
+
+	if marker.Status == model.TransactionBegin {
+		log.Printf("Início de transação recebido: %s", marker.ID)
+		return nil
+	}
+
+	log.Printf("Fim de transação recebido: %s, Eventos: %d", marker.ID, marker.EventCount)
+	store, ok := kc.Sink.(sink.TransactionStore)
+	if !ok {
+		err := fmt.Errorf("o sink %s não registra transações", kc.Sink.Name())
+		log.Printf("Erro ao registrar a transação %s: %v", marker.ID, err)
+		return kc.publishDeadLetter(ctx, msg, deadletter.ErrorClassStorage, 1, err)
+	}
+	attempts, err := resilience.Run(ctx, kc.RetryPolicy, kc.Breaker, func(ctx context.Context) error {
+		return kc.recordTransaction(ctx, store, route.Database, marker)
+	})
+	if err != nil {
+		if ctx.Err() != nil || integrityFailure(err) {
+			return err
+		}
+		log.Printf("Erro ao registrar a transação %s após %d tentativa(s): %v", marker.ID, attempts, err)
+		return kc.publishDeadLetter(ctx, msg, deadletter.ErrorClassStorage, attempts, err)
+	}
+	return nil
+}
+
+// recordTransaction registra a transação como pendente de validação. Um marcador entregue
+// novamente é ignorado: a chave primária impede um segundo registro.
+func (kc *KafkaConsumer) recordTransaction(ctx context.Context, store sink.TransactionStore, database string, marker model.TransactionMarker) error {
+	if kc.WriteTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, kc.WriteTimeout)
+		defer cancel()
+	}
+
+	record := sink.TransactionRecord{
+		ID:              marker.ID,
+		Status:          sink.TransactionPending,
+		EventCount:      marker.EventCount,
+		DataCollections: marker.DataCollections,
+		CommitDate:      time.UnixMilli(marker.TsMs),
+		RecordedAt:      time.Now(),
+	}
+	err := store.InsertTransaction(ctx, database, record)
+	if errors.Is(err, sink.ErrDuplicate) {
+		log.Printf("Transação %s já registrada, ignorando.", marker.ID)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	metrics.Transactions.WithLabelValues(sink.TransactionPending).Inc()
+	log.Printf("Transação %s registrada no banco '%s', aguardando %d evento(s).", marker.ID, database, marker.EventCount)
+	return nil
+}
+
+// ValidateTransactions verifica periodicamente, em cada banco de destino, se os eventos das
+// transações pendentes foram gravados na trilha. As transações completas são marcadas como
+// complete; as que não se completam dentro do timeout, como incomplete. Como a validação é
+// feita sobre os registros gravados, ela sobrevive a reinícios e pode ser executada por várias
+// instâncias do consumidor.
+func (kc *KafkaConsumer) ValidateTransactions(ctx context.Context, interval, timeout time.Duration) {
+	store, ok := kc.Sink.(sink.TransactionStore)
+	if !ok {
+		log.Printf("O sink %s não registra transações; validação de transações desativada.", kc.Sink.Name())
+		return
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			for database := range kc.Router.Databases() {
+				if err := kc.validatePending(ctx, store, database, timeout); err != nil {
+					log.Printf("Erro ao validar as transações do banco '%s': %v", database, err)
+				}
+			}
+		}
+	}
+}
+
+// validatePending valida as transações pendentes registradas em um banco
+func (kc *KafkaConsumer) validatePending(ctx context.Context, store sink.TransactionStore, database string, timeout time.Duration) error {
+	pending, err := store.Transactions(ctx, database, sink.TransactionPending)
+	if err != nil {
+		return err
+	}
+
+	if len(pending) == 0 {
+		return nil
+	}
+	ids := make([]string, len(pending))
+	for i, record := range pending {
+		ids[i] = record.ID
+	}
+	counts, err := kc.countTransactionEvents(ctx, store, ids)
+	if err != nil {
+		return err
+	}
+
+	for _, record := range pending {
+		received := counts[record.ID]
+		record.ReceivedCount = 0
+		for _, count := range received {
+			record.ReceivedCount += count
+		}
+		complete := record.ReceivedCount >= record.EventCount
+		for i := range record.DataCollections {
+			collection := &record.DataCollections[i]
+			collection.ReceivedCount = received[collection.DataCollection]
+			if collection.ReceivedCount < collection.EventCount {
+				complete = false
+			}
+		}
+
+		switch {
+		case complete:
+			record.Status = sink.TransactionComplete
+		case time.Since(record.RecordedAt) > timeout:
+			record.Status = sink.TransactionIncomplete
+		default:
+			continue
+		}
+
+		now := time.Now()
+		record.ValidatedAt = &now
+		if err := store.UpdateTransaction(ctx, database, record); err != nil {
+			return err
+		}
+		metrics.Transactions.WithLabelValues(record.Status).Inc()
+		if record.Status == sink.TransactionComplete {
+			log.Printf("Transação %s completa: %d evento(s).", record.ID, record.ReceivedCount)
+		} else {
+			log.Printf("Transação %s incompleta após %s: %d de %d evento(s) recebidos.", record.ID, timeout, record.ReceivedCount, record.EventCount)
+		}
+	}
+	return nil
+}
+
+// countTransactionEvents conta os eventos das transações gravados em todas as tabelas de trilha
+// de todos os bancos de destino, com uma consulta por tabela para todas as transações. O marcador
+// END é registrado no banco da rota do tópico de transações, mas os eventos de cada tabela da
+// transação seguem a rota do seu próprio tópico, que não pode ser deduzida do nome da tabela.
+func (kc *KafkaConsumer) countTransactionEvents(ctx context.Context, store sink.TransactionStore, transactionIDs []string) (map[string]map[string]int64, error) {
+	received := make(map[string]map[string]int64)
+	for database, tables := range kc.Router.Databases() {
+		counts, err := store.CountTransactionEvents(ctx, database, tables, transactionIDs)
+		if err != nil {
+			return nil, err
+		}
+		for id, tableCounts := range counts {
+			if received[id] == nil {
+				received[id] = make(map[string]int64)
+			}
+			for table, count := range tableCounts {
+				received[id][table] += count
+			}
+		}
+	}
+	return received, nil
+}
@@ -0,0 +1,101 @@
+package consumer
+
+import (
+	"context"
+	"fmt"
+	"github.com/Waelson/audit/audit-consumer/internal/routing"
+	"github.com/Waelson/audit/audit-consumer/internal/sink"
+	"testing"
+	"time"
+)
+
+// transactionEvent retorna um evento de criação da tabela informada, na transação informada
+func transactionEvent(transactionID, table string, order int) []byte {
+	return []byte(fmt.Sprintf(`{"op":"c","after":{"id":%d},"transaction":{"id":"%s","total_order":%d,"data_collection_order":1},`+
+		`"source":{"connector":"postgresql","db":"payment_db","schema":"public","table":"%s","ts_ms":1700000000000,"lsn":%d}}`, order, transactionID, order, table, 1000+order))
+}
+
+// countingStore conta as consultas de contagem de eventos feitas ao sink
+type countingStore struct {
+	*sink.MemorySink
+	queries [][]string
+}
+
+func (s *countingStore) CountTransactionEvents(ctx context.Context, database string, tables []string, transactionIDs []string) (map[string]map[string]int64, error) {
+	s.queries = append(s.queries, transactionIDs)
+	return s.MemorySink.CountTransactionEvents(ctx, database, tables, transactionIDs)
+}
+
+func TestValidateTransactionsAcrossRoutes(t *testing.T) {
+	kc, memory, _ := newTestConsumer(t,
+		routing.Route{Topic: "audit.transaction", Kind: routing.KindTransaction, Database: "tx_db"},
+		routing.Route{Topic: "audit.orders", Database: "orders_db", Table: "orders_trail"},
+	)
+	ctx := context.Background()
+
+	consume(kc, "audit.transaction", []byte(`{"status":"END","id":"tx-1","event_count":2,"ts_ms":1700000000000,`+
+		`"data_collections":[{"data_collection":"public.payments","event_count":1},{"data_collection":"public.orders","event_count":1}]}`))
+	consume(kc, "audit-trail", transactionEvent("tx-1", "payments", 1))
+	if err := kc.validatePending(ctx, memory, "tx_db", time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	if complete, _ := memory.Transactions(ctx, "tx_db", sink.TransactionComplete); len(complete) != 0 {
+		t.Fatalf("transação completa com %d de 2 evento(s)", complete[0].ReceivedCount)
+	}
+
+	consume(kc, "audit.orders", transactionEvent("tx-1", "orders", 2))
+	if err := kc.validatePending(ctx, memory, "tx_db", time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	complete, err := memory.Transactions(ctx, "tx_db", sink.TransactionComplete)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(complete) != 1 || complete[0].ReceivedCount != 2 {
+		t.Fatalf("transações completas = %+v, esperado tx-1 com 2 evento(s)", complete)
+	}
+	for _, collection := range complete[0].DataCollections {
+		if collection.ReceivedCount != 1 {
+			t.Errorf("%s: %d evento(s) recebido(s), esperado 1", collection.DataCollection, collection.ReceivedCount)
+		}
+	}
+}
+
+func TestValidatePendingCountsAllTransactionsTogether(t *testing.T) {
+	kc, memory, _ := newTestConsumer(t,
+		routing.Route{Topic: "audit.transaction", Kind: routing.KindTransaction, Database: "tx_db"},
+		routing.Route{Topic: "audit.orders", Database: "orders_db", Table: "orders_trail"},
+	)
+	ctx := context.Background()
+
+	for _, id := range []string{"tx-1", "tx-2", "tx-3"} {
+		consume(kc, "audit.transaction", []byte(`{"status":"END","id":"`+id+`","event_count":1,"ts_ms":1700000000000,`+
+			`"data_collections":[{"data_collection":"public.orders","event_count":1}]}`))
+	}
+	consume(kc, "audit.orders", transactionEvent("tx-1", "orders", 1), transactionEvent("tx-3", "orders", 2))
+
+	store := &countingStore{MemorySink: memory}
+	if err := kc.validatePending(ctx, store, "tx_db", time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	if len(store.queries) != len(kc.Router.Databases()) {
+		t.Errorf("%d consulta(s) de contagem, esperado uma por banco (%d)", len(store.queries), len(kc.Router.Databases()))
+	}
+	for _, ids := range store.queries {
+		if len(ids) != 3 {
+			t.Errorf("consulta com as transações %v, esperado as 3 pendentes", ids)
+		}
+	}
+
+	complete, err := memory.Transactions(ctx, "tx_db", sink.TransactionComplete)
+	if err != nil {
+		t.Fatal(err)
+	}
+	completed := map[string]bool{}
+	for _, record := range complete {
+		completed[record.ID] = true
+	}
+	if len(complete) != 2 || !completed["tx-1"] || !completed["tx-3"] {
+		t.Errorf("transações completas = %+v, esperado tx-1 e tx-3", complete)
+	}
+}
@@ -0,0 +1,83 @@
+package deadletter
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/IBM/sarama"
+	"log"
+	"os"
+	"sync"
+	"sync/atomic"
+)
+
+// rejectedRecord é a linha gravada no arquivo de rejeições para cada mensagem recusada
+type rejectedRecord struct {
+	Topic      string `json:"topic"`
+	Partition  int32  `json:"partition"`
+	Offset     int64  `json:"offset"`
+	ErrorClass string `json:"error_class"`
+	Error      string `json:"error"`
+	Attempts   int    `json:"attempts"`
+}
+
+// FilePublisher grava as mensagens rejeitadas em um arquivo JSON Lines, usado nas importações
+// offline, em que não há um tópico de dead-letter disponível
+type FilePublisher struct {
+	mu        sync.Mutex
+	file      *os.File
+	published atomic.Int64
+}
+
+// NewFilePublisher abre o arquivo de rejeições, acrescentando as novas linhas ao seu final
+func NewFilePublisher(path string) (*FilePublisher, error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o640)
+	if err != nil {
+		return nil, fmt.Errorf("erro ao abrir o arquivo de rejeições '%s': %w", path, err)
+	}
+	return &FilePublisher{file: file}, nil
+}
+
+// Publish grava as coordenadas da mensagem e a causa da falha no arquivo de rejeições,
+// sincronizando-o com o disco para que a mensagem possa ser considerada processada. Assim como
+// no tópico de dead-letter, o conteúdo da linha não é copiado: ela é localizada no arquivo de
+// origem pelo seu número.
+func (p *FilePublisher) Publish(_ context.Context, msg *sarama.ConsumerMessage, errorClass string, attempts int, cause error) error {
+	record := rejectedRecord{
+		Topic:      msg.Topic,
+		Partition:  msg.Partition,
+		Offset:     msg.Offset,
+		ErrorClass: errorClass,
+		Attempts:   attempts,
+	}
+	if cause != nil {
+		record.Error = cause.Error()
+	}
+	line, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("erro ao serializar a mensagem rejeitada: %w", err)
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if _, err := p.file.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("erro ao gravar no arquivo de rejeições: %w", err)
+	}
+	if err := p.file.Sync(); err != nil {
+		return fmt.Errorf("erro ao sincronizar o arquivo de rejeições: %w", err)
+	}
+	p.published.Add(1)
+	log.Printf("Mensagem rejeitada gravada em %s (origem: %s/%d/%d, classe: %s)",
+		p.file.Name(), msg.Topic, msg.Partition, msg.Offset, errorClass)
+	return nil
+}
+
+// Published retorna a quantidade de mensagens gravadas no arquivo desde a sua abertura
+func (p *FilePublisher) Published() int64 {
+	return p.published.Load()
+}
+
+// Close fecha o arquivo de rejeições
+func (p *FilePublisher) Close() error {
+	return p.file.Close()
+}
@@ -0,0 +1,117 @@
+package deadletter
+
+import (
+	"context"
+	"fmt"
+	"github.com/IBM/sarama"
+	"log"
+	"strconv"
+	"time"
+)
+
+// Cabeçalhos adicionados às mensagens publicadas no tópico de dead-letter
+const (
+	HeaderOriginalTopic     = "dlq.original.topic"
+	HeaderOriginalPartition = "dlq.original.partition"
+	HeaderOriginalOffset    = "dlq.original.offset"
+	HeaderErrorClass        = "dlq.error.class"
+	HeaderErrorMessage      = "dlq.error.message"
+	HeaderAttempts          = "dlq.attempts"
+)
+
+// Classes de erro que levam uma mensagem ao tópico de dead-letter
+const (
+	ErrorClassDecode  = "decode"
+	ErrorClassStorage = "storage"
+)
+
+// Intervalo entre tentativas de publicação quando o Kafka recusa a mensagem
+const publishRetryInterval = 5 * time.Second
+
+// Publisher publica mensagens que não puderam ser processadas em um tópico de dead-letter
+type Publisher interface {
+	Publish(ctx context.Context, msg *sarama.ConsumerMessage, errorClass string, attempts int, cause error) error
+	Close() error
+}
+
+type kafkaPublisher struct {
+	producer sarama.SyncProducer
+	topic    string
+}
+
+// NewKafkaPublisher cria um Publisher que envia as mensagens rejeitadas para o tópico informado
+func NewKafkaPublisher(brokers []string, topic string, config *sarama.Config) (Publisher, error) {
+	if topic == "" {
+		return nil, fmt.Errorf("tópico de dead-letter não configurado")
+	}
+
+	producerConfig := *config
+	producerConfig.Producer.Return.Successes = true
+	producerConfig.Producer.Return.Errors = true
+	producerConfig.Producer.RequiredAcks = sarama.WaitForAll
+
+	producer, err := sarama.NewSyncProducer(brokers, &producerConfig)
+	if err != nil {
+		return nil, fmt.Errorf("erro ao criar producer de dead-letter: %w", err)
+	}
+
+	return &kafkaPublisher{producer: producer, topic: topic}, nil
+}
+
+// Publish registra no tópico de dead-letter as coordenadas da mensagem original e a causa da
+// falha. A chave e o valor originais não são copiados, pois contêm os dados sensíveis que o
+// mascaramento e a criptografia retiram da trilha; a mensagem é reprocessada a partir do tópico
+// de origem com o subcomando replay. A publicação é repetida até ter sucesso ou até o contexto
+// ser encerrado, pois a mensagem só pode ser marcada como processada depois de estar no tópico
+// de dead-letter.
+func (p *kafkaPublisher) Publish(ctx context.Context, msg *sarama.ConsumerMessage, errorClass string, attempts int, cause error) error {
+	dlqMsg := &sarama.ProducerMessage{
+		Topic:   p.topic,
+		Headers: buildHeaders(msg, errorClass, attempts, cause),
+	}
+
+	for {
+		partition, offset, err := p.producer.SendMessage(dlqMsg)
+		if err == nil {
+			log.Printf("Mensagem enviada ao dead-letter - Tópico: %s, Partição: %d, Offset: %d (origem: %s/%d/%d, classe: %s)",
+				p.topic, partition, offset, msg.Topic, msg.Partition, msg.Offset, errorClass)
+			return nil
+		}
+
+		log.Printf("Erro ao publicar no tópico de dead-letter %s: %v. Tentando novamente em %s...", p.topic, err, publishRetryInterval)
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("publicação no dead-letter interrompida: %w", ctx.Err())
+		case <-time.After(publishRetryInterval):
+		}
+	}
+}
+
+// Close encerra o producer de dead-letter
+func (p *kafkaPublisher) Close() error {
+	return p.producer.Close()
+}
+
+// buildHeaders preserva os cabeçalhos originais e acrescenta as coordenadas e a causa da falha
+func buildHeaders(msg *sarama.ConsumerMessage, errorClass string, attempts int, cause error) []sarama.RecordHeader {
+	headers := make([]sarama.RecordHeader, 0, len(msg.Headers)+6)
+	for _, h := range msg.Headers {
+		if h != nil {
+			headers = append(headers, *h)
+		}
+	}
+
+	errorMessage := ""
+	if cause != nil {
+		errorMessage = cause.Error()
+	}
+
+	return append(headers,
+		sarama.RecordHeader{Key: []byte(HeaderOriginalTopic), Value: []byte(msg.Topic)},
+		sarama.RecordHeader{Key: []byte(HeaderOriginalPartition), Value: []byte(strconv.Itoa(int(msg.Partition)))},
+		sarama.RecordHeader{Key: []byte(HeaderOriginalOffset), Value: []byte(strconv.FormatInt(msg.Offset, 10))},
+		sarama.RecordHeader{Key: []byte(HeaderErrorClass), Value: []byte(errorClass)},
+		sarama.RecordHeader{Key: []byte(HeaderErrorMessage), Value: []byte(errorMessage)},
+		sarama.RecordHeader{Key: []byte(HeaderAttempts), Value: []byte(strconv.Itoa(attempts))},
+	)
+}
@@ -0,0 +1,91 @@
+package deadletter
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/IBM/sarama"
+	"github.com/IBM/sarama/mocks"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var sensitiveMessage = &sarama.ConsumerMessage{
+	Topic:     "audit-trail",
+	Partition: 2,
+	Offset:    42,
+	Key:       []byte(`{"id":7}`),
+	Value:     []byte(`{"after":{"card_number":"4111111111111111","security_code":"123"}}`),
+	Headers:   []*sarama.RecordHeader{{Key: []byte("trace-id"), Value: []byte("abc")}},
+}
+
+func TestKafkaPublisherOmitsKeyAndValue(t *testing.T) {
+	producer := mocks.NewSyncProducer(t, nil)
+	producer.ExpectSendMessageWithMessageCheckerFunctionAndSucceed(func(msg *sarama.ProducerMessage) error {
+		if msg.Key != nil || msg.Value != nil {
+			return errors.New("a chave ou o valor original foi copiado para o dead-letter")
+		}
+		headers := make(map[string]string)
+		for _, h := range msg.Headers {
+			headers[string(h.Key)] = string(h.Value)
+		}
+		want := map[string]string{
+			"trace-id":              "abc",
+			HeaderOriginalTopic:     "audit-trail",
+			HeaderOriginalPartition: "2",
+			HeaderOriginalOffset:    "42",
+			HeaderErrorClass:        ErrorClassStorage,
+			HeaderErrorMessage:      "falha",
+			HeaderAttempts:          "3",
+		}
+		for key, value := range want {
+			if headers[key] != value {
+				return errors.New("cabeçalho " + key + " = " + headers[key] + ", esperado " + value)
+			}
+		}
+		return nil
+	})
+
+	publisher := &kafkaPublisher{producer: producer, topic: "audit-trail-dlq"}
+	if err := publisher.Publish(context.Background(), sensitiveMessage, ErrorClassStorage, 3, errors.New("falha")); err != nil {
+		t.Fatal(err)
+	}
+	if err := publisher.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestFilePublisherOmitsValue(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "dump.ndjson.rejects.ndjson")
+	publisher, err := NewFilePublisher(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := publisher.Publish(context.Background(), sensitiveMessage, ErrorClassDecode, 1, errors.New("falha")); err != nil {
+		t.Fatal(err)
+	}
+	if err := publisher.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if publisher.Published() != 1 {
+		t.Fatalf("Published() = %d, esperado 1", publisher.Published())
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(data), "4111111111111111") {
+		t.Fatalf("o arquivo de rejeições contém o valor original: %s", data)
+	}
+	var record rejectedRecord
+	if err := json.Unmarshal(data, &record); err != nil {
+		t.Fatal(err)
+	}
+	want := rejectedRecord{Topic: "audit-trail", Partition: 2, Offset: 42, ErrorClass: ErrorClassDecode, Error: "falha", Attempts: 1}
+	if record != want {
+		t.Fatalf("registro = %+v, esperado %+v", record, want)
+	}
+}
@@ -0,0 +1,418 @@
+package decoder
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"github.com/Waelson/audit/audit-consumer/internal/model"
+	"github.com/linkedin/goavro/v2"
+	"strings"
+	"sync"
+)
+
+// confluentMagicByte é o primeiro byte das mensagens no formato de wire da Confluent,
+// seguido pelo identificador do schema (4 bytes, big-endian) e pelo dado em Avro binário
+const confluentMagicByte = 0
+
+// NewAvroDecoder cria um Decoder para envelopes do Debezium serializados em Avro no formato
+// de wire da Confluent. O schema de escrita é resolvido no schema registry.
+func NewAvroDecoder(registry SchemaRegistry) Decoder {
+	return &avroDecoder{registry: registry, schemas: make(map[int]*avroSchema)}
+}
+
+type avroDecoder struct {
+	registry SchemaRegistry
+
+	mu      sync.RWMutex
+	schemas map[int]*avroSchema
+}
+
+// avroSchema é um schema de escrita já compilado
+type avroSchema struct {
+	codec      *goavro.Codec
+	definition interface{}
+	names      map[string]interface{}
+	connect    *model.ConnectSchema
+}
+
+// Decode decodifica a mensagem e produz o mesmo KafkaEvent do caminho JSON: as uniões do Avro
+// são desfeitas e os tipos lógicos mantêm a representação do JsonConverter (decimais em bytes,
+// datas e timestamps como inteiros), acompanhados do schema equivalente do Kafka Connect.
+func (d *avroDecoder) Decode(value []byte) (model.KafkaEvent, error) {
+	var event model.KafkaEvent
+	data, schema, err := d.decodeJSON(value)
+	if err != nil {
+		return event, err
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	if err := dec.Decode(&event); err != nil {
+		return event, fmt.Errorf("erro ao decodificar envelope Avro: %w", err)
+	}
+	event.Schema = schema.connect
+	return event, nil
+}
+
+// DecodeTransaction decodifica um marcador do tópico de transações
+func (d *avroDecoder) DecodeTransaction(value []byte) (model.TransactionMarker, error) {
+	var marker model.TransactionMarker
+	data, _, err := d.decodeJSON(value)
+	if err != nil {
+		return marker, err
+	}
+	if err := json.Unmarshal(data, &marker); err != nil {
+		return marker, fmt.Errorf("erro ao decodificar marcador de transação Avro: %w", err)
+	}
+	return marker, nil
+}
+
+// DecodeSchemaChange decodifica um evento do tópico de alterações de schema
+func (d *avroDecoder) DecodeSchemaChange(value []byte) (model.SchemaChange, error) {
+	data, _, err := d.decodeJSON(value)
+	if err != nil {
+		return model.SchemaChange{}, err
+	}
+	return decodeSchemaChange(data)
+}
+
+// decodeJSON decodifica a mensagem com o seu schema de escrita e a converte em JSON, sem as
+// uniões do Avro
+func (d *avroDecoder) decodeJSON(value []byte) ([]byte, *avroSchema, error) {
+	if len(value) < 5 || value[0] != confluentMagicByte {
+		return nil, nil, fmt.Errorf("mensagem fora do formato de wire da Confluent")
+	}
+
+	id := int(binary.BigEndian.Uint32(value[1:5]))
+	schema, err := d.schema(id)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	native, _, err := schema.codec.NativeFromBinary(value[5:])
+	if err != nil {
+		return nil, nil, fmt.Errorf("erro ao decodificar Avro com o schema %d: %w", id, err)
+	}
+
+	data, err := json.Marshal(unwrapUnions(native, schema.definition, "", schema.names))
+	if err != nil {
+		return nil, nil, fmt.Errorf("erro ao converter evento Avro: %w", err)
+	}
+	return data, schema, nil
+}
+
+// schema retorna o schema compilado, consultando o schema registry apenas na primeira vez
+func (d *avroDecoder) schema(id int) (*avroSchema, error) {
+	d.mu.RLock()
+	schema, ok := d.schemas[id]
+	d.mu.RUnlock()
+	if ok {
+		return schema, nil
+	}
+
+	specification, err := d.registry.Schema(id)
+	if err != nil {
+		return nil, err
+	}
+	schema, err = compileAvroSchema(specification)
+	if err != nil {
+		return nil, fmt.Errorf("erro ao compilar o schema %d: %w", id, err)
+	}
+
+	d.mu.Lock()
+	d.schemas[id] = schema
+	d.mu.Unlock()
+	return schema, nil
+}
+
+// compileAvroSchema compila o schema sem os atributos logicalType, para que o goavro entregue os
+// valores na representação primitiva usada pelo JsonConverter
+func compileAvroSchema(specification string) (*avroSchema, error) {
+	var definition interface{}
+	if err := json.Unmarshal([]byte(specification), &definition); err != nil {
+		return nil, fmt.Errorf("schema Avro inválido: %w", err)
+	}
+	definition = stripLogicalTypes(definition)
+
+	plain, err := json.Marshal(definition)
+	if err != nil {
+		return nil, err
+	}
+	codec, err := goavro.NewCodec(string(plain))
+	if err != nil {
+		return nil, err
+	}
+
+	names := make(map[string]interface{})
+	collectNames(definition, "", names)
+	connect := connectSchema(definition, "", names)
+	return &avroSchema{codec: codec, definition: definition, names: names, connect: &connect}, nil
+}
+
+// stripLogicalTypes remove recursivamente os atributos logicalType do schema
+func stripLogicalTypes(definition interface{}) interface{} {
+	switch def := definition.(type) {
+	case map[string]interface{}:
+		result := make(map[string]interface{}, len(def))
+		for key, value := range def {
+			if key != "logicalType" {
+				result[key] = stripLogicalTypes(value)
+			}
+		}
+		return result
+	case []interface{}:
+		result := make([]interface{}, len(def))
+		for i, value := range def {
+			result[i] = stripLogicalTypes(value)
+		}
+		return result
+	default:
+		return definition
+	}
+}
+
+// collectNames registra os tipos nomeados (record, enum e fixed) pelo nome completo
+func collectNames(definition interface{}, namespace string, names map[string]interface{}) {
+	switch def := definition.(type) {
+	case []interface{}:
+		for _, branch := range def {
+			collectNames(branch, namespace, names)
+		}
+	case map[string]interface{}:
+		typeName, _ := def["type"].(string)
+		switch typeName {
+		case "record", "error", "enum", "fixed":
+			fullName, ns := fullName(def, namespace)
+			names[fullName] = def
+			if fields, ok := def["fields"].([]interface{}); ok {
+				for _, field := range fields {
+					if f, ok := field.(map[string]interface{}); ok {
+						collectNames(f["type"], ns, names)
+					}
+				}
+			}
+		case "array":
+			collectNames(def["items"], namespace, names)
+		case "map":
+			collectNames(def["values"], namespace, names)
+		default:
+			if nested, ok := def["type"].(map[string]interface{}); ok {
+				collectNames(nested, namespace, names)
+			}
+		}
+	}
+}
+
+// fullName retorna o nome completo de um tipo nomeado e o namespace dos tipos aninhados
+func fullName(def map[string]interface{}, namespace string) (string, string) {
+	name, _ := def["name"].(string)
+	if strings.Contains(name, ".") {
+		return name, name[:strings.LastIndex(name, ".")]
+	}
+	if ns, ok := def["namespace"].(string); ok {
+		namespace = ns
+	}
+	if namespace == "" {
+		return name, namespace
+	}
+	return namespace + "." + name, namespace
+}
+
+// resolveName resolve uma referência a um tipo nomeado considerando o namespace corrente
+func resolveName(name, namespace string, names map[string]interface{}) (interface{}, bool) {
+	if def, ok := names[name]; ok {
+		return def, true
+	}
+	if namespace != "" {
+		def, ok := names[namespace+"."+name]
+		return def, ok
+	}
+	return nil, false
+}
+
+// unionBranchName retorna o nome com que o goavro identifica um ramo de uma união
+func unionBranchName(branch interface{}, namespace string) string {
+	switch def := branch.(type) {
+	case string:
+		return def
+	case map[string]interface{}:
+		typeName, _ := def["type"].(string)
+		switch typeName {
+		case "record", "error", "enum", "fixed":
+			name, _ := fullName(def, namespace)
+			return name
+		default:
+			return typeName
+		}
+	}
+	return ""
+}
+
+// unwrapUnions converte os valores nativos do goavro em valores simples: as uniões, que o goavro
+// representa como map[nome do tipo]valor, são substituídas pelo valor do ramo escolhido
+func unwrapUnions(value interface{}, definition interface{}, namespace string, names map[string]interface{}) interface{} {
+	if value == nil {
+		return nil
+	}
+
+	switch def := definition.(type) {
+	case []interface{}:
+		wrapped, ok := value.(map[string]interface{})
+		if !ok || len(wrapped) != 1 {
+			return value
+		}
+		for branchName, branchValue := range wrapped {
+			for _, branch := range def {
+				name := unionBranchName(branch, namespace)
+				if name == branchName || (namespace != "" && namespace+"."+name == branchName) {
+					return unwrapUnions(branchValue, branch, namespace, names)
+				}
+			}
+			if named, ok := resolveName(branchName, namespace, names); ok {
+				return unwrapUnions(branchValue, named, namespace, names)
+			}
+			return branchValue
+		}
+	case string:
+		if named, ok := resolveName(def, namespace, names); ok {
+			return unwrapUnions(value, named, namespace, names)
+		}
+		return value
+	case map[string]interface{}:
+		typeName, _ := def["type"].(string)
+		switch typeName {
+		case "record", "error":
+			record, ok := value.(map[string]interface{})
+			if !ok {
+				return value
+			}
+			_, ns := fullName(def, namespace)
+			fields, _ := def["fields"].([]interface{})
+			result := make(map[string]interface{}, len(record))
+			for _, field := range fields {
+				f, ok := field.(map[string]interface{})
+				if !ok {
+					continue
+				}
+				name, _ := f["name"].(string)
+				if fieldValue, exists := record[name]; exists {
+					result[name] = unwrapUnions(fieldValue, f["type"], ns, names)
+				}
+			}
+			return result
+		case "array":
+			items, ok := value.([]interface{})
+			if !ok {
+				return value
+			}
+			result := make([]interface{}, len(items))
+			for i, item := range items {
+				result[i] = unwrapUnions(item, def["items"], namespace, names)
+			}
+			return result
+		case "map":
+			entries, ok := value.(map[string]interface{})
+			if !ok {
+				return value
+			}
+			result := make(map[string]interface{}, len(entries))
+			for key, entry := range entries {
+				result[key] = unwrapUnions(entry, def["values"], namespace, names)
+			}
+			return result
+		default:
+			if nested, ok := def["type"].(map[string]interface{}); ok {
+				return unwrapUnions(value, nested, namespace, names)
+			}
+			if nested, ok := def["type"].([]interface{}); ok {
+				return unwrapUnions(value, nested, namespace, names)
+			}
+			return value
+		}
+	}
+	return value
+}
+
+// avroPrimitiveTypes associa os tipos primitivos do Avro aos tipos do Kafka Connect
+var avroPrimitiveTypes = map[string]string{
+	"boolean": "boolean",
+	"int":     "int32",
+	"long":    "int64",
+	"float":   "float32",
+	"double":  "float64",
+	"string":  "string",
+	"bytes":   "bytes",
+	"enum":    "string",
+	"fixed":   "bytes",
+}
+
+// connectSchema converte um schema Avro no schema equivalente do Kafka Connect, usando os
+// atributos connect.* que o AvroConverter grava para preservar os tipos lógicos do Debezium
+func connectSchema(definition interface{}, namespace string, names map[string]interface{}) model.ConnectSchema {
+	switch def := definition.(type) {
+	case string:
+		if named, ok := resolveName(def, namespace, names); ok {
+			return connectSchema(named, namespace, names)
+		}
+		return model.ConnectSchema{Type: avroPrimitiveTypes[def]}
+	case []interface{}:
+		optional := false
+		var schema model.ConnectSchema
+		for _, branch := range def {
+			if branch == "null" {
+				optional = true
+				continue
+			}
+			if schema.Type == "" {
+				schema = connectSchema(branch, namespace, names)
+			}
+		}
+		schema.Optional = optional
+		return schema
+	case map[string]interface{}:
+		var schema model.ConnectSchema
+		typeName, _ := def["type"].(string)
+		switch typeName {
+		case "record", "error":
+			fullName, ns := fullName(def, namespace)
+			schema = model.ConnectSchema{Type: "struct", Name: fullName}
+			fields, _ := def["fields"].([]interface{})
+			for _, field := range fields {
+				if f, ok := field.(map[string]interface{}); ok {
+					fieldSchema := connectSchema(f["type"], ns, names)
+					fieldSchema.Field, _ = f["name"].(string)
+					schema.Fields = append(schema.Fields, fieldSchema)
+				}
+			}
+		case "array":
+			items := connectSchema(def["items"], namespace, names)
+			schema = model.ConnectSchema{Type: "array", Items: &items}
+		case "map":
+			values := connectSchema(def["values"], namespace, names)
+			schema = model.ConnectSchema{Type: "map", Keys: &model.ConnectSchema{Type: "string"}, Values: &values}
+		case "":
+			schema = connectSchema(def["type"], namespace, names)
+		default:
+			schema = model.ConnectSchema{Type: avroPrimitiveTypes[typeName]}
+		}
+
+		if connectType, ok := def["connect.type"].(string); ok {
+			schema.Type = connectType
+		}
+		if connectName, ok := def["connect.name"].(string); ok {
+			schema.Name = connectName
+		}
+		if version, ok := def["connect.version"].(float64); ok {
+			schema.Version = int(version)
+		}
+		if parameters, ok := def["connect.parameters"].(map[string]interface{}); ok {
+			schema.Parameters = make(map[string]string, len(parameters))
+			for key, value := range parameters {
+				schema.Parameters[key] = fmt.Sprint(value)
+			}
+		}
+		return schema
+	}
+	return model.ConnectSchema{}
+}
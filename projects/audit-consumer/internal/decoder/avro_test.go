@@ -0,0 +1,147 @@
+package decoder
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"github.com/linkedin/goavro/v2"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sync/atomic"
+	"testing"
+)
+
+// paymentsSchema é o envelope do Debezium para a tabela public.payments, como registrado pelo
+// AvroConverter
+const paymentsSchema = `{
+	"type": "record", "name": "Envelope", "namespace": "payment.public.payments",
+	"fields": [
+		{"name": "before", "type": ["null", {"type": "record", "name": "Value", "fields": [
+			{"name": "id", "type": "long"},
+			{"name": "amount", "type": {"type": "bytes", "scale": 2, "precision": 10, "logicalType": "decimal",
+				"connect.version": 1, "connect.parameters": {"scale": "2"}, "connect.name": "org.apache.kafka.connect.data.Decimal"}},
+			{"name": "note", "type": ["null", "string"], "default": null}
+		]}], "default": null},
+		{"name": "after", "type": ["null", "Value"], "default": null},
+		{"name": "source", "type": {"type": "record", "name": "Source", "namespace": "io.debezium.connector.postgresql", "fields": [
+			{"name": "table", "type": "string"},
+			{"name": "lsn", "type": ["null", "long"], "default": null}
+		]}},
+		{"name": "op", "type": "string"}
+	]
+}`
+
+// newStubRegistry cria um schema registry de testes que responde apenas pelo schema 7 e conta
+// as consultas recebidas
+func newStubRegistry(t *testing.T) (SchemaRegistry, *int32) {
+	t.Helper()
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		switch r.URL.Path {
+		case "/schemas/ids/7":
+			json.NewEncoder(w).Encode(map[string]string{"schema": paymentsSchema})
+		case "/schemas/ids/8":
+			w.WriteHeader(http.StatusServiceUnavailable)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	t.Cleanup(server.Close)
+
+	registry, err := NewSchemaRegistry(RegistryOptions{URL: server.URL + "/", HTTPClient: server.Client()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return registry, &requests
+}
+
+// encodeAvro serializa o valor no formato de wire da Confluent com o schema informado
+func encodeAvro(t *testing.T, id uint32, native map[string]interface{}) []byte {
+	t.Helper()
+	schema, err := compileAvroSchema(paymentsSchema)
+	if err != nil {
+		t.Fatal(err)
+	}
+	header := make([]byte, 5)
+	binary.BigEndian.PutUint32(header[1:], id)
+	value, err := schema.codec.BinaryFromNative(header, native)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return value
+}
+
+func TestAvroDecoderDecode(t *testing.T) {
+	registry, requests := newStubRegistry(t)
+	decoder := NewAvroDecoder(registry)
+	value := encodeAvro(t, 7, map[string]interface{}{
+		"before": nil,
+		"after": goavro.Union("payment.public.payments.Value", map[string]interface{}{
+			"id": int64(1), "amount": []byte{0x30, 0x39}, "note": goavro.Union("string", "pix"),
+		}),
+		"source": map[string]interface{}{"table": "payments", "lsn": goavro.Union("long", int64(9007199254740993))},
+		"op":     "c",
+	})
+
+	for i := 0; i < 2; i++ {
+		event, err := decoder.Decode(value)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if event.Op != "c" || event.Source.Table != "payments" || event.Source.Lsn != 9007199254740993 {
+			t.Errorf("op = %q, tabela = %q, lsn = %d", event.Op, event.Source.Table, event.Source.Lsn)
+		}
+		if event.Before != nil {
+			t.Errorf("before = %#v, esperado nulo", event.Before)
+		}
+		amount := event.Schema.FieldSchema("after").FieldSchema("amount")
+		if amount == nil || amount.Name != logicalDecimal || amount.Parameters["scale"] != "2" {
+			t.Fatalf("schema de amount = %+v, esperado o decimal do Kafka Connect", amount)
+		}
+
+		NormalizeLogicalTypes(&event)
+		want := map[string]interface{}{"id": json.Number("1"), "amount": "123.45", "note": "pix"}
+		if !reflect.DeepEqual(event.After, want) {
+			t.Errorf("after = %#v, esperado %#v", event.After, want)
+		}
+	}
+	if got := atomic.LoadInt32(requests); got != 1 {
+		t.Errorf("consultas ao schema registry = %d, esperado 1", got)
+	}
+}
+
+func TestAvroDecoderErrors(t *testing.T) {
+	registry, _ := newStubRegistry(t)
+	decoder := NewAvroDecoder(registry)
+	valid := encodeAvro(t, 7, map[string]interface{}{
+		"before": nil, "after": nil, "source": map[string]interface{}{"table": "payments", "lsn": nil}, "op": "d",
+	})
+	unavailable := append([]byte(nil), valid...)
+	binary.BigEndian.PutUint32(unavailable[1:5], 8)
+	unknown := append([]byte(nil), valid...)
+	binary.BigEndian.PutUint32(unknown[1:5], 9)
+
+	tests := []struct {
+		name        string
+		value       []byte
+		unavailable bool
+	}{
+		{name: "fora do formato de wire", value: []byte(`{"op":"c"}`)},
+		{name: "dado truncado", value: valid[:6]},
+		{name: "registry indisponível", value: unavailable, unavailable: true},
+		{name: "schema inexistente", value: unknown},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := decoder.Decode(tt.value)
+			if err == nil {
+				t.Fatal("Decode() não retornou erro")
+			}
+			if got := errors.Is(err, ErrRegistryUnavailable); got != tt.unavailable {
+				t.Errorf("erro = %v, registry indisponível = %t, esperado %t", err, got, tt.unavailable)
+			}
+		})
+	}
+}
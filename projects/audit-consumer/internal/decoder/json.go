@@ -0,0 +1,116 @@
+package decoder
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/Waelson/audit/audit-consumer/internal/model"
+)
+
+// Decoder converte o valor de uma mensagem do Kafka em um KafkaEvent ou, nos tópicos de
+// transações e de alterações de schema, em um TransactionMarker ou em um SchemaChange
+type Decoder interface {
+	Decode(value []byte) (model.KafkaEvent, error)
+	DecodeTransaction(value []byte) (model.TransactionMarker, error)
+	DecodeSchemaChange(value []byte) (model.SchemaChange, error)
+}
+
+// NewJSONDecoder cria um Decoder para envelopes do Debezium serializados pelo JsonConverter.
+// Os dois formatos do conversor são detectados automaticamente: o envelope simples
+// (schemas.enable=false) e o envelope {schema, payload} (schemas.enable=true).
+func NewJSONDecoder() Decoder {
+	return &jsonDecoder{}
+}
+
+type jsonDecoder struct{}
+
+// Decode decodifica o envelope. Quando o schema está presente ele é mantido no evento para
+// que os tipos dos campos possam ser interpretados nas etapas seguintes.
+func (d *jsonDecoder) Decode(value []byte) (model.KafkaEvent, error) {
+	var event model.KafkaEvent
+
+	payload, schemaData, err := unwrapPayload(value)
+	if err != nil {
+		return event, err
+	}
+	if schemaData != nil {
+		var schema model.ConnectSchema
+		if err := json.Unmarshal(schemaData, &schema); err != nil {
+			return event, fmt.Errorf("erro ao decodificar schema do envelope: %w", err)
+		}
+		event.Schema = &schema
+	}
+
+	// UseNumber preserva a precisão de inteiros grandes nas imagens before/after
+	dec := json.NewDecoder(bytes.NewReader(payload))
+	dec.UseNumber()
+	if err := dec.Decode(&event); err != nil {
+		return event, fmt.Errorf("erro ao decodificar payload do envelope: %w", err)
+	}
+	return event, nil
+}
+
+// DecodeTransaction decodifica um marcador do tópico de transações
+func (d *jsonDecoder) DecodeTransaction(value []byte) (model.TransactionMarker, error) {
+	var marker model.TransactionMarker
+
+	payload, _, err := unwrapPayload(value)
+	if err != nil {
+		return marker, err
+	}
+	if err := json.Unmarshal(payload, &marker); err != nil {
+		return marker, fmt.Errorf("erro ao decodificar marcador de transação: %w", err)
+	}
+	return marker, nil
+}
+
+// DecodeSchemaChange decodifica um evento do tópico de alterações de schema
+func (d *jsonDecoder) DecodeSchemaChange(value []byte) (model.SchemaChange, error) {
+	payload, _, err := unwrapPayload(value)
+	if err != nil {
+		return model.SchemaChange{}, err
+	}
+	return decodeSchemaChange(payload)
+}
+
+// decodeSchemaChange decodifica o evento de alteração de schema preservando a precisão dos
+// inteiros da posição (LSN, SCN), que compõe a chave de idempotência
+func decodeSchemaChange(data []byte) (model.SchemaChange, error) {
+	var change model.SchemaChange
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	if err := dec.Decode(&change); err != nil {
+		return change, fmt.Errorf("erro ao decodificar alteração de schema: %w", err)
+	}
+	return change, nil
+}
+
+// unwrapPayload retorna o payload da mensagem e o schema que o acompanha, quando presente
+func unwrapPayload(value []byte) (json.RawMessage, json.RawMessage, error) {
+	var wrapper map[string]json.RawMessage
+	if err := json.Unmarshal(value, &wrapper); err != nil {
+		return nil, nil, fmt.Errorf("erro ao decodificar envelope JSON: %w", err)
+	}
+
+	payload := json.RawMessage(value)
+	var schema json.RawMessage
+	schemaData, hasSchema := wrapper["schema"]
+	payloadData, hasPayload := wrapper["payload"]
+	if hasSchema && hasPayload {
+		payload = payloadData
+		if !isJSONNull(schemaData) {
+			schema = schemaData
+		}
+	}
+
+	if isJSONNull(payload) {
+		return nil, nil, fmt.Errorf("envelope sem payload")
+	}
+	return payload, schema, nil
+}
+
+// isJSONNull indica se o valor JSON é nulo ou vazio
+func isJSONNull(data json.RawMessage) bool {
+	trimmed := bytes.TrimSpace(data)
+	return len(trimmed) == 0 || bytes.Equal(trimmed, []byte("null"))
+}
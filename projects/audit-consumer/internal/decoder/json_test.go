@@ -0,0 +1,101 @@
+package decoder
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestJSONDecoderDecode(t *testing.T) {
+	tests := []struct {
+		name       string
+		value      string
+		wantAfter  interface{}
+		wantSchema bool
+	}{
+		{
+			name:      "envelope simples",
+			value:     `{"op":"c","after":{"id":9007199254740993},"source":{"table":"payments"}}`,
+			wantAfter: map[string]interface{}{"id": json.Number("9007199254740993")},
+		},
+		{
+			name:       "envelope com schema",
+			value:      `{"schema":{"type":"struct","fields":[{"field":"after","type":"struct"}]},"payload":{"op":"c","after":{"id":1},"source":{"table":"payments"}}}`,
+			wantAfter:  map[string]interface{}{"id": json.Number("1")},
+			wantSchema: true,
+		},
+		{
+			name:      "envelope com schema nulo",
+			value:     `{"schema":null,"payload":{"op":"c","after":{"id":1},"source":{"table":"payments"}}}`,
+			wantAfter: map[string]interface{}{"id": json.Number("1")},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			event, err := NewJSONDecoder().Decode([]byte(tt.value))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if event.Op != "c" || event.Source.Table != "payments" {
+				t.Errorf("op = %q, tabela = %q, esperado c e payments", event.Op, event.Source.Table)
+			}
+			if !reflect.DeepEqual(event.After, tt.wantAfter) {
+				t.Errorf("after = %#v, esperado %#v", event.After, tt.wantAfter)
+			}
+			if (event.Schema != nil) != tt.wantSchema {
+				t.Errorf("schema presente = %t, esperado %t", event.Schema != nil, tt.wantSchema)
+			}
+			if tt.wantSchema && event.Schema.FieldSchema("after") == nil {
+				t.Error("schema sem o campo after")
+			}
+		})
+	}
+}
+
+func TestJSONDecoderErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		value string
+	}{
+		{name: "JSON inválido", value: `{"op":`},
+		{name: "tombstone", value: `null`},
+		{name: "payload nulo", value: `{"schema":{"type":"struct"},"payload":null}`},
+		{name: "schema inválido", value: `{"schema":"struct","payload":{"op":"c"}}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := NewJSONDecoder().Decode([]byte(tt.value)); err == nil {
+				t.Error("Decode() não retornou erro")
+			}
+		})
+	}
+}
+
+func TestJSONDecoderDecodeTransaction(t *testing.T) {
+	value := `{"schema":{"type":"struct"},"payload":{"status":"END","id":"571:53195832","event_count":2,` +
+		`"data_collections":[{"data_collection":"public.payments","event_count":2}],"ts_ms":1700000000000}}`
+	marker, err := NewJSONDecoder().DecodeTransaction([]byte(value))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if marker.Status != "END" || marker.ID != "571:53195832" || marker.EventCount != 2 {
+		t.Errorf("marcador = %+v", marker)
+	}
+	if len(marker.DataCollections) != 1 || marker.DataCollections[0].DataCollection != "public.payments" {
+		t.Errorf("tabelas do marcador = %+v", marker.DataCollections)
+	}
+}
+
+func TestJSONDecoderDecodeSchemaChange(t *testing.T) {
+	value := `{"source":{"lsn":9007199254740993},"ts_ms":1700000000000,"databaseName":"payment_db","ddl":"ALTER TABLE payments ADD note text"}`
+	change, err := NewJSONDecoder().DecodeSchemaChange([]byte(value))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lsn := change.Source["lsn"]; lsn != json.Number("9007199254740993") {
+		t.Errorf("lsn = %#v, esperado a posição sem perda de precisão", lsn)
+	}
+	if change.DatabaseName != "payment_db" {
+		t.Errorf("banco = %q, esperado payment_db", change.DatabaseName)
+	}
+}
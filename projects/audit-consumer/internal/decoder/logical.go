@@ -0,0 +1,285 @@
+package decoder
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"github.com/Waelson/audit/audit-consumer/internal/model"
+	"log"
+	"math/big"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Nomes dos tipos lógicos do Kafka Connect e do Debezium tratados pelo consumidor
+const (
+	logicalDecimal              = "org.apache.kafka.connect.data.Decimal"
+	logicalConnectDate          = "org.apache.kafka.connect.data.Date"
+	logicalConnectTime          = "org.apache.kafka.connect.data.Time"
+	logicalConnectTimestamp     = "org.apache.kafka.connect.data.Timestamp"
+	logicalVariableScaleDecimal = "io.debezium.data.VariableScaleDecimal"
+	logicalDate                 = "io.debezium.time.Date"
+	logicalTime                 = "io.debezium.time.Time"
+	logicalMicroTime            = "io.debezium.time.MicroTime"
+	logicalNanoTime             = "io.debezium.time.NanoTime"
+	logicalTimestamp            = "io.debezium.time.Timestamp"
+	logicalMicroTimestamp       = "io.debezium.time.MicroTimestamp"
+	logicalNanoTimestamp        = "io.debezium.time.NanoTimestamp"
+	logicalZonedTimestamp       = "io.debezium.time.ZonedTimestamp"
+	logicalUUID                 = "io.debezium.data.Uuid"
+	logicalJSON                 = "io.debezium.data.Json"
+)
+
+const (
+	dateLayout = "2006-01-02"
+	timeLayout = "15:04:05.999999999"
+)
+
+// NormalizeLogicalTypes converte os tipos lógicos das imagens before e after em valores canônicos
+// e legíveis, de acordo com o schema do envelope. Sem schema o evento não é alterado.
+// Um valor que não pode ser convertido é mantido na representação original.
+func NormalizeLogicalTypes(event *model.KafkaEvent) {
+	if event.Schema == nil {
+		return
+	}
+	event.Before = normalizeValue(event.Before, event.Schema.FieldSchema("before"))
+	event.After = normalizeValue(event.After, event.Schema.FieldSchema("after"))
+}
+
+// normalizeValue converte recursivamente um valor segundo o seu schema
+func normalizeValue(value interface{}, schema *model.ConnectSchema) interface{} {
+	if value == nil || schema == nil {
+		return value
+	}
+
+	if schema.Name != "" {
+		converted, handled, err := convertLogicalType(value, schema)
+		if err != nil {
+			log.Printf("Não foi possível converter o tipo lógico %s: %v. Mantendo o valor original.", schema.Name, err)
+			return value
+		}
+		if handled {
+			return converted
+		}
+	}
+
+	switch schema.Type {
+	case "struct":
+		record, ok := value.(map[string]interface{})
+		if !ok {
+			return value
+		}
+		for name, fieldValue := range record {
+			record[name] = normalizeValue(fieldValue, schema.FieldSchema(name))
+		}
+		return record
+	case "array":
+		items, ok := value.([]interface{})
+		if !ok {
+			return value
+		}
+		for i, item := range items {
+			items[i] = normalizeValue(item, schema.Items)
+		}
+		return items
+	case "map":
+		entries, ok := value.(map[string]interface{})
+		if !ok {
+			return value
+		}
+		for key, entry := range entries {
+			entries[key] = normalizeValue(entry, schema.Values)
+		}
+		return entries
+	}
+	return value
+}
+
+// convertLogicalType converte um valor de tipo lógico conhecido. O retorno handled indica se o
+// tipo é tratado pelo consumidor.
+func convertLogicalType(value interface{}, schema *model.ConnectSchema) (interface{}, bool, error) {
+	var converted interface{}
+	var err error
+
+	switch schema.Name {
+	case logicalDecimal:
+		converted, err = convertDecimal(value, schema)
+	case logicalVariableScaleDecimal:
+		converted, err = convertVariableScaleDecimal(value)
+	case logicalDate, logicalConnectDate:
+		converted, err = convertEpoch(value, 24*time.Hour, dateLayout)
+	case logicalTime, logicalConnectTime:
+		converted, err = convertEpoch(value, time.Millisecond, timeLayout)
+	case logicalMicroTime:
+		converted, err = convertEpoch(value, time.Microsecond, timeLayout)
+	case logicalNanoTime:
+		converted, err = convertEpoch(value, time.Nanosecond, timeLayout)
+	case logicalTimestamp, logicalConnectTimestamp:
+		converted, err = convertEpoch(value, time.Millisecond, time.RFC3339Nano)
+	case logicalMicroTimestamp:
+		converted, err = convertEpoch(value, time.Microsecond, time.RFC3339Nano)
+	case logicalNanoTimestamp:
+		converted, err = convertEpoch(value, time.Nanosecond, time.RFC3339Nano)
+	case logicalZonedTimestamp:
+		converted, err = convertZonedTimestamp(value)
+	case logicalUUID:
+		converted, err = convertUUID(value)
+	case logicalJSON:
+		converted, err = convertJSON(value)
+	default:
+		return value, false, nil
+	}
+	return converted, true, err
+}
+
+// convertDecimal converte um decimal serializado como bytes (complemento de dois, big-endian,
+// codificado em base64 no JSON) para a sua representação textual. Decimais já publicados como
+// texto ou número (decimal.handling.mode string ou double) são mantidos.
+func convertDecimal(value interface{}, schema *model.ConnectSchema) (interface{}, error) {
+	encoded, ok := value.(string)
+	if !ok || schema.Type != "bytes" {
+		return value, nil
+	}
+
+	scale, err := strconv.Atoi(schema.Parameters["scale"])
+	if err != nil {
+		return nil, fmt.Errorf("escala inválida: '%s'", schema.Parameters["scale"])
+	}
+	unscaled, err := decodeUnscaled(encoded)
+	if err != nil {
+		return nil, err
+	}
+	return formatDecimal(unscaled, scale), nil
+}
+
+// convertVariableScaleDecimal converte a estrutura {scale, value} usada pelo Debezium para
+// decimais sem escala fixa
+func convertVariableScaleDecimal(value interface{}) (interface{}, error) {
+	record, ok := value.(map[string]interface{})
+	if !ok {
+		return value, nil
+	}
+
+	scale, err := toInt64(record["scale"])
+	if err != nil {
+		return nil, fmt.Errorf("escala inválida: %w", err)
+	}
+	encoded, ok := record["value"].(string)
+	if !ok {
+		return nil, fmt.Errorf("valor do decimal ausente")
+	}
+	unscaled, err := decodeUnscaled(encoded)
+	if err != nil {
+		return nil, err
+	}
+	return formatDecimal(unscaled, int(scale)), nil
+}
+
+// decodeUnscaled decodifica o valor sem escala de um decimal a partir do base64
+func decodeUnscaled(encoded string) (*big.Int, error) {
+	data, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("decimal em base64 inválido: %w", err)
+	}
+
+	unscaled := new(big.Int).SetBytes(data)
+	if len(data) > 0 && data[0]&0x80 != 0 {
+		// Valor negativo em complemento de dois
+		unscaled.Sub(unscaled, new(big.Int).Lsh(big.NewInt(1), uint(len(data)*8)))
+	}
+	return unscaled, nil
+}
+
+// formatDecimal formata o valor sem escala com a quantidade de casas decimais informada
+func formatDecimal(unscaled *big.Int, scale int) string {
+	if scale <= 0 {
+		return new(big.Int).Mul(unscaled, new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(-scale)), nil)).String()
+	}
+
+	digits := new(big.Int).Abs(unscaled).String()
+	if len(digits) <= scale {
+		digits = strings.Repeat("0", scale-len(digits)+1) + digits
+	}
+
+	sign := ""
+	if unscaled.Sign() < 0 {
+		sign = "-"
+	}
+	return sign + digits[:len(digits)-scale] + "." + digits[len(digits)-scale:]
+}
+
+// convertEpoch converte um inteiro contado em unidades a partir da época (ou da meia-noite, para
+// os tipos de horário) em texto no formato informado, sempre em UTC
+func convertEpoch(value interface{}, unit time.Duration, layout string) (interface{}, error) {
+	amount, err := toInt64(value)
+	if err != nil {
+		return nil, err
+	}
+
+	var instant time.Time
+	if unit == 24*time.Hour {
+		instant = time.Unix(0, 0).UTC().AddDate(0, 0, int(amount))
+	} else {
+		seconds := amount / int64(time.Second/unit)
+		remainder := amount % int64(time.Second/unit)
+		instant = time.Unix(seconds, remainder*int64(unit)).UTC()
+	}
+	return instant.Format(layout), nil
+}
+
+// convertZonedTimestamp normaliza o timestamp com fuso publicado como texto ISO-8601
+func convertZonedTimestamp(value interface{}) (interface{}, error) {
+	text, ok := value.(string)
+	if !ok {
+		return value, nil
+	}
+	instant, err := time.Parse(time.RFC3339Nano, text)
+	if err != nil {
+		return nil, fmt.Errorf("timestamp com fuso inválido: %w", err)
+	}
+	return instant.Format(time.RFC3339Nano), nil
+}
+
+// convertUUID normaliza o UUID para letras minúsculas
+func convertUUID(value interface{}) (interface{}, error) {
+	text, ok := value.(string)
+	if !ok {
+		return value, nil
+	}
+	return strings.ToLower(text), nil
+}
+
+// convertJSON substitui o documento JSON publicado como texto pela sua estrutura
+func convertJSON(value interface{}) (interface{}, error) {
+	text, ok := value.(string)
+	if !ok {
+		return value, nil
+	}
+
+	var document interface{}
+	dec := json.NewDecoder(bytes.NewReader([]byte(text)))
+	dec.UseNumber()
+	if err := dec.Decode(&document); err != nil {
+		return nil, fmt.Errorf("documento JSON inválido: %w", err)
+	}
+	return document, nil
+}
+
+// toInt64 converte um número decodificado do envelope em int64
+func toInt64(value interface{}) (int64, error) {
+	switch v := value.(type) {
+	case json.Number:
+		return v.Int64()
+	case float64:
+		return int64(v), nil
+	case int64:
+		return v, nil
+	case int32:
+		return int64(v), nil
+	case int:
+		return int64(v), nil
+	}
+	return 0, fmt.Errorf("valor numérico inválido: %v", value)
+}
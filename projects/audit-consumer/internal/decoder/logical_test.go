@@ -0,0 +1,91 @@
+package decoder
+
+import (
+	"encoding/json"
+	"github.com/Waelson/audit/audit-consumer/internal/model"
+	"reflect"
+	"testing"
+)
+
+func TestConvertLogicalType(t *testing.T) {
+	decimal := func(scale string) *model.ConnectSchema {
+		return &model.ConnectSchema{Type: "bytes", Name: logicalDecimal, Parameters: map[string]string{"scale": scale}}
+	}
+	tests := []struct {
+		name   string
+		schema *model.ConnectSchema
+		value  interface{}
+		want   interface{}
+	}{
+		{name: "decimal", schema: decimal("2"), value: "MDk=", want: "123.45"},
+		{name: "decimal negativo", schema: decimal("2"), value: "/w==", want: "-0.01"},
+		{name: "decimal menor que a escala", schema: decimal("4"), value: "Bw==", want: "0.0007"},
+		{name: "decimal sem casas", schema: decimal("0"), value: "MDk=", want: "12345"},
+		{name: "decimal como texto", schema: &model.ConnectSchema{Type: "string", Name: logicalDecimal}, value: "10.50", want: "10.50"},
+		{name: "decimal de escala variável", schema: &model.ConnectSchema{Type: "struct", Name: logicalVariableScaleDecimal},
+			value: map[string]interface{}{"scale": json.Number("3"), "value": "MDk="}, want: "12.345"},
+		{name: "data", schema: &model.ConnectSchema{Type: "int32", Name: logicalDate}, value: json.Number("19737"), want: "2024-01-15"},
+		{name: "horário em milissegundos", schema: &model.ConnectSchema{Type: "int32", Name: logicalTime}, value: json.Number("45296789"), want: "12:34:56.789"},
+		{name: "horário em microssegundos", schema: &model.ConnectSchema{Type: "int64", Name: logicalMicroTime}, value: json.Number("45296000001"), want: "12:34:56.000001"},
+		{name: "timestamp", schema: &model.ConnectSchema{Type: "int64", Name: logicalConnectTimestamp}, value: json.Number("1700000000123"), want: "2023-11-14T22:13:20.123Z"},
+		{name: "timestamp em microssegundos", schema: &model.ConnectSchema{Type: "int64", Name: logicalMicroTimestamp}, value: json.Number("1700000000123456"), want: "2023-11-14T22:13:20.123456Z"},
+		{name: "timestamp em nanossegundos", schema: &model.ConnectSchema{Type: "int64", Name: logicalNanoTimestamp}, value: json.Number("1700000000000000001"), want: "2023-11-14T22:13:20.000000001Z"},
+		{name: "timestamp com fuso", schema: &model.ConnectSchema{Type: "string", Name: logicalZonedTimestamp}, value: "2024-01-14T10:00:00.500-03:00", want: "2024-01-14T10:00:00.5-03:00"},
+		{name: "uuid", schema: &model.ConnectSchema{Type: "string", Name: logicalUUID}, value: "A0EEBC99-9C0B-4EF8-BB6D-6BB9BD380A11", want: "a0eebc99-9c0b-4ef8-bb6d-6bb9bd380a11"},
+		{name: "json", schema: &model.ConnectSchema{Type: "string", Name: logicalJSON}, value: `{"tags":["a"],"total":10}`,
+			want: map[string]interface{}{"tags": []interface{}{"a"}, "total": json.Number("10")}},
+		{name: "valor inválido mantido", schema: &model.ConnectSchema{Type: "int32", Name: logicalDate}, value: "ontem", want: "ontem"},
+		{name: "tipo lógico desconhecido", schema: &model.ConnectSchema{Type: "string", Name: "io.debezium.data.Bits"}, value: "AQ==", want: "AQ=="},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := normalizeValue(tt.value, tt.schema); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("normalizeValue() = %#v, esperado %#v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNormalizeLogicalTypes(t *testing.T) {
+	envelope := `{
+		"schema": {"type": "struct", "fields": [
+			{"field": "before", "type": "struct", "optional": true, "fields": [
+				{"field": "amount", "type": "bytes", "name": "org.apache.kafka.connect.data.Decimal", "parameters": {"scale": "2"}}
+			]},
+			{"field": "after", "type": "struct", "optional": true, "fields": [
+				{"field": "amount", "type": "bytes", "name": "org.apache.kafka.connect.data.Decimal", "parameters": {"scale": "2"}},
+				{"field": "paid_on", "type": "array", "items": {"type": "int32", "name": "io.debezium.time.Date"}},
+				{"field": "metadata", "type": "struct", "fields": [
+					{"field": "ref", "type": "string", "name": "io.debezium.data.Uuid"}
+				]}
+			]}
+		]},
+		"payload": {"op": "u", "before": {"amount": "MDk="},
+			"after": {"amount": "AMg=", "paid_on": [0, 1], "metadata": {"ref": "ABC"}}}
+	}`
+	event, err := NewJSONDecoder().Decode([]byte(envelope))
+	if err != nil {
+		t.Fatal(err)
+	}
+	NormalizeLogicalTypes(&event)
+
+	if want := map[string]interface{}{"amount": "123.45"}; !reflect.DeepEqual(event.Before, want) {
+		t.Errorf("before = %#v, esperado %#v", event.Before, want)
+	}
+	want := map[string]interface{}{
+		"amount":   "2.00",
+		"paid_on":  []interface{}{"1970-01-01", "1970-01-02"},
+		"metadata": map[string]interface{}{"ref": "abc"},
+	}
+	if !reflect.DeepEqual(event.After, want) {
+		t.Errorf("after = %#v, esperado %#v", event.After, want)
+	}
+}
+
+func TestNormalizeLogicalTypesWithoutSchema(t *testing.T) {
+	event := model.KafkaEvent{After: map[string]interface{}{"amount": "MDk="}}
+	NormalizeLogicalTypes(&event)
+	if want := map[string]interface{}{"amount": "MDk="}; !reflect.DeepEqual(event.After, want) {
+		t.Errorf("after = %#v, esperado %#v", event.After, want)
+	}
+}
@@ -0,0 +1,115 @@
+package decoder
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrRegistryUnavailable indica uma falha transitória na consulta ao schema registry. A mensagem
+// não tem problema e deve ser decodificada novamente quando o registry voltar a responder.
+var ErrRegistryUnavailable = errors.New("schema registry indisponível")
+
+// SchemaRegistry resolve o schema de escrita a partir do identificador gravado na mensagem
+type SchemaRegistry interface {
+	Schema(id int) (string, error)
+}
+
+// RegistryOptions configura o acesso a um schema registry compatível com o da Confluent
+type RegistryOptions struct {
+	URL      string
+	Username string
+	Password string
+	// HTTPClient permite substituir o cliente HTTP, por exemplo por um servidor de testes
+	HTTPClient *http.Client
+}
+
+type registryClient struct {
+	opts RegistryOptions
+
+	mu    sync.RWMutex
+	cache map[int]string
+}
+
+// NewSchemaRegistry cria um cliente de schema registry que mantém em cache os schemas já
+// resolvidos: os schemas são imutáveis para um mesmo identificador
+func NewSchemaRegistry(opts RegistryOptions) (SchemaRegistry, error) {
+	if opts.URL == "" {
+		return nil, fmt.Errorf("URL do schema registry não configurada")
+	}
+	opts.URL = strings.TrimRight(opts.URL, "/")
+	if opts.HTTPClient == nil {
+		opts.HTTPClient = &http.Client{Timeout: 10 * time.Second}
+	}
+	return &registryClient{opts: opts, cache: make(map[int]string)}, nil
+}
+
+// Schema retorna o schema registrado com o identificador informado
+func (r *registryClient) Schema(id int) (string, error) {
+	r.mu.RLock()
+	schema, ok := r.cache[id]
+	r.mu.RUnlock()
+	if ok {
+		return schema, nil
+	}
+
+	schema, err := r.fetch(id)
+	if err != nil {
+		return "", err
+	}
+
+	r.mu.Lock()
+	r.cache[id] = schema
+	r.mu.Unlock()
+	return schema, nil
+}
+
+// fetch consulta o endpoint GET /schemas/ids/{id} do schema registry
+func (r *registryClient) fetch(id int) (string, error) {
+	url := fmt.Sprintf("%s/schemas/ids/%d", r.opts.URL, id)
+	log.Printf("Consultando schema %d no schema registry: %s", id, url)
+
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return "", fmt.Errorf("erro ao criar requisição ao schema registry: %w", err)
+	}
+	req.Header.Set("Accept", "application/vnd.schemaregistry.v1+json")
+	if r.opts.Username != "" {
+		req.SetBasicAuth(r.opts.Username, r.opts.Password)
+	}
+
+	resp, err := r.opts.HTTPClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", ErrRegistryUnavailable, err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", fmt.Errorf("%w: erro ao ler resposta: %v", ErrRegistryUnavailable, err)
+	}
+	if resp.StatusCode >= http.StatusInternalServerError || resp.StatusCode == http.StatusTooManyRequests {
+		return "", fmt.Errorf("%w: status %d para o schema %d", ErrRegistryUnavailable, resp.StatusCode, id)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("schema registry retornou status %d para o schema %d: %s", resp.StatusCode, id, string(body))
+	}
+
+	var result struct {
+		Schema     string `json:"schema"`
+		SchemaType string `json:"schemaType"`
+	}
+	if err := json.Unmarshal(body, &result); err != nil {
+		return "", fmt.Errorf("erro ao decodificar resposta do schema registry: %w", err)
+	}
+	if result.SchemaType != "" && result.SchemaType != "AVRO" {
+		return "", fmt.Errorf("schema %d é do tipo %s, apenas AVRO é suportado", id, result.SchemaType)
+	}
+	return result.Schema, nil
+}
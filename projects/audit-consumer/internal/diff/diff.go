@@ -0,0 +1,113 @@
+package diff
+
+import (
+	"github.com/Waelson/audit/audit-consumer/internal/model"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// Compute compara as imagens anterior e posterior de uma linha e retorna as alterações coluna a
+// coluna, ordenadas pelo caminho. Colunas que contêm objetos (como documentos JSON) são comparadas
+// recursivamente, e o caminho das alterações internas é separado por pontos (ex.: "address.city").
+// Listas são comparadas por inteiro.
+func Compute(before, after interface{}) []model.ColumnChange {
+	beforeMap, beforeOk := before.(map[string]interface{})
+	afterMap, afterOk := after.(map[string]interface{})
+	if !beforeOk || !afterOk {
+		return nil
+	}
+
+	changes := make([]model.ColumnChange, 0)
+	compareObjects("", beforeMap, afterMap, &changes)
+	sort.SliceStable(changes, func(i, j int) bool {
+		return changes[i].Path < changes[j].Path
+	})
+	return changes
+}
+
+// ChangedColumns retorna, sem repetições e em ordem alfabética, as colunas de primeiro nível
+// afetadas pelas alterações
+func ChangedColumns(changes []model.ColumnChange) []string {
+	seen := make(map[string]bool, len(changes))
+	columns := make([]string, 0, len(changes))
+	for _, change := range changes {
+		column := change.Column
+		if !seen[column] {
+			seen[column] = true
+			columns = append(columns, column)
+		}
+	}
+	sort.Strings(columns)
+	return columns
+}
+
+// compareObjects compara dois objetos e acumula as diferenças encontradas
+func compareObjects(prefix string, before, after map[string]interface{}, changes *[]model.ColumnChange) {
+	for key, oldValue := range before {
+		path := joinPath(prefix, key)
+		newValue, exists := after[key]
+		if !exists {
+			*changes = append(*changes, newChange(path, model.ChangeRemoved, oldValue, nil))
+			continue
+		}
+		compareValues(path, oldValue, newValue, changes)
+	}
+
+	for key, newValue := range after {
+		if _, exists := before[key]; !exists {
+			*changes = append(*changes, newChange(joinPath(prefix, key), model.ChangeAdded, nil, newValue))
+		}
+	}
+}
+
+// compareValues compara dois valores, descendo nos objetos aninhados
+func compareValues(path string, oldValue, newValue interface{}, changes *[]model.ColumnChange) {
+	oldObject, oldIsObject := oldValue.(map[string]interface{})
+	newObject, newIsObject := newValue.(map[string]interface{})
+	if oldIsObject && newIsObject {
+		compareObjects(path, oldObject, newObject, changes)
+		return
+	}
+
+	if !reflect.DeepEqual(oldValue, newValue) {
+		*changes = append(*changes, newChange(path, model.ChangeModified, oldValue, newValue))
+	}
+}
+
+// newChange cria uma alteração, identificando a coluna de primeiro nível do caminho
+func newChange(path, kind string, oldValue, newValue interface{}) model.ColumnChange {
+	column := path
+	if i := strings.Index(path, "."); i >= 0 {
+		column = path[:i]
+	}
+	return model.ColumnChange{Column: column, Path: path, Kind: kind, Old: deepCopy(oldValue), New: deepCopy(newValue)}
+}
+
+// deepCopy copia objetos e listas para que as alterações não compartilhem valores com as imagens,
+// que ainda podem ser modificadas (por exemplo, pela criptografia das colunas)
+func deepCopy(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		result := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			result[key] = deepCopy(item)
+		}
+		return result
+	case []interface{}:
+		result := make([]interface{}, len(v))
+		for i, item := range v {
+			result[i] = deepCopy(item)
+		}
+		return result
+	}
+	return value
+}
+
+// joinPath adiciona uma chave ao caminho
+func joinPath(prefix, key string) string {
+	if prefix == "" {
+		return key
+	}
+	return prefix + "." + key
+}
@@ -0,0 +1,90 @@
+package diff
+
+import (
+	"github.com/Waelson/audit/audit-consumer/internal/model"
+	"reflect"
+	"testing"
+)
+
+func TestCompute(t *testing.T) {
+	tests := []struct {
+		name   string
+		before interface{}
+		after  interface{}
+		want   []model.ColumnChange
+	}{
+		{
+			name:   "imagens iguais",
+			before: map[string]interface{}{"id": 1.0, "status": "PAID"},
+			after:  map[string]interface{}{"id": 1.0, "status": "PAID"},
+			want:   []model.ColumnChange{},
+		},
+		{
+			name:   "colunas alteradas, incluídas e removidas em ordem de caminho",
+			before: map[string]interface{}{"status": "PENDING", "amount": 10.0, "note": "x"},
+			after:  map[string]interface{}{"status": "PAID", "amount": 10.0, "paid_at": "2024-01-01"},
+			want: []model.ColumnChange{
+				{Column: "note", Path: "note", Kind: model.ChangeRemoved, Old: "x"},
+				{Column: "paid_at", Path: "paid_at", Kind: model.ChangeAdded, New: "2024-01-01"},
+				{Column: "status", Path: "status", Kind: model.ChangeModified, Old: "PENDING", New: "PAID"},
+			},
+		},
+		{
+			name:   "objetos comparados recursivamente",
+			before: map[string]interface{}{"address": map[string]interface{}{"city": "Recife", "zip": "50000"}},
+			after:  map[string]interface{}{"address": map[string]interface{}{"city": "Olinda", "zip": "50000", "number": 10.0}},
+			want: []model.ColumnChange{
+				{Column: "address", Path: "address.city", Kind: model.ChangeModified, Old: "Recife", New: "Olinda"},
+				{Column: "address", Path: "address.number", Kind: model.ChangeAdded, New: 10.0},
+			},
+		},
+		{
+			name:   "listas comparadas por inteiro",
+			before: map[string]interface{}{"tags": []interface{}{"a", "b"}},
+			after:  map[string]interface{}{"tags": []interface{}{"a", "c"}},
+			want: []model.ColumnChange{
+				{Column: "tags", Path: "tags", Kind: model.ChangeModified, Old: []interface{}{"a", "b"}, New: []interface{}{"a", "c"}},
+			},
+		},
+		{
+			name:   "objeto substituído por valor",
+			before: map[string]interface{}{"metadata": map[string]interface{}{"a": 1.0}},
+			after:  map[string]interface{}{"metadata": nil},
+			want: []model.ColumnChange{
+				{Column: "metadata", Path: "metadata", Kind: model.ChangeModified, Old: map[string]interface{}{"a": 1.0}},
+			},
+		},
+		{
+			name:  "sem imagem anterior",
+			after: map[string]interface{}{"id": 1.0},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Compute(tt.before, tt.after); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Compute() = %#v, esperado %#v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestComputeCopiesValues(t *testing.T) {
+	before := map[string]interface{}{"address": map[string]interface{}{"city": "Recife"}, "tags": []interface{}{"a"}}
+	after := map[string]interface{}{"address": map[string]interface{}{"city": "Olinda"}, "tags": []interface{}{"b"}}
+	changes := Compute(before, after)
+
+	after["tags"].([]interface{})[0] = "cifrado"
+	after["address"].(map[string]interface{})["city"] = "cifrado"
+	for _, change := range changes {
+		if change.New == "cifrado" || reflect.DeepEqual(change.New, []interface{}{"cifrado"}) {
+			t.Errorf("alteração %s compartilha o valor com a imagem", change.Path)
+		}
+	}
+}
+
+func TestChangedColumns(t *testing.T) {
+	changes := []model.ColumnChange{{Column: "status"}, {Column: "address"}, {Column: "address"}}
+	if got, want := ChangedColumns(changes), []string{"address", "status"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("ChangedColumns() = %v, esperado %v", got, want)
+	}
+}
@@ -0,0 +1,331 @@
+package encryption
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/Waelson/audit/audit-consumer/internal/model"
+	"os"
+	"sort"
+	"strings"
+)
+
+// Algorithm identifica o algoritmo dos valores cifrados
+const Algorithm = "aes-256-gcm"
+
+// ShreddedMarker substitui o algoritmo nos valores de titulares cuja chave foi destruída
+const ShreddedMarker = "shredded"
+
+// wildcard casa com qualquer valor nos campos de seleção das regras
+const wildcard = "*"
+
+// Rule define uma coluna cifrada. Application, Schema e Table vazios ou "*" casam com qualquer
+// valor. Column aceita caminhos separados por pontos. Tenant define o dono da chave de dados;
+// quando omitido, o tenant é a aplicação do evento. Subject, quando informado, é a coluna que
+// identifica o titular do dado (ex.: "customer_id" ou "name_on_card"): a coluna passa a ser
+// cifrada com a chave do titular, que pode ser destruída para eliminar os seus dados.
+type Rule struct {
+	Application string `json:"application,omitempty"`
+	Schema      string `json:"schema,omitempty"`
+	Table       string `json:"table,omitempty"`
+	Column      string `json:"column"`
+	Tenant      string `json:"tenant,omitempty"`
+	Subject     string `json:"subject,omitempty"`
+}
+
+// Encryptor cifra as colunas sensíveis dos eventos. Um Encryptor nulo não altera os eventos.
+type Encryptor struct {
+	rules    []Rule
+	provider KeyProvider
+	subjects *SubjectKeyStore
+}
+
+// transform substitui um valor do evento pela sua versão cifrada
+type transform func(value interface{}) (interface{}, error)
+
+// LoadRules lê as regras de um arquivo JSON contendo uma lista de regras
+func LoadRules(path string) ([]Rule, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("erro ao ler o arquivo de criptografia '%s': %w", path, err)
+	}
+
+	var rules []Rule
+	if err := json.Unmarshal(data, &rules); err != nil {
+		return nil, fmt.Errorf("erro ao decodificar o arquivo de criptografia '%s': %w", path, err)
+	}
+	return rules, nil
+}
+
+// NewEncryptor valida as regras e cria o Encryptor. O repositório de chaves de titulares só é
+// obrigatório quando alguma regra informa o titular. A coluna que identifica o titular também é
+// um dado pessoal: ela precisa ser cifrada com a chave do próprio titular por uma regra do mesmo
+// escopo, para que a eliminação não deixe o identificador legível.
+func NewEncryptor(rules []Rule, provider KeyProvider, subjects *SubjectKeyStore) (*Encryptor, error) {
+	for i, rule := range rules {
+		if rule.Column == "" {
+			return nil, fmt.Errorf("regra %d: coluna não informada", i)
+		}
+		if rule.Subject == "" {
+			continue
+		}
+		if subjects == nil {
+			return nil, fmt.Errorf("regra %d: a coluna '%s' usa chave de titular, mas o repositório de chaves de titulares não foi configurado", i, rule.Column)
+		}
+		if !subjectCovered(rules, rule) {
+			return nil, fmt.Errorf("regra %d: a coluna do titular '%s' não é cifrada com a chave do titular; inclua uma regra com \"column\" e \"subject\" iguais a '%s' no mesmo escopo", i, rule.Subject, rule.Subject)
+		}
+	}
+	if provider == nil {
+		return nil, fmt.Errorf("provedor de chaves não configurado")
+	}
+	return &Encryptor{rules: rules, provider: provider, subjects: subjects}, nil
+}
+
+// subjectCovered indica se alguma regra cifra a coluna do titular da regra informada com a chave
+// do próprio titular, do mesmo tenant, em todos os eventos em que a regra se aplica
+func subjectCovered(rules []Rule, rule Rule) bool {
+	for _, other := range rules {
+		if other.Column == rule.Subject && other.Subject == rule.Subject && other.Tenant == rule.Tenant &&
+			coversField(other.Application, rule.Application) &&
+			coversField(other.Schema, rule.Schema) &&
+			coversField(other.Table, rule.Table) {
+			return true
+		}
+	}
+	return false
+}
+
+// coversField indica se o campo de seleção pattern casa com todos os valores casados por value
+func coversField(pattern, value string) bool {
+	return pattern == "" || pattern == wildcard || pattern == value
+}
+
+// Apply cifra as colunas das regras que se aplicam ao evento nas imagens before e after e no
+// diff, com a chave ativa do tenant ou com a chave do titular, e registra no evento os
+// identificadores das chaves e a referência dos titulares. O titular é lido em cada imagem, e os
+// valores anteriores do diff usam a chave da imagem before e os novos a da imagem after, de modo
+// que a troca do titular numa alteração não grave os dados de um com a chave do outro. As chaves
+// são obtidas antes de qualquer alteração, para que um erro não deixe o evento parcialmente
+// cifrado. Colunas de titulares cuja chave foi destruída são gravadas apenas com o marcador de
+// eliminação.
+func (e *Encryptor) Apply(event *model.KafkaEvent) error {
+	if e == nil {
+		return nil
+	}
+
+	type step struct {
+		column        string
+		before, after transform
+	}
+	var steps []step
+	keyIDs := make(map[string]bool)
+	refs := make(map[string]bool)
+	for _, rule := range e.rules {
+		if !rule.matches(event) {
+			continue
+		}
+
+		tenant := rule.Tenant
+		if tenant == "" {
+			tenant = event.Application
+		}
+		before, err := e.imageTransform(rule, tenant, event.Before, keyIDs, refs)
+		if err != nil {
+			return err
+		}
+		after, err := e.imageTransform(rule, tenant, event.After, keyIDs, refs)
+		if err != nil {
+			return err
+		}
+		steps = append(steps, step{column: rule.Column, before: before, after: after})
+	}
+
+	for _, step := range steps {
+		path := strings.Split(step.column, ".")
+		if err := transformPath(event.Before, path, step.before); err != nil {
+			return err
+		}
+		if err := transformPath(event.After, path, step.after); err != nil {
+			return err
+		}
+		if err := transformChanges(event.Diff, step.column, step.before, step.after); err != nil {
+			return err
+		}
+	}
+
+	event.KeyID = joinSorted(keyIDs)
+	event.SubjectRef = joinSorted(refs)
+	return nil
+}
+
+// imageTransform retorna a transformação da coluna da regra numa imagem, com a chave do titular
+// identificado nela ou com a chave ativa do tenant, e registra a chave e a referência do titular
+// usadas
+func (e *Encryptor) imageTransform(rule Rule, tenant string, image interface{}, keyIDs, refs map[string]bool) (transform, error) {
+	key, ref, err := e.key(rule, tenant, image)
+	if ref != "" {
+		refs[ref] = true
+	}
+	if errors.Is(err, ErrSubjectShredded) {
+		keyIDs[key.ID] = true
+		return shredded(key.ID), nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("erro ao obter a chave de criptografia: %w", err)
+	}
+	keyIDs[key.ID] = true
+	return encrypted(key), nil
+}
+
+// key retorna a chave usada pela regra na imagem: a chave do titular, quando a regra informa o
+// titular e a imagem o identifica, ou a chave ativa do tenant
+func (e *Encryptor) key(rule Rule, tenant string, image interface{}) (DataKey, string, error) {
+	if rule.Subject != "" {
+		if subject, ok := subjectValue(image, rule.Subject); ok {
+			ref := e.subjects.Ref(tenant, subject)
+			key, err := e.subjects.Key(tenant, ref)
+			return key, ref, err
+		}
+	}
+	key, err := e.provider.ActiveKey(tenant)
+	return key, "", err
+}
+
+// subjectValue lê na imagem o identificador do titular
+func subjectValue(image interface{}, column string) (string, bool) {
+	value := image
+	for _, field := range strings.Split(column, ".") {
+		record, ok := value.(map[string]interface{})
+		if !ok {
+			return "", false
+		}
+		value = record[field]
+	}
+	switch v := value.(type) {
+	case nil:
+		return "", false
+	case string:
+		return v, v != ""
+	default:
+		return fmt.Sprint(v), true
+	}
+}
+
+// matches indica se a regra se aplica ao evento
+func (rule Rule) matches(event *model.KafkaEvent) bool {
+	return matchField(rule.Application, event.Application) &&
+		matchField(rule.Schema, event.Source.Schema) &&
+		matchField(rule.Table, event.Source.Table)
+}
+
+// matchField compara um campo de seleção da regra com o valor do evento
+func matchField(pattern, value string) bool {
+	return pattern == "" || pattern == wildcard || pattern == value
+}
+
+// encrypted cifra os valores com a chave informada
+func encrypted(key DataKey) transform {
+	return func(value interface{}) (interface{}, error) {
+		return Encrypt(key, value)
+	}
+}
+
+// shredded substitui os valores pelo marcador de eliminação, sem gravar o dado original
+func shredded(keyID string) transform {
+	return func(value interface{}) (interface{}, error) {
+		return map[string]interface{}{"enc": ShreddedMarker, "kid": keyID}, nil
+	}
+}
+
+// transformPath percorre o caminho da coluna na imagem e substitui o valor encontrado
+func transformPath(image interface{}, path []string, fn transform) error {
+	record, ok := image.(map[string]interface{})
+	if !ok {
+		return nil
+	}
+
+	value, exists := record[path[0]]
+	if !exists || value == nil {
+		return nil
+	}
+	if len(path) > 1 {
+		return transformPath(value, path[1:], fn)
+	}
+
+	result, err := fn(value)
+	if err != nil {
+		return err
+	}
+	record[path[0]] = result
+	return nil
+}
+
+// transformChanges substitui os valores do diff que contêm a coluna cifrada: a própria coluna,
+// campos internos dela ou objetos que a contêm. Os valores anteriores usam a transformação da
+// imagem before e os novos a da imagem after.
+func transformChanges(changes []model.ColumnChange, column string, before, after transform) error {
+	for i := range changes {
+		change := &changes[i]
+		switch {
+		case change.Path == column || strings.HasPrefix(change.Path, column+"."):
+			if err := transformValue(&change.Old, before); err != nil {
+				return err
+			}
+			if err := transformValue(&change.New, after); err != nil {
+				return err
+			}
+		case strings.HasPrefix(column, change.Path+"."):
+			path := strings.Split(strings.TrimPrefix(column, change.Path+"."), ".")
+			if err := transformPath(change.Old, path, before); err != nil {
+				return err
+			}
+			if err := transformPath(change.New, path, after); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// transformValue substitui um valor do diff, se ele existir
+func transformValue(value *interface{}, fn transform) error {
+	if *value == nil {
+		return nil
+	}
+	result, err := fn(*value)
+	if err != nil {
+		return err
+	}
+	*value = result
+	return nil
+}
+
+// joinSorted junta os valores em ordem alfabética, separados por vírgula
+func joinSorted(values map[string]bool) string {
+	list := make([]string, 0, len(values))
+	for value := range values {
+		list = append(list, value)
+	}
+	sort.Strings(list)
+	return strings.Join(list, ",")
+}
+
+// Encrypt cifra um valor, serializado em JSON para preservar o seu tipo, e retorna o envelope
+// {"enc", "kid", "ct"} que o substitui no evento
+func Encrypt(key DataKey, value interface{}) (map[string]interface{}, error) {
+	plaintext, err := json.Marshal(value)
+	if err != nil {
+		return nil, fmt.Errorf("erro ao serializar valor para criptografia: %w", err)
+	}
+	ciphertext, err := seal(key.Key, plaintext, []byte(key.ID))
+	if err != nil {
+		return nil, fmt.Errorf("erro ao cifrar valor: %w", err)
+	}
+	return map[string]interface{}{
+		"enc": Algorithm,
+		"kid": key.ID,
+		"ct":  base64.StdEncoding.EncodeToString(ciphertext),
+	}, nil
+}
@@ -0,0 +1,227 @@
+package encryption
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"github.com/Waelson/audit/audit-consumer/internal/model"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// staticKeys é um KeyProvider com uma chave ativa por tenant
+type staticKeys map[string]DataKey
+
+func (k staticKeys) ActiveKey(tenant string) (DataKey, error) {
+	return k.Key("kek-" + tenant)
+}
+
+func (k staticKeys) Key(id string) (DataKey, error) {
+	key, ok := k[id]
+	if !ok {
+		return DataKey{}, ErrSubjectShredded
+	}
+	return key, nil
+}
+
+func newTestKeys(t *testing.T, tenants ...string) staticKeys {
+	t.Helper()
+	keys := make(staticKeys)
+	for _, tenant := range tenants {
+		key, err := NewKey()
+		if err != nil {
+			t.Fatal(err)
+		}
+		keys["kek-"+tenant] = DataKey{ID: "kek-" + tenant, Tenant: tenant, Key: key}
+	}
+	return keys
+}
+
+// subjectRules cifra o nome no cartão e o identificador do cliente com a chave do cliente
+var subjectRules = []Rule{
+	{Schema: "public", Table: "payments", Column: "name_on_card", Subject: "customer_id"},
+	{Schema: "public", Table: "payments", Column: "customer_id", Subject: "customer_id"},
+}
+
+func newSubjectEncryptor(t *testing.T) (*Encryptor, *SubjectKeyStore) {
+	t.Helper()
+	keys := newTestKeys(t, "payments")
+	subjects, err := NewSubjectKeyStore(t.TempDir(), "segredo", keys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	encryptor, err := NewEncryptor(subjectRules, keys, subjects)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return encryptor, subjects
+}
+
+// decryptWith decifra o envelope com a chave informada
+func decryptWith(t *testing.T, key DataKey, value interface{}) interface{} {
+	t.Helper()
+	envelope, ok := value.(map[string]interface{})
+	if !ok || envelope["enc"] != Algorithm {
+		t.Fatalf("valor não cifrado: %v", value)
+	}
+	if envelope["kid"] != key.ID {
+		t.Fatalf("valor cifrado com a chave %v, esperado %s", envelope["kid"], key.ID)
+	}
+	ciphertext, err := base64.StdEncoding.DecodeString(envelope["ct"].(string))
+	if err != nil {
+		t.Fatal(err)
+	}
+	plaintext, err := open(key.Key, ciphertext, []byte(key.ID))
+	if err != nil {
+		t.Fatalf("erro ao decifrar com a chave %s: %v", key.ID, err)
+	}
+	var decoded interface{}
+	if err := json.Unmarshal(plaintext, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	return decoded
+}
+
+func subjectKey(t *testing.T, subjects *SubjectKeyStore, subject string) (DataKey, string) {
+	t.Helper()
+	ref := subjects.Ref("payments", subject)
+	key, err := subjects.Key("payments", ref)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key, ref
+}
+
+func TestApplyResolvesSubjectPerImage(t *testing.T) {
+	encryptor, subjects := newSubjectEncryptor(t)
+	event := model.KafkaEvent{
+		Op:          model.OperationUpdate,
+		Application: "payments",
+		Source:      model.Source{Schema: "public", Table: "payments"},
+		Before:      map[string]interface{}{"customer_id": "1", "name_on_card": "ANA"},
+		After:       map[string]interface{}{"customer_id": "2", "name_on_card": "BIA"},
+		Diff: []model.ColumnChange{
+			{Column: "customer_id", Path: "customer_id", Kind: "changed", Old: "1", New: "2"},
+			{Column: "name_on_card", Path: "name_on_card", Kind: "changed", Old: "ANA", New: "BIA"},
+		},
+	}
+	if err := encryptor.Apply(&event); err != nil {
+		t.Fatal(err)
+	}
+
+	oldKey, oldRef := subjectKey(t, subjects, "1")
+	newKey, newRef := subjectKey(t, subjects, "2")
+	before := event.Before.(map[string]interface{})
+	after := event.After.(map[string]interface{})
+	if got := decryptWith(t, oldKey, before["name_on_card"]); got != "ANA" {
+		t.Errorf("before.name_on_card = %v", got)
+	}
+	if got := decryptWith(t, oldKey, before["customer_id"]); got != "1" {
+		t.Errorf("before.customer_id = %v", got)
+	}
+	if got := decryptWith(t, newKey, after["name_on_card"]); got != "BIA" {
+		t.Errorf("after.name_on_card = %v", got)
+	}
+	for _, change := range event.Diff {
+		decryptWith(t, oldKey, change.Old)
+		decryptWith(t, newKey, change.New)
+	}
+
+	if want := strings.Join(sortedPair(oldKey.ID, newKey.ID), ","); event.KeyID != want {
+		t.Errorf("KeyID = %s, esperado %s", event.KeyID, want)
+	}
+	if want := strings.Join(sortedPair(oldRef, newRef), ","); event.SubjectRef != want {
+		t.Errorf("SubjectRef = %s, esperado %s", event.SubjectRef, want)
+	}
+}
+
+func sortedPair(a, b string) []string {
+	if a > b {
+		return []string{b, a}
+	}
+	return []string{a, b}
+}
+
+func TestApplyUsesTenantKeyWithoutSubject(t *testing.T) {
+	encryptor, _ := newSubjectEncryptor(t)
+	event := model.KafkaEvent{
+		Op:          model.OperationCreate,
+		Application: "payments",
+		Source:      model.Source{Schema: "public", Table: "payments"},
+		After:       map[string]interface{}{"name_on_card": "ANA"},
+	}
+	if err := encryptor.Apply(&event); err != nil {
+		t.Fatal(err)
+	}
+	tenantKey, _ := encryptor.provider.ActiveKey("payments")
+	decryptWith(t, tenantKey, event.After.(map[string]interface{})["name_on_card"])
+	if event.SubjectRef != "" {
+		t.Errorf("SubjectRef = %s, esperado vazio", event.SubjectRef)
+	}
+}
+
+func TestNewEncryptorRequiresEncryptedSubject(t *testing.T) {
+	keys := newTestKeys(t, "payments")
+	subjects, err := NewSubjectKeyStore(t.TempDir(), "segredo", keys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	card := Rule{Schema: "public", Table: "payments", Column: "name_on_card", Subject: "customer_id"}
+	tests := []struct {
+		name    string
+		rules   []Rule
+		wantErr bool
+	}{
+		{name: "titular cifrado", rules: subjectRules},
+		{name: "titular em claro", rules: []Rule{card}, wantErr: true},
+		{name: "titular cifrado com a chave do tenant", rules: []Rule{card, {Column: "customer_id"}}, wantErr: true},
+		{name: "titular cifrado em escopo menor", rules: []Rule{
+			{Column: "name_on_card", Subject: "customer_id"},
+			{Table: "payments", Column: "customer_id", Subject: "customer_id"},
+		}, wantErr: true},
+		{name: "titular cifrado em escopo maior", rules: []Rule{card, {Table: "*", Column: "customer_id", Subject: "customer_id"}}},
+		{name: "titular de outro tenant", rules: []Rule{card, {Column: "customer_id", Subject: "customer_id", Tenant: "cards"}}, wantErr: true},
+		{name: "coluna não informada", rules: []Rule{{Table: "payments"}}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewEncryptor(tt.rules, keys, subjects)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("NewEncryptor() = %v, erro esperado: %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestEncryptRoundTrip(t *testing.T) {
+	key := newTestKeys(t, "payments")["kek-payments"]
+	values := []interface{}{"ANA", 42.5, true, []interface{}{"a", 1.0}, map[string]interface{}{"document": "123"}}
+	for _, value := range values {
+		envelope, err := Encrypt(key, value)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := decryptWith(t, key, envelope); !reflect.DeepEqual(got, value) {
+			t.Errorf("valor decifrado = %#v, esperado %#v", got, value)
+		}
+	}
+}
+
+func TestEncryptBindsKeyID(t *testing.T) {
+	key := newTestKeys(t, "payments")["kek-payments"]
+	envelope, err := Encrypt(key, "ANA")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ciphertext, err := base64.StdEncoding.DecodeString(envelope["ct"].(string))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := open(key.Key, ciphertext, []byte("kek-cards")); err == nil {
+		t.Error("valor decifrado com outro identificador de chave")
+	}
+	ciphertext[len(ciphertext)-1] ^= 1
+	if _, err := open(key.Key, ciphertext, []byte(key.ID)); err == nil {
+		t.Error("valor adulterado decifrado")
+	}
+}
@@ -0,0 +1,220 @@
+package encryption
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+)
+
+// keySize é o tamanho das chaves mestras e das chaves de dados (AES-256)
+const keySize = 32
+
+// DataKey é uma chave de dados já desembrulhada
+type DataKey struct {
+	ID     string
+	Tenant string
+	Key    []byte
+}
+
+// KeyProvider fornece as chaves de dados usadas na criptografia das colunas. A chave ativa de um
+// tenant cifra os novos registros; as chaves anteriores continuam disponíveis pelo identificador
+// para que registros já gravados possam ser decifrados sem serem reescritos.
+type KeyProvider interface {
+	ActiveKey(tenant string) (DataKey, error)
+	Key(id string) (DataKey, error)
+}
+
+// KeyStoreFile é o conteúdo do arquivo de chaves: as chaves mestras, em base64, e as chaves de
+// dados de cada tenant embrulhadas (cifradas) por uma chave mestra
+type KeyStoreFile struct {
+	MasterKeys map[string]string `json:"masterKeys"`
+	DataKeys   []WrappedKey      `json:"dataKeys"`
+}
+
+// WrappedKey é uma chave de dados cifrada pela chave mestra MasterKeyID
+type WrappedKey struct {
+	ID          string `json:"id"`
+	Tenant      string `json:"tenant"`
+	MasterKeyID string `json:"masterKeyId"`
+	WrappedKey  string `json:"wrappedKey"`
+	Active      bool   `json:"active"`
+}
+
+// fileKeyStore é um KeyProvider baseado em um arquivo local, adequado para desenvolvimento e testes
+type fileKeyStore struct {
+	mu     sync.RWMutex
+	keys   map[string]DataKey
+	active map[string]string
+}
+
+// NewFileKeyStore carrega o arquivo de chaves e desembrulha todas as chaves de dados
+func NewFileKeyStore(path string) (KeyProvider, error) {
+	file, err := ReadKeyStoreFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	store := &fileKeyStore{keys: make(map[string]DataKey), active: make(map[string]string)}
+	for _, wrapped := range file.DataKeys {
+		key, err := file.Unwrap(wrapped)
+		if err != nil {
+			return nil, err
+		}
+		if _, exists := store.keys[wrapped.ID]; exists {
+			return nil, fmt.Errorf("chave de dados '%s' duplicada", wrapped.ID)
+		}
+		store.keys[wrapped.ID] = DataKey{ID: wrapped.ID, Tenant: wrapped.Tenant, Key: key}
+		if wrapped.Active {
+			if current, exists := store.active[wrapped.Tenant]; exists {
+				return nil, fmt.Errorf("o tenant '%s' tem mais de uma chave ativa: '%s' e '%s'", wrapped.Tenant, current, wrapped.ID)
+			}
+			store.active[wrapped.Tenant] = wrapped.ID
+		}
+	}
+	return store, nil
+}
+
+// ActiveKey retorna a chave ativa do tenant
+func (s *fileKeyStore) ActiveKey(tenant string) (DataKey, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	id, ok := s.active[tenant]
+	if !ok {
+		return DataKey{}, fmt.Errorf("nenhuma chave ativa para o tenant '%s'", tenant)
+	}
+	return s.keys[id], nil
+}
+
+// Key retorna a chave de dados com o identificador informado
+func (s *fileKeyStore) Key(id string) (DataKey, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	key, ok := s.keys[id]
+	if !ok {
+		return DataKey{}, fmt.Errorf("chave de dados '%s' não encontrada", id)
+	}
+	return key, nil
+}
+
+// ReadKeyStoreFile lê o arquivo de chaves
+func ReadKeyStoreFile(path string) (*KeyStoreFile, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("erro ao ler o arquivo de chaves '%s': %w", path, err)
+	}
+
+	file := &KeyStoreFile{}
+	if err := json.Unmarshal(data, file); err != nil {
+		return nil, fmt.Errorf("erro ao decodificar o arquivo de chaves '%s': %w", path, err)
+	}
+	if file.MasterKeys == nil {
+		file.MasterKeys = make(map[string]string)
+	}
+	return file, nil
+}
+
+// Save grava o arquivo de chaves com permissão restrita ao dono
+func (f *KeyStoreFile) Save(path string) error {
+	data, err := json.MarshalIndent(f, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0600)
+}
+
+// Unwrap decifra uma chave de dados com a sua chave mestra
+func (f *KeyStoreFile) Unwrap(wrapped WrappedKey) ([]byte, error) {
+	master, err := f.masterKey(wrapped.MasterKeyID)
+	if err != nil {
+		return nil, err
+	}
+	ciphertext, err := base64.StdEncoding.DecodeString(wrapped.WrappedKey)
+	if err != nil {
+		return nil, fmt.Errorf("chave de dados '%s' em base64 inválido: %w", wrapped.ID, err)
+	}
+	key, err := open(master, ciphertext, []byte(wrapped.ID))
+	if err != nil {
+		return nil, fmt.Errorf("erro ao desembrulhar a chave de dados '%s': %w", wrapped.ID, err)
+	}
+	return key, nil
+}
+
+// Wrap cifra uma chave de dados com a chave mestra informada
+func (f *KeyStoreFile) Wrap(id, tenant, masterKeyID string, key []byte) (WrappedKey, error) {
+	master, err := f.masterKey(masterKeyID)
+	if err != nil {
+		return WrappedKey{}, err
+	}
+	ciphertext, err := seal(master, key, []byte(id))
+	if err != nil {
+		return WrappedKey{}, err
+	}
+	return WrappedKey{
+		ID:          id,
+		Tenant:      tenant,
+		MasterKeyID: masterKeyID,
+		WrappedKey:  base64.StdEncoding.EncodeToString(ciphertext),
+	}, nil
+}
+
+// masterKey retorna a chave mestra decodificada
+func (f *KeyStoreFile) masterKey(id string) ([]byte, error) {
+	encoded, ok := f.MasterKeys[id]
+	if !ok {
+		return nil, fmt.Errorf("chave mestra '%s' não encontrada", id)
+	}
+	key, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil || len(key) != keySize {
+		return nil, fmt.Errorf("chave mestra '%s' inválida: deve ter %d bytes em base64", id, keySize)
+	}
+	return key, nil
+}
+
+// NewKey gera uma chave aleatória de 256 bits
+func NewKey() ([]byte, error) {
+	key := make([]byte, keySize)
+	if _, err := rand.Read(key); err != nil {
+		return nil, fmt.Errorf("erro ao gerar chave: %w", err)
+	}
+	return key, nil
+}
+
+// seal cifra o texto com AES-256-GCM; o nonce é gravado no início do resultado
+func seal(key, plaintext, additionalData []byte) ([]byte, error) {
+	aead, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, fmt.Errorf("erro ao gerar nonce: %w", err)
+	}
+	return aead.Seal(nonce, nonce, plaintext, additionalData), nil
+}
+
+// open decifra um texto produzido por seal
+func open(key, ciphertext, additionalData []byte) ([]byte, error) {
+	aead, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(ciphertext) < aead.NonceSize() {
+		return nil, fmt.Errorf("texto cifrado menor que o nonce")
+	}
+	nonce, data := ciphertext[:aead.NonceSize()], ciphertext[aead.NonceSize():]
+	return aead.Open(nil, nonce, data, additionalData)
+}
+
+// newGCM cria o AEAD AES-GCM para a chave informada
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
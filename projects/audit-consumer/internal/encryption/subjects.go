@@ -0,0 +1,178 @@
+package encryption
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// ErrSubjectShredded indica que a chave do titular foi destruída para atender a um pedido de
+// eliminação: os dados dele não podem mais ser cifrados nem decifrados com ela
+var ErrSubjectShredded = errors.New("chave do titular destruída")
+
+// subjectKeyPrefix identifica as chaves de titulares
+const subjectKeyPrefix = "subject-"
+
+// shreddedSuffix é a extensão do marcador gravado quando a chave de um titular é destruída
+const shreddedSuffix = ".shredded"
+
+// subjectKeyFile é o conteúdo do arquivo de uma chave de titular: a chave de dados do titular
+// embrulhada pela chave de dados do tenant
+type subjectKeyFile struct {
+	ID         string    `json:"id"`
+	Tenant     string    `json:"tenant"`
+	SubjectRef string    `json:"subjectRef"`
+	KekID      string    `json:"kekId"`
+	WrappedKey string    `json:"wrappedKey"`
+	CreatedAt  time.Time `json:"createdAt"`
+}
+
+// SubjectKeyStore mantém uma chave por titular (cliente, portador do cartão etc.), um arquivo por
+// chave no diretório informado. Destruir o arquivo torna ilegíveis os dados pessoais do titular na
+// trilha imutável, sem alterar os registros e, portanto, sem invalidar as provas de integridade.
+// O diretório é compartilhado com a Audit API, que executa a destruição.
+type SubjectKeyStore struct {
+	dir        string
+	secret     []byte
+	tenantKeys KeyProvider
+}
+
+// NewSubjectKeyStore cria o repositório de chaves de titulares. O segredo é usado no HMAC que
+// identifica o titular sem expor o seu identificador e deve ser o mesmo na Audit API.
+func NewSubjectKeyStore(dir, secret string, tenantKeys KeyProvider) (*SubjectKeyStore, error) {
+	if secret == "" {
+		return nil, fmt.Errorf("segredo das chaves de titulares não configurado")
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, fmt.Errorf("erro ao criar o diretório de chaves de titulares '%s': %w", dir, err)
+	}
+	return &SubjectKeyStore{dir: dir, secret: []byte(secret), tenantKeys: tenantKeys}, nil
+}
+
+// Ref retorna a referência do titular: o HMAC-SHA256 do tenant e do identificador do titular
+func (s *SubjectKeyStore) Ref(tenant, subject string) string {
+	mac := hmac.New(sha256.New, s.secret)
+	mac.Write([]byte(tenant + ":" + subject))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// SubjectKeyID retorna o identificador da chave do titular a partir da sua referência
+func SubjectKeyID(ref string) string {
+	return subjectKeyPrefix + ref[:32]
+}
+
+// Key retorna a chave do titular, criando-a no primeiro uso. Retorna ErrSubjectShredded se a
+// chave já foi destruída.
+func (s *SubjectKeyStore) Key(tenant, ref string) (DataKey, error) {
+	id := SubjectKeyID(ref)
+	if s.shredded(id) {
+		return DataKey{ID: id, Tenant: tenant}, ErrSubjectShredded
+	}
+
+	key, err := s.read(id)
+	if errors.Is(err, os.ErrNotExist) {
+		key, err = s.create(id, tenant, ref)
+		if errors.Is(err, os.ErrExist) {
+			// Criada concorrentemente por outra instância do consumidor
+			key, err = s.read(id)
+		}
+		if err == nil && s.shredded(id) {
+			// A chave foi destruída enquanto era criada: a nova chave também é descartada
+			os.Remove(s.path(id))
+			return DataKey{ID: id, Tenant: tenant}, ErrSubjectShredded
+		}
+	}
+	return key, err
+}
+
+// shredded indica se existe o marcador de destruição da chave
+func (s *SubjectKeyStore) shredded(id string) bool {
+	_, err := os.Stat(s.path(id) + shreddedSuffix)
+	return err == nil
+}
+
+// read lê e desembrulha a chave do titular
+func (s *SubjectKeyStore) read(id string) (DataKey, error) {
+	data, err := os.ReadFile(s.path(id))
+	if err != nil {
+		return DataKey{}, err
+	}
+	var file subjectKeyFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return DataKey{}, fmt.Errorf("arquivo da chave de titular '%s' inválido: %w", id, err)
+	}
+
+	kek, err := s.tenantKeys.Key(file.KekID)
+	if err != nil {
+		return DataKey{}, err
+	}
+	ciphertext, err := base64.StdEncoding.DecodeString(file.WrappedKey)
+	if err != nil {
+		return DataKey{}, fmt.Errorf("chave de titular '%s' em base64 inválido: %w", id, err)
+	}
+	key, err := open(kek.Key, ciphertext, []byte(id))
+	if err != nil {
+		return DataKey{}, fmt.Errorf("erro ao desembrulhar a chave de titular '%s': %w", id, err)
+	}
+	return DataKey{ID: id, Tenant: file.Tenant, Key: key}, nil
+}
+
+// create gera a chave do titular, embrulhada pela chave ativa do tenant. O arquivo é criado de
+// forma exclusiva para que instâncias concorrentes não usem chaves diferentes.
+func (s *SubjectKeyStore) create(id, tenant, ref string) (DataKey, error) {
+	kek, err := s.tenantKeys.ActiveKey(tenant)
+	if err != nil {
+		return DataKey{}, err
+	}
+	key, err := NewKey()
+	if err != nil {
+		return DataKey{}, err
+	}
+	wrapped, err := seal(kek.Key, key, []byte(id))
+	if err != nil {
+		return DataKey{}, err
+	}
+
+	data, err := json.Marshal(subjectKeyFile{
+		ID:         id,
+		Tenant:     tenant,
+		SubjectRef: ref,
+		KekID:      kek.ID,
+		WrappedKey: base64.StdEncoding.EncodeToString(wrapped),
+		CreatedAt:  time.Now().UTC(),
+	})
+	if err != nil {
+		return DataKey{}, err
+	}
+
+	// O arquivo é gravado em um temporário e publicado com um link, que falha se a chave já
+	// existir: leitores nunca encontram um arquivo parcialmente gravado
+	temp, err := os.CreateTemp(s.dir, id+".*.tmp")
+	if err != nil {
+		return DataKey{}, fmt.Errorf("erro ao gravar a chave de titular '%s': %w", id, err)
+	}
+	defer os.Remove(temp.Name())
+	if _, err := temp.Write(data); err != nil {
+		temp.Close()
+		return DataKey{}, fmt.Errorf("erro ao gravar a chave de titular '%s': %w", id, err)
+	}
+	if err := temp.Close(); err != nil {
+		return DataKey{}, fmt.Errorf("erro ao gravar a chave de titular '%s': %w", id, err)
+	}
+	if err := os.Link(temp.Name(), s.path(id)); err != nil {
+		return DataKey{}, err
+	}
+	return DataKey{ID: id, Tenant: tenant, Key: key}, nil
+}
+
+// path retorna o caminho do arquivo da chave
+func (s *SubjectKeyStore) path(id string) string {
+	return filepath.Join(s.dir, id+".json")
+}
@@ -0,0 +1,107 @@
+package encryption
+
+import (
+	"errors"
+	"github.com/Waelson/audit/audit-consumer/internal/model"
+	"os"
+	"reflect"
+	"testing"
+)
+
+// shred destrói a chave do titular como a Audit API: grava o marcador e remove o arquivo da chave
+func shred(t *testing.T, subjects *SubjectKeyStore, ref string) {
+	t.Helper()
+	id := SubjectKeyID(ref)
+	if err := os.WriteFile(subjects.path(id)+shreddedSuffix, nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Remove(subjects.path(id)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		t.Fatal(err)
+	}
+}
+
+func TestSubjectKeyStoreKey(t *testing.T) {
+	keys := newTestKeys(t, "payments")
+	dir := t.TempDir()
+	subjects, err := NewSubjectKeyStore(dir, "segredo", keys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ref := subjects.Ref("payments", "42")
+	if other := subjects.Ref("cards", "42"); other == ref {
+		t.Error("a referência do titular não depende do tenant")
+	}
+
+	created, err := subjects.Key("payments", ref)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if created.ID != SubjectKeyID(ref) || len(created.Key) != keySize {
+		t.Errorf("chave criada = %s com %d bytes", created.ID, len(created.Key))
+	}
+
+	// Outra instância com o mesmo diretório lê a chave já criada
+	reopened, err := NewSubjectKeyStore(dir, "segredo", keys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	read, err := reopened.Key("payments", ref)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(read, created) {
+		t.Errorf("chave lida = %+v, esperado %+v", read, created)
+	}
+}
+
+func TestSubjectKeyStoreShredded(t *testing.T) {
+	_, subjects := newSubjectEncryptor(t)
+	_, ref := subjectKey(t, subjects, "42")
+	shred(t, subjects, ref)
+
+	if _, err := subjects.Key("payments", ref); !errors.Is(err, ErrSubjectShredded) {
+		t.Errorf("Key() = %v, esperado %v", err, ErrSubjectShredded)
+	}
+	// Uma chave destruída antes do primeiro uso também não é criada
+	unused := subjects.Ref("payments", "43")
+	shred(t, subjects, unused)
+	if _, err := subjects.Key("payments", unused); !errors.Is(err, ErrSubjectShredded) {
+		t.Errorf("Key() = %v, esperado %v", err, ErrSubjectShredded)
+	}
+	if _, err := os.Stat(subjects.path(SubjectKeyID(unused))); !errors.Is(err, os.ErrNotExist) {
+		t.Error("chave criada para um titular eliminado")
+	}
+}
+
+func TestApplyWritesShreddedMarker(t *testing.T) {
+	encryptor, subjects := newSubjectEncryptor(t)
+	_, ref := subjectKey(t, subjects, "42")
+	shred(t, subjects, ref)
+
+	event := model.KafkaEvent{
+		Op:          model.OperationUpdate,
+		Application: "payments",
+		Source:      model.Source{Schema: "public", Table: "payments"},
+		Before:      map[string]interface{}{"customer_id": "42", "name_on_card": "ANA"},
+		After:       map[string]interface{}{"customer_id": "42", "name_on_card": "ANA MARIA"},
+		Diff:        []model.ColumnChange{{Column: "name_on_card", Path: "name_on_card", Kind: "changed", Old: "ANA", New: "ANA MARIA"}},
+	}
+	if err := encryptor.Apply(&event); err != nil {
+		t.Fatal(err)
+	}
+
+	marker := map[string]interface{}{"enc": ShreddedMarker, "kid": SubjectKeyID(ref)}
+	for _, image := range []interface{}{event.Before, event.After} {
+		for _, column := range []string{"customer_id", "name_on_card"} {
+			if got := image.(map[string]interface{})[column]; !reflect.DeepEqual(got, marker) {
+				t.Errorf("%s = %v, esperado o marcador de eliminação", column, got)
+			}
+		}
+	}
+	if change := event.Diff[0]; !reflect.DeepEqual(change.Old, marker) || !reflect.DeepEqual(change.New, marker) {
+		t.Errorf("diff = %v -> %v, esperado o marcador de eliminação", change.Old, change.New)
+	}
+	if event.SubjectRef != ref {
+		t.Errorf("SubjectRef = %s, esperado %s", event.SubjectRef, ref)
+	}
+}
@@ -0,0 +1,139 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Situações de um serviço ou de uma dependência
+const (
+	StatusOK       = "ok"
+	StatusDown     = "down"
+	StatusDegraded = "degraded"
+)
+
+// Check verifica uma dependência, retornando um erro quando ela não está disponível
+type Check func(ctx context.Context) error
+
+// Result é a situação de uma dependência na última verificação
+type Result struct {
+	Status  string `json:"status"`
+	Error   string `json:"error,omitempty"`
+	Latency string `json:"latency"`
+}
+
+// Report é a resposta dos endpoints de saúde, com a situação de cada dependência
+type Report struct {
+	Status string            `json:"status"`
+	Checks map[string]Result `json:"checks"`
+}
+
+// Checker executa as verificações das dependências do serviço. As verificações podem ser
+// registradas depois que o servidor HTTP já está no ar, à medida que as dependências são
+// inicializadas.
+type Checker struct {
+	mu      sync.RWMutex
+	checks  map[string]Check
+	timeout time.Duration
+}
+
+// NewChecker cria um Checker que limita cada verificação ao timeout informado
+func NewChecker(timeout time.Duration) *Checker {
+	return &Checker{checks: make(map[string]Check), timeout: timeout}
+}
+
+// Register registra a verificação de uma dependência, substituindo a anterior de mesmo nome
+func (c *Checker) Register(name string, check Check) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.checks[name] = check
+}
+
+// Run executa as verificações em paralelo. O serviço está ok quando todas as dependências
+// estão disponíveis.
+func (c *Checker) Run(ctx context.Context) Report {
+	c.mu.RLock()
+	names := make([]string, 0, len(c.checks))
+	for name := range c.checks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	checks := make([]Check, len(names))
+	for i, name := range names {
+		checks[i] = c.checks[name]
+	}
+	c.mu.RUnlock()
+
+	results := make([]Result, len(names))
+	var wg sync.WaitGroup
+	for i := range checks {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			results[i] = c.run(ctx, checks[i])
+		}(i)
+	}
+	wg.Wait()
+
+	report := Report{Status: StatusOK, Checks: make(map[string]Result, len(names))}
+	for i, name := range names {
+		report.Checks[name] = results[i]
+		if results[i].Status != StatusOK {
+			report.Status = StatusDown
+		}
+	}
+	return report
+}
+
+// run executa uma verificação limitada pelo timeout
+func (c *Checker) run(ctx context.Context, check Check) Result {
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
+	start := time.Now()
+	err := check(ctx)
+	result := Result{Status: StatusOK, Latency: time.Since(start).Round(time.Microsecond).String()}
+	if err != nil {
+		result.Status = StatusDown
+		result.Error = err.Error()
+	}
+	return result
+}
+
+// Liveness responde em /healthz. O processo está vivo enquanto responde, portanto a resposta é
+// sempre 200; dependências indisponíveis apenas marcam o serviço como degraded, sem provocar
+// o reinício do container.
+func (c *Checker) Liveness() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		report := c.Run(r.Context())
+		if report.Status != StatusOK {
+			report.Status = StatusDegraded
+		}
+		writeReport(w, http.StatusOK, report)
+	}
+}
+
+// Readiness responde em /readyz com 200 quando todas as dependências estão disponíveis e com
+// 503 caso contrário
+func (c *Checker) Readiness() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		report := c.Run(r.Context())
+		status := http.StatusOK
+		if report.Status != StatusOK {
+			status = http.StatusServiceUnavailable
+		}
+		writeReport(w, status, report)
+	}
+}
+
+// writeReport escreve o relatório em JSON
+func writeReport(w http.ResponseWriter, status int, report Report) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(report)
+}
@@ -0,0 +1,132 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestRun(t *testing.T) {
+	unavailable := errors.New("kafka indisponível")
+	tests := []struct {
+		name     string
+		checks   map[string]Check
+		status   string
+		statuses map[string]string
+	}{
+		{"sem dependências", map[string]Check{}, StatusOK, map[string]string{}},
+		{"todas disponíveis", map[string]Check{
+			"kafka":           func(ctx context.Context) error { return nil },
+			"immudb:audit_db": func(ctx context.Context) error { return nil },
+		}, StatusOK, map[string]string{"kafka": StatusOK, "immudb:audit_db": StatusOK}},
+		{"uma indisponível", map[string]Check{
+			"kafka":           func(ctx context.Context) error { return unavailable },
+			"immudb:audit_db": func(ctx context.Context) error { return nil },
+		}, StatusDown, map[string]string{"kafka": StatusDown, "immudb:audit_db": StatusOK}},
+		{"verificação que excede o timeout", map[string]Check{
+			"immudb:audit_db": func(ctx context.Context) error {
+				<-ctx.Done()
+				return ctx.Err()
+			},
+		}, StatusDown, map[string]string{"immudb:audit_db": StatusDown}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			checker := NewChecker(20 * time.Millisecond)
+			for name, check := range tt.checks {
+				checker.Register(name, check)
+			}
+			report := checker.Run(context.Background())
+			if report.Status != tt.status || len(report.Checks) != len(tt.statuses) {
+				t.Fatalf("esperado %s com %d verificação(ões), obtido %+v", tt.status, len(tt.statuses), report)
+			}
+			for name, status := range tt.statuses {
+				result := report.Checks[name]
+				if result.Status != status || (status == StatusDown) != (result.Error != "") || result.Latency == "" {
+					t.Errorf("%s: esperado %s, obtido %+v", name, status, result)
+				}
+			}
+		})
+	}
+}
+
+func TestRunChecksInParallel(t *testing.T) {
+	// Cada verificação espera pela outra: executadas em sequência, ambas excederiam o timeout
+	var started sync.WaitGroup
+	started.Add(2)
+	check := func(ctx context.Context) error {
+		started.Done()
+		done := make(chan struct{})
+		go func() {
+			started.Wait()
+			close(done)
+		}()
+		select {
+		case <-done:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	checker := NewChecker(time.Second)
+	checker.Register("immudb:a", check)
+	checker.Register("immudb:b", check)
+	if report := checker.Run(context.Background()); report.Status != StatusOK {
+		t.Errorf("verificações não executadas em paralelo: %+v", report)
+	}
+}
+
+func TestRegisterReplacesCheck(t *testing.T) {
+	checker := NewChecker(time.Second)
+	checker.Register("kafka", func(ctx context.Context) error { return errors.New("fora do consumer group") })
+	checker.Register("kafka", func(ctx context.Context) error { return nil })
+	report := checker.Run(context.Background())
+	if report.Status != StatusOK || len(report.Checks) != 1 {
+		t.Errorf("esperado apenas a última verificação registrada, obtido %+v", report)
+	}
+}
+
+func TestEndpoints(t *testing.T) {
+	tests := []struct {
+		name      string
+		err       error
+		readiness bool
+		code      int
+		status    string
+	}{
+		{"healthz disponível", nil, false, http.StatusOK, StatusOK},
+		{"healthz com dependência indisponível", errors.New("kafka indisponível"), false, http.StatusOK, StatusDegraded},
+		{"readyz disponível", nil, true, http.StatusOK, StatusOK},
+		{"readyz com dependência indisponível", errors.New("kafka indisponível"), true, http.StatusServiceUnavailable, StatusDown},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			checker := NewChecker(time.Second)
+			checker.Register("kafka", func(ctx context.Context) error { return tt.err })
+			handle, path := checker.Liveness(), "/healthz"
+			if tt.readiness {
+				handle, path = checker.Readiness(), "/readyz"
+			}
+			w := httptest.NewRecorder()
+			handle(w, httptest.NewRequest(http.MethodGet, path, nil))
+			if w.Code != tt.code {
+				t.Errorf("esperado status %d, obtido %d", tt.code, w.Code)
+			}
+			if w.Header().Get("Cache-Control") != "no-store" {
+				t.Error("resposta de saúde sem Cache-Control: no-store")
+			}
+			var report Report
+			if err := json.Unmarshal(w.Body.Bytes(), &report); err != nil {
+				t.Fatalf("resposta inválida: %v", err)
+			}
+			if report.Status != tt.status || report.Checks["kafka"].Status == "" {
+				t.Errorf("esperado %s com a verificação do kafka, obtido %+v", tt.status, report)
+			}
+		})
+	}
+}
@@ -0,0 +1,191 @@
+package masking
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"github.com/Waelson/audit/audit-consumer/internal/model"
+	"os"
+	"strings"
+	"unicode"
+)
+
+// Ações de mascaramento disponíveis
+const (
+	// ActionDrop remove a coluna das imagens
+	ActionDrop = "drop"
+	// ActionHash substitui o valor pelo HMAC-SHA256 com o salt configurado, preservando a
+	// possibilidade de comparar valores iguais sem expô-los
+	ActionHash = "hash"
+	// ActionLast4 mantém apenas os 4 últimos caracteres do valor
+	ActionLast4 = "last4"
+	// ActionMask substitui letras e dígitos por '*', preservando o tamanho, os separadores e os
+	// últimos KeepLast caracteres
+	ActionMask = "mask"
+)
+
+// hashPrefix identifica os valores substituídos pelo HMAC
+const hashPrefix = "hmac-sha256:"
+
+// wildcard casa com qualquer valor nos campos de seleção das regras
+const wildcard = "*"
+
+// Rule define o mascaramento de uma coluna. Application, Schema e Table vazios ou "*" casam com
+// qualquer valor. Column aceita caminhos separados por pontos para campos de colunas com objetos
+// (ex.: "metadata.document").
+type Rule struct {
+	Application string `json:"application,omitempty"`
+	Schema      string `json:"schema,omitempty"`
+	Table       string `json:"table,omitempty"`
+	Column      string `json:"column"`
+	Action      string `json:"action"`
+	KeepLast    int    `json:"keepLast,omitempty"`
+}
+
+// Masker aplica as regras de mascaramento aos eventos. Um Masker nulo não altera os eventos.
+type Masker struct {
+	rules []Rule
+	salt  []byte
+}
+
+// LoadRules lê as regras de um arquivo JSON contendo uma lista de regras
+func LoadRules(path string) ([]Rule, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("erro ao ler o arquivo de mascaramento '%s': %w", path, err)
+	}
+
+	var rules []Rule
+	if err := json.Unmarshal(data, &rules); err != nil {
+		return nil, fmt.Errorf("erro ao decodificar o arquivo de mascaramento '%s': %w", path, err)
+	}
+	return rules, nil
+}
+
+// NewMasker valida as regras e cria o Masker. O salt é obrigatório quando alguma regra usa hash.
+func NewMasker(rules []Rule, salt string) (*Masker, error) {
+	for i, rule := range rules {
+		if rule.Column == "" {
+			return nil, fmt.Errorf("regra %d: coluna não informada", i)
+		}
+		switch rule.Action {
+		case ActionDrop, ActionLast4, ActionMask:
+		case ActionHash:
+			if salt == "" {
+				return nil, fmt.Errorf("regra %d: a ação '%s' exige o salt de mascaramento", i, rule.Action)
+			}
+		default:
+			return nil, fmt.Errorf("regra %d: ação desconhecida '%s'", i, rule.Action)
+		}
+		if rule.KeepLast < 0 {
+			return nil, fmt.Errorf("regra %d: keepLast não pode ser negativo", i)
+		}
+	}
+	return &Masker{rules: rules, salt: []byte(salt)}, nil
+}
+
+// Apply mascara as imagens before e after do evento segundo as regras da sua aplicação, schema
+// e tabela. Deve ser chamado antes de qualquer gravação, registro em log ou cálculo de diff.
+func (m *Masker) Apply(event *model.KafkaEvent) {
+	if m == nil {
+		return
+	}
+	for _, rule := range m.rules {
+		if !rule.matches(event) {
+			continue
+		}
+		path := strings.Split(rule.Column, ".")
+		m.applyRule(event.Before, path, rule)
+		m.applyRule(event.After, path, rule)
+	}
+}
+
+// matches indica se a regra se aplica ao evento
+func (rule Rule) matches(event *model.KafkaEvent) bool {
+	return matchField(rule.Application, event.Application) &&
+		matchField(rule.Schema, event.Source.Schema) &&
+		matchField(rule.Table, event.Source.Table)
+}
+
+// matchField compara um campo de seleção da regra com o valor do evento
+func matchField(pattern, value string) bool {
+	return pattern == "" || pattern == wildcard || pattern == value
+}
+
+// applyRule percorre o caminho da coluna na imagem e mascara o valor encontrado
+func (m *Masker) applyRule(image interface{}, path []string, rule Rule) {
+	record, ok := image.(map[string]interface{})
+	if !ok {
+		return
+	}
+
+	value, exists := record[path[0]]
+	if !exists {
+		return
+	}
+	if len(path) > 1 {
+		m.applyRule(value, path[1:], rule)
+		return
+	}
+
+	if rule.Action == ActionDrop {
+		delete(record, path[0])
+		return
+	}
+	if value != nil {
+		record[path[0]] = m.mask(value, rule)
+	}
+}
+
+// mask aplica a ação da regra a um valor
+func (m *Masker) mask(value interface{}, rule Rule) string {
+	text := stringValue(value)
+	switch rule.Action {
+	case ActionHash:
+		mac := hmac.New(sha256.New, m.salt)
+		mac.Write([]byte(text))
+		return hashPrefix + hex.EncodeToString(mac.Sum(nil))
+	case ActionLast4:
+		runes := []rune(text)
+		if len(runes) > 4 {
+			runes = runes[len(runes)-4:]
+		}
+		return string(runes)
+	default:
+		return maskPreservingFormat(text, rule.KeepLast)
+	}
+}
+
+// maskPreservingFormat substitui letras e dígitos por '*', exceto os últimos keepLast caracteres
+// alfanuméricos, mantendo os separadores para preservar o formato do valor
+func maskPreservingFormat(text string, keepLast int) string {
+	runes := []rune(text)
+	kept := 0
+	for i := len(runes) - 1; i >= 0; i-- {
+		if !unicode.IsLetter(runes[i]) && !unicode.IsDigit(runes[i]) {
+			continue
+		}
+		if kept < keepLast {
+			kept++
+			continue
+		}
+		runes[i] = '*'
+	}
+	return string(runes)
+}
+
+// stringValue converte o valor da coluna em texto; objetos e listas são serializados em JSON
+func stringValue(value interface{}) string {
+	switch v := value.(type) {
+	case string:
+		return v
+	case map[string]interface{}, []interface{}:
+		data, err := json.Marshal(v)
+		if err == nil {
+			return string(data)
+		}
+	}
+	return fmt.Sprint(value)
+}
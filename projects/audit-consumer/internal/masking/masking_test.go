@@ -0,0 +1,143 @@
+package masking
+
+import (
+	"github.com/Waelson/audit/audit-consumer/internal/model"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// paymentEvent retorna uma atualização da tabela public.payments da aplicação payment-api
+func paymentEvent() *model.KafkaEvent {
+	event := &model.KafkaEvent{
+		Application: "payment-api",
+		Before: map[string]interface{}{
+			"card_number": "4111 1111 1111 1234",
+			"cvv":         "123",
+			"metadata":    map[string]interface{}{"document": "123.456.789-00"},
+		},
+		After: map[string]interface{}{
+			"card_number": "4111 1111 1111 1234",
+			"cvv":         "123",
+			"metadata":    map[string]interface{}{"document": "123.456.789-00"},
+			"email":       nil,
+		},
+	}
+	event.Source.Schema = "public"
+	event.Source.Table = "payments"
+	return event
+}
+
+func TestApply(t *testing.T) {
+	tests := []struct {
+		name   string
+		rule   Rule
+		column string
+		want   interface{}
+	}{
+		{name: "drop", rule: Rule{Column: "cvv", Action: ActionDrop}, column: "cvv", want: nil},
+		{name: "last4", rule: Rule{Column: "card_number", Action: ActionLast4}, column: "card_number", want: "1234"},
+		{name: "mask", rule: Rule{Column: "card_number", Action: ActionMask}, column: "card_number", want: "**** **** **** ****"},
+		{name: "mask com keepLast", rule: Rule{Column: "card_number", Action: ActionMask, KeepLast: 4}, column: "card_number", want: "**** **** **** 1234"},
+		{name: "campo de objeto", rule: Rule{Column: "metadata.document", Action: ActionMask, KeepLast: 2}, column: "metadata",
+			want: map[string]interface{}{"document": "***.***.***-00"}},
+		{name: "tabela diferente", rule: Rule{Table: "orders", Column: "cvv", Action: ActionDrop}, column: "cvv", want: "123"},
+		{name: "aplicação curinga", rule: Rule{Application: "*", Schema: "public", Column: "cvv", Action: ActionDrop}, column: "cvv", want: nil},
+		{name: "valor nulo mantido", rule: Rule{Column: "email", Action: ActionMask}, column: "email", want: nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			masker, err := NewMasker([]Rule{tt.rule}, "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			event := paymentEvent()
+			masker.Apply(event)
+			for _, image := range []interface{}{event.Before, event.After} {
+				if got := image.(map[string]interface{})[tt.column]; !reflect.DeepEqual(got, tt.want) {
+					t.Errorf("%s = %#v, esperado %#v", tt.column, got, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestApplyDropRemovesColumn(t *testing.T) {
+	masker, err := NewMasker([]Rule{{Column: "cvv", Action: ActionDrop}}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	event := paymentEvent()
+	masker.Apply(event)
+	if _, exists := event.After.(map[string]interface{})["cvv"]; exists {
+		t.Error("a coluna removida permanece na imagem")
+	}
+}
+
+func TestApplyHash(t *testing.T) {
+	rules := []Rule{{Column: "card_number", Action: ActionHash}}
+	hash := func(salt string) string {
+		masker, err := NewMasker(rules, salt)
+		if err != nil {
+			t.Fatal(err)
+		}
+		event := paymentEvent()
+		masker.Apply(event)
+		return event.After.(map[string]interface{})["card_number"].(string)
+	}
+
+	first := hash("salt-a")
+	if !strings.HasPrefix(first, hashPrefix) || strings.Contains(first, "1234") {
+		t.Errorf("hash = %q, esperado o HMAC com o prefixo %q", first, hashPrefix)
+	}
+	if again := hash("salt-a"); again != first {
+		t.Errorf("hash com o mesmo salt = %q, esperado %q", again, first)
+	}
+	if other := hash("salt-b"); other == first {
+		t.Error("hashes iguais com salts diferentes")
+	}
+}
+
+func TestNilMasker(t *testing.T) {
+	var masker *Masker
+	event := paymentEvent()
+	masker.Apply(event)
+	if !reflect.DeepEqual(event, paymentEvent()) {
+		t.Error("um Masker nulo alterou o evento")
+	}
+}
+
+func TestNewMaskerErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		rule Rule
+	}{
+		{name: "sem coluna", rule: Rule{Action: ActionDrop}},
+		{name: "ação desconhecida", rule: Rule{Column: "cvv", Action: "encrypt"}},
+		{name: "hash sem salt", rule: Rule{Column: "cvv", Action: ActionHash}},
+		{name: "keepLast negativo", rule: Rule{Column: "cvv", Action: ActionMask, KeepLast: -1}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := NewMasker([]Rule{tt.rule}, ""); err == nil {
+				t.Error("NewMasker() não retornou erro")
+			}
+		})
+	}
+}
+
+func TestLoadRules(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "masking.json")
+	if err := os.WriteFile(path, []byte(`[{"table":"payments","column":"cvv","action":"drop"}]`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	rules, err := LoadRules(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []Rule{{Table: "payments", Column: "cvv", Action: ActionDrop}}; !reflect.DeepEqual(rules, want) {
+		t.Errorf("LoadRules() = %v, esperado %v", rules, want)
+	}
+}
@@ -0,0 +1,128 @@
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+const namespace = "audit_consumer"
+
+var (
+	// CircuitBreakerState expõe o estado de cada circuit breaker (0 = closed, 1 = half-open, 2 = open)
+	CircuitBreakerState = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "circuit_breaker_state",
+		Help:      "Estado do circuit breaker (0 = closed, 1 = half-open, 2 = open).",
+	}, []string{"breaker"})
+
+	// CircuitBreakerFailures conta as falhas registradas no circuit breaker por classe de erro
+	CircuitBreakerFailures = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "circuit_breaker_failures_total",
+		Help:      "Falhas transitórias registradas no circuit breaker.",
+	}, []string{"breaker", "error_class"})
+
+	// StorageAttempts conta as tentativas de gravação por resultado
+	StorageAttempts = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "storage_attempts_total",
+		Help:      "Tentativas de gravação no armazenamento de auditoria por resultado.",
+	}, []string{"result"})
+
+	// SessionRenewals conta as renovações da sessão com o ImmuDB por resultado
+	SessionRenewals = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "immudb_session_renewals_total",
+		Help:      "Reconexões ao ImmuDB após sessão expirada ou erro de transporte, por resultado.",
+	}, []string{"result"})
+
+	// VerificationFailures conta as gravações cuja prova criptográfica foi rejeitada por banco
+	VerificationFailures = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "verification_failures_total",
+		Help:      "Gravações no ImmuDB cuja prova de consistência com o estado confiável falhou.",
+	}, []string{"database"})
+
+	// DuplicatesSkipped conta os eventos ignorados por já terem sido ingeridos
+	DuplicatesSkipped = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "duplicates_skipped_total",
+		Help:      "Eventos ignorados por já estarem registrados na trilha de auditoria.",
+	})
+
+	// Transactions conta as transações de origem registradas (pending) e validadas (complete ou
+	// incomplete)
+	Transactions = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "transactions_total",
+		Help:      "Transações do banco de origem registradas e validadas, por situação.",
+	}, []string{"status"})
+
+	// MessagesConsumed conta as mensagens recebidas do Kafka por tópico
+	MessagesConsumed = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "messages_consumed_total",
+		Help:      "Mensagens recebidas do Kafka.",
+	}, []string{"topic"})
+
+	// MessagesDecoded conta os eventos decodificados por tópico e tabela de origem
+	MessagesDecoded = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "messages_decoded_total",
+		Help:      "Eventos decodificados e validados.",
+	}, []string{"topic", "table"})
+
+	// MessagesStored conta os eventos gravados na trilha por tópico e tabela de origem
+	MessagesStored = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "messages_stored_total",
+		Help:      "Eventos gravados no armazenamento de auditoria.",
+	}, []string{"topic", "table"})
+
+	// MessagesFailed conta as mensagens enviadas ao dead-letter por tópico e etapa (decode ou storage)
+	MessagesFailed = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "messages_failed_total",
+		Help:      "Mensagens enviadas ao dead-letter.",
+	}, []string{"topic", "stage"})
+
+	// WriteDuration mede a duração das gravações por sink, banco e tabela de destino
+	WriteDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "storage_write_duration_seconds",
+		Help:      "Duração das gravações no armazenamento de auditoria.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"sink", "database", "table"})
+
+	// BatchSize mede a quantidade de eventos gravados em cada lote
+	BatchSize = promauto.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "batch_size",
+		Help:      "Quantidade de eventos por lote gravado.",
+		Buckets:   prometheus.ExponentialBuckets(1, 2, 11),
+	})
+
+	// ConsumerLag expõe, por partição, as mensagens ainda não processadas (high-water mark do
+	// Kafka menos o próximo offset a processar)
+	ConsumerLag = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "consumer_lag",
+		Help:      "Mensagens da partição ainda não processadas pelo consumidor.",
+	}, []string{"topic", "partition"})
+
+	// Rebalances conta as sessões do consumer group iniciadas, uma a cada rebalanceamento
+	Rebalances = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "rebalances_total",
+		Help:      "Sessões do consumer group iniciadas após rebalanceamentos.",
+	})
+
+	// EndToEndLatency mede o tempo entre a alteração no banco de origem (source.ts_ms) e a
+	// gravação do evento na trilha
+	EndToEndLatency = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "end_to_end_latency_seconds",
+		Help:      "Tempo entre a alteração no banco de origem e a gravação na trilha de auditoria.",
+		Buckets:   prometheus.ExponentialBuckets(0.05, 2, 14),
+	}, []string{"topic", "table"})
+)
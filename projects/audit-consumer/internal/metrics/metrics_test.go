@@ -0,0 +1,67 @@
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"strings"
+	"testing"
+)
+
+// observeAll registra uma observação em cada métrica, para que as métricas com rótulos sejam
+// exportadas
+func observeAll() {
+	CircuitBreakerState.WithLabelValues("immudb").Set(0)
+	CircuitBreakerFailures.WithLabelValues("immudb", "unavailable").Inc()
+	StorageAttempts.WithLabelValues("success").Inc()
+	SessionRenewals.WithLabelValues("success").Inc()
+	VerificationFailures.WithLabelValues("audit_db").Inc()
+	DuplicatesSkipped.Inc()
+	Transactions.WithLabelValues("pending").Inc()
+	MessagesConsumed.WithLabelValues("audit-trail").Inc()
+	MessagesDecoded.WithLabelValues("audit-trail", "public.payments").Inc()
+	MessagesStored.WithLabelValues("audit-trail", "public.payments").Inc()
+	MessagesFailed.WithLabelValues("audit-trail", "decode").Inc()
+	WriteDuration.WithLabelValues("immudb", "audit_db", "audit_trail").Observe(0.01)
+	BatchSize.Observe(10)
+	ConsumerLag.WithLabelValues("audit-trail", "0").Set(5)
+	Rebalances.Inc()
+	EndToEndLatency.WithLabelValues("audit-trail", "public.payments").Observe(0.5)
+}
+
+func TestMetricsFollowNamingConventions(t *testing.T) {
+	observeAll()
+	problems, err := testutil.GatherAndLint(prometheus.DefaultGatherer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, problem := range problems {
+		if strings.HasPrefix(problem.Metric, namespace+"_") {
+			t.Errorf("%s: %s", problem.Metric, problem.Text)
+		}
+	}
+
+	families, err := prometheus.DefaultGatherer.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	exported := 0
+	for _, family := range families {
+		if strings.HasPrefix(family.GetName(), namespace+"_") {
+			exported++
+		}
+	}
+	if exported != 16 {
+		t.Errorf("%d métrica(s) do consumidor exportada(s), esperado 16", exported)
+	}
+}
+
+func TestCounterLabels(t *testing.T) {
+	before := testutil.ToFloat64(Transactions.WithLabelValues("complete"))
+	Transactions.WithLabelValues("complete").Inc()
+	if after := testutil.ToFloat64(Transactions.WithLabelValues("complete")); after != before+1 {
+		t.Errorf("transações completas = %v, esperado %v", after, before+1)
+	}
+	if pending := testutil.ToFloat64(Transactions.WithLabelValues("incomplete")); pending != 0 {
+		t.Errorf("transações incompletas = %v, esperado 0", pending)
+	}
+}
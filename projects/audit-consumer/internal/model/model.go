@@ -1,5 +1,19 @@
 package model
 
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// Operações emitidas pelo Debezium no campo "op" do envelope
+const (
+	OperationCreate   = "c"
+	OperationUpdate   = "u"
+	OperationDelete   = "d"
+	OperationRead     = "r"
+	OperationTruncate = "t"
+)
+
 type Source struct {
 	Version   string `json:"version"`
 	Connector string `json:"connector"`
@@ -12,8 +26,8 @@ type Source struct {
 	TsNs      int64  `json:"ts_ns"`
 	Schema    string `json:"schema"`
 	Table     string `json:"table"`
-	TxID      int    `json:"txId"`
-	Lsn       int    `json:"lsn"`
+	TxID      int64  `json:"txId"`
+	Lsn       int64  `json:"lsn"`
 }
 
 // KafkaEvent é a estrutura do evento Kafka recebido
@@ -26,9 +40,198 @@ type KafkaEvent struct {
 	Before      interface{} `json:"before"`
 	Source      Source      `json:"source"`
 	Application string      `json:"application"`
+	// Transaction identifica a transação do banco de origem, presente quando o conector publica
+	// os metadados de transação (provide.transaction.metadata=true)
+	Transaction *TransactionBlock `json:"transaction"`
+	// Kafka contém as coordenadas da mensagem de origem, preenchidas pelo consumidor
+	Kafka KafkaCoordinates `json:"-"`
+	// Schema é o schema do envelope, presente apenas quando o conversor publica schemas
+	Schema *ConnectSchema `json:"-"`
+	// Diff contém as alterações coluna a coluna dos eventos de atualização, calculadas pelo consumidor
+	Diff []ColumnChange `json:"-"`
+	// KeyID identifica a chave de dados usada na criptografia das colunas sensíveis
+	KeyID string `json:"-"`
+	// SubjectRef identifica os titulares cujos dados foram cifrados com chaves de titular
+	SubjectRef string `json:"-"`
+}
+
+// Validate verifica se o evento contém as informações exigidas pela sua operação
+func (e KafkaEvent) Validate() error {
+	switch e.Op {
+	case OperationCreate, OperationRead, OperationUpdate:
+		if e.After == nil {
+			return fmt.Errorf("evento '%s' sem a imagem posterior (after)", e.Op)
+		}
+	case OperationDelete:
+		if e.Before == nil {
+			return fmt.Errorf("evento de exclusão sem a imagem anterior (before); verifique a REPLICA IDENTITY da tabela")
+		}
+	case OperationTruncate:
+		if e.Source.Table == "" {
+			return fmt.Errorf("evento de truncate sem a tabela de origem")
+		}
+	default:
+		return fmt.Errorf("operação desconhecida: '%s'", e.Op)
+	}
+	return nil
+}
+
+// TransactionBlock é o bloco "transaction" dos eventos: a transação de origem e a posição do
+// evento dentro dela
+type TransactionBlock struct {
+	ID                  string `json:"id"`
+	TotalOrder          int64  `json:"total_order"`
+	DataCollectionOrder int64  `json:"data_collection_order"`
+}
+
+// Situações dos marcadores do tópico de transações
+const (
+	TransactionBegin = "BEGIN"
+	TransactionEnd   = "END"
+)
+
+// TransactionMarker é a mensagem publicada pelo Debezium no tópico de transações no início
+// (BEGIN) e no fim (END) de cada transação. O marcador END informa a quantidade de eventos da
+// transação, no total e por tabela (data collection).
+type TransactionMarker struct {
+	Status          string                `json:"status"`
+	ID              string                `json:"id"`
+	EventCount      int64                 `json:"event_count"`
+	DataCollections []DataCollectionCount `json:"data_collections"`
+	TsMs            int64                 `json:"ts_ms"`
+}
+
+// DataCollectionCount é a quantidade de eventos de uma tabela na transação. ReceivedCount é
+// preenchido pelo consumidor na validação da transação.
+type DataCollectionCount struct {
+	DataCollection string `json:"data_collection"`
+	EventCount     int64  `json:"event_count"`
+	ReceivedCount  int64  `json:"received_count"`
+}
+
+// Validate verifica se o marcador contém as informações exigidas pela sua situação
+func (m TransactionMarker) Validate() error {
+	if m.ID == "" {
+		return fmt.Errorf("marcador de transação sem identificador")
+	}
+	switch m.Status {
+	case TransactionBegin, TransactionEnd:
+		return nil
+	default:
+		return fmt.Errorf("situação de transação desconhecida: '%s'", m.Status)
+	}
+}
+
+// Tipos de alteração das tabelas informados nos eventos de alteração de schema
+const (
+	TableChangeCreate = "CREATE"
+	TableChangeAlter  = "ALTER"
+	TableChangeDrop   = "DROP"
+)
+
+// SchemaChange é o evento de alteração de schema (DDL) publicado pelo Debezium no tópico
+// <topic.prefix>, ou o registro equivalente do tópico de histórico de schema. Os eventos do tópico
+// de alterações informam a posição no bloco source; os registros do histórico, no bloco position.
+// Um mesmo DDL pode afetar várias tabelas, descritas em TableChanges com a definição resultante.
+type SchemaChange struct {
+	Source       map[string]interface{} `json:"source"`
+	Position     map[string]interface{} `json:"position"`
+	TsMs         int64                  `json:"ts_ms"`
+	DatabaseName string                 `json:"databaseName"`
+	SchemaName   string                 `json:"schemaName"`
+	DDL          string                 `json:"ddl"`
+	TableChanges []TableChange          `json:"tableChanges"`
+}
+
+// TableChange é a alteração de uma tabela: o tipo (CREATE, ALTER ou DROP), o identificador
+// qualificado da tabela, ex.: "payment_db"."public"."payments", e a definição das suas colunas
+// após a alteração
+type TableChange struct {
+	Type  string          `json:"type"`
+	ID    string          `json:"id"`
+	Table json.RawMessage `json:"table"`
+}
+
+// Validate verifica se o evento informa o DDL ou as tabelas alteradas
+func (c SchemaChange) Validate() error {
+	if c.DDL == "" && len(c.TableChanges) == 0 {
+		return fmt.Errorf("alteração de schema sem DDL e sem tabelas alteradas")
+	}
+	for _, change := range c.TableChanges {
+		if change.ID == "" {
+			return fmt.Errorf("alteração de schema sem o identificador da tabela")
+		}
+	}
+	return nil
+}
+
+// KafkaCoordinates identifica uma mensagem no Kafka
+type KafkaCoordinates struct {
+	Topic     string
+	Partition int32
+	Offset    int64
+}
+
+// IdempotencyKey retorna a chave natural que identifica o evento de forma única.
+// Quando o Debezium informa a posição da alteração no log do banco (LSN) a chave é baseada
+// nela, de modo que o mesmo evento tenha a mesma chave mesmo que seja publicado novamente.
+// Leituras de snapshot compartilham o mesmo LSN e por isso usam as coordenadas do Kafka.
+func (e KafkaEvent) IdempotencyKey() string {
+	if e.Source.Lsn != 0 && e.Op != "r" {
+		return fmt.Sprintf("lsn:%s:%s.%s.%s:%d:%d:%s",
+			e.Source.Name, e.Source.Db, e.Source.Schema, e.Source.Table, e.Source.Lsn, e.Source.TxID, e.Op)
+	}
+	return fmt.Sprintf("kafka:%s:%d:%d", e.Kafka.Topic, e.Kafka.Partition, e.Kafka.Offset)
 }
 
 type Event struct {
 	After  interface{} `json:"after"`
 	Before interface{} `json:"before"`
+	// Diff contém as alterações coluna a coluna dos eventos de atualização
+	Diff []ColumnChange `json:"diff,omitempty"`
+}
+
+// Tipos de alteração de uma coluna
+const (
+	ChangeModified = "changed"
+	ChangeAdded    = "added"
+	ChangeRemoved  = "removed"
+)
+
+// ColumnChange é a alteração de uma coluna entre as imagens before e after. Path identifica
+// campos internos de colunas com objetos (ex.: "address.city"); Column é a coluna de primeiro nível.
+type ColumnChange struct {
+	Column string      `json:"column"`
+	Path   string      `json:"path"`
+	Kind   string      `json:"kind"`
+	Old    interface{} `json:"old"`
+	New    interface{} `json:"new"`
+}
+
+// ConnectSchema é o schema do Kafka Connect que acompanha o envelope quando o conversor
+// é configurado com schemas.enable=true
+type ConnectSchema struct {
+	Type       string            `json:"type"`
+	Optional   bool              `json:"optional"`
+	Name       string            `json:"name,omitempty"`
+	Version    int               `json:"version,omitempty"`
+	Parameters map[string]string `json:"parameters,omitempty"`
+	Field      string            `json:"field,omitempty"`
+	Fields     []ConnectSchema   `json:"fields,omitempty"`
+	Items      *ConnectSchema    `json:"items,omitempty"`
+	Keys       *ConnectSchema    `json:"keys,omitempty"`
+	Values     *ConnectSchema    `json:"values,omitempty"`
+}
+
+// FieldSchema retorna o schema do campo informado de uma estrutura ou nil se ele não existir
+func (s *ConnectSchema) FieldSchema(name string) *ConnectSchema {
+	if s == nil {
+		return nil
+	}
+	for i := range s.Fields {
+		if s.Fields[i].Field == name {
+			return &s.Fields[i]
+		}
+	}
+	return nil
 }
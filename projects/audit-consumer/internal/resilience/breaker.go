@@ -0,0 +1,162 @@
+package resilience
+
+import (
+	"context"
+	"github.com/Waelson/audit/audit-consumer/internal/metrics"
+	"log"
+	"sync"
+	"time"
+)
+
+// State representa o estado do circuit breaker
+type State int
+
+const (
+	StateClosed State = iota
+	StateHalfOpen
+	StateOpen
+)
+
+func (s State) String() string {
+	switch s {
+	case StateClosed:
+		return "closed"
+	case StateHalfOpen:
+		return "half-open"
+	case StateOpen:
+		return "open"
+	default:
+		return "unknown"
+	}
+}
+
+// CircuitBreaker suspende as chamadas a uma dependência depois de falhas consecutivas.
+// Após o tempo de abertura uma única chamada de teste é liberada (half-open): se ela tiver
+// sucesso o circuito fecha, caso contrário volta a abrir.
+type CircuitBreaker struct {
+	name             string
+	failureThreshold int
+	openTimeout      time.Duration
+
+	mu       sync.Mutex
+	state    State
+	failures int
+	openedAt time.Time
+	probing  bool
+	changed  chan struct{}
+}
+
+// NewCircuitBreaker cria um circuit breaker que abre após failureThreshold falhas consecutivas
+func NewCircuitBreaker(name string, failureThreshold int, openTimeout time.Duration) *CircuitBreaker {
+	if failureThreshold < 1 {
+		failureThreshold = 1
+	}
+	metrics.CircuitBreakerState.WithLabelValues(name).Set(float64(StateClosed))
+	return &CircuitBreaker{
+		name:             name,
+		failureThreshold: failureThreshold,
+		openTimeout:      openTimeout,
+		changed:          make(chan struct{}),
+	}
+}
+
+// State retorna o estado atual do circuit breaker
+func (b *CircuitBreaker) State() State {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.state
+}
+
+// Wait bloqueia enquanto o circuito estiver aberto. Retorna nil quando a chamada pode
+// ser executada ou o erro do contexto caso ele seja encerrado durante a espera. probe indica
+// que a chamada liberada é a chamada de teste do estado meio-aberto: o chamador deve encerrá-la
+// com Success, Failure ou, se ela for interrompida sem resultado, Abort.
+func (b *CircuitBreaker) Wait(ctx context.Context) (probe bool, err error) {
+	for {
+		b.mu.Lock()
+		var wait time.Duration
+		switch b.state {
+		case StateClosed:
+			b.mu.Unlock()
+			return false, nil
+		case StateOpen:
+			elapsed := time.Since(b.openedAt)
+			if elapsed >= b.openTimeout {
+				b.setState(StateHalfOpen)
+				b.probing = true
+				b.mu.Unlock()
+				return true, nil
+			}
+			wait = b.openTimeout - elapsed
+		case StateHalfOpen:
+			if !b.probing {
+				b.probing = true
+				b.mu.Unlock()
+				return true, nil
+			}
+			wait = b.openTimeout
+		}
+		changed := b.changed
+		b.mu.Unlock()
+
+		select {
+		case <-ctx.Done():
+			return false, ctx.Err()
+		case <-changed:
+		case <-time.After(wait):
+		}
+	}
+}
+
+// Abort libera a chamada de teste do estado meio-aberto interrompida sem resultado, como no
+// cancelamento do contexto em um rebalanceamento ou no encerramento, para que a próxima chamada
+// teste a dependência. O estado do circuito não é alterado.
+func (b *CircuitBreaker) Abort() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if !b.probing {
+		return
+	}
+	b.probing = false
+	b.notify()
+}
+
+// Success registra uma chamada bem-sucedida e fecha o circuito
+func (b *CircuitBreaker) Success() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.failures = 0
+	b.probing = false
+	if b.state != StateClosed {
+		b.setState(StateClosed)
+	}
+}
+
+// Failure registra uma falha da dependência, abrindo o circuito quando o limite é atingido
+func (b *CircuitBreaker) Failure(err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.failures++
+	b.probing = false
+	metrics.CircuitBreakerFailures.WithLabelValues(b.name, ClassifyError(err)).Inc()
+
+	if b.state == StateHalfOpen || (b.state == StateClosed && b.failures >= b.failureThreshold) {
+		log.Printf("Circuit breaker '%s': %d falha(s) consecutiva(s), última: %v", b.name, b.failures, err)
+		b.openedAt = time.Now()
+		b.setState(StateOpen)
+	}
+}
+
+// setState altera o estado e acorda as goroutines em espera. Deve ser chamado com o lock adquirido.
+func (b *CircuitBreaker) setState(state State) {
+	log.Printf("Circuit breaker '%s' mudou de estado: %s -> %s", b.name, b.state, state)
+	b.state = state
+	metrics.CircuitBreakerState.WithLabelValues(b.name).Set(float64(state))
+	b.notify()
+}
+
+// notify acorda as goroutines em espera. Deve ser chamado com o lock adquirido.
+func (b *CircuitBreaker) notify() {
+	close(b.changed)
+	b.changed = make(chan struct{})
+}
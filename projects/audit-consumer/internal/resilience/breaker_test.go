@@ -0,0 +1,130 @@
+package resilience
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+var errUnavailable = WithClass(ErrorClassUnavailable, errors.New("servidor indisponível"))
+
+func TestCircuitBreakerStates(t *testing.T) {
+	tests := []struct {
+		name  string
+		calls []string
+		want  State
+	}{
+		{name: "falhas abaixo do limite", calls: []string{"failure", "failure"}, want: StateClosed},
+		{name: "falhas no limite", calls: []string{"failure", "failure", "failure"}, want: StateOpen},
+		{name: "sucesso zera as falhas", calls: []string{"failure", "failure", "success", "failure", "failure"}, want: StateClosed},
+		{name: "teste com sucesso fecha", calls: []string{"failure", "failure", "failure", "wait", "success"}, want: StateClosed},
+		{name: "teste com falha reabre", calls: []string{"failure", "failure", "failure", "wait", "failure"}, want: StateOpen},
+		{name: "teste interrompido mantém meio-aberto", calls: []string{"failure", "failure", "failure", "wait", "abort"}, want: StateHalfOpen},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			breaker := NewCircuitBreaker(t.Name(), 3, time.Millisecond)
+			for _, call := range tt.calls {
+				switch call {
+				case "failure":
+					breaker.Failure(errUnavailable)
+				case "success":
+					breaker.Success()
+				case "abort":
+					breaker.Abort()
+				case "wait":
+					time.Sleep(2 * time.Millisecond)
+					probe, err := breaker.Wait(context.Background())
+					if err != nil || !probe {
+						t.Fatalf("Wait() = %v, %v; esperada a chamada de teste", probe, err)
+					}
+				}
+			}
+			if state := breaker.State(); state != tt.want {
+				t.Errorf("estado = %s, esperado %s", state, tt.want)
+			}
+		})
+	}
+}
+
+func TestCircuitBreakerSingleProbe(t *testing.T) {
+	breaker := NewCircuitBreaker(t.Name(), 1, time.Millisecond)
+	breaker.Failure(errUnavailable)
+	time.Sleep(2 * time.Millisecond)
+
+	if probe, err := breaker.Wait(context.Background()); err != nil || !probe {
+		t.Fatalf("Wait() = %v, %v; esperada a chamada de teste", probe, err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := breaker.Wait(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("segunda chamada liberada durante o teste: %v", err)
+	}
+}
+
+func TestRunReleasesProbeOnCancellation(t *testing.T) {
+	policy := NewRetryPolicy(3, time.Millisecond, time.Millisecond, 0, DefaultRetryableClasses)
+	breaker := NewCircuitBreaker(t.Name(), 1, time.Millisecond)
+	breaker.Failure(errUnavailable)
+	time.Sleep(2 * time.Millisecond)
+
+	// A chamada de teste é interrompida pelo cancelamento do contexto, como em um rebalanceamento
+	ctx, cancel := context.WithCancel(context.Background())
+	_, err := Run(ctx, policy, breaker, func(ctx context.Context) error {
+		cancel()
+		return ctx.Err()
+	})
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("Run() = %v, esperado context.Canceled", err)
+	}
+
+	ctx, cancel = context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	attempts, err := Run(ctx, policy, breaker, func(context.Context) error { return nil })
+	if err != nil || attempts != 1 {
+		t.Fatalf("Run() = %d, %v; esperada uma tentativa com sucesso", attempts, err)
+	}
+	if state := breaker.State(); state != StateClosed {
+		t.Errorf("estado = %s, esperado %s", state, StateClosed)
+	}
+}
+
+func TestRun(t *testing.T) {
+	errInvalid := WithClass(ErrorClassInvalid, errors.New("registro inválido"))
+	tests := []struct {
+		name         string
+		results      []error
+		wantAttempts int
+		wantErr      error
+	}{
+		{name: "sucesso", results: []error{nil}, wantAttempts: 1},
+		{name: "transitório e sucesso", results: []error{errUnavailable, nil}, wantAttempts: 2},
+		{name: "erro da operação não é repetido", results: []error{errInvalid}, wantAttempts: 1, wantErr: errInvalid},
+		{name: "tentativas esgotadas", results: []error{errUnavailable, errUnavailable, errUnavailable}, wantAttempts: 3, wantErr: errUnavailable},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			policy := NewRetryPolicy(3, time.Millisecond, time.Millisecond, 0, DefaultRetryableClasses)
+			breaker := NewCircuitBreaker(t.Name(), 10, time.Millisecond)
+			calls := 0
+			attempts, err := Run(context.Background(), policy, breaker, func(context.Context) error {
+				result := tt.results[calls]
+				calls++
+				return result
+			})
+			if attempts != tt.wantAttempts || !errors.Is(err, tt.wantErr) {
+				t.Errorf("Run() = %d, %v; esperado %d, %v", attempts, err, tt.wantAttempts, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	policy := NewRetryPolicy(5, 100*time.Millisecond, time.Second, 0, nil)
+	for attempt, want := range map[int]time.Duration{1: 100 * time.Millisecond, 2: 200 * time.Millisecond, 4: 800 * time.Millisecond, 5: time.Second} {
+		if got := policy.Backoff(attempt); got != want {
+			t.Errorf("Backoff(%d) = %s, esperado %s", attempt, got, want)
+		}
+	}
+}
@@ -0,0 +1,190 @@
+package resilience
+
+import (
+	"context"
+	"errors"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"math"
+	"math/rand"
+	"time"
+)
+
+// Classes de erro usadas para decidir se uma operação pode ser repetida
+const (
+	ErrorClassUnavailable       = "unavailable"
+	ErrorClassTimeout           = "timeout"
+	ErrorClassResourceExhausted = "resource_exhausted"
+	ErrorClassAborted           = "aborted"
+	ErrorClassUnauthenticated   = "unauthenticated"
+	ErrorClassInvalid           = "invalid"
+	ErrorClassCanceled          = "canceled"
+	ErrorClassUnknown           = "unknown"
+	// ErrorClassIntegrity indica que o armazenamento falhou na verificação criptográfica; a
+	// operação nunca é repetida
+	ErrorClassIntegrity = "integrity"
+)
+
+// DefaultRetryableClasses são as classes de erro consideradas transitórias por padrão
+var DefaultRetryableClasses = []string{
+	ErrorClassUnavailable,
+	ErrorClassTimeout,
+	ErrorClassResourceExhausted,
+	ErrorClassAborted,
+}
+
+// RetryPolicy define quantas vezes e com qual intervalo uma operação é repetida
+type RetryPolicy struct {
+	MaxAttempts      int
+	InitialBackoff   time.Duration
+	MaxBackoff       time.Duration
+	Multiplier       float64
+	Jitter           float64
+	RetryableClasses map[string]bool
+}
+
+// NewRetryPolicy cria uma política de retentativa com backoff exponencial e jitter
+func NewRetryPolicy(maxAttempts int, initialBackoff, maxBackoff time.Duration, jitter float64, retryableClasses []string) RetryPolicy {
+	if maxAttempts < 1 {
+		maxAttempts = 1
+	}
+	classes := make(map[string]bool, len(retryableClasses))
+	for _, class := range retryableClasses {
+		classes[class] = true
+	}
+	return RetryPolicy{
+		MaxAttempts:      maxAttempts,
+		InitialBackoff:   initialBackoff,
+		MaxBackoff:       maxBackoff,
+		Multiplier:       2,
+		Jitter:           math.Max(0, math.Min(jitter, 1)),
+		RetryableClasses: classes,
+	}
+}
+
+// IsRetryable indica se o erro pertence a uma classe transitória
+func (p RetryPolicy) IsRetryable(err error) bool {
+	return err != nil && p.RetryableClasses[ClassifyError(err)]
+}
+
+// Backoff calcula o intervalo de espera após a tentativa informada (iniciando em 1)
+func (p RetryPolicy) Backoff(attempt int) time.Duration {
+	backoff := float64(p.InitialBackoff) * math.Pow(p.Multiplier, float64(attempt-1))
+	if p.MaxBackoff > 0 && backoff > float64(p.MaxBackoff) {
+		backoff = float64(p.MaxBackoff)
+	}
+	if p.Jitter > 0 {
+		// Distribui o intervalo em [backoff*(1-jitter), backoff*(1+jitter)]
+		backoff = backoff * (1 - p.Jitter + 2*p.Jitter*rand.Float64())
+	}
+	return time.Duration(backoff)
+}
+
+// classifiedError é um erro cuja classe foi definida por quem o produziu
+type classifiedError struct {
+	class string
+	err   error
+}
+
+func (e *classifiedError) Error() string {
+	return e.err.Error()
+}
+
+func (e *classifiedError) Unwrap() error {
+	return e.err
+}
+
+// WithClass associa uma classe ao erro, para falhas que não vêm de chamadas gRPC
+func WithClass(class string, err error) error {
+	if err == nil {
+		return nil
+	}
+	return &classifiedError{class: class, err: err}
+}
+
+// ClassifyError associa um erro de uma chamada gRPC, ou classificado com WithClass, a uma
+// classe de erro
+func ClassifyError(err error) string {
+	if err == nil {
+		return ""
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		return ErrorClassTimeout
+	}
+	if errors.Is(err, context.Canceled) {
+		return ErrorClassCanceled
+	}
+	var classified *classifiedError
+	if errors.As(err, &classified) {
+		return classified.class
+	}
+
+	st, ok := status.FromError(err)
+	if !ok {
+		return ErrorClassUnknown
+	}
+	switch st.Code() {
+	case codes.Unavailable:
+		return ErrorClassUnavailable
+	case codes.DeadlineExceeded:
+		return ErrorClassTimeout
+	case codes.ResourceExhausted:
+		return ErrorClassResourceExhausted
+	case codes.Aborted:
+		return ErrorClassAborted
+	case codes.Unauthenticated, codes.PermissionDenied:
+		return ErrorClassUnauthenticated
+	case codes.Canceled:
+		return ErrorClassCanceled
+	case codes.InvalidArgument, codes.FailedPrecondition, codes.AlreadyExists, codes.NotFound, codes.OutOfRange:
+		return ErrorClassInvalid
+	default:
+		return ErrorClassUnknown
+	}
+}
+
+// Run executa a operação aplicando a política de retentativa e o circuit breaker.
+// Enquanto o circuit breaker estiver aberto a execução fica suspensa; erros transitórios só
+// são devolvidos depois de esgotadas as tentativas com o circuito fechado, isto é, quando a
+// falha parece ser da operação e não da indisponibilidade do servidor.
+// Retorna a quantidade de tentativas realizadas e o último erro.
+func Run(ctx context.Context, policy RetryPolicy, breaker *CircuitBreaker, operation func(ctx context.Context) error) (int, error) {
+	attempts := 0
+	for {
+		probe, err := breaker.Wait(ctx)
+		if err != nil {
+			return attempts, err
+		}
+
+		attempts++
+		err = operation(ctx)
+		if err == nil {
+			breaker.Success()
+			return attempts, nil
+		}
+		if ctx.Err() != nil {
+			// A operação foi interrompida sem resultado: a chamada de teste é liberada para
+			// que o circuito não fique meio-aberto à espera de um resultado que não virá
+			if probe {
+				breaker.Abort()
+			}
+			return attempts, ctx.Err()
+		}
+		if !policy.IsRetryable(err) {
+			// O servidor respondeu: o erro é da operação e não conta como falha do circuito
+			breaker.Success()
+			return attempts, err
+		}
+
+		breaker.Failure(err)
+		if attempts >= policy.MaxAttempts && breaker.State() == StateClosed {
+			return attempts, err
+		}
+
+		select {
+		case <-ctx.Done():
+			return attempts, ctx.Err()
+		case <-time.After(policy.Backoff(attempts)):
+		}
+	}
+}
@@ -0,0 +1,186 @@
+package routing
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+)
+
+// Decoders disponíveis para as rotas
+const (
+	DecoderJSON = "json"
+	DecoderAvro = "avro"
+)
+
+// Tipos de tópico: eventos de alteração das tabelas, marcadores de transação ou alterações de
+// schema (DDL) do Debezium
+const (
+	KindChange      = "change"
+	KindTransaction = "transaction"
+	KindSchema      = "schema"
+)
+
+// identifierPattern restringe os nomes de banco e tabela, que são interpolados nas instruções SQL
+var identifierPattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// Route define como as mensagens de um tópico são processadas. A rota é escolhida pelo nome
+// exato do tópico (Topic) ou por uma expressão regular que deve casar com o nome inteiro (Pattern).
+// Campos vazios assumem os valores da rota padrão. Kind indica o tipo de tópico; nos tópicos de
+// transações, Database é o banco onde as transações são registradas e validadas, e nos tópicos de
+// alterações de schema, o banco onde o histórico de DDL é registrado.
+type Route struct {
+	Topic       string `json:"topic,omitempty"`
+	Pattern     string `json:"pattern,omitempty"`
+	Kind        string `json:"kind,omitempty"`
+	Decoder     string `json:"decoder,omitempty"`
+	Database    string `json:"database,omitempty"`
+	Table       string `json:"table,omitempty"`
+	Application string `json:"application,omitempty"`
+
+	pattern *regexp.Regexp
+}
+
+// Router escolhe a rota de cada tópico
+type Router struct {
+	defaults Route
+	routes   []Route
+}
+
+// LoadRoutes lê as rotas de um arquivo JSON contendo uma lista de rotas
+func LoadRoutes(path string) ([]Route, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("erro ao ler o arquivo de rotas '%s': %w", path, err)
+	}
+
+	var routes []Route
+	if err := json.Unmarshal(data, &routes); err != nil {
+		return nil, fmt.Errorf("erro ao decodificar o arquivo de rotas '%s': %w", path, err)
+	}
+	return routes, nil
+}
+
+// NewRouter valida as rotas e cria o Router. A rota padrão deve definir decoder, banco e tabela.
+// Rotas por nome exato têm precedência sobre as rotas por expressão regular, que são avaliadas
+// na ordem em que foram informadas.
+func NewRouter(defaults Route, routes []Route) (*Router, error) {
+	if err := validate(defaults); err != nil {
+		return nil, fmt.Errorf("rota padrão inválida: %w", err)
+	}
+
+	router := &Router{defaults: defaults}
+	for i, route := range routes {
+		if (route.Topic == "") == (route.Pattern == "") {
+			return nil, fmt.Errorf("rota %d: informe exatamente um entre 'topic' e 'pattern'", i)
+		}
+		if route.Pattern != "" {
+			pattern, err := regexp.Compile("^(?:" + route.Pattern + ")$")
+			if err != nil {
+				return nil, fmt.Errorf("rota %d: expressão regular inválida '%s': %w", i, route.Pattern, err)
+			}
+			route.pattern = pattern
+		}
+
+		route = route.withDefaults(defaults)
+		if err := validate(route); err != nil {
+			return nil, fmt.Errorf("rota %d: %w", i, err)
+		}
+		router.routes = append(router.routes, route)
+	}
+
+	// Mantém as rotas por nome exato antes das rotas por expressão regular
+	sort.SliceStable(router.routes, func(i, j int) bool {
+		return router.routes[i].pattern == nil && router.routes[j].pattern != nil
+	})
+	return router, nil
+}
+
+// Route retorna a rota do tópico informado ou a rota padrão se nenhuma rota casar com ele
+func (r *Router) Route(topic string) Route {
+	for _, route := range r.routes {
+		if route.Topic == topic || (route.pattern != nil && route.pattern.MatchString(topic)) {
+			return route
+		}
+	}
+	return r.defaults
+}
+
+// Databases retorna os bancos de destino de todas as rotas e as tabelas de cada um
+func (r *Router) Databases() map[string][]string {
+	databases := make(map[string][]string)
+	seen := make(map[string]bool)
+	for _, route := range append([]Route{r.defaults}, r.routes...) {
+		key := route.Database + "." + route.Table
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		databases[route.Database] = append(databases[route.Database], route.Table)
+	}
+	return databases
+}
+
+// Uses indica se alguma rota, inclusive a padrão, utiliza o decoder informado
+func (r *Router) Uses(decoderName string) bool {
+	if r.defaults.Decoder == decoderName {
+		return true
+	}
+	for _, route := range r.routes {
+		if route.Decoder == decoderName {
+			return true
+		}
+	}
+	return false
+}
+
+// HasKind indica se alguma rota, inclusive a padrão, é do tipo informado
+func (r *Router) HasKind(kind string) bool {
+	if r.defaults.Kind == kind {
+		return true
+	}
+	for _, route := range r.routes {
+		if route.Kind == kind {
+			return true
+		}
+	}
+	return false
+}
+
+// withDefaults preenche os campos vazios da rota com os valores da rota padrão
+func (route Route) withDefaults(defaults Route) Route {
+	if route.Kind == "" {
+		route.Kind = defaults.Kind
+	}
+	if route.Decoder == "" {
+		route.Decoder = defaults.Decoder
+	}
+	if route.Database == "" {
+		route.Database = defaults.Database
+	}
+	if route.Table == "" {
+		route.Table = defaults.Table
+	}
+	if route.Application == "" {
+		route.Application = defaults.Application
+	}
+	return route
+}
+
+// validate verifica o tipo, o decoder e os nomes de banco e tabela da rota
+func validate(route Route) error {
+	if route.Kind != KindChange && route.Kind != KindTransaction && route.Kind != KindSchema {
+		return fmt.Errorf("tipo de tópico desconhecido: '%s'", route.Kind)
+	}
+	if route.Decoder != DecoderJSON && route.Decoder != DecoderAvro {
+		return fmt.Errorf("decoder desconhecido: '%s'", route.Decoder)
+	}
+	if !identifierPattern.MatchString(route.Database) {
+		return fmt.Errorf("nome de banco inválido: '%s'", route.Database)
+	}
+	if !identifierPattern.MatchString(route.Table) {
+		return fmt.Errorf("nome de tabela inválido: '%s'", route.Table)
+	}
+	return nil
+}
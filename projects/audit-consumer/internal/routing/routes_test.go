@@ -0,0 +1,102 @@
+package routing
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+var defaultRoute = Route{Kind: KindChange, Decoder: DecoderJSON, Database: "audit_db", Table: "audit_trail"}
+
+func TestRouterRoute(t *testing.T) {
+	router, err := NewRouter(defaultRoute, []Route{
+		{Pattern: `billing\..*`, Database: "billing_db", Decoder: DecoderAvro},
+		{Topic: "billing.public.invoices", Table: "invoices"},
+		{Pattern: `.*\.transaction`, Kind: KindTransaction},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		topic string
+		want  Route
+	}{
+		{topic: "billing.public.invoices", want: Route{Topic: "billing.public.invoices", Kind: KindChange, Decoder: DecoderJSON, Database: "audit_db", Table: "invoices"}},
+		{topic: "billing.public.orders", want: Route{Pattern: `billing\..*`, Kind: KindChange, Decoder: DecoderAvro, Database: "billing_db", Table: "audit_trail"}},
+		{topic: "billing.transaction", want: Route{Pattern: `billing\..*`, Kind: KindChange, Decoder: DecoderAvro, Database: "billing_db", Table: "audit_trail"}},
+		{topic: "payment.transaction", want: Route{Pattern: `.*\.transaction`, Kind: KindTransaction, Decoder: DecoderJSON, Database: "audit_db", Table: "audit_trail"}},
+		{topic: "xbilling.orders", want: defaultRoute},
+		{topic: "audit-trail", want: defaultRoute},
+	}
+	for _, tt := range tests {
+		t.Run(tt.topic, func(t *testing.T) {
+			got := router.Route(tt.topic)
+			got.pattern = nil
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Route() = %+v, esperado %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRouterDatabases(t *testing.T) {
+	router, err := NewRouter(defaultRoute, []Route{
+		{Topic: "orders", Table: "orders_trail"},
+		{Topic: "orders-v2", Table: "orders_trail"},
+		{Topic: "billing", Database: "billing_db", Decoder: DecoderAvro},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string][]string{"audit_db": {"audit_trail", "orders_trail"}, "billing_db": {"audit_trail"}}
+	if got := router.Databases(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Databases() = %v, esperado %v", got, want)
+	}
+	if !router.Uses(DecoderAvro) || !router.HasKind(KindChange) || router.HasKind(KindSchema) {
+		t.Error("Uses() ou HasKind() não consideram as rotas")
+	}
+}
+
+func TestNewRouterErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		defaults Route
+		routes   []Route
+	}{
+		{name: "rota padrão sem banco", defaults: Route{Kind: KindChange, Decoder: DecoderJSON, Table: "audit_trail"}},
+		{name: "sem tópico nem expressão", defaults: defaultRoute, routes: []Route{{Table: "orders"}}},
+		{name: "tópico e expressão", defaults: defaultRoute, routes: []Route{{Topic: "orders", Pattern: "orders.*"}}},
+		{name: "expressão inválida", defaults: defaultRoute, routes: []Route{{Pattern: "orders("}}},
+		{name: "tipo desconhecido", defaults: defaultRoute, routes: []Route{{Topic: "orders", Kind: "heartbeat"}}},
+		{name: "decoder desconhecido", defaults: defaultRoute, routes: []Route{{Topic: "orders", Decoder: "protobuf"}}},
+		{name: "tabela com SQL", defaults: defaultRoute, routes: []Route{{Topic: "orders", Table: "orders; DROP TABLE x"}}},
+		{name: "banco com hífen", defaults: defaultRoute, routes: []Route{{Topic: "orders", Database: "audit-db"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := NewRouter(tt.defaults, tt.routes); err == nil {
+				t.Error("NewRouter() não retornou erro")
+			}
+		})
+	}
+}
+
+func TestLoadRoutes(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "routes.json")
+	content := `[{"topic":"orders","table":"orders_trail"},{"pattern":"billing\\..*","decoder":"avro","kind":"change"}]`
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	routes, err := LoadRoutes(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Route{{Topic: "orders", Table: "orders_trail"}, {Pattern: `billing\..*`, Decoder: DecoderAvro, Kind: KindChange}}
+	if !reflect.DeepEqual(routes, want) {
+		t.Errorf("LoadRoutes() = %+v, esperado %+v", routes, want)
+	}
+	if _, err := LoadRoutes(filepath.Join(t.TempDir(), "ausente.json")); err == nil {
+		t.Error("LoadRoutes() não retornou erro para um arquivo ausente")
+	}
+}
@@ -0,0 +1,69 @@
+package routing
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Subscription define os tópicos consumidos: uma lista de nomes e, opcionalmente, uma expressão
+// regular avaliada sobre os tópicos existentes no cluster. O tópico de dead-letter nunca é
+// consumido, para que as mensagens rejeitadas não voltem ao consumidor.
+type Subscription struct {
+	Topics     []string
+	Pattern    *regexp.Regexp
+	DeadLetter string
+}
+
+// NewSubscription cria a inscrição a partir da lista de tópicos e da expressão regular, que deve
+// casar com o nome inteiro do tópico. O tópico de dead-letter não pode estar na lista e é
+// excluído dos tópicos que casam com a expressão.
+func NewSubscription(topics []string, pattern, deadLetter string) (Subscription, error) {
+	subscription := Subscription{Topics: topics, DeadLetter: deadLetter}
+	for _, topic := range topics {
+		if deadLetter != "" && topic == deadLetter {
+			return subscription, fmt.Errorf("o tópico de dead-letter '%s' não pode ser consumido", deadLetter)
+		}
+	}
+	if pattern != "" {
+		compiled, err := regexp.Compile("^(?:" + pattern + ")$")
+		if err != nil {
+			return subscription, fmt.Errorf("expressão regular de tópicos inválida '%s': %w", pattern, err)
+		}
+		subscription.Pattern = compiled
+	}
+	if len(subscription.Topics) == 0 && subscription.Pattern == nil {
+		return subscription, fmt.Errorf("nenhum tópico ou expressão regular de tópicos informado")
+	}
+	return subscription, nil
+}
+
+// Dynamic indica se os tópicos inscritos dependem dos tópicos existentes no cluster
+func (s Subscription) Dynamic() bool {
+	return s.Pattern != nil
+}
+
+// Resolve retorna, em ordem alfabética, os tópicos listados e os tópicos disponíveis que casam com a
+// expressão regular. Tópicos internos do Kafka (iniciados por "__") e o tópico de dead-letter
+// nunca casam com a expressão.
+func (s Subscription) Resolve(available []string) []string {
+	selected := make(map[string]bool)
+	for _, topic := range s.Topics {
+		selected[topic] = true
+	}
+	if s.Pattern != nil {
+		for _, topic := range available {
+			if !strings.HasPrefix(topic, "__") && topic != s.DeadLetter && s.Pattern.MatchString(topic) {
+				selected[topic] = true
+			}
+		}
+	}
+
+	topics := make([]string, 0, len(selected))
+	for topic := range selected {
+		topics = append(topics, topic)
+	}
+	sort.Strings(topics)
+	return topics
+}
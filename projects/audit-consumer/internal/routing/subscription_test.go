@@ -0,0 +1,52 @@
+package routing
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSubscriptionResolve(t *testing.T) {
+	available := []string{"__consumer_offsets", "audit-trail", "audit-trail-dlq", "audit.orders", "billing"}
+	tests := []struct {
+		name    string
+		topics  []string
+		pattern string
+		want    []string
+	}{
+		{name: "lista de tópicos", topics: []string{"billing", "audit-trail"}, want: []string{"audit-trail", "billing"}},
+		{name: "expressão exclui o dead-letter", pattern: "audit.*", want: []string{"audit-trail", "audit.orders"}},
+		{name: "expressão casa com o nome inteiro", pattern: "audit", want: []string{}},
+		{name: "expressão exclui tópicos internos", pattern: ".*", want: []string{"audit-trail", "audit.orders", "billing"}},
+		{name: "lista e expressão", topics: []string{"billing"}, pattern: `audit\..*`, want: []string{"audit.orders", "billing"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			subscription, err := NewSubscription(tt.topics, tt.pattern, "audit-trail-dlq")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := subscription.Resolve(available); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Resolve() = %v, esperado %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewSubscriptionErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		topics  []string
+		pattern string
+	}{
+		{name: "sem tópicos"},
+		{name: "expressão inválida", pattern: "audit("},
+		{name: "dead-letter na lista", topics: []string{"audit-trail", "audit-trail-dlq"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := NewSubscription(tt.topics, tt.pattern, "audit-trail-dlq"); err == nil {
+				t.Error("NewSubscription() não retornou erro")
+			}
+		})
+	}
+}
@@ -0,0 +1,289 @@
+package sink
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/Waelson/audit/audit-consumer/internal/metrics"
+	"github.com/Waelson/audit/audit-consumer/internal/resilience"
+	"github.com/codenotary/immudb/pkg/api/schema"
+	"github.com/codenotary/immudb/pkg/client"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"log"
+	"strings"
+	"sync"
+	"time"
+)
+
+// sessionErrors são as mensagens com que o ImmuDB rejeita uma operação por falta de uma sessão
+// válida: o token expirou, o servidor foi reiniciado ou a sessão foi encerrada
+var sessionErrors = []string{
+	"not logged in",
+	"token has expired",
+	"invalid token",
+	"session not found",
+	"no session found",
+	"please select a database first",
+	client.ErrNotConnected.Error(),
+}
+
+// immuConnection é uma conexão com o ImmuDB que renova a sessão automaticamente. Quando uma
+// operação falha por sessão expirada ou por erro de transporte, a conexão é refeita: um novo
+// cliente é autenticado e o banco em uso é selecionado novamente com UseDatabase. A operação é
+// repetida uma vez após a renovação quando é seguro fazê-lo: sempre que o servidor rejeitou a
+// sessão, pois a operação não chegou a ser executada, e nas consultas em caso de erro de
+// transporte. Uma gravação interrompida por erro de transporte não é repetida, pois pode ter sido
+// aplicada; o erro é devolvido como indisponibilidade para a política de retentativa.
+type immuConnection struct {
+	options  *client.Options
+	user     string
+	password string
+	// open cria um cliente autenticado no banco em uso; é substituído nos testes
+	open func(ctx context.Context, database string) (client.ImmuClient, error)
+
+	mu         sync.Mutex
+	client     client.ImmuClient
+	database   string
+	generation uint64
+}
+
+// newImmuConnection cria a conexão com o ImmuDB. A sessão é aberta em connect.
+func newImmuConnection(options *client.Options, user, password string) *immuConnection {
+	c := &immuConnection{
+		options:  options,
+		user:     user,
+		password: password,
+	}
+	c.open = c.login
+	return c
+}
+
+// connect abre uma sessão autenticada com o ImmuDB
+func (c *immuConnection) connect(ctx context.Context) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.dial(ctx)
+}
+
+// dial abre uma nova sessão e a torna a sessão em uso. Deve ser chamado com o mutex adquirido.
+func (c *immuConnection) dial(ctx context.Context) error {
+	immuClient, err := c.open(ctx, c.database)
+	if err != nil {
+		return err
+	}
+	c.client = immuClient
+	c.generation++
+	log.Println("Conexão com o ImmuDB estabelecida com sucesso.")
+	return nil
+}
+
+// login cria um novo cliente, autentica e seleciona o banco informado, se houver
+func (c *immuConnection) login(ctx context.Context, database string) (client.ImmuClient, error) {
+	log.Printf("Inicializando conexão com o ImmuDB - Host: %s, Porta: %d", c.options.Address, c.options.Port)
+	immuClient, err := client.NewImmuClient(c.options)
+	if err != nil {
+		return nil, resilience.WithClass(resilience.ErrorClassUnavailable, fmt.Errorf("erro ao conectar ao ImmuDB: %w", err))
+	}
+
+	log.Println("Autenticando no ImmuDB...")
+	if _, err := immuClient.Login(ctx, []byte(c.user), []byte(c.password)); err != nil {
+		immuClient.Disconnect()
+		return nil, classifyImmuDBError(fmt.Errorf("erro ao autenticar no ImmuDB: %w", err))
+	}
+	if database != "" {
+		if _, err := immuClient.UseDatabase(ctx, &schema.Database{DatabaseName: database}); err != nil {
+			immuClient.Disconnect()
+			return nil, classifyImmuDBError(fmt.Errorf("erro ao usar banco de dados '%s': %w", database, err))
+		}
+	}
+	return immuClient, nil
+}
+
+// renew refaz a conexão após a falha de uma operação executada com a geração informada. Se outra
+// operação já renovou a conexão, a nova sessão é reaproveitada.
+func (c *immuConnection) renew(ctx context.Context, generation uint64) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.generation != generation {
+		return nil
+	}
+
+	log.Printf("Conexão com o ImmuDB perdida, reconectando - Banco: %s", c.database)
+	if c.client != nil {
+		// A sessão anterior já foi invalidada pelo servidor: os erros do encerramento são esperados
+		c.client.Disconnect()
+	}
+	if err := c.dial(ctx); err != nil {
+		metrics.SessionRenewals.WithLabelValues("failure").Inc()
+		return err
+	}
+	metrics.SessionRenewals.WithLabelValues("success").Inc()
+	return nil
+}
+
+// current retorna o cliente em uso e a sua geração
+func (c *immuConnection) current() (client.ImmuClient, uint64, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.client == nil {
+		return nil, 0, errors.New("conexão com o ImmuDB não inicializada")
+	}
+	return c.client, c.generation, nil
+}
+
+// do executa a operação, renovando a conexão e repetindo a operação uma vez quando ela falha por
+// sessão inválida ou, se a operação for idempotente, por erro de transporte
+func (c *immuConnection) do(ctx context.Context, idempotent bool, operation func(immuClient client.ImmuClient) error) error {
+	immuClient, generation, err := c.current()
+	if err != nil {
+		return err
+	}
+	err = operation(immuClient)
+	if err == nil {
+		return nil
+	}
+
+	expired := isSessionError(err)
+	if !expired && !isTransportError(err) {
+		return err
+	}
+	if renewErr := c.renew(ctx, generation); renewErr != nil {
+		return renewErr
+	}
+	if !expired && !idempotent {
+		return resilience.WithClass(resilience.ErrorClassUnavailable, err)
+	}
+
+	immuClient, _, err = c.current()
+	if err != nil {
+		return err
+	}
+	return classifyImmuDBError(operation(immuClient))
+}
+
+// CreateDatabase cria o banco de dados, ignorando o erro caso ele já exista
+func (c *immuConnection) CreateDatabase(ctx context.Context, database string) error {
+	return c.do(ctx, true, func(immuClient client.ImmuClient) error {
+		_, err := immuClient.CreateDatabaseV2(ctx, database, nil)
+		if err != nil && err.Error() != "database already exists" {
+			return err
+		}
+		return nil
+	})
+}
+
+// UseDatabase seleciona o banco de dados em uso, que passa a ser selecionado novamente a cada
+// renovação da sessão
+func (c *immuConnection) UseDatabase(ctx context.Context, database string) error {
+	err := c.do(ctx, true, func(immuClient client.ImmuClient) error {
+		_, err := immuClient.UseDatabase(ctx, &schema.Database{DatabaseName: database})
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	c.mu.Lock()
+	c.database = database
+	c.mu.Unlock()
+	return nil
+}
+
+// SQLExec executa um comando SQL no banco em uso
+func (c *immuConnection) SQLExec(ctx context.Context, query string, params map[string]interface{}) (*schema.SQLExecResult, error) {
+	var result *schema.SQLExecResult
+	err := c.do(ctx, false, func(immuClient client.ImmuClient) error {
+		var err error
+		result, err = immuClient.SQLExec(ctx, query, params)
+		return err
+	})
+	return result, err
+}
+
+// SQLQuery executa uma consulta SQL no banco em uso
+func (c *immuConnection) SQLQuery(ctx context.Context, query string, params map[string]interface{}) (*schema.SQLQueryResult, error) {
+	var result *schema.SQLQueryResult
+	err := c.do(ctx, true, func(immuClient client.ImmuClient) error {
+		var err error
+		result, err = immuClient.SQLQuery(ctx, query, params, false)
+		return err
+	})
+	return result, err
+}
+
+// VerifiedTxByID lê a transação com a prova de que ela é consistente com o último estado
+// confiável do banco em uso, persistido pelo cliente, e avança esse estado
+func (c *immuConnection) VerifiedTxByID(ctx context.Context, tx uint64) (*schema.Tx, error) {
+	var verified *schema.Tx
+	err := c.do(ctx, true, func(immuClient client.ImmuClient) error {
+		var err error
+		verified, err = immuClient.VerifiedTxByID(ctx, tx)
+		return err
+	})
+	return verified, err
+}
+
+// Health verifica se a sessão é válida e o banco em uso está disponível
+func (c *immuConnection) Health(ctx context.Context) error {
+	return c.do(ctx, true, func(immuClient client.ImmuClient) error {
+		_, err := immuClient.Health(ctx)
+		return err
+	})
+}
+
+// Close encerra a sessão e fecha a conexão
+func (c *immuConnection) Close() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.client == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := c.client.Logout(ctx); err != nil {
+		log.Printf("Erro ao encerrar a sessão do ImmuDB - Banco: %s: %v", c.database, err)
+	}
+	if err := c.client.Disconnect(); err != nil {
+		log.Printf("Erro ao fechar a conexão com o ImmuDB - Banco: %s: %v", c.database, err)
+	}
+	c.client = nil
+}
+
+// isSessionError indica se o ImmuDB rejeitou a operação por falta de uma sessão válida
+func isSessionError(err error) bool {
+	if st, ok := status.FromError(err); ok && st.Code() == codes.Unauthenticated {
+		return true
+	}
+	message := err.Error()
+	for _, sessionError := range sessionErrors {
+		if strings.Contains(message, sessionError) {
+			return true
+		}
+	}
+	return false
+}
+
+// isTransportError indica se a operação falhou na comunicação com o servidor. O cliente do ImmuDB
+// nem sempre preserva o código gRPC, por isso a mensagem também é verificada.
+func isTransportError(err error) bool {
+	if st, ok := status.FromError(err); ok && st.Code() == codes.Unavailable {
+		return true
+	}
+	message := err.Error()
+	return strings.Contains(message, "connection error") || strings.Contains(message, "transport is closing")
+}
+
+// classifyImmuDBError associa os erros de sessão e de transporte, que o cliente do ImmuDB nem
+// sempre devolve com o código gRPC, às classes de erro transitórias
+func classifyImmuDBError(err error) error {
+	switch {
+	case err == nil:
+		return nil
+	case isTransportError(err):
+		return resilience.WithClass(resilience.ErrorClassUnavailable, err)
+	case isSessionError(err):
+		return resilience.WithClass(resilience.ErrorClassUnauthenticated, err)
+	default:
+		return err
+	}
+}
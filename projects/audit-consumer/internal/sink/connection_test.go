@@ -0,0 +1,175 @@
+package sink
+
+import (
+	"context"
+	"errors"
+	"github.com/Waelson/audit/audit-consumer/internal/resilience"
+	"github.com/codenotary/immudb/pkg/client"
+	"sync"
+	"testing"
+)
+
+// testImmuClient identifica a sessão aberta; as operações são simuladas pelos próprios testes
+type testImmuClient struct {
+	client.ImmuClient
+	session int
+}
+
+func (c *testImmuClient) Disconnect() error {
+	return nil
+}
+
+// newTestConnection cria uma conexão cujas sessões são numeradas na ordem em que são abertas
+func newTestConnection(t *testing.T, openErr func(session int) error) (*immuConnection, *int) {
+	t.Helper()
+	var mu sync.Mutex
+	sessions := 0
+	connection := newImmuConnection(client.DefaultOptions(), "immudb", "immudb")
+	connection.open = func(ctx context.Context, database string) (client.ImmuClient, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		if openErr != nil {
+			if err := openErr(sessions + 1); err != nil {
+				return nil, err
+			}
+		}
+		sessions++
+		return &testImmuClient{session: sessions}, nil
+	}
+	if err := connection.connect(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	return connection, &sessions
+}
+
+// session retorna a sessão do cliente usado na operação
+func session(immuClient client.ImmuClient) int {
+	return immuClient.(*testImmuClient).session
+}
+
+func TestConnectionDo(t *testing.T) {
+	expired := errors.New("token has expired")
+	transport := errors.New("rpc error: code = Unavailable desc = connection error")
+	rejected := errors.New("table does not exist")
+
+	tests := []struct {
+		name       string
+		idempotent bool
+		firstErr   error
+		sessions   int
+		attempts   int
+		class      string
+	}{
+		{"sucesso na sessão atual", false, nil, 1, 1, ""},
+		{"erro do servidor não renova a sessão", true, rejected, 1, 1, resilience.ErrorClassUnknown},
+		{"sessão expirada repete a gravação", false, expired, 2, 2, ""},
+		{"erro de transporte repete a consulta", true, transport, 2, 2, ""},
+		{"erro de transporte não repete a gravação", false, transport, 2, 1, resilience.ErrorClassUnavailable},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			connection, sessions := newTestConnection(t, nil)
+			var used []int
+			err := connection.do(context.Background(), tt.idempotent, func(immuClient client.ImmuClient) error {
+				used = append(used, session(immuClient))
+				if len(used) == 1 {
+					return tt.firstErr
+				}
+				return nil
+			})
+			if tt.class == "" && err != nil {
+				t.Fatalf("erro inesperado: %v", err)
+			}
+			if tt.class != "" && resilience.ClassifyError(err) != tt.class {
+				t.Errorf("esperado erro da classe %s, obtido %v (%s)", tt.class, err, resilience.ClassifyError(err))
+			}
+			if *sessions != tt.sessions || len(used) != tt.attempts {
+				t.Errorf("%d sessão(ões) e %d tentativa(s), esperado %d e %d", *sessions, len(used), tt.sessions, tt.attempts)
+			}
+			if len(used) == 2 && used[1] != 2 {
+				t.Errorf("operação repetida na sessão %d, esperado a sessão renovada", used[1])
+			}
+		})
+	}
+}
+
+func TestConnectionRenewSameGeneration(t *testing.T) {
+	connection, sessions := newTestConnection(t, nil)
+	_, generation, err := connection.current()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Duas operações que falharam na mesma geração: apenas a primeira renova a sessão
+	for i := 0; i < 2; i++ {
+		if err := connection.renew(context.Background(), generation); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if *sessions != 2 {
+		t.Errorf("%d sessão(ões) aberta(s), esperado 2", *sessions)
+	}
+	if _, current, _ := connection.current(); current != generation+1 {
+		t.Errorf("geração %d, esperado %d", current, generation+1)
+	}
+}
+
+func TestConnectionConcurrentRenewal(t *testing.T) {
+	connection, sessions := newTestConnection(t, nil)
+	const callers = 2
+
+	// Os chamadores obtêm a mesma sessão e falham juntos por sessão expirada
+	var started sync.WaitGroup
+	started.Add(callers)
+	var wg sync.WaitGroup
+	retried := make([]int, callers)
+	errs := make([]error, callers)
+	for i := 0; i < callers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			errs[i] = connection.do(context.Background(), false, func(immuClient client.ImmuClient) error {
+				if session(immuClient) == 1 {
+					started.Done()
+					started.Wait()
+					return errors.New("session not found")
+				}
+				retried[i] = session(immuClient)
+				return nil
+			})
+		}(i)
+	}
+	wg.Wait()
+
+	for i := 0; i < callers; i++ {
+		if errs[i] != nil || retried[i] != 2 {
+			t.Errorf("chamador %d: repetido na sessão %d (%v), esperado a sessão 2", i, retried[i], errs[i])
+		}
+	}
+	if *sessions != 2 {
+		t.Errorf("%d sessão(ões) aberta(s), esperado uma única renovação", *sessions)
+	}
+}
+
+func TestConnectionRenewalFailure(t *testing.T) {
+	unavailable := resilience.WithClass(resilience.ErrorClassUnavailable, errors.New("servidor indisponível"))
+	connection, sessions := newTestConnection(t, func(session int) error {
+		if session == 2 {
+			return unavailable
+		}
+		return nil
+	})
+	_, generation, _ := connection.current()
+
+	attempts := 0
+	err := connection.do(context.Background(), true, func(immuClient client.ImmuClient) error {
+		attempts++
+		return errors.New("invalid token")
+	})
+	if !errors.Is(err, unavailable) || attempts != 1 {
+		t.Errorf("esperado o erro da renovação após 1 tentativa, obtido %v após %d", err, attempts)
+	}
+	if _, current, _ := connection.current(); current != generation || *sessions != 1 {
+		t.Errorf("geração %d com %d sessão(ões), esperado a sessão anterior mantida", current, *sessions)
+	}
+}
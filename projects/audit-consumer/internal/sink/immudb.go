@@ -0,0 +1,596 @@
+package sink
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/Waelson/audit/audit-consumer/internal/metrics"
+	"github.com/Waelson/audit/audit-consumer/internal/model"
+	"github.com/codenotary/immudb/pkg/api/schema"
+	"github.com/codenotary/immudb/pkg/client"
+	"log"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ImmuDBSink grava a trilha de auditoria no ImmuDB. Cada banco de destino tem a sua própria
+// conexão, pois o banco em uso pertence à sessão; as conexões renovam a sessão automaticamente
+// quando ela expira ou o servidor é reiniciado. Com a verificação habilitada, cada gravação é
+// confirmada por uma prova criptográfica contra o último estado confiável do banco.
+type ImmuDBSink struct {
+	options     *client.Options
+	user        string
+	password    string
+	verify      bool
+	connections map[string]*immuConnection
+
+	mu       sync.Mutex
+	failures map[string]error
+}
+
+// NewImmuDBSink cria o sink do ImmuDB. As conexões são abertas em Setup; o estado confiável de
+// cada banco é persistido no diretório das opções do cliente.
+func NewImmuDBSink(options *client.Options, user, password string, verify bool) *ImmuDBSink {
+	return &ImmuDBSink{
+		options:     options,
+		user:        user,
+		password:    password,
+		verify:      verify,
+		connections: make(map[string]*immuConnection),
+		failures:    make(map[string]error),
+	}
+}
+
+// Name identifica o sink
+func (s *ImmuDBSink) Name() string {
+	return TypeImmuDB
+}
+
+// Setup conecta cada banco de destino e cria o banco e as tabelas automaticamente
+func (s *ImmuDBSink) Setup(ctx context.Context, databases map[string][]string) error {
+	for dbName, tables := range databases {
+		connection := newImmuConnection(s.options, s.user, s.password)
+		if err := connection.connect(ctx); err != nil {
+			return err
+		}
+		s.connections[dbName] = connection
+		if err := createDatabaseAndTable(ctx, connection, dbName, tables); err != nil {
+			return fmt.Errorf("erro ao configurar o banco de dados e tabela: %w", err)
+		}
+	}
+	return nil
+}
+
+// Check verifica se a sessão é válida e o banco de destino está selecionado, renovando a sessão
+// se necessário. Um banco que falhou na verificação de integridade permanece indisponível.
+func (s *ImmuDBSink) Check(ctx context.Context, database string) error {
+	connection, err := s.connection(database)
+	if err != nil {
+		return err
+	}
+	if err := s.failed(database); err != nil {
+		return err
+	}
+	return connection.Health(ctx)
+}
+
+// Close encerra a sessão de cada banco e fecha a sua conexão
+func (s *ImmuDBSink) Close() error {
+	for dbName, connection := range s.connections {
+		log.Printf("Encerrando a sessão do ImmuDB - Banco: %s", dbName)
+		connection.Close()
+	}
+	return nil
+}
+
+// connection retorna a conexão do banco de destino
+func (s *ImmuDBSink) connection(database string) (*immuConnection, error) {
+	connection, ok := s.connections[database]
+	if !ok {
+		return nil, fmt.Errorf("cliente do ImmuDB não configurado para o banco '%s'", database)
+	}
+	return connection, nil
+}
+
+// Write insere os eventos Kafka na tabela de destino. Eventos já ingeridos são ignorados; os
+// demais são gravados com um único INSERT de múltiplas linhas, junto com suas chaves de
+// idempotência, em uma mesma transação.
+func (s *ImmuDBSink) Write(ctx context.Context, target Target, events []model.KafkaEvent) error {
+	connection, err := s.connection(target.Database)
+	if err != nil {
+		return err
+	}
+	if err := s.failed(target.Database); err != nil {
+		return err
+	}
+	log.Printf("Preparando para inserir %d evento(s) no ImmuDB - Banco: %s, Tabela: %s", len(events), target.Database, target.Table)
+
+	remaining, err := filterIngested(ctx, connection, target, events)
+	if err != nil {
+		return err
+	}
+	if s.verify {
+		// Os eventos já ingeridos podem ter sido gravados por uma tentativa cujas provas não
+		// chegaram a ser registradas
+		if err := s.reconcileProofs(ctx, connection, target, ingestedKeys(events, remaining)); err != nil {
+			return err
+		}
+	}
+	events = remaining
+	if len(events) == 0 {
+		log.Println("Todos os eventos já foram ingeridos, nada a inserir.")
+		return nil
+	}
+
+	keyHashes := make([]string, 0, len(events))
+	keyValues := make([]string, 0, len(events))
+	values := make([]string, 0, len(events))
+	params := make(map[string]interface{}, len(events)*(len(auditTrailColumns)+1))
+	for i, event := range events {
+		row, err := auditTrailRow(event)
+		if err != nil {
+			return err
+		}
+
+		keyParam := fmt.Sprintf("key_hash_%d", i)
+		params[keyParam] = IdempotencyHash(row["idempotency_key"].(string))
+		keyHashes = append(keyHashes, params[keyParam].(string))
+		keyValues = append(keyValues, fmt.Sprintf("(@%s, @idempotency_key_%d, @event_date_%d)", keyParam, i, i))
+
+		placeholders := make([]string, 0, len(auditTrailColumns))
+		for _, column := range auditTrailColumns {
+			name := fmt.Sprintf("%s_%d", column, i)
+			placeholders = append(placeholders, "@"+name)
+			params[name] = row[column]
+		}
+		values = append(values, "("+strings.Join(placeholders, ", ")+")")
+	}
+
+	// A chave de idempotência é a chave primária da tabela de chaves: um evento já gravado
+	// faz a transação inteira falhar, impedindo registros duplicados na trilha
+	query := fmt.Sprintf(`
+		BEGIN TRANSACTION;
+		INSERT INTO %s (key_hash, idempotency_key, event_date) VALUES %s;
+		INSERT INTO %s (%s) VALUES %s;
+		COMMIT;`,
+		keyTable(target.Table), strings.Join(keyValues, ", "),
+		target.Table, strings.Join(auditTrailColumns, ", "), strings.Join(values, ", "))
+
+	// Executa a query SQL
+	result, err := connection.SQLExec(ctx, query, params)
+	if err != nil {
+		if isDuplicateKeyError(err) && len(events) == 1 {
+			// Outro consumidor gravou o mesmo evento entre a verificação e a inserção
+			log.Printf("Evento já ingerido, ignorando: %s", events[0].IdempotencyKey())
+			metrics.DuplicatesSkipped.Inc()
+			return nil
+		}
+		return fmt.Errorf("erro ao inserir evento no ImmuDB: %w", err)
+	}
+	if s.verify {
+		proof, err := s.verifyTx(ctx, connection, target.Database, result)
+		if err != nil {
+			return err
+		}
+		if err := recordProofs(ctx, connection, target, keyHashes, proof); err != nil {
+			return err
+		}
+	}
+
+	for _, event := range events {
+		log.Printf("Inserção no ImmuDB concluída: Table=%s, Operation=%s", event.Source.Table, event.Op)
+	}
+	return nil
+}
+
+// sqlQuerier executa consultas SQL no banco em uso, implementado por immuConnection
+type sqlQuerier interface {
+	SQLQuery(ctx context.Context, query string, params map[string]interface{}) (*schema.SQLQueryResult, error)
+}
+
+// filterIngested remove os eventos cuja chave de idempotência já está registrada no ImmuDB,
+// assim como eventos repetidos dentro do próprio lote
+func filterIngested(ctx context.Context, connection sqlQuerier, target Target, events []model.KafkaEvent) ([]model.KafkaEvent, error) {
+	placeholders := make([]string, 0, len(events))
+	params := make(map[string]interface{}, len(events))
+	for i, event := range events {
+		name := fmt.Sprintf("key_hash_%d", i)
+		placeholders = append(placeholders, "@"+name)
+		params[name] = IdempotencyHash(event.IdempotencyKey())
+	}
+
+	query := fmt.Sprintf("SELECT key_hash FROM %s WHERE key_hash IN (%s);", keyTable(target.Table), strings.Join(placeholders, ", "))
+	result, err := connection.SQLQuery(ctx, query, params)
+	if err != nil {
+		return nil, fmt.Errorf("erro ao consultar chaves de idempotência no ImmuDB: %w", err)
+	}
+
+	seen := make(map[string]bool, len(result.Rows)+len(events))
+	for _, row := range result.Rows {
+		seen[row.Values[0].GetS()] = true
+	}
+	return skipSeen(seen, events), nil
+}
+
+// keyTable retorna o nome da tabela de chaves de idempotência associada a uma tabela de trilha
+func keyTable(table string) string {
+	return table + "_key"
+}
+
+// isDuplicateKeyError indica se o ImmuDB rejeitou a inserção por chave primária duplicada
+func isDuplicateKeyError(err error) bool {
+	return err != nil && strings.Contains(err.Error(), "key already exists")
+}
+
+// InsertTransaction registra a transação. Um marcador entregue novamente encontra a chave
+// primária já registrada e resulta em ErrDuplicate.
+func (s *ImmuDBSink) InsertTransaction(ctx context.Context, database string, record TransactionRecord) error {
+	err := s.writeTransaction(ctx, database, "INSERT", record)
+	if isDuplicateKeyError(err) {
+		return ErrDuplicate
+	}
+	return err
+}
+
+// UpdateTransaction atualiza a situação da transação com UPSERT, que preserva as versões
+// anteriores no histórico do ImmuDB
+func (s *ImmuDBSink) UpdateTransaction(ctx context.Context, database string, record TransactionRecord) error {
+	return s.writeTransaction(ctx, database, "UPSERT", record)
+}
+
+// writeTransaction grava a transação com o comando informado
+func (s *ImmuDBSink) writeTransaction(ctx context.Context, database, statement string, record TransactionRecord) error {
+	connection, err := s.connection(database)
+	if err != nil {
+		return err
+	}
+	if err := s.failed(database); err != nil {
+		return err
+	}
+	params, err := transactionRow(record)
+	if err != nil {
+		return err
+	}
+
+	placeholders := make([]string, 0, len(transactionColumns))
+	for _, column := range transactionColumns {
+		placeholders = append(placeholders, "@"+column)
+	}
+	query := fmt.Sprintf("%s INTO %s (%s) VALUES (%s);",
+		statement, TransactionTable, strings.Join(transactionColumns, ", "), strings.Join(placeholders, ", "))
+	result, err := connection.SQLExec(ctx, query, params)
+	if err != nil {
+		return fmt.Errorf("erro ao gravar a transação %s no ImmuDB: %w", record.ID, err)
+	}
+	if s.verify {
+		_, err = s.verifyTx(ctx, connection, database, result)
+	}
+	return err
+}
+
+// Transactions lê as transações na situação informada
+func (s *ImmuDBSink) Transactions(ctx context.Context, database, status string) ([]TransactionRecord, error) {
+	connection, err := s.connection(database)
+	if err != nil {
+		return nil, err
+	}
+	query := fmt.Sprintf("SELECT %s FROM %s WHERE status = @status;", strings.Join(transactionColumns, ", "), TransactionTable)
+	result, err := connection.SQLQuery(ctx, query, map[string]interface{}{"status": status})
+	if err != nil {
+		return nil, fmt.Errorf("erro ao consultar as transações: %w", err)
+	}
+
+	records := make([]TransactionRecord, 0, len(result.Rows))
+	for _, row := range result.Rows {
+		record := TransactionRecord{
+			ID:            row.Values[0].GetS(),
+			Status:        row.Values[1].GetS(),
+			EventCount:    row.Values[2].GetN(),
+			ReceivedCount: row.Values[3].GetN(),
+			CommitDate:    time.UnixMicro(row.Values[6].GetTs()),
+			RecordedAt:    time.UnixMicro(row.Values[7].GetTs()),
+		}
+		if err := json.Unmarshal([]byte(row.Values[4].GetS()), &record.DataCollections); err != nil {
+			return nil, fmt.Errorf("tabelas da transação %s inválidas: %w", record.ID, err)
+		}
+		records = append(records, record)
+	}
+	return records, nil
+}
+
+// CountTransactionEvents conta os eventos das transações gravados nas tabelas de trilha do banco,
+// com uma consulta por tabela para todas as transações
+func (s *ImmuDBSink) CountTransactionEvents(ctx context.Context, database string, tables []string, transactionIDs []string) (map[string]map[string]int64, error) {
+	connection, err := s.connection(database)
+	if err != nil {
+		return nil, err
+	}
+	counts := make(map[string]map[string]int64)
+	if len(transactionIDs) == 0 {
+		return counts, nil
+	}
+
+	params := make(map[string]interface{}, len(transactionIDs))
+	placeholders := make([]string, len(transactionIDs))
+	for i, id := range transactionIDs {
+		name := fmt.Sprintf("transaction_id_%d", i)
+		params[name] = id
+		placeholders[i] = "@" + name
+	}
+	for _, table := range tables {
+		query := fmt.Sprintf(`
+			SELECT transaction_id, db_name, db_schema, db_table, COUNT(*) AS events
+			FROM %s
+			WHERE transaction_id IN (%s)
+			GROUP BY transaction_id, db_name, db_schema, db_table;`, table, strings.Join(placeholders, ", "))
+		result, err := connection.SQLQuery(ctx, query, params)
+		if err != nil {
+			return nil, fmt.Errorf("erro ao contar os eventos das transações: %w", err)
+		}
+		for _, row := range result.Rows {
+			source := model.Source{Db: row.Values[1].GetS(), Schema: row.Values[2].GetS(), Table: row.Values[3].GetS()}
+			addTransactionCount(counts, row.Values[0].GetS(), SourceTable(source), row.Values[4].GetN())
+		}
+	}
+	return counts, nil
+}
+
+// InsertSchemaChanges registra as alterações de schema, uma por transação do ImmuDB. As
+// alterações cuja chave já está registrada são ignoradas.
+func (s *ImmuDBSink) InsertSchemaChanges(ctx context.Context, database string, records []SchemaChangeRecord) error {
+	connection, err := s.connection(database)
+	if err != nil {
+		return err
+	}
+	if err := s.failed(database); err != nil {
+		return err
+	}
+
+	placeholders := make([]string, 0, len(schemaChangeColumns))
+	for _, column := range schemaChangeColumns {
+		placeholders = append(placeholders, "@"+column)
+	}
+	query := fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s);",
+		SchemaChangeTable, strings.Join(schemaChangeColumns, ", "), strings.Join(placeholders, ", "))
+	for _, record := range records {
+		result, err := connection.SQLExec(ctx, query, schemaChangeRow(record))
+		if isDuplicateKeyError(err) {
+			log.Printf("Alteração de schema já registrada, ignorando: %s", record.Key)
+			metrics.DuplicatesSkipped.Inc()
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("erro ao gravar a alteração de schema da tabela '%s' no ImmuDB: %w", record.DbTable, err)
+		}
+		if s.verify {
+			if _, err := s.verifyTx(ctx, connection, database, result); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// SchemaDefinition retorna a definição da alteração de schema mais recente da tabela de origem.
+// As alterações de uma tabela são poucas, e a mais recente é escolhida aqui.
+func (s *ImmuDBSink) SchemaDefinition(ctx context.Context, database, dbName, dbSchema, dbTable string) (string, error) {
+	connection, err := s.connection(database)
+	if err != nil {
+		return "", err
+	}
+	query := fmt.Sprintf(`
+		SELECT table_definition, change_date, recorded_at
+		FROM %s
+		WHERE db_name = @db_name AND db_schema = @db_schema AND db_table = @db_table;`, SchemaChangeTable)
+	params := map[string]interface{}{"db_name": dbName, "db_schema": dbSchema, "db_table": dbTable}
+	result, err := connection.SQLQuery(ctx, query, params)
+	if err != nil {
+		return "", fmt.Errorf("erro ao consultar o histórico de schema da tabela '%s': %w", dbTable, err)
+	}
+
+	var definition string
+	var latest [2]int64
+	for _, row := range result.Rows {
+		current := [2]int64{row.Values[1].GetTs(), row.Values[2].GetTs()}
+		if definition == "" || current[0] > latest[0] || current[0] == latest[0] && current[1] >= latest[1] {
+			definition, latest = row.Values[0].GetS(), current
+		}
+	}
+	return definition, nil
+}
+
+// auditTrailMigrations são as colunas (nome e tipo) adicionadas às tabelas de trilha após a
+// sua primeira versão, aplicadas em bancos criados anteriormente
+var auditTrailMigrations = [][2]string{
+	{"idempotency_key", "VARCHAR"},
+	{"source_version", "VARCHAR"},
+	{"source_name", "VARCHAR"},
+	{"source_ts", "TIMESTAMP"},
+	{"source_snapshot", "VARCHAR"},
+	{"source_sequence", "VARCHAR"},
+	{"source_tx_id", "INTEGER"},
+	{"source_lsn", "INTEGER"},
+	{"changed_columns", "VARCHAR"},
+	{"key_id", "VARCHAR"},
+	{"subject_ref", "VARCHAR"},
+	{"transaction_id", "VARCHAR[128]"},
+	{"transaction_order", "INTEGER"},
+}
+
+// createDatabaseAndTable cria o banco de dados e as tabelas de trilha informadas, junto com as
+// suas tabelas de chaves de idempotência, se ainda não existirem
+func createDatabaseAndTable(ctx context.Context, connection *immuConnection, dbName string, tables []string) error {
+	log.Printf("Criando banco de dados '%s' e tabelas %v, se não existirem...", dbName, tables)
+
+	// Cria o banco de dados, se não existir
+	if err := connection.CreateDatabase(ctx, dbName); err != nil {
+		return fmt.Errorf("erro ao criar banco de dados: %w", err)
+	}
+
+	// Usa o banco de dados criado, selecionado novamente a cada renovação da sessão
+	if err := connection.UseDatabase(ctx, dbName); err != nil {
+		return fmt.Errorf("erro ao usar banco de dados '%s': %w", dbName, err)
+	}
+
+	for _, table := range tables {
+		if err := createAuditTrailTable(ctx, connection, table); err != nil {
+			return err
+		}
+	}
+	if err := createTransactionTable(ctx, connection); err != nil {
+		return err
+	}
+	if err := createSchemaChangeTable(ctx, connection); err != nil {
+		return err
+	}
+
+	log.Println("Banco de dados e tabela configurados com sucesso.")
+	return nil
+}
+
+// createAuditTrailTable cria uma tabela de trilha e a sua tabela de chaves de idempotência
+func createAuditTrailTable(ctx context.Context, connection *immuConnection, table string) error {
+	query := fmt.Sprintf(`
+		CREATE TABLE IF NOT EXISTS %s (
+			id INTEGER AUTO_INCREMENT,
+			connector VARCHAR,
+			application VARCHAR,
+			db_name VARCHAR,
+			db_schema VARCHAR,
+			db_table VARCHAR,
+			event_operation VARCHAR,
+			event_date TIMESTAMP,
+			event JSON,
+			idempotency_key VARCHAR,
+			source_version VARCHAR,
+			source_name VARCHAR,
+			source_ts TIMESTAMP,
+			source_snapshot VARCHAR,
+			source_sequence VARCHAR,
+			source_tx_id INTEGER,
+			source_lsn INTEGER,
+			changed_columns VARCHAR,
+			key_id VARCHAR,
+			subject_ref VARCHAR,
+			transaction_id VARCHAR[128],
+			transaction_order INTEGER,
+			PRIMARY KEY (id)
+		);
+	`, table)
+	_, err := connection.SQLExec(ctx, query, nil)
+	if err != nil {
+		return fmt.Errorf("erro ao criar tabela no ImmuDB: %w", err)
+	}
+
+	// Adiciona as colunas criadas após a primeira versão da tabela
+	for _, column := range auditTrailMigrations {
+		if err := addColumnIfNotExists(ctx, connection, table, column[0], column[1]); err != nil {
+			return err
+		}
+	}
+
+	// Indexa a transação de origem, consultada na validação das transações e pela Audit API. O
+	// ImmuDB só indexa colunas de tamanho limitado: numa tabela em que a coluna foi criada sem
+	// limite, a validação continua funcionando, mas percorre a tabela inteira.
+	query = fmt.Sprintf("CREATE INDEX IF NOT EXISTS ON %s(transaction_id);", table)
+	if _, err := connection.SQLExec(ctx, query, nil); err != nil {
+		if !strings.Contains(err.Error(), "Max key length") {
+			return fmt.Errorf("erro ao criar o índice da transação na tabela '%s': %w", table, err)
+		}
+		log.Printf("A coluna transaction_id da tabela '%s' não tem tamanho limitado e não pode ser indexada: %v", table, err)
+	}
+
+	// Cria a tabela de chaves de idempotência: a chave primária garante que cada evento
+	// seja registrado uma única vez na trilha de auditoria
+	query = fmt.Sprintf(`
+		CREATE TABLE IF NOT EXISTS %s (
+			key_hash VARCHAR[64],
+			idempotency_key VARCHAR,
+			event_date TIMESTAMP,
+			PRIMARY KEY (key_hash)
+		);
+	`, keyTable(table))
+	_, err = connection.SQLExec(ctx, query, nil)
+	if err != nil {
+		return fmt.Errorf("erro ao criar tabela de idempotência no ImmuDB: %w", err)
+	}
+
+	// Cria a tabela de provas: a transação do ImmuDB, verificada, em que cada evento foi gravado
+	query = fmt.Sprintf(`
+		CREATE TABLE IF NOT EXISTS %s (
+			key_hash VARCHAR[64],
+			tx_id INTEGER,
+			tx_hash VARCHAR[64],
+			verified_at TIMESTAMP,
+			PRIMARY KEY (key_hash)
+		);
+	`, proofTable(table))
+	_, err = connection.SQLExec(ctx, query, nil)
+	if err != nil {
+		return fmt.Errorf("erro ao criar tabela de provas no ImmuDB: %w", err)
+	}
+	return nil
+}
+
+// createTransactionTable cria a tabela que registra as transações do banco de origem. O
+// identificador da transação é a chave primária: a validação atualiza a situação com UPSERT e o
+// ImmuDB preserva as versões anteriores do registro.
+func createTransactionTable(ctx context.Context, connection *immuConnection) error {
+	query := fmt.Sprintf(`
+		CREATE TABLE IF NOT EXISTS %s (
+			transaction_id VARCHAR[128],
+			status VARCHAR,
+			event_count INTEGER,
+			received_count INTEGER,
+			data_collections JSON,
+			table_list VARCHAR,
+			commit_date TIMESTAMP,
+			recorded_at TIMESTAMP,
+			validated_at TIMESTAMP,
+			PRIMARY KEY (transaction_id)
+		);
+	`, TransactionTable)
+	_, err := connection.SQLExec(ctx, query, nil)
+	if err != nil {
+		return fmt.Errorf("erro ao criar tabela de transações no ImmuDB: %w", err)
+	}
+	return nil
+}
+
+// createSchemaChangeTable cria a tabela do histórico de alterações de schema. O hash da chave de
+// idempotência é a chave primária, de modo que um DDL entregue novamente não é registrado duas vezes.
+func createSchemaChangeTable(ctx context.Context, connection *immuConnection) error {
+	query := fmt.Sprintf(`
+		CREATE TABLE IF NOT EXISTS %s (
+			key_hash VARCHAR[64],
+			idempotency_key VARCHAR,
+			source_name VARCHAR,
+			db_name VARCHAR,
+			db_schema VARCHAR,
+			db_table VARCHAR,
+			change_type VARCHAR,
+			ddl VARCHAR,
+			table_definition JSON,
+			source_position VARCHAR,
+			change_date TIMESTAMP,
+			recorded_at TIMESTAMP,
+			PRIMARY KEY (key_hash)
+		);
+	`, SchemaChangeTable)
+	_, err := connection.SQLExec(ctx, query, nil)
+	if err != nil {
+		return fmt.Errorf("erro ao criar tabela de alterações de schema no ImmuDB: %w", err)
+	}
+	return nil
+}
+
+// addColumnIfNotExists adiciona uma coluna a uma tabela existente, ignorando o erro caso ela já exista
+func addColumnIfNotExists(ctx context.Context, connection *immuConnection, table, column, columnType string) error {
+	query := fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s;", table, column, columnType)
+	_, err := connection.SQLExec(ctx, query, nil)
+	if err != nil && !strings.Contains(err.Error(), "column already exists") {
+		return fmt.Errorf("erro ao adicionar a coluna '%s' na tabela '%s': %w", column, table, err)
+	}
+	return nil
+}
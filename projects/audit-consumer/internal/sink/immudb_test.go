@@ -0,0 +1,69 @@
+package sink
+
+import (
+	"context"
+	"errors"
+	"github.com/Waelson/audit/audit-consumer/internal/model"
+	"github.com/codenotary/immudb/pkg/api/schema"
+	"strings"
+	"testing"
+)
+
+// testKeyTable simula a tabela de chaves de idempotência do ImmuDB
+type testKeyTable struct {
+	keys    map[string]bool
+	err     error
+	queries []string
+}
+
+func (k *testKeyTable) SQLQuery(ctx context.Context, query string, params map[string]interface{}) (*schema.SQLQueryResult, error) {
+	k.queries = append(k.queries, query)
+	if k.err != nil {
+		return nil, k.err
+	}
+	result := &schema.SQLQueryResult{}
+	for _, value := range params {
+		if k.keys[value.(string)] {
+			result.Rows = append(result.Rows, &schema.Row{Values: []*schema.SQLValue{{Value: &schema.SQLValue_S{S: value.(string)}}}})
+		}
+	}
+	return result, nil
+}
+
+func TestFilterIngested(t *testing.T) {
+	target := Target{Database: "audit_db", Table: "orders_trail"}
+	tests := []struct {
+		name     string
+		ingested []model.KafkaEvent
+		events   []model.KafkaEvent
+		expected []model.KafkaEvent
+	}{
+		{"nenhum evento gravado", nil, []model.KafkaEvent{testEvent(1), testEvent(2)}, []model.KafkaEvent{testEvent(1), testEvent(2)}},
+		{"lote parcialmente gravado", []model.KafkaEvent{testEvent(1), testEvent(3)}, []model.KafkaEvent{testEvent(1), testEvent(2), testEvent(3)}, []model.KafkaEvent{testEvent(2)}},
+		{"repetição dentro do lote", nil, []model.KafkaEvent{testEvent(1), testEvent(1), testEvent(2)}, []model.KafkaEvent{testEvent(1), testEvent(2)}},
+		{"repetição de um evento gravado", []model.KafkaEvent{testEvent(2)}, []model.KafkaEvent{testEvent(2), testEvent(1), testEvent(2)}, []model.KafkaEvent{testEvent(1)}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			keys := &testKeyTable{keys: map[string]bool{}}
+			for _, event := range tt.ingested {
+				keys.keys[IdempotencyHash(event.IdempotencyKey())] = true
+			}
+			remaining, err := filterIngested(context.Background(), keys, target, tt.events)
+			if err != nil {
+				t.Fatalf("erro inesperado: %v", err)
+			}
+			if len(keys.queries) != 1 || !strings.Contains(keys.queries[0], "FROM orders_trail_key ") {
+				t.Errorf("esperado uma consulta à tabela de chaves, obtido %v", keys.queries)
+			}
+			assertEvents(t, remaining, tt.expected)
+		})
+	}
+}
+
+func TestFilterIngestedQueryError(t *testing.T) {
+	keys := &testKeyTable{err: errors.New("immudb indisponível")}
+	if _, err := filterIngested(context.Background(), keys, Target{Database: "audit_db", Table: "audit_trail"}, []model.KafkaEvent{testEvent(1)}); err == nil {
+		t.Error("filterIngested não retornou erro com a consulta falhando")
+	}
+}
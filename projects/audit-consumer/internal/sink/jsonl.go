@@ -0,0 +1,200 @@
+package sink
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/Waelson/audit/audit-consumer/internal/model"
+	"github.com/Waelson/audit/audit-consumer/internal/resilience"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// JSONLSink grava a trilha de auditoria em arquivos JSON Lines, um evento por linha, em
+// <dir>/<banco>/<tabela>-<data>.jsonl. O arquivo em uso é trocado por um novo ao atingir o
+// tamanho ou a idade máxima, e a cada inicialização do consumidor. Não há controle de
+// idempotência: mensagens entregues novamente geram linhas repetidas, identificáveis pela
+// coluna idempotency_key.
+type JSONLSink struct {
+	dir      string
+	maxBytes int64
+	maxAge   time.Duration
+
+	mu    sync.Mutex
+	files map[Target]*jsonlFile
+}
+
+// jsonlFile é o arquivo em uso de uma tabela de trilha
+type jsonlFile struct {
+	mu       sync.Mutex
+	file     *os.File
+	size     int64
+	openedAt time.Time
+}
+
+// NewJSONLSink cria o sink de arquivos JSON Lines. Com maxAge zero os arquivos são trocados
+// apenas pelo tamanho.
+func NewJSONLSink(dir string, maxBytes int64, maxAge time.Duration) *JSONLSink {
+	return &JSONLSink{
+		dir:      dir,
+		maxBytes: maxBytes,
+		maxAge:   maxAge,
+		files:    make(map[Target]*jsonlFile),
+	}
+}
+
+// Name identifica o sink
+func (s *JSONLSink) Name() string {
+	return TypeJSONL
+}
+
+// Setup cria o diretório de cada banco de destino
+func (s *JSONLSink) Setup(_ context.Context, databases map[string][]string) error {
+	for database := range databases {
+		path := filepath.Join(s.dir, database)
+		log.Printf("Criando o diretório '%s' da trilha de auditoria, se não existir...", path)
+		if err := os.MkdirAll(path, 0o750); err != nil {
+			return fmt.Errorf("erro ao criar o diretório '%s': %w", path, err)
+		}
+	}
+	return nil
+}
+
+// Check verifica se o diretório do banco de destino existe
+func (s *JSONLSink) Check(_ context.Context, database string) error {
+	path := filepath.Join(s.dir, database)
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("'%s' não é um diretório", path)
+	}
+	return nil
+}
+
+// Close fecha os arquivos em uso
+func (s *JSONLSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var errs []error
+	for target, current := range s.files {
+		current.mu.Lock()
+		if current.file != nil {
+			errs = append(errs, current.file.Close())
+			current.file = nil
+		}
+		current.mu.Unlock()
+		delete(s.files, target)
+	}
+	return errors.Join(errs...)
+}
+
+// Write acrescenta os eventos ao arquivo em uso da tabela de destino com uma única escrita,
+// sincronizada com o disco antes do retorno
+func (s *JSONLSink) Write(_ context.Context, target Target, events []model.KafkaEvent) error {
+	var data []byte
+	for _, event := range events {
+		row, err := auditTrailRow(event)
+		if err != nil {
+			return err
+		}
+		// O evento é gravado como objeto JSON, e não como texto, para facilitar a leitura
+		row["event"] = json.RawMessage(row["event"].(string))
+		line, err := json.Marshal(row)
+		if err != nil {
+			return fmt.Errorf("erro ao converter evento para JSON: %w", err)
+		}
+		data = append(append(data, line...), '\n')
+	}
+
+	current := s.file(target)
+	current.mu.Lock()
+	defer current.mu.Unlock()
+	if err := s.rotate(target, current, int64(len(data))); err != nil {
+		return classifyFileError(err)
+	}
+
+	written, err := current.file.Write(data)
+	if err == nil {
+		err = current.file.Sync()
+	}
+	if err != nil {
+		// O arquivo pode ter ficado com uma linha incompleta: a próxima gravação usa um novo arquivo
+		current.file.Close()
+		current.file = nil
+		return classifyFileError(fmt.Errorf("erro ao gravar no arquivo da trilha: %w", err))
+	}
+	current.size += int64(written)
+
+	log.Printf("Inserção de %d evento(s) no arquivo concluída - Banco: %s, Tabela: %s", len(events), target.Database, target.Table)
+	return nil
+}
+
+// file retorna o arquivo da tabela de destino, criando o seu registro na primeira gravação
+func (s *JSONLSink) file(target Target) *jsonlFile {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	current, ok := s.files[target]
+	if !ok {
+		current = &jsonlFile{}
+		s.files[target] = current
+	}
+	return current
+}
+
+// rotate abre um novo arquivo quando não há arquivo em uso ou quando a gravação ultrapassaria o
+// tamanho máximo ou o arquivo atingiu a idade máxima. Um arquivo vazio não é trocado pelo tamanho,
+// para que um lote maior que o limite possa ser gravado.
+func (s *JSONLSink) rotate(target Target, current *jsonlFile, pending int64) error {
+	if current.file != nil {
+		full := current.size > 0 && current.size+pending > s.maxBytes
+		expired := s.maxAge > 0 && time.Since(current.openedAt) >= s.maxAge
+		if !full && !expired {
+			return nil
+		}
+		if err := current.file.Close(); err != nil {
+			log.Printf("Erro ao fechar o arquivo da trilha '%s': %v", current.file.Name(), err)
+		}
+		current.file = nil
+	}
+
+	now := time.Now()
+	file, err := createJSONLFile(filepath.Join(s.dir, target.Database), target.Table, now)
+	if err != nil {
+		return err
+	}
+	log.Printf("Arquivo da trilha em uso: %s", file.Name())
+	current.file, current.size, current.openedAt = file, 0, now
+	return nil
+}
+
+// createJSONLFile cria um novo arquivo da tabela com o instante no nome. Um arquivo nunca é
+// reaberto: se já existe um arquivo com o mesmo nome, criado por uma troca ou inicialização no
+// mesmo milissegundo, o instante do nome avança um milissegundo, mantendo a ordem dos arquivos.
+func createJSONLFile(dir, table string, now time.Time) (*os.File, error) {
+	for stamp := now.UTC(); ; stamp = stamp.Add(time.Millisecond) {
+		path := filepath.Join(dir, fmt.Sprintf("%s-%s.jsonl", table, stamp.Format("20060102T150405.000Z")))
+		file, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_APPEND|os.O_WRONLY, 0o640)
+		if errors.Is(err, os.ErrExist) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("erro ao abrir o arquivo da trilha '%s': %w", path, err)
+		}
+		return file, nil
+	}
+}
+
+// classifyFileError associa a falta de espaço em disco a uma classe de erro transitória
+func classifyFileError(err error) error {
+	if errors.Is(err, syscall.ENOSPC) {
+		return resilience.WithClass(resilience.ErrorClassResourceExhausted, err)
+	}
+	return err
+}
@@ -0,0 +1,100 @@
+package sink
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"github.com/Waelson/audit/audit-consumer/internal/model"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+)
+
+// jsonlFiles retorna as linhas de cada arquivo da tabela, na ordem em que os arquivos foram criados
+func jsonlFiles(t *testing.T, dir string, target Target) [][]map[string]interface{} {
+	t.Helper()
+	paths, err := filepath.Glob(filepath.Join(dir, target.Database, target.Table+"-*.jsonl"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(paths)
+	var files [][]map[string]interface{}
+	for _, path := range paths {
+		file, err := os.Open(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var lines []map[string]interface{}
+		scanner := bufio.NewScanner(file)
+		for scanner.Scan() {
+			var line map[string]interface{}
+			if err := json.Unmarshal(scanner.Bytes(), &line); err != nil {
+				t.Fatalf("linha inválida em '%s': %v", path, err)
+			}
+			lines = append(lines, line)
+		}
+		file.Close()
+		files = append(files, lines)
+	}
+	return files
+}
+
+// lineSize retorna o tamanho da linha gravada para o evento
+func lineSize(t *testing.T, event model.KafkaEvent) int64 {
+	t.Helper()
+	dir := t.TempDir()
+	s := NewJSONLSink(dir, 1<<20, 0)
+	target := Target{Database: "audit_db", Table: "audit_trail"}
+	if err := s.Setup(context.Background(), map[string][]string{target.Database: {target.Table}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Write(context.Background(), target, []model.KafkaEvent{event}); err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	return s.files[target].size
+}
+
+func TestJSONLRotatesAtSizeLimit(t *testing.T) {
+	ctx := context.Background()
+	line := lineSize(t, testEvent(1))
+	dir := t.TempDir()
+	s := NewJSONLSink(dir, 2*line, 0)
+	defer s.Close()
+	target := Target{Database: "audit_db", Table: "audit_trail"}
+	if err := s.Setup(ctx, map[string][]string{target.Database: {target.Table}}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Os dois primeiros eventos preenchem exatamente o limite; o terceiro abre um novo arquivo e o
+	// lote seguinte, maior que o limite, é gravado inteiro em um arquivo próprio
+	batches := [][]model.KafkaEvent{
+		{testEvent(1)},
+		{testEvent(2)},
+		{testEvent(3)},
+		{testEvent(4), testEvent(5), testEvent(6)},
+	}
+	for _, batch := range batches {
+		if err := s.Write(ctx, target, batch); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	files := jsonlFiles(t, dir, target)
+	expected := [][]float64{{1001, 1002}, {1003}, {1004, 1005, 1006}}
+	if len(files) != len(expected) {
+		t.Fatalf("%d arquivo(s), esperado %d", len(files), len(expected))
+	}
+	for i, lines := range files {
+		if len(lines) != len(expected[i]) {
+			t.Errorf("arquivo %d com %d linha(s), esperado %d", i, len(lines), len(expected[i]))
+			continue
+		}
+		for j, row := range lines {
+			if row["source_lsn"] != expected[i][j]-1000 {
+				t.Errorf("arquivo %d, linha %d: lsn %v, esperado %v", i, j, row["source_lsn"], expected[i][j]-1000)
+			}
+		}
+	}
+}
@@ -0,0 +1,185 @@
+package sink
+
+import (
+	"context"
+	"fmt"
+	"github.com/Waelson/audit/audit-consumer/internal/model"
+	"sync"
+)
+
+// MemorySink mantém a trilha de auditoria em memória, sem armazenamento externo. Ele existe apenas
+// para os testes e não pode ser escolhido na configuração.
+type MemorySink struct {
+	mu           sync.Mutex
+	events       map[Target][]model.KafkaEvent
+	keys         map[Target]map[string]bool
+	transactions map[string]map[string]TransactionRecord
+	schema       map[string][]SchemaChangeRecord
+	schemaKeys   map[string]bool
+}
+
+// NewMemorySink cria um sink em memória vazio
+func NewMemorySink() *MemorySink {
+	return &MemorySink{
+		events:       make(map[Target][]model.KafkaEvent),
+		keys:         make(map[Target]map[string]bool),
+		transactions: make(map[string]map[string]TransactionRecord),
+		schema:       make(map[string][]SchemaChangeRecord),
+		schemaKeys:   make(map[string]bool),
+	}
+}
+
+// Name identifica o sink
+func (s *MemorySink) Name() string {
+	return "memory"
+}
+
+// Setup registra os bancos de destino
+func (s *MemorySink) Setup(_ context.Context, databases map[string][]string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for database := range databases {
+		if s.transactions[database] == nil {
+			s.transactions[database] = make(map[string]TransactionRecord)
+		}
+	}
+	return nil
+}
+
+// Check verifica se o banco de destino foi registrado em Setup
+func (s *MemorySink) Check(_ context.Context, database string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.transactions[database] == nil {
+		return fmt.Errorf("banco '%s' não configurado", database)
+	}
+	return nil
+}
+
+// Close não tem recursos a liberar
+func (s *MemorySink) Close() error {
+	return nil
+}
+
+// Write acrescenta os eventos à tabela de destino, ignorando os já gravados
+func (s *MemorySink) Write(_ context.Context, target Target, events []model.KafkaEvent) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.keys[target] == nil {
+		s.keys[target] = make(map[string]bool)
+	}
+	s.events[target] = append(s.events[target], skipSeen(s.keys[target], events)...)
+	return nil
+}
+
+// Events retorna uma cópia dos eventos gravados na tabela de destino
+func (s *MemorySink) Events(target Target) []model.KafkaEvent {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]model.KafkaEvent(nil), s.events[target]...)
+}
+
+// InsertTransaction registra a transação; uma transação já registrada resulta em ErrDuplicate
+func (s *MemorySink) InsertTransaction(_ context.Context, database string, record TransactionRecord) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.transactions[database][record.ID]; ok {
+		return ErrDuplicate
+	}
+	return s.putTransaction(database, record)
+}
+
+// UpdateTransaction atualiza a situação da transação
+func (s *MemorySink) UpdateTransaction(_ context.Context, database string, record TransactionRecord) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.putTransaction(database, record)
+}
+
+func (s *MemorySink) putTransaction(database string, record TransactionRecord) error {
+	transactions, ok := s.transactions[database]
+	if !ok {
+		return fmt.Errorf("banco '%s' não configurado", database)
+	}
+	record.DataCollections = append([]model.DataCollectionCount(nil), record.DataCollections...)
+	transactions[record.ID] = record
+	return nil
+}
+
+// Transactions lista as transações do banco na situação informada
+func (s *MemorySink) Transactions(_ context.Context, database, status string) ([]TransactionRecord, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var records []TransactionRecord
+	for _, record := range s.transactions[database] {
+		if record.Status == status {
+			record.DataCollections = append([]model.DataCollectionCount(nil), record.DataCollections...)
+			records = append(records, record)
+		}
+	}
+	return records, nil
+}
+
+// CountTransactionEvents conta os eventos das transações gravados nas tabelas de trilha do banco
+func (s *MemorySink) CountTransactionEvents(_ context.Context, database string, tables []string, transactionIDs []string) (map[string]map[string]int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	pending := make(map[string]bool, len(transactionIDs))
+	for _, id := range transactionIDs {
+		pending[id] = true
+	}
+	counts := make(map[string]map[string]int64)
+	for _, table := range tables {
+		for _, event := range s.events[Target{Database: database, Table: table}] {
+			if event.Transaction == nil || !pending[event.Transaction.ID] {
+				continue
+			}
+			addTransactionCount(counts, event.Transaction.ID, SourceTable(event.Source), 1)
+		}
+	}
+	return counts, nil
+}
+
+// InsertSchemaChanges registra as alterações de schema, ignorando as já registradas
+func (s *MemorySink) InsertSchemaChanges(_ context.Context, database string, records []SchemaChangeRecord) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.transactions[database] == nil {
+		return fmt.Errorf("banco '%s' não configurado", database)
+	}
+	for _, record := range records {
+		key := database + ":" + record.Key
+		if s.schemaKeys[key] {
+			continue
+		}
+		s.schemaKeys[key] = true
+		s.schema[database] = append(s.schema[database], record)
+	}
+	return nil
+}
+
+// SchemaDefinition retorna a definição da alteração de schema mais recente da tabela de origem
+func (s *MemorySink) SchemaDefinition(_ context.Context, database, dbName, dbSchema, dbTable string) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var latest *SchemaChangeRecord
+	for i, record := range s.schema[database] {
+		if record.DbName != dbName || record.DbSchema != dbSchema || record.DbTable != dbTable {
+			continue
+		}
+		if latest == nil || !record.ChangeDate.Before(latest.ChangeDate) {
+			latest = &s.schema[database][i]
+		}
+	}
+	if latest == nil {
+		return "", nil
+	}
+	return latest.Definition, nil
+}
+
+// SchemaChanges retorna uma cópia das alterações de schema registradas no banco
+func (s *MemorySink) SchemaChanges(database string) []SchemaChangeRecord {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]SchemaChangeRecord(nil), s.schema[database]...)
+}
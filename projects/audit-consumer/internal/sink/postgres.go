@@ -0,0 +1,513 @@
+package sink
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/Waelson/audit/audit-consumer/internal/model"
+	"github.com/Waelson/audit/audit-consumer/internal/resilience"
+	"github.com/lib/pq"
+	"io"
+	"log"
+	"net"
+	"strings"
+	"time"
+)
+
+// genesisHash é o hash anterior do primeiro registro de cada tabela de trilha
+var genesisHash = strings.Repeat("0", 64)
+
+// chainColumns são as colunas da cadeia de hashes, gravadas junto com as colunas da trilha
+var chainColumns = []string{"key_hash", "prev_hash", "row_hash"}
+
+// PostgresSink grava a trilha de auditoria em tabelas somente de inclusão do PostgreSQL. Cada
+// banco de destino das rotas é um schema. Os registros de cada tabela formam uma cadeia de
+// hashes: o hash de cada registro inclui o hash do registro anterior, de modo que alterar ou
+// remover um registro invalida todos os seguintes.
+type PostgresSink struct {
+	db *sql.DB
+}
+
+// NewPostgresSink cria o sink do PostgreSQL a partir da string de conexão (DSN). A conexão é
+// estabelecida em Setup.
+func NewPostgresSink(dsn string) (*PostgresSink, error) {
+	db, err := sql.Open("postgres", dsn)
+	if err != nil {
+		return nil, fmt.Errorf("erro na conexão com o PostgreSQL: %w", err)
+	}
+	return &PostgresSink{db: db}, nil
+}
+
+// Name identifica o sink
+func (s *PostgresSink) Name() string {
+	return TypePostgres
+}
+
+// Setup cria o schema de cada banco de destino com as suas tabelas de trilha, de transações e de
+// alterações de schema. As tabelas de trilha e de alterações de schema recebem gatilhos que
+// rejeitam alterações e exclusões.
+func (s *PostgresSink) Setup(ctx context.Context, databases map[string][]string) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("erro ao conectar ao PostgreSQL: %w", err)
+	}
+	defer tx.Rollback()
+
+	// Serializa a criação das tabelas entre instâncias do consumidor iniciadas ao mesmo tempo
+	if _, err := tx.ExecContext(ctx, "SELECT pg_advisory_xact_lock(hashtext('audit-consumer-setup'))"); err != nil {
+		return fmt.Errorf("erro ao bloquear a criação das tabelas no PostgreSQL: %w", err)
+	}
+
+	for schemaName, tables := range databases {
+		log.Printf("Criando schema '%s' e tabelas %v no PostgreSQL, se não existirem...", schemaName, tables)
+		schema := pq.QuoteIdentifier(schemaName)
+		query := fmt.Sprintf(`
+			CREATE SCHEMA IF NOT EXISTS %[1]s;
+			CREATE OR REPLACE FUNCTION %[1]s.audit_append_only() RETURNS trigger LANGUAGE plpgsql AS $$
+			BEGIN
+				RAISE EXCEPTION 'a tabela de trilha %% aceita apenas inclusões', TG_TABLE_NAME;
+			END;
+			$$;
+			CREATE TABLE IF NOT EXISTS %[2]s (
+				transaction_id VARCHAR(128) PRIMARY KEY,
+				status TEXT,
+				event_count BIGINT,
+				received_count BIGINT,
+				data_collections JSON,
+				table_list TEXT,
+				commit_date TIMESTAMPTZ,
+				recorded_at TIMESTAMPTZ,
+				validated_at TIMESTAMPTZ
+			);
+			CREATE TABLE IF NOT EXISTS %[3]s (
+				key_hash CHAR(64) PRIMARY KEY,
+				idempotency_key TEXT,
+				source_name TEXT,
+				db_name TEXT,
+				db_schema TEXT,
+				db_table TEXT,
+				change_type TEXT,
+				ddl TEXT,
+				table_definition JSON,
+				source_position TEXT,
+				change_date TIMESTAMPTZ,
+				recorded_at TIMESTAMPTZ
+			);
+			CREATE INDEX IF NOT EXISTS schema_change_table_idx ON %[3]s (db_table, change_date);
+			CREATE OR REPLACE TRIGGER audit_append_only BEFORE UPDATE OR DELETE ON %[3]s
+				FOR EACH ROW EXECUTE FUNCTION %[1]s.audit_append_only();`,
+			schema, qualifiedTable(schemaName, TransactionTable), qualifiedTable(schemaName, SchemaChangeTable))
+		if _, err := tx.ExecContext(ctx, query); err != nil {
+			return fmt.Errorf("erro ao criar o schema '%s' no PostgreSQL: %w", schemaName, err)
+		}
+
+		for _, table := range tables {
+			if err := createPostgresTable(ctx, tx, schemaName, table); err != nil {
+				return err
+			}
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("erro ao criar as tabelas no PostgreSQL: %w", err)
+	}
+	log.Println("Schemas e tabelas do PostgreSQL configurados com sucesso.")
+	return nil
+}
+
+// createPostgresTable cria uma tabela de trilha com a cadeia de hashes. A chave de idempotência
+// é única, impedindo registros duplicados.
+func createPostgresTable(ctx context.Context, tx *sql.Tx, schemaName, table string) error {
+	qualified := qualifiedTable(schemaName, table)
+	query := fmt.Sprintf(`
+		CREATE TABLE IF NOT EXISTS %[1]s (
+			id BIGSERIAL PRIMARY KEY,
+			connector TEXT,
+			application TEXT,
+			db_name TEXT,
+			db_schema TEXT,
+			db_table TEXT,
+			event_operation TEXT,
+			event_date TIMESTAMPTZ,
+			event JSON,
+			idempotency_key TEXT,
+			source_version TEXT,
+			source_name TEXT,
+			source_ts TIMESTAMPTZ,
+			source_snapshot TEXT,
+			source_sequence TEXT,
+			source_tx_id BIGINT,
+			source_lsn BIGINT,
+			changed_columns TEXT,
+			key_id TEXT,
+			subject_ref TEXT,
+			transaction_id TEXT,
+			transaction_order BIGINT,
+			key_hash CHAR(64) NOT NULL UNIQUE,
+			prev_hash CHAR(64) NOT NULL,
+			row_hash CHAR(64) NOT NULL
+		);
+		CREATE INDEX IF NOT EXISTS %[2]s ON %[1]s (transaction_id);
+		CREATE OR REPLACE TRIGGER audit_append_only BEFORE UPDATE OR DELETE ON %[1]s
+			FOR EACH ROW EXECUTE FUNCTION %[3]s.audit_append_only();
+		CREATE OR REPLACE TRIGGER audit_append_only_truncate BEFORE TRUNCATE ON %[1]s
+			FOR EACH STATEMENT EXECUTE FUNCTION %[3]s.audit_append_only();`,
+		qualified, pq.QuoteIdentifier(table+"_transaction_id_idx"), pq.QuoteIdentifier(schemaName))
+	if _, err := tx.ExecContext(ctx, query); err != nil {
+		return fmt.Errorf("erro ao criar a tabela '%s' no PostgreSQL: %w", qualified, err)
+	}
+	return nil
+}
+
+// Check verifica se o PostgreSQL responde
+func (s *PostgresSink) Check(ctx context.Context, _ string) error {
+	return s.db.PingContext(ctx)
+}
+
+// Close fecha as conexões com o PostgreSQL
+func (s *PostgresSink) Close() error {
+	return s.db.Close()
+}
+
+// Write insere os eventos na tabela de destino, em uma única transação, encadeando o hash de
+// cada registro ao do registro anterior. Eventos já ingeridos são ignorados.
+func (s *PostgresSink) Write(ctx context.Context, target Target, events []model.KafkaEvent) error {
+	log.Printf("Preparando para inserir %d evento(s) no PostgreSQL - Schema: %s, Tabela: %s", len(events), target.Database, target.Table)
+	table := qualifiedTable(target.Database, target.Table)
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return classifyPostgres(fmt.Errorf("erro ao iniciar a transação no PostgreSQL: %w", err))
+	}
+	defer tx.Rollback()
+
+	// O lock serializa as gravações na tabela, também entre instâncias do consumidor, para que
+	// a cadeia de hashes permaneça linear
+	if _, err := tx.ExecContext(ctx, "SELECT pg_advisory_xact_lock(hashtext($1))", table); err != nil {
+		return classifyPostgres(fmt.Errorf("erro ao bloquear a tabela '%s' no PostgreSQL: %w", table, err))
+	}
+
+	events, err = s.filterIngested(ctx, tx, table, events)
+	if err != nil {
+		return err
+	}
+	if len(events) == 0 {
+		log.Println("Todos os eventos já foram ingeridos, nada a inserir.")
+		return nil
+	}
+
+	prevHash := genesisHash
+	err = tx.QueryRowContext(ctx, fmt.Sprintf("SELECT row_hash FROM %s ORDER BY id DESC LIMIT 1", table)).Scan(&prevHash)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return classifyPostgres(fmt.Errorf("erro ao consultar o último hash da tabela '%s': %w", table, err))
+	}
+
+	rows, err := chainRows(prevHash, events)
+	if err != nil {
+		return err
+	}
+	columns := append(append([]string{}, auditTrailColumns...), chainColumns...)
+	values := make([]string, 0, len(rows))
+	args := make([]interface{}, 0, len(rows)*len(columns))
+	for _, row := range rows {
+		placeholders := make([]string, 0, len(columns))
+		for _, column := range columns {
+			args = append(args, row[column])
+			placeholders = append(placeholders, fmt.Sprintf("$%d", len(args)))
+		}
+		values = append(values, "("+strings.Join(placeholders, ", ")+")")
+	}
+
+	query := fmt.Sprintf("INSERT INTO %s (%s) VALUES %s", table, strings.Join(columns, ", "), strings.Join(values, ", "))
+	if _, err := tx.ExecContext(ctx, query, args...); err != nil {
+		return classifyPostgres(fmt.Errorf("erro ao inserir evento no PostgreSQL: %w", err))
+	}
+	if err := tx.Commit(); err != nil {
+		return classifyPostgres(fmt.Errorf("erro ao confirmar a inserção no PostgreSQL: %w", err))
+	}
+
+	for _, event := range events {
+		log.Printf("Inserção no PostgreSQL concluída: Table=%s, Operation=%s", event.Source.Table, event.Op)
+	}
+	return nil
+}
+
+// filterIngested remove os eventos cuja chave de idempotência já está registrada na tabela,
+// assim como eventos repetidos dentro do próprio lote
+func (s *PostgresSink) filterIngested(ctx context.Context, tx *sql.Tx, table string, events []model.KafkaEvent) ([]model.KafkaEvent, error) {
+	hashes := make([]string, 0, len(events))
+	for _, event := range events {
+		hashes = append(hashes, IdempotencyHash(event.IdempotencyKey()))
+	}
+
+	rows, err := tx.QueryContext(ctx, fmt.Sprintf("SELECT key_hash FROM %s WHERE key_hash = ANY($1)", table), pq.Array(hashes))
+	if err != nil {
+		return nil, classifyPostgres(fmt.Errorf("erro ao consultar chaves de idempotência no PostgreSQL: %w", err))
+	}
+	defer rows.Close()
+
+	seen := make(map[string]bool, len(events))
+	for rows.Next() {
+		var hash string
+		if err := rows.Scan(&hash); err != nil {
+			return nil, classifyPostgres(err)
+		}
+		seen[hash] = true
+	}
+	if err := rows.Err(); err != nil {
+		return nil, classifyPostgres(err)
+	}
+	return skipSeen(seen, events), nil
+}
+
+// chainRows converte os eventos nos registros da trilha, encadeados a partir do hash do último
+// registro gravado na tabela
+func chainRows(prevHash string, events []model.KafkaEvent) ([]map[string]interface{}, error) {
+	rows := make([]map[string]interface{}, 0, len(events))
+	for _, event := range events {
+		row, err := auditTrailRow(event)
+		if err != nil {
+			return nil, err
+		}
+		rowHash, err := chainHash(prevHash, row)
+		if err != nil {
+			return nil, err
+		}
+		row["key_hash"] = IdempotencyHash(event.IdempotencyKey())
+		row["prev_hash"] = prevHash
+		row["row_hash"] = rowHash
+		prevHash = rowHash
+		rows = append(rows, row)
+	}
+	return rows, nil
+}
+
+// chainHash calcula o hash de um registro: SHA-256 do hash anterior seguido do JSON das colunas
+// da trilha, com as chaves em ordem alfabética e as datas em UTC
+func chainHash(prevHash string, row map[string]interface{}) (string, error) {
+	normalized := make(map[string]interface{}, len(row))
+	for column, value := range row {
+		if t, ok := value.(time.Time); ok {
+			value = t.UTC()
+		}
+		normalized[column] = value
+	}
+	payload, err := json.Marshal(normalized)
+	if err != nil {
+		return "", fmt.Errorf("erro ao converter o registro para o cálculo do hash: %w", err)
+	}
+
+	hash := sha256.New()
+	hash.Write([]byte(prevHash))
+	hash.Write(payload)
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// InsertTransaction registra a transação; um marcador entregue novamente resulta em ErrDuplicate
+func (s *PostgresSink) InsertTransaction(ctx context.Context, database string, record TransactionRecord) error {
+	result, err := s.writeTransaction(ctx, database, "DO NOTHING", record)
+	if err != nil {
+		return err
+	}
+	if affected, err := result.RowsAffected(); err == nil && affected == 0 {
+		return ErrDuplicate
+	}
+	return nil
+}
+
+// UpdateTransaction atualiza a situação da transação
+func (s *PostgresSink) UpdateTransaction(ctx context.Context, database string, record TransactionRecord) error {
+	_, err := s.writeTransaction(ctx, database, `DO UPDATE SET
+		status = EXCLUDED.status,
+		received_count = EXCLUDED.received_count,
+		data_collections = EXCLUDED.data_collections,
+		validated_at = EXCLUDED.validated_at`, record)
+	return err
+}
+
+// writeTransaction grava a transação com a ação informada para o conflito de chave primária
+func (s *PostgresSink) writeTransaction(ctx context.Context, database, onConflict string, record TransactionRecord) (sql.Result, error) {
+	row, err := transactionRow(record)
+	if err != nil {
+		return nil, err
+	}
+	args := make([]interface{}, 0, len(transactionColumns))
+	placeholders := make([]string, 0, len(transactionColumns))
+	for _, column := range transactionColumns {
+		args = append(args, row[column])
+		placeholders = append(placeholders, fmt.Sprintf("$%d", len(args)))
+	}
+
+	query := fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s) ON CONFLICT (transaction_id) %s",
+		qualifiedTable(database, TransactionTable), strings.Join(transactionColumns, ", "), strings.Join(placeholders, ", "), onConflict)
+	result, err := s.db.ExecContext(ctx, query, args...)
+	if err != nil {
+		return nil, classifyPostgres(fmt.Errorf("erro ao gravar a transação %s no PostgreSQL: %w", record.ID, err))
+	}
+	return result, nil
+}
+
+// Transactions lê as transações na situação informada
+func (s *PostgresSink) Transactions(ctx context.Context, database, status string) ([]TransactionRecord, error) {
+	query := fmt.Sprintf("SELECT %s FROM %s WHERE status = $1",
+		strings.Join(transactionColumns, ", "), qualifiedTable(database, TransactionTable))
+	rows, err := s.db.QueryContext(ctx, query, status)
+	if err != nil {
+		return nil, classifyPostgres(fmt.Errorf("erro ao consultar as transações: %w", err))
+	}
+	defer rows.Close()
+
+	var records []TransactionRecord
+	for rows.Next() {
+		var record TransactionRecord
+		var collections, tableList string
+		var validatedAt sql.NullTime
+		err := rows.Scan(&record.ID, &record.Status, &record.EventCount, &record.ReceivedCount, &collections,
+			&tableList, &record.CommitDate, &record.RecordedAt, &validatedAt)
+		if err != nil {
+			return nil, classifyPostgres(fmt.Errorf("erro ao ler as transações: %w", err))
+		}
+		if validatedAt.Valid {
+			record.ValidatedAt = &validatedAt.Time
+		}
+		if err := json.Unmarshal([]byte(collections), &record.DataCollections); err != nil {
+			return nil, fmt.Errorf("tabelas da transação %s inválidas: %w", record.ID, err)
+		}
+		records = append(records, record)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, classifyPostgres(fmt.Errorf("erro ao ler as transações: %w", err))
+	}
+	return records, nil
+}
+
+// CountTransactionEvents conta os eventos das transações gravados nas tabelas de trilha do schema,
+// com uma consulta por tabela para todas as transações
+func (s *PostgresSink) CountTransactionEvents(ctx context.Context, database string, tables []string, transactionIDs []string) (map[string]map[string]int64, error) {
+	counts := make(map[string]map[string]int64)
+	if len(transactionIDs) == 0 {
+		return counts, nil
+	}
+	for _, table := range tables {
+		query := fmt.Sprintf(`
+			SELECT transaction_id, db_name, db_schema, db_table, COUNT(*)
+			FROM %s
+			WHERE transaction_id = ANY($1)
+			GROUP BY transaction_id, db_name, db_schema, db_table`, qualifiedTable(database, table))
+		if err := s.countEvents(ctx, query, transactionIDs, counts); err != nil {
+			return nil, fmt.Errorf("erro ao contar os eventos das transações: %w", err)
+		}
+	}
+	return counts, nil
+}
+
+// countEvents soma as contagens por transação e por tabela de origem retornadas pela consulta
+func (s *PostgresSink) countEvents(ctx context.Context, query string, transactionIDs []string, counts map[string]map[string]int64) error {
+	rows, err := s.db.QueryContext(ctx, query, pq.Array(transactionIDs))
+	if err != nil {
+		return classifyPostgres(err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var transactionID string
+		var source model.Source
+		var dbSchema sql.NullString
+		var count int64
+		if err := rows.Scan(&transactionID, &source.Db, &dbSchema, &source.Table, &count); err != nil {
+			return classifyPostgres(err)
+		}
+		source.Schema = dbSchema.String
+		addTransactionCount(counts, transactionID, SourceTable(source), count)
+	}
+	return classifyPostgres(rows.Err())
+}
+
+// InsertSchemaChanges registra as alterações de schema em uma única transação, ignorando as que
+// já estão registradas
+func (s *PostgresSink) InsertSchemaChanges(ctx context.Context, database string, records []SchemaChangeRecord) error {
+	placeholders := make([]string, 0, len(schemaChangeColumns))
+	for i := range schemaChangeColumns {
+		placeholders = append(placeholders, fmt.Sprintf("$%d", i+1))
+	}
+	query := fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s) ON CONFLICT (key_hash) DO NOTHING",
+		qualifiedTable(database, SchemaChangeTable), strings.Join(schemaChangeColumns, ", "), strings.Join(placeholders, ", "))
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return classifyPostgres(fmt.Errorf("erro ao iniciar a transação no PostgreSQL: %w", err))
+	}
+	defer tx.Rollback()
+	for _, record := range records {
+		row := schemaChangeRow(record)
+		args := make([]interface{}, 0, len(schemaChangeColumns))
+		for _, column := range schemaChangeColumns {
+			args = append(args, row[column])
+		}
+		if _, err := tx.ExecContext(ctx, query, args...); err != nil {
+			return classifyPostgres(fmt.Errorf("erro ao gravar a alteração de schema da tabela '%s' no PostgreSQL: %w", record.DbTable, err))
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return classifyPostgres(fmt.Errorf("erro ao confirmar as alterações de schema no PostgreSQL: %w", err))
+	}
+	return nil
+}
+
+// SchemaDefinition retorna a definição da alteração de schema mais recente da tabela de origem
+func (s *PostgresSink) SchemaDefinition(ctx context.Context, database, dbName, dbSchema, dbTable string) (string, error) {
+	query := fmt.Sprintf(`
+		SELECT table_definition
+		FROM %s
+		WHERE db_name = $1 AND db_schema = $2 AND db_table = $3
+		ORDER BY change_date DESC, recorded_at DESC
+		LIMIT 1`, qualifiedTable(database, SchemaChangeTable))
+	var definition sql.NullString
+	err := s.db.QueryRowContext(ctx, query, dbName, dbSchema, dbTable).Scan(&definition)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", nil
+	}
+	if err != nil {
+		return "", classifyPostgres(fmt.Errorf("erro ao consultar o histórico de schema da tabela '%s': %w", dbTable, err))
+	}
+	return definition.String, nil
+}
+
+// qualifiedTable retorna o nome da tabela qualificado pelo schema, com os identificadores escapados
+func qualifiedTable(schemaName, table string) string {
+	return pq.QuoteIdentifier(schemaName) + "." + pq.QuoteIdentifier(table)
+}
+
+// classifyPostgres associa os erros do PostgreSQL às classes de erro da política de retentativa:
+// falhas de conexão e de recursos são transitórias; erros de sintaxe, de dados e de restrições não.
+func classifyPostgres(err error) error {
+	if err == nil {
+		return nil
+	}
+	var pqErr *pq.Error
+	var netErr net.Error
+	switch {
+	case errors.As(err, &pqErr):
+		switch {
+		case pqErr.Code == "57014":
+			return resilience.WithClass(resilience.ErrorClassTimeout, err)
+		case pqErr.Code.Class() == "08" || pqErr.Code.Class() == "57":
+			return resilience.WithClass(resilience.ErrorClassUnavailable, err)
+		case pqErr.Code.Class() == "40":
+			return resilience.WithClass(resilience.ErrorClassAborted, err)
+		case pqErr.Code.Class() == "53":
+			return resilience.WithClass(resilience.ErrorClassResourceExhausted, err)
+		case pqErr.Code.Class() == "28":
+			return resilience.WithClass(resilience.ErrorClassUnauthenticated, err)
+		default:
+			return resilience.WithClass(resilience.ErrorClassInvalid, err)
+		}
+	case errors.Is(err, driver.ErrBadConn), errors.Is(err, io.EOF), errors.Is(err, io.ErrUnexpectedEOF), errors.As(err, &netErr):
+		return resilience.WithClass(resilience.ErrorClassUnavailable, err)
+	}
+	return err
+}
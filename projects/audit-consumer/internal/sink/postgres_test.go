@@ -0,0 +1,115 @@
+package sink
+
+import (
+	"github.com/Waelson/audit/audit-consumer/internal/model"
+	"testing"
+	"time"
+)
+
+// testEvent retorna um evento de criação com a posição informada no log do banco de origem
+func testEvent(lsn int64) model.KafkaEvent {
+	return model.KafkaEvent{
+		Op:          "c",
+		TsMs:        1700000000000 + lsn,
+		After:       map[string]interface{}{"id": lsn, "amount": 100 * lsn},
+		Application: "payment-api",
+		Source:      model.Source{Connector: "postgresql", Name: "payment", Db: "payment_db", Schema: "public", Table: "payments", Lsn: lsn},
+	}
+}
+
+// verifyChain recalcula a cadeia de hashes como um auditor sobre os registros lidos da tabela e
+// retorna a posição do primeiro registro inválido, ou -1 se a cadeia estiver íntegra
+func verifyChain(t *testing.T, rows []map[string]interface{}) int {
+	t.Helper()
+	prevHash := genesisHash
+	for i, row := range rows {
+		columns := make(map[string]interface{}, len(row))
+		for column, value := range row {
+			columns[column] = value
+		}
+		for _, column := range chainColumns {
+			delete(columns, column)
+		}
+		rowHash, err := chainHash(prevHash, columns)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if row["prev_hash"] != prevHash || row["row_hash"] != rowHash {
+			return i
+		}
+		prevHash = row["row_hash"].(string)
+	}
+	return -1
+}
+
+func TestChainDetectsTampering(t *testing.T) {
+	tests := []struct {
+		name   string
+		tamper func(rows []map[string]interface{}) []map[string]interface{}
+		broken int
+	}{
+		{"cadeia íntegra", func(rows []map[string]interface{}) []map[string]interface{} {
+			return rows
+		}, -1},
+		{"evento alterado", func(rows []map[string]interface{}) []map[string]interface{} {
+			rows[1]["event"] = `{"after":{"amount":1,"id":2},"before":null}`
+			return rows
+		}, 1},
+		{"data alterada", func(rows []map[string]interface{}) []map[string]interface{} {
+			rows[2]["event_date"] = rows[2]["event_date"].(time.Time).Add(-time.Hour)
+			return rows
+		}, 2},
+		{"registro removido", func(rows []map[string]interface{}) []map[string]interface{} {
+			return append(rows[:1], rows[2:]...)
+		}, 1},
+		{"hash recalculado no registro alterado", func(rows []map[string]interface{}) []map[string]interface{} {
+			rows[1]["db_table"] = "refunds"
+			columns := map[string]interface{}{}
+			for column, value := range rows[1] {
+				columns[column] = value
+			}
+			for _, column := range chainColumns {
+				delete(columns, column)
+			}
+			rows[1]["row_hash"], _ = chainHash(rows[1]["prev_hash"].(string), columns)
+			return rows
+		}, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rows, err := chainRows(genesisHash, []model.KafkaEvent{testEvent(1), testEvent(2), testEvent(3), testEvent(4)})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if broken := verifyChain(t, tt.tamper(rows)); broken != tt.broken {
+				t.Errorf("primeiro registro inválido na posição %d, esperado %d", broken, tt.broken)
+			}
+		})
+	}
+}
+
+func TestChainContinuesAcrossBatches(t *testing.T) {
+	first, err := chainRows(genesisHash, []model.KafkaEvent{testEvent(1), testEvent(2)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := chainRows(first[1]["row_hash"].(string), []model.KafkaEvent{testEvent(3)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if broken := verifyChain(t, append(first, second...)); broken != -1 {
+		t.Errorf("cadeia inválida na posição %d entre dois lotes", broken)
+	}
+}
+
+func TestChainHashIgnoresTimeZone(t *testing.T) {
+	rows, err := chainRows(genesisHash, []model.KafkaEvent{testEvent(1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// O PostgreSQL devolve as datas no fuso da sessão: o hash é calculado sobre a data em UTC
+	rows[0]["event_date"] = rows[0]["event_date"].(time.Time).In(time.FixedZone("BRT", -3*60*60))
+	if broken := verifyChain(t, rows); broken != -1 {
+		t.Errorf("registro com a data em outro fuso considerado inválido na posição %d", broken)
+	}
+}
@@ -0,0 +1,243 @@
+package sink
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/Waelson/audit/audit-consumer/internal/metrics"
+	"github.com/Waelson/audit/audit-consumer/internal/model"
+	"github.com/Waelson/audit/audit-consumer/internal/resilience"
+	"github.com/codenotary/immudb/embedded/store"
+	"github.com/codenotary/immudb/pkg/api/schema"
+	"log"
+	"math"
+	"strings"
+	"time"
+)
+
+// txProof identifica uma transação verificada do ImmuDB pelo seu número e pelo hash acumulado
+// (Alh), que encadeia o conteúdo da transação a todas as anteriores
+type txProof struct {
+	id   uint64
+	hash string
+}
+
+// proofConnection são as operações do ImmuDB usadas para provar as transações e registrar as
+// provas, implementadas por immuConnection
+type proofConnection interface {
+	sqlQuerier
+	SQLExec(ctx context.Context, query string, params map[string]interface{}) (*schema.SQLExecResult, error)
+	VerifiedTxByID(ctx context.Context, tx uint64) (*schema.Tx, error)
+}
+
+// proofTable retorna o nome da tabela de provas associada a uma tabela de trilha
+func proofTable(table string) string {
+	return table + "_proof"
+}
+
+// verifyTx confirma a transação gravada com VerifiedTxByID: o servidor prova que ela é
+// consistente com o último estado confiável do banco, e o estado avança para ela. A transação
+// verificada também deve ser a mesma informada na gravação. Um erro de comunicação é devolvido
+// para a política de retentativa, pois a próxima verificação cobre as transações anteriores; uma
+// prova rejeitada bloqueia o banco.
+func (s *ImmuDBSink) verifyTx(ctx context.Context, connection proofConnection, database string, result *schema.SQLExecResult) (txProof, error) {
+	if len(result.Txs) == 0 || result.Txs[len(result.Txs)-1].Header == nil {
+		return txProof{}, errors.New("o ImmuDB não informou a transação gravada")
+	}
+	header := result.Txs[len(result.Txs)-1].Header
+	written := schema.TxHeaderFromProto(header).Alh()
+	return s.proveTx(ctx, connection, database, header.Id, written[:])
+}
+
+// proveTx obtém a prova da transação com VerifiedTxByID e, se informado, confere o hash
+// esperado. Uma prova rejeitada bloqueia o banco.
+func (s *ImmuDBSink) proveTx(ctx context.Context, connection proofConnection, database string, txID uint64, expected []byte) (txProof, error) {
+	verified, err := connection.VerifiedTxByID(ctx, txID)
+	if err == nil {
+		proven := schema.TxHeaderFromProto(verified.Header).Alh()
+		if expected == nil || bytes.Equal(expected, proven[:]) {
+			return txProof{id: txID, hash: hex.EncodeToString(proven[:])}, nil
+		}
+		err = fmt.Errorf("%w: a transação provada difere da transação gravada", store.ErrCorruptedData)
+	}
+	if !errors.Is(err, store.ErrCorruptedData) {
+		return txProof{}, fmt.Errorf("erro ao verificar a transação %d no ImmuDB: %w", txID, err)
+	}
+	return txProof{}, s.fail(database, txID, err)
+}
+
+// fail bloqueia as gravações no banco cuja prova foi rejeitada: o estado do servidor não é
+// consistente com o estado confiável, o que indica adulteração ou perda de dados
+func (s *ImmuDBSink) fail(database string, txID uint64, cause error) error {
+	err := resilience.WithClass(resilience.ErrorClassIntegrity,
+		fmt.Errorf("%w: banco '%s', transação %d: %v", ErrVerificationFailed, database, txID, cause))
+	log.Printf("ALERTA: a prova de consistência do ImmuDB falhou - Banco: %s, Transação: %d: %v. "+
+		"As gravações no banco foram suspensas; verifique o servidor antes de reiniciar o consumidor.", database, txID, cause)
+	metrics.VerificationFailures.WithLabelValues(database).Inc()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.failures[database] = err
+	return err
+}
+
+// failed retorna o erro de verificação que bloqueou o banco, se houver
+func (s *ImmuDBSink) failed(database string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.failures[database]
+}
+
+// recordProofs registra, para cada evento gravado, a transação verificada que o contém. Uma
+// falha é devolvida para que a gravação seja repetida: os eventos já gravados são ignorados na
+// nova tentativa, e as suas provas são registradas por reconcileProofs.
+func recordProofs(ctx context.Context, connection proofConnection, target Target, keyHashes []string, proof txProof) error {
+	values := make([]string, 0, len(keyHashes))
+	params := map[string]interface{}{
+		"tx_id":       int64(proof.id),
+		"tx_hash":     proof.hash,
+		"verified_at": time.Now(),
+	}
+	for i, keyHash := range keyHashes {
+		name := fmt.Sprintf("key_hash_%d", i)
+		params[name] = keyHash
+		values = append(values, fmt.Sprintf("(@%s, @tx_id, @tx_hash, @verified_at)", name))
+	}
+
+	query := fmt.Sprintf("INSERT INTO %s (key_hash, tx_id, tx_hash, verified_at) VALUES %s;",
+		proofTable(target.Table), strings.Join(values, ", "))
+	if _, err := connection.SQLExec(ctx, query, params); err != nil && !isDuplicateKeyError(err) {
+		return fmt.Errorf("erro ao registrar as provas da transação %d - Banco: %s, Tabela: %s: %w",
+			proof.id, target.Database, target.Table, err)
+	}
+	log.Printf("Transação %d verificada - Banco: %s, Tabela: %s, Hash: %s", proof.id, target.Database, target.Table, proof.hash)
+	return nil
+}
+
+// ingestedKeys retorna os hashes das chaves de idempotência dos eventos ignorados por já estarem
+// gravados, isto é, os que não permaneceram no lote
+func ingestedKeys(events, remaining []model.KafkaEvent) []string {
+	kept := make(map[string]bool, len(remaining))
+	for _, event := range remaining {
+		kept[IdempotencyHash(event.IdempotencyKey())] = true
+	}
+	var keyHashes []string
+	for _, event := range events {
+		keyHash := IdempotencyHash(event.IdempotencyKey())
+		if !kept[keyHash] {
+			kept[keyHash] = true
+			keyHashes = append(keyHashes, keyHash)
+		}
+	}
+	return keyHashes
+}
+
+// reconcileProofs registra as provas dos eventos já gravados que não têm prova, o que acontece
+// quando a gravação foi confirmada pelo ImmuDB, mas o registro da prova falhou ou o consumidor
+// foi interrompido antes dele. A transação que gravou cada evento é localizada, verificada com
+// VerifiedTxByID e registrada na tabela de provas.
+func (s *ImmuDBSink) reconcileProofs(ctx context.Context, connection proofConnection, target Target, keyHashes []string) error {
+	if len(keyHashes) == 0 {
+		return nil
+	}
+	missing, err := missingProofs(ctx, connection, target, keyHashes)
+	if err != nil || len(missing) == 0 {
+		return err
+	}
+
+	log.Printf("%d evento(s) gravado(s) sem prova - Banco: %s, Tabela: %s. Registrando as provas...", len(missing), target.Database, target.Table)
+	byTx := make(map[uint64][]string)
+	var txIDs []uint64
+	for _, keyHash := range missing {
+		txID, err := insertionTx(ctx, connection, target, keyHash)
+		if err != nil {
+			return err
+		}
+		if _, ok := byTx[txID]; !ok {
+			txIDs = append(txIDs, txID)
+		}
+		byTx[txID] = append(byTx[txID], keyHash)
+	}
+	for _, txID := range txIDs {
+		proof, err := s.proveTx(ctx, connection, target.Database, txID, nil)
+		if err != nil {
+			return err
+		}
+		if err := recordProofs(ctx, connection, target, byTx[txID], proof); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// missingProofs retorna, dentre as chaves informadas, as que não têm prova registrada
+func missingProofs(ctx context.Context, connection proofConnection, target Target, keyHashes []string) ([]string, error) {
+	placeholders := make([]string, 0, len(keyHashes))
+	params := make(map[string]interface{}, len(keyHashes))
+	for i, keyHash := range keyHashes {
+		name := fmt.Sprintf("key_hash_%d", i)
+		placeholders = append(placeholders, "@"+name)
+		params[name] = keyHash
+	}
+	query := fmt.Sprintf("SELECT key_hash FROM %s WHERE key_hash IN (%s);", proofTable(target.Table), strings.Join(placeholders, ", "))
+	result, err := connection.SQLQuery(ctx, query, params)
+	if err != nil {
+		return nil, fmt.Errorf("erro ao consultar as provas no ImmuDB: %w", err)
+	}
+
+	proven := make(map[string]bool, len(result.Rows))
+	for _, row := range result.Rows {
+		proven[row.Values[0].GetS()] = true
+	}
+	var missing []string
+	for _, keyHash := range keyHashes {
+		if !proven[keyHash] {
+			missing = append(missing, keyHash)
+		}
+	}
+	return missing, nil
+}
+
+// insertionTx localiza a transação que gravou a chave de idempotência, a mesma que gravou o
+// evento: a primeira transação até a qual a chave existe na tabela de chaves. A busca dobra o
+// limite superior até encontrar a chave e, em seguida, faz uma busca binária no intervalo.
+func insertionTx(ctx context.Context, connection proofConnection, target Target, keyHash string) (uint64, error) {
+	query := fmt.Sprintf("SELECT COUNT(*) FROM %s UNTIL TX @tx WHERE key_hash = @key_hash;", keyTable(target.Table))
+	existsUntil := func(txID uint64) (bool, error) {
+		result, err := connection.SQLQuery(ctx, query, map[string]interface{}{"tx": int64(txID), "key_hash": keyHash})
+		if err != nil {
+			return false, fmt.Errorf("erro ao localizar a transação da chave %s no ImmuDB: %w", keyHash, err)
+		}
+		return len(result.Rows) > 0 && result.Rows[0].Values[0].GetN() > 0, nil
+	}
+
+	low, high := uint64(1), uint64(1)
+	for {
+		found, err := existsUntil(high)
+		if err != nil {
+			return 0, err
+		}
+		if found {
+			break
+		}
+		if high > math.MaxUint64/2 {
+			return 0, fmt.Errorf("chave %s não encontrada na tabela '%s'", keyHash, keyTable(target.Table))
+		}
+		low, high = high+1, high*2
+	}
+	for low < high {
+		middle := low + (high-low)/2
+		found, err := existsUntil(middle)
+		if err != nil {
+			return 0, err
+		}
+		if found {
+			high = middle
+		} else {
+			low = middle + 1
+		}
+	}
+	return low, nil
+}
@@ -0,0 +1,162 @@
+package sink
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/codenotary/immudb/embedded/store"
+	"github.com/codenotary/immudb/pkg/api/schema"
+	"github.com/codenotary/immudb/pkg/client"
+	"strings"
+	"testing"
+)
+
+// testProofConnection simula as tabelas de chaves e de provas do ImmuDB: insertedAt é a
+// transação que gravou cada chave e proven, a transação registrada na tabela de provas
+type testProofConnection struct {
+	insertedAt map[string]uint64
+	proven     map[string]uint64
+	corrupted  uint64
+	queryErr   error
+	searches   int
+	verified   []uint64
+}
+
+func (c *testProofConnection) SQLExec(ctx context.Context, query string, params map[string]interface{}) (*schema.SQLExecResult, error) {
+	if !strings.HasPrefix(query, "INSERT INTO audit_trail_proof") {
+		return nil, fmt.Errorf("comando inesperado: %s", query)
+	}
+	for name, value := range params {
+		if strings.HasPrefix(name, "key_hash_") {
+			c.proven[value.(string)] = uint64(params["tx_id"].(int64))
+		}
+	}
+	return &schema.SQLExecResult{}, nil
+}
+
+func (c *testProofConnection) SQLQuery(ctx context.Context, query string, params map[string]interface{}) (*schema.SQLQueryResult, error) {
+	if c.queryErr != nil {
+		return nil, c.queryErr
+	}
+	switch {
+	case strings.Contains(query, "UNTIL TX"):
+		c.searches++
+		var count int64
+		if at, ok := c.insertedAt[params["key_hash"].(string)]; ok && at <= uint64(params["tx"].(int64)) {
+			count = 1
+		}
+		return &schema.SQLQueryResult{Rows: []*schema.Row{{Values: []*schema.SQLValue{{Value: &schema.SQLValue_N{N: count}}}}}}, nil
+	case strings.HasPrefix(query, "SELECT key_hash FROM audit_trail_proof"):
+		result := &schema.SQLQueryResult{}
+		for _, value := range params {
+			if _, ok := c.proven[value.(string)]; ok {
+				result.Rows = append(result.Rows, &schema.Row{Values: []*schema.SQLValue{{Value: &schema.SQLValue_S{S: value.(string)}}}})
+			}
+		}
+		return result, nil
+	}
+	return nil, fmt.Errorf("consulta inesperada: %s", query)
+}
+
+func (c *testProofConnection) VerifiedTxByID(ctx context.Context, tx uint64) (*schema.Tx, error) {
+	c.verified = append(c.verified, tx)
+	if tx == c.corrupted {
+		return nil, fmt.Errorf("prova rejeitada: %w", store.ErrCorruptedData)
+	}
+	return &schema.Tx{Header: &schema.TxHeader{Id: tx, Version: 1}}, nil
+}
+
+func TestInsertionTx(t *testing.T) {
+	tests := []struct {
+		name       string
+		insertedAt uint64
+	}{
+		{"primeira transação", 1},
+		{"segunda transação", 2},
+		{"limite do intervalo dobrado", 8},
+		{"logo após o limite", 9},
+		{"última transação do banco", 37},
+		{"transação distante", 1000003},
+	}
+	target := Target{Database: "audit_db", Table: "audit_trail"}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			connection := &testProofConnection{insertedAt: map[string]uint64{"k1": tt.insertedAt}}
+			txID, err := insertionTx(context.Background(), connection, target, "k1")
+			if err != nil {
+				t.Fatalf("erro inesperado: %v", err)
+			}
+			if txID != tt.insertedAt {
+				t.Errorf("esperado a transação %d, obtido %d", tt.insertedAt, txID)
+			}
+			// A busca dobra o limite e depois divide o intervalo: cerca de duas consultas por bit
+			if limit := 2*bitLength(tt.insertedAt) + 2; connection.searches > limit {
+				t.Errorf("%d consultas, esperado no máximo %d", connection.searches, limit)
+			}
+		})
+	}
+}
+
+func bitLength(n uint64) int {
+	bits := 0
+	for ; n > 0; n >>= 1 {
+		bits++
+	}
+	return bits
+}
+
+func TestInsertionTxErrors(t *testing.T) {
+	target := Target{Database: "audit_db", Table: "audit_trail"}
+	if _, err := insertionTx(context.Background(), &testProofConnection{insertedAt: map[string]uint64{}}, target, "k1"); err == nil {
+		t.Error("insertionTx não retornou erro para uma chave ausente")
+	}
+	failing := &testProofConnection{queryErr: errors.New("immudb indisponível")}
+	if _, err := insertionTx(context.Background(), failing, target, "k1"); err == nil || !strings.Contains(err.Error(), "immudb indisponível") {
+		t.Errorf("esperado o erro da consulta, obtido %v", err)
+	}
+}
+
+func TestReconcileProofs(t *testing.T) {
+	s := NewImmuDBSink(client.DefaultOptions(), "immudb", "immudb", true)
+	target := Target{Database: "audit_db", Table: "audit_trail"}
+	connection := &testProofConnection{
+		insertedAt: map[string]uint64{"k1": 5, "k2": 5, "k3": 9, "k4": 3},
+		proven:     map[string]uint64{"k4": 3},
+	}
+
+	if err := s.reconcileProofs(context.Background(), connection, target, []string{"k1", "k2", "k3", "k4"}); err != nil {
+		t.Fatalf("erro inesperado: %v", err)
+	}
+	expected := map[string]uint64{"k1": 5, "k2": 5, "k3": 9, "k4": 3}
+	for key, txID := range expected {
+		if connection.proven[key] != txID {
+			t.Errorf("%s: prova da transação %d, esperado %d", key, connection.proven[key], txID)
+		}
+	}
+	if len(connection.verified) != 2 || connection.verified[0] != 5 || connection.verified[1] != 9 {
+		t.Errorf("transações verificadas = %v, esperado uma verificação de 5 e de 9", connection.verified)
+	}
+
+	// Uma nova reconciliação não encontra eventos sem prova
+	connection.verified = nil
+	if err := s.reconcileProofs(context.Background(), connection, target, []string{"k1", "k3"}); err != nil || len(connection.verified) != 0 {
+		t.Errorf("esperado nenhuma verificação, obtido %v (%v)", connection.verified, err)
+	}
+}
+
+func TestReconcileProofsRejectedProof(t *testing.T) {
+	s := NewImmuDBSink(client.DefaultOptions(), "immudb", "immudb", true)
+	target := Target{Database: "audit_db", Table: "audit_trail"}
+	connection := &testProofConnection{insertedAt: map[string]uint64{"k1": 7}, proven: map[string]uint64{}, corrupted: 7}
+
+	err := s.reconcileProofs(context.Background(), connection, target, []string{"k1"})
+	if !errors.Is(err, ErrVerificationFailed) {
+		t.Fatalf("esperado ErrVerificationFailed, obtido %v", err)
+	}
+	if len(connection.proven) != 0 {
+		t.Errorf("esperado nenhuma prova registrada, obtido %v", connection.proven)
+	}
+	if !errors.Is(s.failed(target.Database), ErrVerificationFailed) {
+		t.Error("banco não bloqueado após a prova rejeitada")
+	}
+}
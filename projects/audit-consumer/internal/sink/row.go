@@ -0,0 +1,194 @@
+package sink
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"github.com/Waelson/audit/audit-consumer/internal/diff"
+	"github.com/Waelson/audit/audit-consumer/internal/metrics"
+	"github.com/Waelson/audit/audit-consumer/internal/model"
+	"log"
+	"sort"
+	"strings"
+	"time"
+)
+
+// auditTrailColumns são as colunas preenchidas em cada inserção na tabela de trilha
+var auditTrailColumns = []string{
+	"connector", "application", "db_name", "db_schema", "db_table", "event_operation", "event_date", "event",
+	"idempotency_key", "source_version", "source_name", "source_ts", "source_snapshot", "source_sequence",
+	"source_tx_id", "source_lsn", "changed_columns", "key_id", "subject_ref", "transaction_id", "transaction_order",
+}
+
+// transactionColumns são as colunas da tabela de transações
+var transactionColumns = []string{
+	"transaction_id", "status", "event_count", "received_count", "data_collections", "table_list",
+	"commit_date", "recorded_at", "validated_at",
+}
+
+// schemaChangeColumns são as colunas da tabela de alterações de schema
+var schemaChangeColumns = []string{
+	"key_hash", "idempotency_key", "source_name", "db_name", "db_schema", "db_table", "change_type", "ddl",
+	"table_definition", "source_position", "change_date", "recorded_at",
+}
+
+// IdempotencyHash reduz a chave de idempotência a um tamanho fixo, compatível com o limite
+// de tamanho das chaves primárias do ImmuDB
+func IdempotencyHash(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// skipSeen remove os eventos cujo hash da chave de idempotência já está em seen, assim como os
+// eventos repetidos dentro do próprio lote
+func skipSeen(seen map[string]bool, events []model.KafkaEvent) []model.KafkaEvent {
+	fresh := make([]model.KafkaEvent, 0, len(events))
+	for _, event := range events {
+		hash := IdempotencyHash(event.IdempotencyKey())
+		if seen[hash] {
+			log.Printf("Evento já ingerido, ignorando: %s", event.IdempotencyKey())
+			metrics.DuplicatesSkipped.Inc()
+			continue
+		}
+		seen[hash] = true
+		fresh = append(fresh, event)
+	}
+	return fresh
+}
+
+// auditTrailRow converte um evento Kafka nos valores das colunas da tabela de trilha
+func auditTrailRow(event model.KafkaEvent) (map[string]interface{}, error) {
+	// Converter o timestamp do evento (TsMs) para time.Time
+	eventDate := time.UnixMilli(event.TsMs)
+
+	// Serializa o evento como string JSON, com as alterações coluna a coluna das atualizações
+	e := model.Event{
+		After:  event.After,
+		Before: event.Before,
+		Diff:   event.Diff,
+	}
+	var changedColumns interface{}
+	if event.Diff != nil {
+		changedColumns = strings.Join(diff.ChangedColumns(event.Diff), ",")
+	}
+	var keyID interface{}
+	if event.KeyID != "" {
+		keyID = event.KeyID
+	}
+	var subjectRef interface{}
+	if event.SubjectRef != "" {
+		subjectRef = event.SubjectRef
+	}
+	var transactionID, transactionOrder interface{}
+	if event.Transaction != nil {
+		transactionID = event.Transaction.ID
+		transactionOrder = event.Transaction.TotalOrder
+	}
+	eventData, err := json.Marshal(e)
+	if err != nil {
+		return nil, fmt.Errorf("erro ao converter evento para JSON: %w", err)
+	}
+
+	return map[string]interface{}{
+		"connector":         event.Source.Connector,
+		"application":       event.Application,
+		"db_name":           event.Source.Db,
+		"db_schema":         event.Source.Schema,
+		"db_table":          event.Source.Table,
+		"event_operation":   event.Op,
+		"event_date":        eventDate,
+		"event":             string(eventData),
+		"idempotency_key":   event.IdempotencyKey(),
+		"source_version":    event.Source.Version,
+		"source_name":       event.Source.Name,
+		"source_ts":         sourceTimestamp(event.Source),
+		"source_snapshot":   event.Source.Snapshot,
+		"source_sequence":   event.Source.Sequence,
+		"source_tx_id":      event.Source.TxID,
+		"source_lsn":        event.Source.Lsn,
+		"changed_columns":   changedColumns,
+		"key_id":            keyID,
+		"subject_ref":       subjectRef,
+		"transaction_id":    transactionID,
+		"transaction_order": transactionOrder,
+	}, nil
+}
+
+// sourceTimestamp retorna o instante da alteração no banco de origem com a maior precisão
+// informada pelo Debezium (ts_us, quando disponível, ou ts_ms)
+func sourceTimestamp(source model.Source) time.Time {
+	if source.TsUs != 0 {
+		return time.UnixMicro(source.TsUs)
+	}
+	return time.UnixMilli(source.TsMs)
+}
+
+// SourceTable identifica a tabela de origem do evento como "schema.tabela", ou "banco.tabela"
+// quando a origem não tem schema
+func SourceTable(source model.Source) string {
+	owner := source.Schema
+	if owner == "" {
+		owner = source.Db
+	}
+	return owner + "." + source.Table
+}
+
+// addTransactionCount soma a contagem de eventos da transação na tabela de origem
+func addTransactionCount(counts map[string]map[string]int64, transactionID, sourceTable string, count int64) {
+	if counts[transactionID] == nil {
+		counts[transactionID] = make(map[string]int64)
+	}
+	counts[transactionID][sourceTable] += count
+}
+
+// transactionRow converte a transação nos valores das colunas da tabela de transações
+func transactionRow(record TransactionRecord) (map[string]interface{}, error) {
+	collections, err := json.Marshal(record.DataCollections)
+	if err != nil {
+		return nil, fmt.Errorf("erro ao converter as tabelas da transação para JSON: %w", err)
+	}
+	tables := make([]string, 0, len(record.DataCollections))
+	for _, collection := range record.DataCollections {
+		tables = append(tables, collection.DataCollection)
+	}
+	sort.Strings(tables)
+
+	var validatedAt interface{}
+	if record.ValidatedAt != nil {
+		validatedAt = *record.ValidatedAt
+	}
+	return map[string]interface{}{
+		"transaction_id":   record.ID,
+		"status":           record.Status,
+		"event_count":      record.EventCount,
+		"received_count":   record.ReceivedCount,
+		"data_collections": string(collections),
+		"table_list":       strings.Join(tables, ","),
+		"commit_date":      record.CommitDate,
+		"recorded_at":      record.RecordedAt,
+		"validated_at":     validatedAt,
+	}, nil
+}
+
+// schemaChangeRow converte a alteração de schema nos valores das colunas da tabela de alterações
+func schemaChangeRow(record SchemaChangeRecord) map[string]interface{} {
+	var definition interface{}
+	if record.Definition != "" {
+		definition = record.Definition
+	}
+	return map[string]interface{}{
+		"key_hash":         IdempotencyHash(record.Key),
+		"idempotency_key":  record.Key,
+		"source_name":      record.SourceName,
+		"db_name":          record.DbName,
+		"db_schema":        record.DbSchema,
+		"db_table":         record.DbTable,
+		"change_type":      record.ChangeType,
+		"ddl":              record.DDL,
+		"table_definition": definition,
+		"source_position":  record.Position,
+		"change_date":      record.ChangeDate,
+		"recorded_at":      record.RecordedAt,
+	}
+}
@@ -0,0 +1,55 @@
+package sink
+
+import (
+	"github.com/Waelson/audit/audit-consumer/internal/model"
+	"strings"
+	"testing"
+)
+
+// snapshotEvent retorna um evento de snapshot, identificado pela posição da mensagem no Kafka
+func snapshotEvent(offset int64) model.KafkaEvent {
+	event := testEvent(0)
+	event.Op = "r"
+	event.Kafka = model.KafkaCoordinates{Topic: "audit-trail", Partition: 0, Offset: offset}
+	return event
+}
+
+// assertEvents compara os eventos pelas suas chaves de idempotência, na ordem do lote
+func assertEvents(t *testing.T, got, expected []model.KafkaEvent) {
+	t.Helper()
+	keys := func(events []model.KafkaEvent) []string {
+		keys := make([]string, 0, len(events))
+		for _, event := range events {
+			keys = append(keys, event.IdempotencyKey())
+		}
+		return keys
+	}
+	if strings.Join(keys(got), " ") != strings.Join(keys(expected), " ") {
+		t.Errorf("esperado %v, obtido %v", keys(expected), keys(got))
+	}
+}
+
+func TestSkipSeen(t *testing.T) {
+	tests := []struct {
+		name     string
+		seen     []model.KafkaEvent
+		events   []model.KafkaEvent
+		expected []model.KafkaEvent
+	}{
+		{"lote sem repetições", nil, []model.KafkaEvent{testEvent(1), testEvent(2)}, []model.KafkaEvent{testEvent(1), testEvent(2)}},
+		{"evento já ingerido", []model.KafkaEvent{testEvent(2)}, []model.KafkaEvent{testEvent(1), testEvent(2), testEvent(3)}, []model.KafkaEvent{testEvent(1), testEvent(3)}},
+		{"repetição dentro do lote", nil, []model.KafkaEvent{testEvent(1), testEvent(2), testEvent(1), testEvent(2)}, []model.KafkaEvent{testEvent(1), testEvent(2)}},
+		{"repetição de um evento já ingerido", []model.KafkaEvent{testEvent(1)}, []model.KafkaEvent{testEvent(1), testEvent(1), testEvent(2)}, []model.KafkaEvent{testEvent(2)}},
+		{"snapshot identificado pelo offset", nil, []model.KafkaEvent{snapshotEvent(7), snapshotEvent(8), snapshotEvent(7)}, []model.KafkaEvent{snapshotEvent(7), snapshotEvent(8)}},
+		{"todos já ingeridos", []model.KafkaEvent{testEvent(1), testEvent(2)}, []model.KafkaEvent{testEvent(2), testEvent(1)}, []model.KafkaEvent{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			seen := make(map[string]bool)
+			for _, event := range tt.seen {
+				seen[IdempotencyHash(event.IdempotencyKey())] = true
+			}
+			assertEvents(t, skipSeen(seen, tt.events), tt.expected)
+		})
+	}
+}
@@ -0,0 +1,121 @@
+package sink
+
+import (
+	"context"
+	"errors"
+	"github.com/Waelson/audit/audit-consumer/internal/model"
+	"time"
+)
+
+// Tipos de sink disponíveis
+const (
+	TypeImmuDB   = "immudb"
+	TypePostgres = "postgres"
+	TypeJSONL    = "jsonl"
+)
+
+// AuditSink grava a trilha de auditoria em um meio de armazenamento. Os bancos de destino das
+// rotas são mapeados para a estrutura do sink: bancos do ImmuDB, schemas do PostgreSQL ou
+// diretórios dos arquivos JSON Lines.
+type AuditSink interface {
+	// Name identifica o sink nos logs, nas métricas e nas verificações de saúde
+	Name() string
+	// Setup prepara cada banco de destino com as suas tabelas de trilha
+	Setup(ctx context.Context, databases map[string][]string) error
+	// Write grava os eventos na tabela de destino em uma única operação. Os sinks com controle
+	// de idempotência ignoram os eventos cuja chave já está registrada.
+	Write(ctx context.Context, target Target, events []model.KafkaEvent) error
+	// Check verifica se o banco de destino está disponível para gravação
+	Check(ctx context.Context, database string) error
+	// Close encerra as sessões e fecha as conexões
+	Close() error
+}
+
+// TransactionStore é implementado pelos sinks que registram e validam as transações do banco de
+// origem anunciadas no tópico de transações do Debezium
+type TransactionStore interface {
+	// InsertTransaction registra uma nova transação; retorna ErrDuplicate se ela já estiver registrada
+	InsertTransaction(ctx context.Context, database string, record TransactionRecord) error
+	// UpdateTransaction atualiza a situação de uma transação registrada
+	UpdateTransaction(ctx context.Context, database string, record TransactionRecord) error
+	// Transactions lista as transações do banco na situação informada
+	Transactions(ctx context.Context, database, status string) ([]TransactionRecord, error)
+	// CountTransactionEvents conta os eventos das transações gravados nas tabelas de trilha do
+	// banco, por transação e por tabela de origem ("schema.tabela", ou "banco.tabela" quando a
+	// origem não tem schema). As transações sem eventos não aparecem no resultado.
+	CountTransactionEvents(ctx context.Context, database string, tables []string, transactionIDs []string) (map[string]map[string]int64, error)
+}
+
+// SchemaChangeStore é implementado pelos sinks que registram o histórico de alterações de schema
+// (DDL) do banco de origem publicado pelo Debezium
+type SchemaChangeStore interface {
+	// InsertSchemaChanges registra as alterações, ignorando as que já estão registradas
+	InsertSchemaChanges(ctx context.Context, database string, records []SchemaChangeRecord) error
+	// SchemaDefinition retorna a definição da alteração mais recente registrada para a tabela de
+	// origem, ou vazio se não houver nenhuma
+	SchemaDefinition(ctx context.Context, database, dbName, dbSchema, dbTable string) (string, error)
+}
+
+// ErrDuplicate indica que o registro já existe no sink
+var ErrDuplicate = errors.New("registro já existente")
+
+// ErrVerificationFailed indica que o sink não comprovou a integridade de uma gravação. As
+// gravações no banco afetado são recusadas até a intervenção de um operador.
+var ErrVerificationFailed = errors.New("falha na verificação de integridade do armazenamento")
+
+// Target é a tabela de trilha de destino dos eventos de uma rota
+type Target struct {
+	Database string
+	Table    string
+}
+
+// TransactionTable é a tabela, criada em cada banco de destino, que registra as transações do
+// banco de origem anunciadas no tópico de transações do Debezium
+const TransactionTable = "audit_transaction"
+
+// SchemaChangeTable é a tabela, criada em cada banco de destino, que registra o histórico de
+// alterações de schema das tabelas do banco de origem
+const SchemaChangeTable = "schema_change"
+
+// Situações de uma transação registrada
+const (
+	// TransactionPending indica que nem todos os eventos anunciados foram gravados na trilha
+	TransactionPending = "pending"
+	// TransactionComplete indica que todos os eventos anunciados foram gravados na trilha
+	TransactionComplete = "complete"
+	// TransactionIncomplete indica que os eventos anunciados não chegaram dentro do prazo
+	TransactionIncomplete = "incomplete"
+)
+
+// TransactionRecord é uma transação registrada na tabela de transações
+type TransactionRecord struct {
+	ID              string
+	Status          string
+	EventCount      int64
+	ReceivedCount   int64
+	DataCollections []model.DataCollectionCount
+	CommitDate      time.Time
+	RecordedAt      time.Time
+	ValidatedAt     *time.Time
+}
+
+// SchemaChangeRecord é a alteração de schema de uma tabela de origem. Um DDL que afeta várias
+// tabelas gera um registro por tabela; um DDL sem tabela associada (como a criação de um banco)
+// gera um único registro sem tabela.
+type SchemaChangeRecord struct {
+	// Key identifica a alteração pela posição do DDL no log do banco de origem e pela tabela
+	Key        string
+	SourceName string
+	DbName     string
+	DbSchema   string
+	DbTable    string
+	// ChangeType é o tipo da alteração da tabela: CREATE, ALTER ou DROP
+	ChangeType string
+	DDL        string
+	// Definition é a definição da tabela após a alteração, em JSON, como informada pelo Debezium
+	Definition string
+	// Position é a posição do DDL no log do banco de origem, em JSON
+	Position   string
+	ChangeDate time.Time
+	RecordedAt time.Time
+}
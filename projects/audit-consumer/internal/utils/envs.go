@@ -3,6 +3,8 @@ package utils
 import (
 	"os"
 	"strconv"
+	"strings"
+	"time"
 )
 
 // GetEnv retorna o valor de uma variável de ambiente ou um valor padrão
@@ -22,3 +24,37 @@ func GetEnvAsInt(key string, defaultValue int) int {
 	}
 	return defaultValue
 }
+
+// GetEnvAsFloat retorna o valor de uma variável de ambiente como float64 ou um valor padrão
+func GetEnvAsFloat(key string, defaultValue float64) float64 {
+	if value, exists := os.LookupEnv(key); exists {
+		if floatValue, err := strconv.ParseFloat(value, 64); err == nil {
+			return floatValue
+		}
+	}
+	return defaultValue
+}
+
+// GetEnvAsDuration retorna o valor de uma variável de ambiente como time.Duration (ex.: "500ms", "30s") ou um valor padrão
+func GetEnvAsDuration(key string, defaultValue time.Duration) time.Duration {
+	if value, exists := os.LookupEnv(key); exists {
+		if duration, err := time.ParseDuration(value); err == nil {
+			return duration
+		}
+	}
+	return defaultValue
+}
+
+// GetEnvAsSlice retorna o valor de uma variável de ambiente separada por vírgulas ou um valor padrão
+func GetEnvAsSlice(key string, defaultValue []string) []string {
+	if value, exists := os.LookupEnv(key); exists {
+		items := make([]string, 0)
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+		return items
+	}
+	return defaultValue
+}
@@ -82,8 +82,12 @@ const App = () => {
         return "Update";
       case "d":
         return "Delete";
+      case "r":
+        return "Snapshot Read";
+      case "t":
+        return "Truncate";
       default:
-        return operation; // Retorna o valor original caso não seja "C", "U" ou "D"
+        return operation; // Retorna o valor original caso não seja "C", "U", "D", "R" ou "T"
     }
   };
 
@@ -259,6 +263,8 @@ const App = () => {
               <option value="C">Create</option>
               <option value="U">Update</option>
               <option value="D">Delete</option>
+              <option value="R">Snapshot Read</option>
+              <option value="T">Truncate</option>
             </select>
           </div>
 
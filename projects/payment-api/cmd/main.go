@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"database/sql"
 	"encoding/json"
 	"fmt"
@@ -27,6 +28,19 @@ type Payment struct {
 	TransactionDateTime string  `json:"transactionDateTime"`
 }
 
+// HealthCheck é a situação de uma dependência na última verificação
+type HealthCheck struct {
+	Status  string `json:"status"`
+	Error   string `json:"error,omitempty"`
+	Latency string `json:"latency"`
+}
+
+// HealthReport é a resposta dos endpoints de saúde, com a situação de cada dependência
+type HealthReport struct {
+	Status string                 `json:"status"`
+	Checks map[string]HealthCheck `json:"checks"`
+}
+
 var db *sql.DB
 
 func main() {
@@ -87,6 +101,10 @@ func main() {
 	// Rota para receber pagamentos
 	r.Post("/api/v1/payment", handlePayment)
 
+	// Rotas de saúde usadas pelos healthchecks dos containers
+	r.Get("/healthz", handleHealth(false))
+	r.Get("/readyz", handleHealth(true))
+
 	// Inicializa o servidor na porta 8080
 	log.Println("Servidor rodando na porta 8080...")
 	log.Fatal(http.ListenAndServe(":8080", r))
@@ -151,6 +169,37 @@ func handlePayment(w http.ResponseWriter, r *http.Request) {
 	log.Println("Requisição de pagamento processada com sucesso.")
 }
 
+// handleHealth verifica a conexão com o PostgreSQL. Em /readyz o serviço responde 503 quando o
+// banco está indisponível; em /healthz responde sempre 200, indicando degraded, para que a
+// indisponibilidade do banco não provoque o reinício do container.
+func handleHealth(readiness bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), 2*time.Second)
+		defer cancel()
+
+		start := time.Now()
+		err := db.PingContext(ctx)
+		check := HealthCheck{Status: "ok", Latency: time.Since(start).Round(time.Microsecond).String()}
+		report := HealthReport{Status: "ok", Checks: map[string]HealthCheck{"postgres": check}}
+		status := http.StatusOK
+		if err != nil {
+			check.Status = "down"
+			check.Error = err.Error()
+			report.Checks["postgres"] = check
+			report.Status = "degraded"
+			if readiness {
+				report.Status = "down"
+				status = http.StatusServiceUnavailable
+			}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-store")
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(report)
+	}
+}
+
 // getEnv busca o valor de uma variável de ambiente ou retorna o padrão
 func getEnv(key, defaultValue string) string {
 	if value, exists := os.LookupEnv(key); exists {